@@ -0,0 +1,337 @@
+// dnsctl manages a dnsd server through its management API, either on the
+// local unix socket or over HTTPS.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	apiSocket = flag.String("socket", "/var/run/dnsd.sock", "unix socket of the management API")
+	apiURL    = flag.String("url", "", "base URL of the management API over HTTPS, instead of the unix socket")
+	insecure  = flag.Bool("insecure", false, "do not verify the server certificate")
+	format    = flag.String("format", "", "format of imported files: bind (default), route53 or cloudflare")
+)
+
+const usage = `usage: dnsctl [flags] command [args...]
+
+commands:
+  zone list
+  zone create ZONE
+  zone delete ZONE
+  record list ZONE [TYPE]
+  record set ZONE NAME TYPE TTL VALUE...
+  record add ZONE NAME TYPE TTL VALUE...
+  record rm ZONE NAME TYPE [VALUE...]
+  export ZONE
+  import ZONE [FILE]
+  stats
+
+NAME is relative to the zone, use @ for the zone apex.
+
+flags:
+`
+
+// record is a record set, as exchanged with the API
+type record struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     uint32   `json:"ttl"`
+	Handler bool     `json:"handler,omitempty"`
+	Values  []string `json:"values"`
+}
+
+type client struct {
+	http *http.Client
+	base string
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(newClient(), flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "dnsctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func newClient() *client {
+	if *apiURL != "" {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: *insecure}
+		return &client{http: &http.Client{Transport: tr}, base: strings.TrimSuffix(*apiURL, "/")}
+	}
+	return &client{
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", *apiSocket)
+			},
+		}},
+		base: "http://dnsd",
+	}
+}
+
+// errUsage is returned when the command line is invalid
+var errUsage = errors.New("invalid command, see dnsctl -h")
+
+func run(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	if cmd == "zone" || cmd == "record" {
+		if len(args) == 0 {
+			return errUsage
+		}
+		cmd, args = cmd+" "+args[0], args[1:]
+	}
+
+	switch {
+	case cmd == "zone list" && len(args) == 0:
+		var zones []struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+			IP   string `json:"ip"`
+		}
+		if err := c.call("GET", "zones", nil, nil, &zones); err != nil {
+			return err
+		}
+		for _, z := range zones {
+			if z.IP != "" {
+				fmt.Printf("%s\t%s\t%s\n", z.Name, z.ID, z.IP)
+			} else {
+				fmt.Printf("%s\t%s\n", z.Name, z.ID)
+			}
+		}
+		return nil
+	case cmd == "zone create" && len(args) == 1:
+		return c.call("POST", "zones", url.Values{"zone": {args[0]}}, nil, nil)
+	case cmd == "zone delete" && len(args) == 1:
+		return c.call("DELETE", "zones", url.Values{"zone": {args[0]}}, nil, nil)
+	case cmd == "record list" && (len(args) == 1 || len(args) == 2):
+		q := url.Values{"zone": {args[0]}, "limit": {"1000"}}
+		if len(args) == 2 {
+			q.Set("type", args[1])
+		}
+		return c.listRecords(q)
+	case cmd == "record set" && len(args) >= 5:
+		rec, err := parseRecord(args)
+		if err != nil {
+			return err
+		}
+		return c.putRecord(args[0], rec)
+	case cmd == "record add" && len(args) >= 5:
+		rec, err := parseRecord(args)
+		if err != nil {
+			return err
+		}
+		cur, err := c.getRecord(args[0], rec.Name, rec.Type)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			rec.Handler = cur.Handler
+			for _, v := range cur.Values {
+				if !slices.Contains(rec.Values, v) {
+					rec.Values = append(rec.Values, v)
+				}
+			}
+		}
+		return c.putRecord(args[0], rec)
+	case cmd == "record rm" && len(args) >= 3:
+		name := relName(args[1])
+		if len(args) == 3 {
+			return c.deleteRecord(args[0], name, args[2])
+		}
+		cur, err := c.getRecord(args[0], name, args[2])
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			return fmt.Errorf("no %s record at %s", args[2], args[1])
+		}
+		rm := args[3:]
+		var values []string
+		for _, v := range cur.Values {
+			if !slices.Contains(rm, v) {
+				values = append(values, v)
+			}
+		}
+		if len(values) == len(cur.Values) {
+			return fmt.Errorf("no matching value in %s %s", args[1], args[2])
+		}
+		if len(values) == 0 {
+			return c.deleteRecord(args[0], name, args[2])
+		}
+		cur.Name, cur.Values = name, values
+		return c.putRecord(args[0], cur)
+	case cmd == "export" && len(args) == 1:
+		return c.call("GET", "zone-export", url.Values{"zone": {args[0]}}, nil, os.Stdout)
+	case cmd == "import" && (len(args) == 1 || len(args) == 2):
+		var in io.Reader = os.Stdin
+		if len(args) == 2 {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		q := url.Values{"zone": {args[0]}}
+		if *format != "" {
+			q.Set("format", *format)
+		}
+		var res struct {
+			Records  int      `json:"records"`
+			Warnings []string `json:"warnings"`
+		}
+		if err := c.call("POST", "zone-import", q, in, &res); err != nil {
+			return err
+		}
+		for _, w := range res.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		fmt.Printf("imported %d records\n", res.Records)
+		return nil
+	case cmd == "stats" && len(args) == 0:
+		var vars map[string]json.RawMessage
+		if err := c.call("GET", "vars", nil, nil, &vars); err != nil {
+			return err
+		}
+		// runtime internals are not of interest here
+		delete(vars, "cmdline")
+		delete(vars, "memstats")
+		buf, err := json.MarshalIndent(vars, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", buf)
+		return nil
+	}
+	return errUsage
+}
+
+// call performs an API request. The response is decoded as JSON into res,
+// or copied to it if it is an io.Writer.
+func (c *client) call(method, path string, q url.Values, body io.Reader, res any) error {
+	u := c.base + "/api/" + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s", method, path, bytes.TrimSpace(msg))
+	}
+	switch v := res.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err = io.Copy(v, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(res)
+	}
+}
+
+func (c *client) listRecords(q url.Values) error {
+	for {
+		var page struct {
+			Records    []*record `json:"records"`
+			NextCursor string    `json:"next_cursor"`
+		}
+		if err := c.call("GET", "records", q, nil, &page); err != nil {
+			return err
+		}
+		for _, r := range page.Records {
+			for _, v := range r.Values {
+				fmt.Printf("%s\t%d\t%s\t%s\n", r.Name, r.TTL, r.Type, v)
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.Set("cursor", page.NextCursor)
+	}
+}
+
+// getRecord returns the record set name/typ of zone, or nil if there is none
+func (c *client) getRecord(zone, name, typ string) (*record, error) {
+	// the set itself sorts before the names below it
+	q := url.Values{"zone": {zone}, "suffix": {name}, "type": {typ}, "limit": {"1"}}
+	var page struct {
+		Records []*record `json:"records"`
+	}
+	if err := c.call("GET", "records", q, nil, &page); err != nil {
+		return nil, err
+	}
+	fqdn := strings.TrimSuffix(zone, ".") + "."
+	if name != "" {
+		fqdn = name + "." + fqdn
+	}
+	if len(page.Records) == 0 || !strings.EqualFold(page.Records[0].Name, fqdn) {
+		return nil, nil
+	}
+	return page.Records[0], nil
+}
+
+func (c *client) putRecord(zone string, rec *record) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return c.call("PUT", "records", url.Values{"zone": {zone}}, bytes.NewReader(buf), nil)
+}
+
+func (c *client) deleteRecord(zone, name, typ string) error {
+	return c.call("DELETE", "records", url.Values{"zone": {zone}, "name": {name}, "type": {typ}}, nil, nil)
+}
+
+// parseRecord reads ZONE NAME TYPE TTL VALUE... arguments
+func parseRecord(args []string) (*record, error) {
+	ttl, err := strconv.ParseUint(args[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TTL %q", args[3])
+	}
+	return &record{
+		Name:   relName(args[1]),
+		Type:   strings.ToUpper(args[2]),
+		TTL:    uint32(ttl),
+		Values: args[4:],
+	}, nil
+}
+
+// relName returns the name as expected by the API, with "@" for the apex
+func relName(name string) string {
+	if name == "@" {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// fakeApi serves the records endpoint from a single record set
+type fakeApi struct {
+	set     *record
+	deleted bool
+}
+
+func (f *fakeApi) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		res := map[string]any{"records": []*record{}}
+		if f.set != nil {
+			res["records"] = []*record{{Name: "www.example.com.", Type: f.set.Type, TTL: f.set.TTL, Values: f.set.Values}}
+		}
+		json.NewEncoder(rw).Encode(res)
+	case "PUT":
+		f.set = &record{}
+		json.NewDecoder(req.Body).Decode(f.set)
+	case "DELETE":
+		f.set, f.deleted = nil, true
+	}
+}
+
+func TestRecordCommands(t *testing.T) {
+	f := &fakeApi{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &client{http: srv.Client(), base: srv.URL}
+
+	for _, args := range [][]string{
+		{"record", "add", "example.com", "www", "a", "300", "192.0.2.1"},
+		{"record", "add", "example.com", "www", "A", "600", "192.0.2.2", "192.0.2.1"},
+	} {
+		if err := run(c, args); err != nil {
+			t.Fatalf("%v: %s", args, err)
+		}
+	}
+	if f.set.Name != "www" || f.set.Type != "A" || f.set.TTL != 600 || !slices.Equal(f.set.Values, []string{"192.0.2.2", "192.0.2.1"}) {
+		t.Errorf("unexpected record after add: %+v", f.set)
+	}
+
+	if err := run(c, []string{"record", "rm", "example.com", "www", "A", "192.0.2.2"}); err != nil {
+		t.Fatalf("rm: %s", err)
+	}
+	if f.deleted || !slices.Equal(f.set.Values, []string{"192.0.2.1"}) {
+		t.Errorf("unexpected record after rm: %+v", f.set)
+	}
+	if err := run(c, []string{"record", "rm", "example.com", "www", "A", "192.0.2.3"}); err == nil {
+		t.Errorf("removing a missing value should fail")
+	}
+	if err := run(c, []string{"record", "rm", "example.com", "www", "A", "192.0.2.1"}); err != nil || !f.deleted {
+		t.Errorf("removing the last value should delete the set: %v", err)
+	}
+
+	if err := run(c, []string{"record", "add", "example.com"}); err != errUsage {
+		t.Errorf("invalid command: %v", err)
+	}
+}
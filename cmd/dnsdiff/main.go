@@ -0,0 +1,106 @@
+// dnsdiff compares two copies of a zone, loaded from zone files or
+// transferred from servers, and prints the RRsets that differ. It is meant
+// for checking migrations and replication between servers.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+var (
+	ignoreTTL    = flag.Bool("ignore-ttl", false, "ignore TTL differences")
+	ignoreSerial = flag.Bool("ignore-serial", false, "ignore changes of the SOA serial alone")
+	rrsig        = flag.Bool("rrsig", false, "compare RRSIG records, ignored by default as they change at each re-signing")
+	timeout      = flag.Duration("timeout", time.Minute, "timeout of zone transfers")
+)
+
+const usage = `usage: dnsdiff [flags] ZONE SOURCE SOURCE
+
+Each SOURCE is either a zone file, or @SERVER[:PORT] to transfer the zone
+from a server with AXFR. Removed records are prefixed with -, added records
+with +. The exit status is 1 if the zones differ, 2 on error.
+
+flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := &dnszone.DiffOptions{IgnoreTTL: *ignoreTTL, IgnoreSerial: *ignoreSerial, IgnoreRRSIG: !*rrsig}
+	n, err := run(os.Stdout, flag.Arg(0), flag.Arg(1), flag.Arg(2), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnsdiff: %s\n", err)
+		os.Exit(2)
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+// run loads both copies of zone and writes their differences to w. It
+// returns the number of RRsets that differ.
+func run(w io.Writer, zone, src1, src2 string, opts *dnszone.DiffOptions) (int, error) {
+	if !strings.HasSuffix(zone, ".") {
+		zone += "."
+	}
+	a, err := load(zone, src1)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", src1, err)
+	}
+	b, err := load(zone, src2)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", src2, err)
+	}
+
+	changes := dnszone.Diff(zone, a, b, opts)
+	for _, c := range changes {
+		if _, err := io.WriteString(w, c.String()); err != nil {
+			return 0, err
+		}
+	}
+	return len(changes), nil
+}
+
+// load returns the records of zone from src, a zone file or @server
+func load(zone, src string) ([]*dnsmsg.Resource, error) {
+	server, ok := strings.CutPrefix(src, "@")
+	if !ok {
+		return dnszone.ParseFile(src, zone)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	conn, err := net.DialTimeout("tcp", server, *timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*timeout))
+
+	var rrs []*dnsmsg.Resource
+	soa, err := dnsmsg.Transfer(conn, dnsmsg.NewQuery(zone, dnsmsg.IN, dnsmsg.AXFR), func(set *dnsmsg.XFRSet) error {
+		rrs = append(rrs, set.Records...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(rrs, soa), nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.zone"), filepath.Join(dir, "b.zone")
+	os.WriteFile(a, []byte("$TTL 300\n@ SOA ns1 hostmaster 1 1d 2h 4w 300\nwww A 192.0.2.1\n"), 0600)
+	os.WriteFile(b, []byte("$TTL 300\n@ SOA ns1 hostmaster 2 1d 2h 4w 300\nwww A 192.0.2.2\n"), 0600)
+
+	buf := &bytes.Buffer{}
+	n, err := run(buf, "example.com", a, b, &dnszone.DiffOptions{IgnoreSerial: true})
+	if err != nil {
+		t.Fatalf("failed to compare: %s", err)
+	}
+	if expect := "- www.example.com. IN A 300 192.0.2.1\n+ www.example.com. IN A 300 192.0.2.2\n"; n != 1 || buf.String() != expect {
+		t.Errorf("unexpected output (%d changes):\n%s", n, buf)
+	}
+
+	if _, err := run(buf, "example.com", a, filepath.Join(dir, "missing.zone"), nil); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
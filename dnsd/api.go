@@ -3,13 +3,20 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
 	"github.com/KarpelesLab/rndstr"
 	"github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
@@ -41,6 +48,44 @@ func handleApi(rw http.ResponseWriter, req *http.Request) {
 
 		// TODO
 		fmt.Fprintf(b, "Hello test\n")
+	case "zones":
+		handleZones(rw, req)
+	case "zone-settings":
+		handleZoneSettings(rw, req)
+	case "records":
+		switch req.Method {
+		case "PUT":
+			handleRecordUpsert(rw, req)
+		case "DELETE":
+			handleRecordDelete(rw, req)
+		default:
+			handleRecordList(rw, req)
+		}
+	case "audit":
+		handleAuditExport(rw, req)
+	case "zone-export":
+		handleZoneExport(rw, req)
+	case "zone-import":
+		handleZoneImport(rw, req)
+	case "webhooks":
+		handleWebhooks(rw, req)
+	case "rewrites":
+		handleRewrites(rw, req)
+	case "dhcp":
+		handleDhcp(rw, req)
+	case "dnssec-keys":
+		handleDnssecKeys(rw, req)
+	case "dnssec-dnskey":
+		handleDnssecDNSKEY(rw, req)
+	case "resolve-batch":
+		handleResolveBatch(rw, req)
+	case "publish":
+		handlePublish(rw, req)
+	case "publish-sync":
+		handlePublishSync(rw, req)
+	case "vars":
+		// runtime counters (answer sources, ...)
+		expvar.Handler().ServeHTTP(rw, req)
 	case "export-all":
 		// export all records
 		rw.Header().Set("Content-Type", "text/plain")
@@ -107,6 +152,492 @@ func handleApi(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+type apiZone struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	IP   string `json:"ip,omitempty"` // only served on this local address
+}
+
+// handleZones lists zones (GET), or creates (POST) or deletes (DELETE) the
+// zone given in the "zone" parameter. Deleting a zone removes all its
+// records, and the other names pointing to it.
+func handleZones(rw http.ResponseWriter, req *http.Request) {
+	zone := strings.TrimSuffix(req.URL.Query().Get("zone"), ".")
+
+	switch req.Method {
+	case "GET":
+		res := []*apiZone{}
+		err := db.View(func(tx *bolt.Tx) error {
+			var id uuid.UUID
+			if b := tx.Bucket([]byte("domain")); b != nil {
+				b.ForEach(func(k, v []byte) error {
+					copy(id[:], v[12:])
+					res = append(res, &apiZone{Name: string(reverseDnsName(k)), ID: id.String()})
+					return nil
+				})
+			}
+			if b := tx.Bucket([]byte("ip-domain")); b != nil {
+				b.ForEach(func(k, v []byte) error {
+					copy(id[:], v[12:])
+					res = append(res, &apiZone{Name: string(reverseDnsName(k[16:])), ID: id.String(), IP: net.IP(k[:16]).String()})
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(res)
+	case "POST":
+		if zone == "" {
+			http.Error(rw, "zone is required", http.StatusBadRequest)
+			return
+		}
+		_, _, sub, err := getZone(req.Context(), zone, nil)
+		if err == nil && len(sub) == 0 {
+			http.Error(rw, "zone already exists", http.StatusConflict)
+			return
+		}
+		// a zone can be created below an existing one, it takes over the
+		// names it covers
+		z, err := newZone(zone)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res := &apiZone{Name: zone, ID: z.String()}
+		audit(apiActor(req), "zone-create", "zone:"+zone, nil, res)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(res)
+	case "DELETE":
+		z, _, sub, err := getZone(req.Context(), zone, nil)
+		if err != nil || len(sub) > 0 {
+			http.Error(rw, "zone not found", http.StatusNotFound)
+			return
+		}
+		if err := deleteZone(z); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		before := &apiZone{Name: zone, ID: z.String()}
+		audit(apiActor(req), "zone-delete", "zone:"+zone, before, nil)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(before)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
+
+// handleZoneSettings returns (GET) or updates (POST) the settings of the
+// zone given in the "zone" parameter, as JSON
+func handleZoneSettings(rw http.ResponseWriter, req *http.Request) {
+	z, domain, sub, err := getZone(req.Context(), req.URL.Query().Get("zone"), nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+
+	var s *zoneSettings
+
+	switch req.Method {
+	case "GET":
+		s, err = z.getSettings()
+		if err == os.ErrNotExist {
+			s, err = &zoneSettings{}, nil
+		}
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "POST":
+		before, err := z.getSettings()
+		if err != nil && err != os.ErrNotExist {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s = &zoneSettings{}
+		if err := json.NewDecoder(req.Body).Decode(s); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		switch s.LimitMode {
+		case "", limitSubset, limitTruncate:
+		default:
+			http.Error(rw, "invalid limit_mode", http.StatusBadRequest)
+			return
+		}
+		if s.MaxRecords < 0 {
+			http.Error(rw, "invalid max_records", http.StatusBadRequest)
+			return
+		}
+		if s.DNSSEC != nil {
+			if err := s.DNSSEC.validate(); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := z.setSettings(s); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit(apiActor(req), "zone-settings", "zone:"+string(reverseDnsName(domain)), before, s)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(s)
+}
+
+type apiRecord struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     uint32   `json:"ttl"`
+	Handler bool     `json:"handler,omitempty"`
+	Values  []string `json:"values"`
+}
+
+type apiRecordList struct {
+	Records    []*apiRecord `json:"records"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+const (
+	recordListDefault = 100
+	recordListMax     = 1000
+)
+
+// handleRecordList returns the records of the zone given in the "zone"
+// parameter, one page at a time. Records are sorted by name (in reverse label
+// order, as stored) then type, and can be filtered by name suffix and type.
+//
+// Parameters: zone, cursor (next_cursor of the previous page), limit, type,
+// suffix (name relative to the zone, matching itself and its subdomains) and
+// order (asc or desc).
+func handleRecordList(rw http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	z, domain, sub, err := getZone(req.Context(), q.Get("zone"), nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+
+	limit := recordListDefault
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(rw, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, recordListMax)
+	}
+
+	var typ dnsmsg.Type
+	if v := q.Get("type"); v != "" {
+		typ, err = dnsmsg.ParseType(v)
+		if err != nil {
+			http.Error(rw, "invalid type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var desc bool
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		http.Error(rw, "invalid order", http.StatusBadRequest)
+		return
+	}
+
+	var cursor []byte
+	if v := q.Get("cursor"); v != "" {
+		cursor, err = base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			http.Error(rw, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// keys of the selected records are all within [lower, upper)
+	suffix := reverseDnsName([]byte(strings.Trim(q.Get("suffix"), ".")))
+	lower := append(z[:], suffix...)
+	var upper []byte
+	if len(suffix) == 0 {
+		upper = prefixEnd(z[:])
+	} else {
+		upper = prefixEnd(append(bdup(lower), '.'))
+	}
+
+	// match checks the key k (without the zone prefix) against the filters
+	match := func(k []byte) bool {
+		if !bytes.HasPrefix(k, suffix) || len(k) < len(suffix)+3 {
+			return false
+		}
+		if len(suffix) > 0 && k[len(suffix)] != 0 && k[len(suffix)] != '.' {
+			// not on a label boundary
+			return false
+		}
+		return typ == 0 || dnsmsg.Type(binary.BigEndian.Uint16(k[len(k)-2:])) == typ
+	}
+
+	res := &apiRecordList{Records: []*apiRecord{}}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+
+		var k, v []byte
+		switch {
+		case !desc && cursor == nil:
+			k, v = c.Seek(lower)
+		case !desc:
+			k, v = c.Seek(append(z[:], cursor...))
+			if bytes.Equal(k[min(len(k), 16):], cursor) {
+				k, v = c.Next()
+			}
+		default:
+			start := upper
+			if cursor != nil {
+				start = append(z[:], cursor...)
+			}
+			if start == nil {
+				k, v = c.Last()
+			} else if k, _ = c.Seek(start); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for ; k != nil; k, v = advance(c, desc) {
+			if bytes.Compare(k, lower) < 0 || (upper != nil && bytes.Compare(k, upper) >= 0) {
+				break
+			}
+			if err := req.Context().Err(); err != nil {
+				return err
+			}
+			if !match(k[16:]) {
+				continue
+			}
+			if len(res.Records) == limit {
+				// there is at least one more record after this page
+				res.NextCursor = base64.RawURLEncoding.EncodeToString(cursor)
+				break
+			}
+
+			rec, err := ReadRecord(v[12:])
+			if err != nil {
+				return err
+			}
+			res.Records = append(res.Records, &apiRecord{
+				Name:    recordName(domain, k[16:]),
+				Type:    rec.Type.String(),
+				TTL:     rec.TTL,
+				Handler: rec.Handler,
+				Values:  rec.Value,
+			})
+			cursor = bdup(k[16:])
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
+
+// handleRecordUpsert sets the record set posted as an apiRecord in the zone
+// given in the "zone" parameter. Nothing is written if the stored set is
+// already identical, and the response tells whether anything changed.
+func handleRecordUpsert(rw http.ResponseWriter, req *http.Request) {
+	zone := req.URL.Query().Get("zone")
+	z, _, sub, err := getZone(req.Context(), zone, nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+
+	in := &apiRecord{}
+	if err := json.NewDecoder(req.Body).Decode(in); err != nil {
+		http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+		return
+	}
+	typ, err := dnsmsg.ParseType(in.Type)
+	if err != nil {
+		http.Error(rw, "invalid type", http.StatusBadRequest)
+		return
+	}
+	if len(in.Values) == 0 {
+		http.Error(rw, "invalid record set", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSuffix(in.Name, ".")
+
+	rec := &Record{Type: typ, TTL: in.TTL, Handler: in.Handler}
+	for _, v := range in.Values {
+		if !in.Handler {
+			// store values in their canonical form
+			rd, err := dnsmsg.RDataFromString(typ, v)
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("invalid value %q: %s", v, err), http.StatusBadRequest)
+				return
+			}
+			v = rd.String()
+		}
+		rec.Value = append(rec.Value, v)
+	}
+
+	prev, changed, err := z.upsertRecord(name, rec)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	after := &apiRecord{Name: name, Type: typ.String(), TTL: rec.TTL, Handler: rec.Handler, Values: rec.Value}
+	if changed {
+		var before *apiRecord
+		if prev != nil {
+			before = &apiRecord{Name: name, Type: typ.String(), TTL: prev.TTL, Handler: prev.Handler, Values: prev.Value}
+		}
+		audit(apiActor(req), "record-upsert", "zone:"+zone, before, after)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]any{"changed": changed, "record": after})
+}
+
+// handleRecordDelete removes the record set given by the "name" (relative to
+// the zone) and "type" parameters from the zone given in the "zone"
+// parameter
+func handleRecordDelete(rw http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	zone := q.Get("zone")
+	z, _, sub, err := getZone(req.Context(), zone, nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+	typ, err := dnsmsg.ParseType(q.Get("type"))
+	if err != nil {
+		http.Error(rw, "invalid type", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSuffix(q.Get("name"), ".")
+
+	prev, err := z.deleteRecord(name, typ)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if prev == nil {
+		http.Error(rw, "record not found", http.StatusNotFound)
+		return
+	}
+	before := &apiRecord{Name: name, Type: typ.String(), TTL: prev.TTL, Handler: prev.Handler, Values: prev.Value}
+	audit(apiActor(req), "record-delete", "zone:"+zone, before, nil)
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]any{"record": before})
+}
+
+// handleZoneExport writes the zone given in the "zone" parameter in master
+// file format. Records served by handlers have no static value and are
+// skipped.
+func handleZoneExport(rw http.ResponseWriter, req *http.Request) {
+	z, domain, sub, err := getZone(req.Context(), req.URL.Query().Get("zone"), nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+
+	var rrs []*dnsmsg.Resource
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+
+		for k, v := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, v = c.Next() {
+			rec, err := ReadRecord(v[12:])
+			if err != nil {
+				return err
+			}
+			if rec.Handler {
+				continue
+			}
+			name := k[16:]
+			name = name[:bytes.IndexByte(name, 0)]
+			rdata, err := rec.RData(req.Context(), name, rec.Type)
+			if err != nil {
+				return fmt.Errorf("record %s %s: %w", reverseDnsName(name), rec.Type, err)
+			}
+			for _, rd := range rdata {
+				rrs = append(rrs, &dnsmsg.Resource{
+					Name:  dnsmsg.Name(reverseDnsName(name)),
+					Type:  rec.Type,
+					Class: dnsmsg.IN,
+					TTL:   rec.TTL,
+					Data:  rd,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/dns")
+	dnszone.Write(rw, string(reverseDnsName(domain)), rrs)
+}
+
+// advance moves c to the next record in the requested order
+func advance(c *bolt.Cursor, desc bool) ([]byte, []byte) {
+	if desc {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// prefixEnd returns the smallest key greater than all keys starting with p,
+// or nil if there is none
+func prefixEnd(p []byte) []byte {
+	end := bdup(p)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// recordName returns the fully qualified name of a record from its key
+// (without zone prefix) and the zone domain, both in reverse order
+func recordName(domain, k []byte) string {
+	name := bdup(domain)
+	if pos := bytes.IndexByte(k, 0); pos > 0 {
+		name = append(append(name, '.'), k[:pos]...)
+	}
+	return string(reverseDnsName(name)) + "."
+}
+
 func getApiKey() string {
 	v, err := simpleGet([]byte("local"), []byte("apikey"))
 	if err == nil {
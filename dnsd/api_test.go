@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestDb replaces the global database with an empty temporary one for
+// the duration of the test
+func openTestDb(t testing.TB) {
+	t.Helper()
+	d, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	old := db
+	db = d
+	t.Cleanup(func() {
+		d.Close()
+		db = old
+	})
+}
+
+func listRecords(t *testing.T, query string) *apiRecordList {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/records?"+query, nil))
+	if rw.Code != 200 {
+		t.Fatalf("records?%s: status %d: %s", query, rw.Code, rw.Body)
+	}
+	res := &apiRecordList{}
+	if err := json.Unmarshal(rw.Body.Bytes(), res); err != nil {
+		t.Fatalf("records?%s: %s", query, err)
+	}
+	return res
+}
+
+func TestRecordList(t *testing.T) {
+	openTestDb(t)
+
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("", 3600, dnsmsg.NS, "ns1.example.com.")
+	for i := 0; i < 5; i++ {
+		z.setRecord(fmt.Sprintf("h%d.www", i), 3600, dnsmsg.A, fmt.Sprintf("192.0.2.%d", i))
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.10")
+	z.setRecord("www", 3600, dnsmsg.TXT, "\"hello\"")
+	z.setRecord("www2", 3600, dnsmsg.A, "192.0.2.20")
+
+	// walk all records in both directions, 3 at a time
+	for _, order := range []string{"asc", "desc"} {
+		var names []string
+		cursor := ""
+		for {
+			res := listRecords(t, "zone=example.com&limit=3&order="+order+"&cursor="+cursor)
+			for _, r := range res.Records {
+				names = append(names, r.Name+"/"+r.Type)
+			}
+			if res.NextCursor == "" {
+				break
+			}
+			cursor = res.NextCursor
+		}
+		if len(names) != 10 {
+			t.Fatalf("order %s: expected 10 records, got %v", order, names)
+		}
+		first, last := "example.com./NS", "www2.example.com./A"
+		if order == "desc" {
+			first, last = last, first
+		}
+		if names[0] != first || names[9] != last {
+			t.Errorf("order %s: unexpected order %v", order, names)
+		}
+	}
+
+	res := listRecords(t, "zone=example.com&suffix=www")
+	if len(res.Records) != 7 {
+		t.Errorf("suffix=www: expected 7 records, got %d", len(res.Records))
+	}
+
+	res = listRecords(t, "zone=example.com&suffix=www&type=txt")
+	if len(res.Records) != 1 || res.Records[0].Name != "www.example.com." || res.Records[0].Values[0] != "\"hello\"" {
+		t.Errorf("suffix=www&type=txt: unexpected result %+v", res.Records)
+	}
+
+	res = listRecords(t, "zone=example.com&type=A&limit=7")
+	if len(res.Records) != 7 || res.NextCursor != "" {
+		t.Errorf("type=A: expected 7 records on a single page, got %d (cursor %q)", len(res.Records), res.NextCursor)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	openTestDb(t)
+	c := newManualClock(time.Date(2024, 7, 29, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+
+	if _, err := getOrCreateZone("example.com"); err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	for _, body := range []string{`{"max_records":10}`, `{"max_records":20}`} {
+		c.Advance(time.Hour)
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("POST", "/api/zone-settings?zone=example.com", strings.NewReader(body)))
+		if rw.Code != 200 {
+			t.Fatalf("zone-settings: status %d: %s", rw.Code, rw.Body)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/audit?target=zone:example.com", nil))
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit entries, got %q", rw.Body)
+	}
+	var e auditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("failed to decode entry: %s", err)
+	}
+	if e.Op != "zone-settings" || string(e.Before) != `{"max_records":10}` || string(e.After) != `{"max_records":20}` || !e.Time.Equal(c.Now()) {
+		t.Errorf("unexpected audit entry %s", lines[1])
+	}
+
+	// only the second entry is within the retention period
+	*auditRetention = 30 * time.Minute
+	defer func() { *auditRetention = 90 * 24 * time.Hour }()
+	if err := pruneAudit(); err != nil {
+		t.Fatalf("failed to prune: %s", err)
+	}
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/audit", nil))
+	if n := strings.Count(rw.Body.String(), "\n"); n != 1 {
+		t.Errorf("expected 1 entry after pruning, got %d", n)
+	}
+}
+
+func TestZoneExport(t *testing.T) {
+	openTestDb(t)
+	c := newManualClock(time.Date(2024, 7, 29, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("", 3600, dnsmsg.NS, "ns1.example.net.", "ns2.example.net.")
+	z.setRecord("www", 300, dnsmsg.A, "192.0.2.1")
+	z.setHandlerRecord("*", 300, dnsmsg.A, "base32addr")
+
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/zone-export?zone=example.com", nil))
+
+	expect := `$ORIGIN example.com.
+$TTL 3600
+@	60	IN	SOA	ns1.example.com. admin.example.com. 20240729 900 900 1800 60
+@	IN	NS	ns1.example.net.
+@	IN	NS	ns2.example.net.
+www	300	IN	A	192.0.2.1
+`
+	if rw.Body.String() != expect {
+		t.Errorf("unexpected export:\n%s", rw.Body)
+	}
+}
+
+func TestRecordUpsert(t *testing.T) {
+	openTestDb(t)
+
+	if _, err := getOrCreateZone("example.com"); err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	upsert := func(body string) (int, bool) {
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("PUT", "/api/records?zone=example.com", strings.NewReader(body)))
+		var res struct {
+			Changed bool `json:"changed"`
+		}
+		json.NewDecoder(rw.Body).Decode(&res)
+		return rw.Code, res.Changed
+	}
+
+	tests := []struct {
+		body    string
+		code    int
+		changed bool
+	}{
+		{`{"name":"www","type":"A","ttl":300,"values":["192.0.2.1","192.0.2.2"]}`, 200, true},
+		{`{"name":"www","type":"A","ttl":300,"values":["192.0.2.2","192.0.2.1"]}`, 200, false}, // same set
+		{`{"name":"www","type":"A","ttl":600,"values":["192.0.2.2","192.0.2.1"]}`, 200, true},
+		{`{"name":"www","type":"A","ttl":600,"values":["192.0.2.1"]}`, 200, true},
+		{`{"name":"www","type":"A","ttl":600,"values":["not an ip"]}`, 400, false},
+		{`{"name":"www","type":"NOPE","ttl":600,"values":["192.0.2.1"]}`, 400, false},
+		{`{"name":"www","type":"A","ttl":600,"values":[]}`, 400, false},
+	}
+	for _, test := range tests {
+		code, changed := upsert(test.body)
+		if code != test.code || changed != test.changed {
+			t.Errorf("upsert %s: got %d/%v, expected %d/%v", test.body, code, changed, test.code, test.changed)
+		}
+	}
+
+	list := listRecords(t, "zone=example.com&type=A")
+	if len(list.Records) != 1 || list.Records[0].TTL != 600 || strings.Join(list.Records[0].Values, ",") != "192.0.2.1" {
+		t.Errorf("unexpected records %+v", list.Records)
+	}
+
+	// only actual changes are audited
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/audit?target=zone:example.com", nil))
+	if n := strings.Count(rw.Body.String(), "record-upsert"); n != 3 {
+		t.Errorf("expected 3 audit entries, got %d", n)
+	}
+}
+
+func TestDNSSECPolicy(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	for _, c := range []struct {
+		body string
+		code int
+	}{
+		{`{"dnssec":{"algorithm":"DSA"}}`, 400},
+		{`{"dnssec":{"algorithm":"ED25519","zsk_size":2048}}`, 400},
+		{`{"dnssec":{"nsec3_iterations":10}}`, 400},
+		{`{"dnssec":{"signatures_validity":3600}}`, 400},
+		{`{"dnssec":{"algorithm":"RSASHA256","ksk_size":4096,"nsec3":true}}`, 200},
+	} {
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("POST", "/api/zone-settings?zone=example.com", strings.NewReader(c.body)))
+		if rw.Code != c.code {
+			t.Errorf("%s: expected status %d, got %d: %s", c.body, c.code, rw.Code, rw.Body)
+		}
+	}
+
+	s, err := z.getSettings()
+	if err != nil || s.DNSSEC == nil {
+		t.Fatalf("failed to read settings: %v", err)
+	}
+	p := s.DNSSEC
+	if p.algorithm() != 8 || p.keySize(true) != 4096 || p.keySize(false) != defaultRSAKeySize || !p.NSEC3 || p.validity() != defaultSignatureValidity {
+		t.Errorf("unexpected policy %+v", p)
+	}
+}
+
+func TestApiSocket(t *testing.T) {
+	openTestDb(t)
+	if _, err := getOrCreateZone("example.com"); err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	old := *apiSocket
+	*apiSocket = filepath.Join(t.TempDir(), "api.sock")
+	defer func() { *apiSocket = old }()
+	go initApiSocket()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", *apiSocket)
+		},
+	}}
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		resp, err = client.Post("http://dnsd/api/zone-settings?zone=example.com", "application/json", strings.NewReader(`{"max_records":5}`))
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to reach API socket: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("zone-settings: status %d", resp.StatusCode)
+	}
+
+	st, err := os.Stat(*apiSocket)
+	if err != nil || st.Mode().Perm() != 0660 {
+		t.Errorf("unexpected socket permissions: %v %v", st.Mode(), err)
+	}
+
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/audit?target=zone:example.com", nil))
+	var e auditEntry
+	if err := json.Unmarshal(rw.Body.Bytes(), &e); err != nil || e.Who != "api:unix" {
+		t.Errorf("unexpected audit entry %s: %v", rw.Body, err)
+	}
+}
+
+func TestZonesApi(t *testing.T) {
+	openTestDb(t)
+
+	call := func(method, url string) *httptest.ResponseRecorder {
+		t.Helper()
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest(method, url, nil))
+		return rw
+	}
+
+	if rw := call("POST", "/api/zones?zone=example.com"); rw.Code != 200 {
+		t.Fatalf("create: status %d: %s", rw.Code, rw.Body)
+	}
+	if rw := call("POST", "/api/zones?zone=example.com"); rw.Code != http.StatusConflict {
+		t.Errorf("create existing zone: status %d", rw.Code)
+	}
+	if rw := call("POST", "/api/zones?zone=sub.example.com"); rw.Code != 200 {
+		t.Errorf("create sub zone: status %d: %s", rw.Code, rw.Body)
+	}
+
+	var zones []*apiZone
+	json.Unmarshal(call("GET", "/api/zones").Body.Bytes(), &zones)
+	if len(zones) != 2 || zones[0].Name != "example.com" || zones[1].Name != "sub.example.com" {
+		t.Errorf("unexpected zone list %+v", zones)
+	}
+
+	z, _, _, _ := getZone(context.Background(), "example.com", nil)
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	if rw := call("DELETE", "/api/records?zone=example.com&name=www&type=A"); rw.Code != 200 {
+		t.Errorf("delete record: status %d: %s", rw.Code, rw.Body)
+	}
+	if rw := call("DELETE", "/api/records?zone=example.com&name=www&type=A"); rw.Code != 404 {
+		t.Errorf("delete missing record: status %d", rw.Code)
+	}
+
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	if rw := call("DELETE", "/api/zones?zone=example.com"); rw.Code != 200 {
+		t.Fatalf("delete: status %d: %s", rw.Code, rw.Body)
+	}
+	if res := listRecords(t, "zone=sub.example.com"); len(res.Records) != 1 {
+		t.Errorf("records of the sub zone were changed: %+v", res.Records)
+	}
+	if _, _, _, err := getZone(context.Background(), "www.example.com", nil); err != os.ErrNotExist {
+		t.Errorf("zone still found after delete: %v", err)
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("record")).Cursor()
+		if k, _ := c.Seek(z[:]); bytes.HasPrefix(k, z[:]) {
+			return fmt.Errorf("record %x left", k)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResolveBatch(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	z.setRecord("www", 3600, dnsmsg.AAAA, "2001:db8::1")
+
+	rw := httptest.NewRecorder()
+	body := `[{"name":"www.example.com","type":"A"},{"name":"www.example.com.","type":28},{"name":"www.example.com"},{"name":"nothere.example.net","type":"A"}]`
+	handleApi(rw, httptest.NewRequest("POST", "/api/resolve-batch", strings.NewReader(body)))
+	if rw.Code != 200 {
+		t.Fatalf("status %d: %s", rw.Code, rw.Body)
+	}
+	var res []struct {
+		Status dnsmsg.RCode
+		Answer []struct {
+			Name string `json:"name"`
+			Data string `json:"data"`
+		}
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatalf("failed to decode %s: %s", rw.Body, err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("got %d answers, expected 4", len(res))
+	}
+	for i, expect := range []string{"192.0.2.1", "2001:db8::1", "192.0.2.1"} {
+		if len(res[i].Answer) != 1 || res[i].Answer[0].Data != expect || res[i].Answer[0].Name != "www.example.com." {
+			t.Errorf("query %d: unexpected answer %+v", i, res[i])
+		}
+	}
+	if res[3].Status != dnsmsg.ErrName {
+		t.Errorf("query 3: got status %s", res[3].Status)
+	}
+
+	for _, body := range []string{`{"name":"www.example.com"}`, `[{"name":"www.example.com","type":"BOGUS"}]`, `[{"type":"A"}]`} {
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("POST", "/api/resolve-batch", strings.NewReader(body)))
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", body, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	apiSocket     = flag.String("api-socket", "/var/run/dnsd.sock", "unix socket serving the management API (empty to disable)")
+	apiSocketMode = flag.Uint("api-socket-mode", 0660, "permissions of the management API socket")
+	httpsApi      = flag.Bool("https-api", false, "also serve the management API on the HTTPS listener, reachable by anyone able to connect to it")
+)
+
+// initApiSocket serves the management API on a unix socket, so local tools
+// can use it with access controlled by filesystem permissions
+func initApiSocket() {
+	if *apiSocket == "" {
+		return
+	}
+
+	// remove a socket left over by a previous instance
+	if st, err := os.Lstat(*apiSocket); err == nil && st.Mode()&fs.ModeSocket != 0 {
+		os.Remove(*apiSocket)
+	}
+
+	l, err := net.Listen("unix", *apiSocket)
+	if err != nil {
+		log.Printf("[api] failed to listen on %s: %s", *apiSocket, err)
+		return
+	}
+	if err := os.Chmod(*apiSocket, fs.FileMode(*apiSocketMode)); err != nil {
+		log.Printf("[api] failed to set permissions of %s: %s", *apiSocket, err)
+		l.Close()
+		return
+	}
+	log.Printf("[api] listening on %s", *apiSocket)
+
+	srv := &http.Server{Handler: http.HandlerFunc(handleApiSocketReq)}
+	err = srv.Serve(l)
+	log.Printf("[api] Serve failed: %s", err)
+}
+
+// handleApiSocketReq serves the /api/ endpoints, with the same URLs as on
+// the HTTPS listener
+func handleApiSocketReq(rw http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, "/api/") {
+		http.NotFound(rw, req)
+		return
+	}
+	handleApi(rw, req)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var auditRetention = flag.Duration("audit-retention", 90*24*time.Hour, "how long entries are kept in the audit log (0 to keep forever)")
+
+// auditEntry describes a single change made through the management
+// interfaces. Before and After hold the JSON encoded state of the target.
+type auditEntry struct {
+	Time   time.Time       `json:"time"`
+	Who    string          `json:"who"`
+	Op     string          `json:"op"`
+	Target string          `json:"target"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// audit records a change in the audit log. before and after are encoded as
+// JSON, and can be nil for creations and deletions.
+func audit(who, op, target string, before, after any) {
+	e := &auditEntry{
+		Who:    who,
+		Op:     op,
+		Target: target,
+		Before: auditValue(before),
+		After:  auditValue(after),
+	}
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(e); err != nil {
+		log.Printf("[audit] failed to encode entry: %s", err)
+		return
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("audit"))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(now(), seq), buf.Bytes())
+	})
+	if err != nil {
+		log.Printf("[audit] failed to store entry: %s", err)
+	}
+}
+
+func auditValue(v any) json.RawMessage {
+	buf, err := json.Marshal(v)
+	if err != nil || string(buf) == "null" {
+		return nil
+	}
+	return buf
+}
+
+// apiActor returns who is performing an API request, for the audit log
+func apiActor(req *http.Request) string {
+	if _, ok := req.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr); ok {
+		return "api:unix"
+	}
+	return "api:" + req.RemoteAddr
+}
+
+// readAuditEntry decodes an entry of the audit bucket
+func readAuditEntry(k, v []byte) (*auditEntry, error) {
+	e := &auditEntry{}
+	if err := gob.NewDecoder(bytes.NewReader(v)).Decode(e); err != nil {
+		return nil, err
+	}
+	e.Time = parseTimeKey(k).UTC()
+	return e, nil
+}
+
+// pruneAudit removes audit entries older than the retention period
+func pruneAudit() error {
+	if *auditRetention <= 0 {
+		return nil
+	}
+	limit := timeKey(clock.Now().Add(-*auditRetention))
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("audit"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func auditPruneThread() {
+	for {
+		if err := pruneAudit(); err != nil {
+			log.Printf("[audit] failed to prune log: %s", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// handleAuditExport writes audit entries as JSON lines, oldest first.
+// Parameters: since and until (RFC 3339 times), target (prefix of the
+// target) and limit.
+func handleAuditExport(rw http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	var start, end []byte
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(rw, "invalid since", http.StatusBadRequest)
+			return
+		}
+		start = timeKey(t)
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(rw, "invalid until", http.StatusBadRequest)
+			return
+		}
+		end = timeKey(t)
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(rw, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	target := q.Get("target")
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(rw)
+
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("audit"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		n := 0
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			e, err := readAuditEntry(k, v)
+			if err != nil {
+				log.Printf("[audit] failed to decode entry: %s", err)
+				continue
+			}
+			if !strings.HasPrefix(e.Target, target) {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			if n++; n == limit {
+				break
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+)
+
+// Parent-side automation of DS updates (RFC 7344, RFC 8078): the children
+// with DS records of the zones in dnsd are polled for their CDS and CDNSKEY
+// records, which change the DS RRset once validated with the current DS
+// records. Children without DS records are not bootstrapped, their first DS
+// records are added by hand.
+
+var (
+	cdsScan     = flag.Duration("cds-scan", 0, "how often children with DS records are polled for CDS and CDNSKEY records to update their DS records (0 to disable)")
+	cdsResolver = flag.String("cds-resolver", "", "resolver (host:port, over TCP) used to query the children for CDS and CDNSKEY records, empty to query the zones served by dnsd")
+	cdsTimeout  = flag.Duration("cds-timeout", 10*time.Second, "deadline for the queries of a child zone")
+)
+
+// cdsThread polls the children of the zones for CDS and CDNSKEY records
+func cdsThread() {
+	if *cdsScan <= 0 {
+		return
+	}
+	t := time.NewTicker(*cdsScan)
+	defer t.Stop()
+	for range t.C {
+		zones, err := listZones()
+		if err != nil {
+			log.Printf("[cds] failed to list zones: %s", err)
+			continue
+		}
+		for _, z := range zones {
+			if err := z.scanCDS(context.Background(), cdsFetch); err != nil {
+				log.Printf("[cds] zone %s: %s", z, err)
+			}
+		}
+	}
+}
+
+// cdsFetch queries the records of type t at name with the DO bit, from
+// -cds-resolver or the zones served by dnsd
+func cdsFetch(ctx context.Context, name dnsmsg.Name, t dnsmsg.Type) (*dnsmsg.Message, error) {
+	q := dnsmsg.NewQuery(string(name), dnsmsg.IN, t)
+	q.SetDO(true)
+
+	if *cdsResolver == "" {
+		res, err := handleQuery(ctx, q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		// names are qualified on the wire
+		buf, err := res.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return dnsmsg.Parse(buf)
+	}
+
+	q.Bits.SetRecDesired(true)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", *cdsResolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	if err := dnsmsg.WriteStreamMessage(conn, q); err != nil {
+		return nil, err
+	}
+	res, err := dnsmsg.ReadStreamMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	if res.ID != q.ID {
+		return nil, errors.New("response does not match the query")
+	}
+	return res, nil
+}
+
+// scanCDS updates the DS records of the children of z from their CDS and
+// CDNSKEY records, queried with fetch. Zones served under several names are
+// scanned under the first one.
+func (z dnsZone) scanCDS(ctx context.Context, fetch dnssec.FetchFunc) error {
+	domains, err := z.domains()
+	if err != nil || len(domains) == 0 {
+		return err
+	}
+	domain := domains[0]
+	rrs, _, err := z.zoneRecords()
+	if err != nil {
+		return err
+	}
+
+	// DS RRsets by child, in the order of the zone
+	var names []dnsmsg.Name
+	sets := make(map[dnsmsg.Name][]*dnsmsg.Resource)
+	for _, rr := range rrs {
+		if rr.Type != dnsmsg.DS || rr.Name == "" {
+			continue
+		}
+		child := dnsmsg.Name(string(rr.Name) + "." + domain + ".")
+		if sets[child] == nil {
+			names = append(names, child)
+		}
+		sets[child] = append(sets[child], &dnsmsg.Resource{Name: child, Type: dnsmsg.DS, Class: dnsmsg.IN, TTL: rr.TTL, Data: rr.Data})
+	}
+	for _, child := range names {
+		name := string(child[:len(child)-len(domain)-2])
+		if err := z.updateDS(ctx, fetch, domain, name, sets[child]); err != nil {
+			log.Printf("[cds] %s: %s", child, err)
+		}
+	}
+	return nil
+}
+
+// childRRset returns the records of type t at name in the answer of msg,
+// and their signatures
+func childRRset(msg *dnsmsg.Message, name dnsmsg.Name, t dnsmsg.Type) (rrset, sigs []*dnsmsg.Resource) {
+	for _, rr := range msg.Answer {
+		if !rr.Name.Equal(name) {
+			continue
+		}
+		switch {
+		case rr.Type == t:
+			rrset = append(rrset, rr)
+		case rr.Type == dnsmsg.RRSIG && rr.Data.(*dnsmsg.RDataRRSIG).TypeCovered == t:
+			sigs = append(sigs, rr)
+		}
+	}
+	return
+}
+
+// updateDS applies the CDS and CDNSKEY records of the child at name, relative
+// to domain, to its DS records ds. The records must be signed with a key of
+// the current DS RRset, and the new DS RRset must still validate them
+// (RFC 7344 section 4.1).
+func (z dnsZone) updateDS(ctx context.Context, fetch dnssec.FetchFunc, domain, name string, ds []*dnsmsg.Resource) error {
+	ctx, cancel := context.WithTimeout(ctx, *cdsTimeout)
+	defer cancel()
+	child := ds[0].Name
+
+	v := dnssec.NewValidator(&dnssec.ValidatorConfig{Fetch: fetch, Anchors: ds, Now: clock.Now})
+	var cds, rrset, sigs []*dnsmsg.Resource
+	for _, typ := range []dnsmsg.Type{dnsmsg.CDS, dnsmsg.CDNSKEY} {
+		msg, err := fetch(ctx, child, typ)
+		if err != nil {
+			return err
+		}
+		set, setSigs := childRRset(msg, child, typ)
+		if len(set) == 0 {
+			continue
+		}
+		if state, err := v.Validate(ctx, set, setSigs); state != dnssec.Secure {
+			return fmt.Errorf("%s records are %s: %v", typ, state, err)
+		}
+		cds = append(cds, set...)
+		rrset, sigs = set, setSigs
+	}
+	u, err := dnssec.CheckDSUpdate(ds, cds)
+	if err != nil || !u.Needed() {
+		return err
+	}
+
+	var after []*dnsmsg.Resource
+	for _, rr := range ds {
+		if !slices.Contains(u.Remove, rr.Data.(*dnsmsg.RDataDS)) {
+			after = append(after, rr)
+		}
+	}
+	for _, d := range u.Add {
+		after = append(after, &dnsmsg.Resource{Name: child, Type: dnsmsg.DS, Class: dnsmsg.IN, TTL: ds[0].TTL, Data: d})
+	}
+
+	if u.Delete {
+		prev, err := z.deleteRecord(name, dnsmsg.DS)
+		if err != nil || prev == nil {
+			return err
+		}
+		log.Printf("[cds] %s: removed DS records, as requested by the child", child)
+		before := &apiRecord{Name: name, Type: dnsmsg.DS.String(), TTL: prev.TTL, Values: prev.Value}
+		audit("cds", "record-delete", "zone:"+domain, before, nil)
+		return nil
+	}
+
+	if state, err := dnssec.NewValidator(&dnssec.ValidatorConfig{Fetch: fetch, Anchors: after, Now: clock.Now}).Validate(ctx, rrset, sigs); state != dnssec.Secure {
+		return fmt.Errorf("the requested DS records would not validate the child: %s %v", state, err)
+	}
+
+	rec := &Record{Type: dnsmsg.DS, TTL: ds[0].TTL}
+	for _, rr := range after {
+		rec.Value = append(rec.Value, rr.Data.String())
+	}
+	prev, changed, err := z.upsertRecord(name, rec)
+	if err != nil || !changed {
+		return err
+	}
+	log.Printf("[cds] %s: updated DS records, %d added and %d removed", child, len(u.Add), len(u.Remove))
+	var before *apiRecord
+	if prev != nil {
+		before = &apiRecord{Name: name, Type: dnsmsg.DS.String(), TTL: prev.TTL, Values: prev.Value}
+	}
+	audit("cds", "record-upsert", "zone:"+domain, before, &apiRecord{Name: name, Type: dnsmsg.DS.String(), TTL: rec.TTL, Values: rec.Value})
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+)
+
+func TestScanCDS(t *testing.T) {
+	openTestDb(t)
+	parent, err := getOrCreateZone("cds.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	child, err := newZone("child.cds.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	child.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	child.setSettings(&zoneSettings{DNSSEC: &dnssecPolicy{}})
+	if err := signZone(child); err != nil {
+		t.Fatalf("failed to sign zone: %s", err)
+	}
+	var ksk *dnsmsg.Resource
+	for _, rr := range signedZones.get(child, "child.cds.example.com").apex[dnsmsg.DNSKEY] {
+		if rr.Data.(*dnsmsg.RDataDNSKEY).Flags&dnssec.FlagSEP != 0 {
+			ksk = rr
+		}
+	}
+	ds := func(digest uint8) string {
+		t.Helper()
+		d, err := dnssec.NewDS(ksk, digest)
+		if err != nil {
+			t.Fatalf("failed to make DS: %s", err)
+		}
+		return d.String()
+	}
+	stale := "12345 13 2 0000000000000000000000000000000000000000000000000000000000000000"
+
+	var tests = []struct {
+		current []string
+		want    []string
+	}{
+		// the DS of a removed key is dropped
+		{[]string{ds(dnssec.DigestSHA256), stale}, []string{ds(dnssec.DigestSHA256)}},
+		// the digest type of the CDS records replaces the current one
+		{[]string{ds(dnssec.DigestSHA384)}, []string{ds(dnssec.DigestSHA256)}},
+		// records not signed by a key of the DS RRset are ignored
+		{[]string{stale}, []string{stale}},
+	}
+	for _, test := range tests {
+		parent.setRecord("child", 3600, dnsmsg.DS, test.current...)
+		if err := parent.scanCDS(context.Background(), cdsFetch); err != nil {
+			t.Fatalf("failed to scan: %s", err)
+		}
+		rrs, err := parent.getRecord(context.Background(), []byte("child"), dnsmsg.DS)
+		if err != nil {
+			t.Fatalf("failed to read DS: %s", err)
+		}
+		var got []string
+		for _, rr := range rrs {
+			got = append(got, rr.Data.String())
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("DS %v: got %v, expected %v", test.current, got, test.want)
+		}
+	}
+}
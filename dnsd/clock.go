@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used throughout dnsd. Everything that needs
+// the current time (record timestamps, SOA serials, certificates, ...) goes
+// through it so tests can freeze and advance time deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// clock is the Clock used by dnsd, defaults to the system clock
+var clock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// manualClock is a Clock that only moves when told to
+type manualClock struct {
+	t  time.Time
+	lk sync.Mutex
+}
+
+func newManualClock(t time.Time) *manualClock {
+	return &manualClock{t: t}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.t
+}
+
+func (c *manualClock) Set(t time.Time) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.t = t
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.t = c.t.Add(d)
+}
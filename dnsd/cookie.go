@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"net"
+	"sync"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var requireCookie = flag.Bool("require-cookie", false, "only answer UDP queries carrying a valid server cookie (RFC 7873)")
+
+var (
+	cookieSecret     []byte
+	cookieSecretOnce sync.Once
+)
+
+const (
+	cookieMaxAge   = 3600 // accept server cookies up to 1 hour old
+	cookieRefresh  = 1800 // issue a new server cookie after 30 minutes
+	cookieMaxSkew  = 300  // tolerate cookies 5 minutes in the future
+	cookieVersion1 = 1
+)
+
+func getCookieSecret() []byte {
+	cookieSecretOnce.Do(func() {
+		v, err := simpleGet([]byte("local"), []byte("cookie-secret"))
+		if err == nil && len(v) == 32 {
+			cookieSecret = v
+			return
+		}
+
+		v = make([]byte, 32)
+		if _, err := rand.Read(v); err != nil {
+			panic(err)
+		}
+		if err := simpleSet([]byte("local"), []byte("cookie-secret"), v); err != nil {
+			panic(err)
+		}
+		cookieSecret = v
+	})
+	return cookieSecret
+}
+
+// serverCookie computes our server cookie for the given client cookie and
+// address, using the layout of RFC 9018 (version, reserved, timestamp, hash)
+func serverCookie(client []byte, ip net.IP, ts uint32) []byte {
+	res := make([]byte, 16)
+	res[0] = cookieVersion1
+	binary.BigEndian.PutUint32(res[4:8], ts)
+
+	h := hmac.New(sha256.New, getCookieSecret())
+	h.Write(client)
+	h.Write(res[:8])
+	h.Write(ip.To16())
+	copy(res[8:], h.Sum(nil))
+	return res
+}
+
+// checkServerCookie returns whether the server part of c is a cookie we
+// issued to ip, and whether it is old enough to be replaced
+func checkServerCookie(c *dnsmsg.EDNSCookie, ip net.IP) (valid, refresh bool) {
+	if len(c.Server) != 16 || c.Server[0] != cookieVersion1 {
+		return false, false
+	}
+	ts := binary.BigEndian.Uint32(c.Server[4:8])
+	age := int32(uint32(clock.Now().Unix()) - ts)
+	if age > cookieMaxAge || age < -cookieMaxSkew {
+		return false, false
+	}
+	if !hmac.Equal(c.Server, serverCookie(c.Client, ip, ts)) {
+		return false, false
+	}
+	return true, age > cookieRefresh
+}
+
+// handleCookie performs server side processing of the cookie option opt
+// sent with the query, and adds our cookie to the response pkt. It returns
+// false if the query must not be processed any further, in which case pkt
+// is a complete response.
+func handleCookie(pkt *dnsmsg.Message, opt *dnsmsg.DnsOpt, raddr net.Addr) bool {
+	var ip net.IP
+	udp := false
+	switch v := raddr.(type) {
+	case *net.UDPAddr:
+		ip = v.IP
+		udp = true
+	case *net.TCPAddr:
+		ip = v.IP
+	}
+
+	if opt == nil {
+		if udp && *requireCookie {
+			// no cookie, send client to TCP
+			pkt.Bits.SetTrunc(true)
+			return false
+		}
+		return true
+	}
+
+	c, err := dnsmsg.ParseCookie(opt)
+	if err != nil {
+		pkt.Bits.SetRCode(dnsmsg.ErrFormat)
+		return false
+	}
+
+	valid, refresh := checkServerCookie(c, ip)
+	if !valid || refresh {
+		c.Server = serverCookie(c.Client, ip, uint32(clock.Now().Unix()))
+	}
+	pkt.SetCookie(c)
+
+	if !valid && udp && *requireCookie {
+		pkt.SetExtendedRCode(dnsmsg.ErrBadCookie)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestQueryCookie(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("cookie.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	c := newManualClock(time.Date(2024, 7, 29, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+	defer func(v bool) { *requireCookie = v }(*requireCookie)
+	*requireCookie = true
+
+	udp := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 53), Port: 5353}
+	client := []byte("abcdefgh")
+	query := func(raddr net.Addr, cookie *dnsmsg.EDNSCookie) *dnsmsg.Message {
+		t.Helper()
+		q := dnsmsg.NewQuery("www.cookie.example.com.", dnsmsg.IN, dnsmsg.A)
+		if cookie != nil {
+			q.SetCookie(cookie)
+		}
+		res, err := handleQuery(context.Background(), q, nil, raddr)
+		if err != nil {
+			t.Fatalf("failed to query: %s", err)
+		}
+		return res
+	}
+
+	// no cookie, the client is sent to TCP
+	res := query(udp, nil)
+	if !res.Bits.IsTrunc() || len(res.Answer) != 0 {
+		t.Errorf("query without cookie: unexpected response %s", res)
+	}
+
+	// client cookie only, BADCOOKIE with a server cookie to retry with
+	res = query(udp, &dnsmsg.EDNSCookie{Client: client})
+	cookie := res.GetCookie()
+	if res.ExtendedRCode() != dnsmsg.ErrBadCookie || len(res.Answer) != 0 {
+		t.Errorf("client cookie: unexpected response %s", res)
+	}
+	if cookie == nil || !bytes.Equal(cookie.Client, client) || len(cookie.Server) != 16 {
+		t.Fatalf("client cookie: unexpected cookie %v", cookie)
+	}
+
+	// valid cookie, kept as is
+	res = query(udp, cookie)
+	if res.ExtendedRCode() != dnsmsg.NoError || len(res.Answer) != 1 {
+		t.Errorf("valid cookie: unexpected response %s", res)
+	}
+	if c := res.GetCookie(); c == nil || !bytes.Equal(c.Server, cookie.Server) {
+		t.Errorf("valid cookie: unexpected cookie %v", c)
+	}
+
+	// valid but old enough to be replaced
+	c.Advance(31 * time.Minute)
+	res = query(udp, cookie)
+	if res.ExtendedRCode() != dnsmsg.NoError || len(res.Answer) != 1 {
+		t.Errorf("old cookie: unexpected response %s", res)
+	}
+	if c := res.GetCookie(); c == nil || bytes.Equal(c.Server, cookie.Server) {
+		t.Errorf("old cookie: server cookie was not refreshed: %v", c)
+	}
+
+	// stale cookie
+	c.Advance(time.Hour)
+	res = query(udp, cookie)
+	if res.ExtendedRCode() != dnsmsg.ErrBadCookie || len(res.Answer) != 0 {
+		t.Errorf("stale cookie: unexpected response %s", res)
+	}
+	cookie = res.GetCookie()
+	if cookie == nil || len(cookie.Server) != 16 {
+		t.Fatalf("stale cookie: unexpected cookie %v", cookie)
+	}
+
+	// forged cookie, and cookie issued to another address
+	forged := &dnsmsg.EDNSCookie{Client: client, Server: bytes.Clone(cookie.Server)}
+	forged.Server[15] ^= 1
+	other := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 54), Port: 5353}
+	for _, test := range []struct {
+		raddr  net.Addr
+		cookie *dnsmsg.EDNSCookie
+	}{
+		{udp, forged},
+		{other, cookie},
+	} {
+		res = query(test.raddr, test.cookie)
+		if res.ExtendedRCode() != dnsmsg.ErrBadCookie || len(res.Answer) != 0 {
+			t.Errorf("cookie %s from %s: unexpected response %s", test.cookie, test.raddr, res)
+		}
+	}
+
+	// cookies are not required over TCP, nor when -require-cookie is off
+	tcp := &net.TCPAddr{IP: udp.IP, Port: 5353}
+	res = query(tcp, &dnsmsg.EDNSCookie{Client: client})
+	if res.ExtendedRCode() != dnsmsg.NoError || len(res.Answer) != 1 || res.GetCookie() == nil {
+		t.Errorf("client cookie over TCP: unexpected response %s", res)
+	}
+	*requireCookie = false
+	res = query(udp, forged)
+	if res.ExtendedRCode() != dnsmsg.NoError || len(res.Answer) != 1 {
+		t.Errorf("forged cookie without -require-cookie: unexpected response %s", res)
+	}
+	if c := res.GetCookie(); c == nil || bytes.Equal(c.Server, forged.Server) || len(c.Server) != 16 {
+		t.Errorf("forged cookie without -require-cookie: unexpected cookie %v", c)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"log"
 	"net"
 	"os"
@@ -61,15 +61,19 @@ func makeDb() {
 }
 
 func getOrCreateZone(dns string) (dnsZone, error) {
-	z, _, _, err := getZone(dns, nil)
+	z, _, _, err := getZone(context.Background(), dns, nil)
 	if err == nil {
 		return z, nil
 	}
 	if err != os.ErrNotExist {
 		return dnsZone{}, err
 	}
+	return newZone(dns)
+}
 
-	z, err = createZone()
+// newZone creates a zone for dns, with a minimal SOA record
+func newZone(dns string) (dnsZone, error) {
+	z, err := createZone()
 	if err != nil {
 		return dnsZone{}, err
 	}
@@ -85,6 +89,7 @@ func getOrCreateZone(dns string) (dnsZone, error) {
 		return dnsZone{}, err
 	}
 
+	fireWebhooks(&webhookEvent{Event: eventZoneCreate, Zone: z.String(), Name: dns})
 	return z, nil
 }
 
@@ -113,18 +118,130 @@ func createDomain(dns string, zone dnsZone, ip net.IP) error {
 	})
 }
 
-func getZone(dns string, laddr net.Addr) (dnsZone, []byte, []byte, error) {
+// listZones returns the zones with at least one name pointing to them
+func listZones() ([]dnsZone, error) {
+	seen := make(map[dnsZone]bool)
+	var res []dnsZone
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{"domain", "ip-domain"} {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+			b.ForEach(func(k, v []byte) error {
+				var z dnsZone
+				copy(z[:], v[12:])
+				if !seen[z] {
+					seen[z] = true
+					res = append(res, z)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// deleteZone removes zone z, with the domains pointing to it, its records,
+// its settings and its DNSSEC keys
+func deleteZone(z dnsZone) error {
+	// record sets removed from the publish targets of the zone
+	type recordSet struct {
+		name string
+		typ  dnsmsg.Type
+	}
+	var sets []recordSet
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		// collect keys first, deleting while iterating would skip some
+		var keys [][]byte
+		for _, name := range []string{"domain", "ip-domain"} {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+			keys = keys[:0]
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if bytes.Equal(v[12:], z[:]) {
+					keys = append(keys, bdup(k))
+				}
+			}
+			if err := deleteKeys(b, keys); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range []string{"dnssec-key", "dnssec-dnskey"} {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+			keys = keys[:0]
+			c := b.Cursor()
+			for k, _ := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, _ = c.Next() {
+				keys = append(keys, bdup(k))
+			}
+			if err := deleteKeys(b, keys); err != nil {
+				return err
+			}
+		}
+
+		if b := tx.Bucket([]byte("record")); b != nil {
+			keys = keys[:0]
+			c := b.Cursor()
+			for k, _ := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, _ = c.Next() {
+				keys = append(keys, bdup(k))
+				name := k[16:]
+				name = name[:bytes.IndexByte(name, 0)]
+				typ := dnsmsg.Type(k[len(k)-2])<<8 | dnsmsg.Type(k[len(k)-1])
+				sets = append(sets, recordSet{string(reverseDnsName(name)), typ})
+			}
+			if err := deleteKeys(b, keys); err != nil {
+				return err
+			}
+		}
+
+		if b := tx.Bucket([]byte("zone")); b != nil {
+			return b.Delete(z[:])
+		}
+		return nil
+	})
+	if err == nil {
+		fireWebhooks(&webhookEvent{Event: eventZoneDelete, Zone: z.String()})
+		for _, s := range sets {
+			queuePublish(z, s.name, s.typ)
+		}
+		queueSign(z)
+	}
+	return err
+}
+
+func deleteKeys(b *bolt.Bucket, keys [][]byte) error {
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getZone(ctx context.Context, dns string, laddr net.Addr) (dnsZone, []byte, []byte, error) {
 	var ip net.IP
 
+	if err := ctx.Err(); err != nil {
+		return dnsZone(uuid.Nil), nil, nil, err
+	}
+
 	switch v := laddr.(type) {
 	case *net.TCPAddr:
 		ip = v.IP.To16()
 	case *net.UDPAddr:
 		ip = v.IP.To16()
-	case nil:
-		// do nothing
 	default:
-		return dnsZone(uuid.Nil), nil, nil, errors.New("invalid address")
+		// no IP (unix socket, in-memory listener...), only global zones
+		// apply
 	}
 
 	name := reverseDnsName([]byte(dns))
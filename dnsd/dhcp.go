@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var (
+	dhcpLeaseFile   = flag.String("dhcp-leases", "", "DHCP lease file to serve LAN hostnames from (empty to disable)")
+	dhcpLeaseFormat = flag.String("dhcp-lease-format", "dnsmasq", "format of the DHCP lease file: dnsmasq or isc")
+	dhcpDomain      = flag.String("dhcp-domain", "lan", "local domain DHCP hostnames are served under")
+	dhcpTTL         = flag.Uint("dhcp-ttl", 60, "TTL of records generated from DHCP leases")
+	dhcpRefresh     = flag.Duration("dhcp-refresh", 5*time.Second, "how often the DHCP lease file is checked for changes")
+)
+
+// dhcpLease is a hostname to address binding handed out by a DHCP server
+type dhcpLease struct {
+	Hostname string    `json:"hostname"`
+	IP       net.IP    `json:"ip"`
+	Expires  time.Time `json:"expires,omitempty"` // zero if the lease does not expire
+}
+
+func (l *dhcpLease) expired(t time.Time) bool {
+	return !l.Expires.IsZero() && !t.Before(l.Expires)
+}
+
+// dhcpTable holds the current DHCP leases, from the lease file and from the
+// API. It is checked before the zones.
+type dhcpTable struct {
+	file  []*dhcpLease
+	api   map[string]*dhcpLease // by IP
+	mtime time.Time
+	lk    sync.RWMutex
+}
+
+var dhcpLeases = &dhcpTable{}
+
+// dhcpHostname returns the lowercase hostname h if it can be used as a single
+// label, or an empty string
+func dhcpHostname(h string) string {
+	h = strings.ToLower(h)
+	if h == "" || len(h) > 63 || h[0] == '-' || h[len(h)-1] == '-' {
+		return ""
+	}
+	for _, c := range h {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return ""
+		}
+	}
+	return h
+}
+
+// parseDnsmasqLeases reads a dnsmasq lease file, made of lines such as:
+//
+//	1760616000 00:11:22:33:44:55 192.168.1.10 laptop 01:00:11:22:33:44:55
+//
+// IPv6 leases use the same layout with the IAID in place of the MAC address,
+// after a "duid" line. An expiry of 0 means the lease does not expire.
+func parseDnsmasqLeases(r io.Reader) ([]*dhcpLease, error) {
+	var res []*dhcpLease
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 4 || f[0] == "duid" {
+			continue
+		}
+		exp, err := strconv.ParseInt(f[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry %q", f[0])
+		}
+		ip := net.ParseIP(f[2])
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", f[2])
+		}
+		host := dhcpHostname(f[3])
+		if host == "" {
+			// "*" when the client did not send a hostname
+			continue
+		}
+		l := &dhcpLease{Hostname: host, IP: ip}
+		if exp != 0 {
+			l.Expires = time.Unix(exp, 0)
+		}
+		res = append(res, l)
+	}
+	return res, s.Err()
+}
+
+// parseIscLeases reads an ISC dhcpd lease file, keeping active leases with a
+// client hostname. Later entries for the same address replace earlier ones,
+// as dhcpd appends to the file.
+func parseIscLeases(r io.Reader) ([]*dhcpLease, error) {
+	var (
+		res   []*dhcpLease
+		cur   *dhcpLease
+		state string
+		byIP  = make(map[string]int)
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSuffix(line, ";")
+		f := strings.Fields(line)
+
+		if cur == nil {
+			if len(f) == 3 && f[0] == "lease" && f[2] == "{" {
+				ip := net.ParseIP(f[1])
+				if ip == nil {
+					return nil, fmt.Errorf("invalid address %q", f[1])
+				}
+				cur, state = &dhcpLease{IP: ip}, ""
+			}
+			continue
+		}
+
+		switch {
+		case line == "}":
+			if state != "" && state != "active" {
+				cur.Hostname = ""
+			}
+			k := cur.IP.String()
+			if i, ok := byIP[k]; ok {
+				res[i] = cur
+			} else {
+				byIP[k] = len(res)
+				res = append(res, cur)
+			}
+			cur = nil
+		case len(f) >= 2 && f[0] == "client-hostname":
+			cur.Hostname = dhcpHostname(strings.Trim(strings.Join(f[1:], " "), `"`))
+		case len(f) >= 3 && f[0] == "binding" && f[1] == "state":
+			state = f[2]
+		case len(f) >= 2 && f[0] == "ends":
+			if f[1] == "never" {
+				break
+			}
+			if len(f) < 4 {
+				return nil, fmt.Errorf("invalid ends %q", line)
+			}
+			// ends <weekday> yyyy/mm/dd hh:mm:ss, in UTC
+			t, err := time.Parse("2006/01/02 15:04:05", f[2]+" "+f[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ends %q", line)
+			}
+			cur.Expires = t
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	// drop leases that were freed or have no hostname
+	n := 0
+	for _, l := range res {
+		if l.Hostname != "" {
+			res[n] = l
+			n += 1
+		}
+	}
+	return res[:n], nil
+}
+
+// load reads the lease file at path if it changed since the last load
+func (d *dhcpTable) load(path, format string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	d.lk.RLock()
+	same := st.ModTime().Equal(d.mtime)
+	d.lk.RUnlock()
+	if same {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var leases []*dhcpLease
+	switch format {
+	case "dnsmasq":
+		leases, err = parseDnsmasqLeases(f)
+	case "isc":
+		leases, err = parseIscLeases(f)
+	default:
+		return fmt.Errorf("unsupported lease file format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.file = leases
+	d.mtime = st.ModTime()
+	log.Printf("[dhcp] loaded %d leases from %s", len(leases), path)
+	return nil
+}
+
+// set adds or replaces a lease given through the API, and returns the
+// lease it replaced, if any
+func (d *dhcpTable) set(l *dhcpLease) *dhcpLease {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.api == nil {
+		d.api = make(map[string]*dhcpLease)
+	}
+	k := l.IP.String()
+	prev := d.api[k]
+	d.api[k] = l
+	return prev
+}
+
+// remove drops the API lease for ip, and returns it, or nil if there was
+// none
+func (d *dhcpTable) remove(ip net.IP) *dhcpLease {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	k := ip.String()
+	prev := d.api[k]
+	delete(d.api, k)
+	return prev
+}
+
+// list returns the leases that have not expired at time t, API leases taking
+// precedence over the lease file for the same address
+func (d *dhcpTable) list(t time.Time) []*dhcpLease {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	var res []*dhcpLease
+	for _, l := range d.file {
+		if _, ok := d.api[l.IP.String()]; !ok && !l.expired(t) {
+			res = append(res, l)
+		}
+	}
+	for _, l := range d.api {
+		if !l.expired(t) {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// answer answers q in pkt from the leases, and returns true if the name is
+// known: a hostname under -dhcp-domain, or the reverse name of a leased
+// address
+func (d *dhcpTable) answer(pkt *dnsmsg.Message, q *dnsmsg.Question) bool {
+	name := strings.ToLower(strings.TrimSuffix(string(q.Name), "."))
+	domain := strings.ToLower(strings.Trim(*dhcpDomain, "."))
+	leases := d.list(clock.Now())
+	if len(leases) == 0 {
+		return false
+	}
+
+	var rrs []*dnsmsg.Resource
+	found := false
+	if ip := ptrAddr(name); ip != nil {
+		for _, l := range leases {
+			if !l.IP.Equal(ip) {
+				continue
+			}
+			found = true
+			if q.Type == dnsmsg.PTR || q.Type == dnsmsg.ANY {
+				rrs = append(rrs, &dnsmsg.Resource{Type: dnsmsg.PTR, Data: &dnsmsg.RDataLabel{Label: l.Hostname + "." + domain + ".", Type: dnsmsg.PTR}})
+			}
+			break
+		}
+	} else if host, ok := strings.CutSuffix(name, "."+domain); ok && domain != "" {
+		for _, l := range leases {
+			if l.Hostname != host {
+				continue
+			}
+			found = true
+			if ip4 := l.IP.To4(); ip4 != nil && (q.Type == dnsmsg.A || q.Type == dnsmsg.ANY) {
+				rrs = append(rrs, &dnsmsg.Resource{Type: dnsmsg.A, Data: &dnsmsg.RDataIP{IP: ip4, Type: dnsmsg.A}})
+			} else if ip4 == nil && (q.Type == dnsmsg.AAAA || q.Type == dnsmsg.ANY) {
+				rrs = append(rrs, &dnsmsg.Resource{Type: dnsmsg.AAAA, Data: &dnsmsg.RDataIP{IP: l.IP, Type: dnsmsg.AAAA}})
+			}
+		}
+	}
+	if !found {
+		return false
+	}
+
+	for _, rr := range rrs {
+		rr.Name = q.Name
+		rr.Class = dnsmsg.IN
+		rr.TTL = uint32(*dhcpTTL)
+	}
+	pkt.Answer = append(pkt.Answer, rrs...)
+	pkt.Bits.SetAuth(true)
+	return true
+}
+
+// answerDhcp answers q in pkt from the DHCP leases, and returns true if the
+// name is known
+func answerDhcp(ctx context.Context, pkt *dnsmsg.Message, q *dnsmsg.Question) bool {
+	if !dhcpLeases.answer(pkt, q) {
+		return false
+	}
+	setAnswerSource(ctx, sourceDhcp)
+	return true
+}
+
+// dhcpThread reloads the lease file whenever it changes
+func dhcpThread() {
+	if *dhcpLeaseFile == "" {
+		return
+	}
+	for {
+		if err := dhcpLeases.load(*dhcpLeaseFile, *dhcpLeaseFormat); err != nil {
+			log.Printf("[dhcp] failed to load leases: %s", err)
+		}
+		time.Sleep(*dhcpRefresh)
+	}
+}
+
+// handleDhcp lists (GET), adds or replaces (PUT) or removes (DELETE, with the
+// "ip" parameter) DHCP leases. Leases set through the API are kept in memory
+// only, and take precedence over the lease file.
+func handleDhcp(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		leases := dhcpLeases.list(clock.Now())
+		sort.Slice(leases, func(i, j int) bool { return leases[i].Hostname < leases[j].Hostname })
+		if leases == nil {
+			leases = []*dhcpLease{}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(leases)
+	case "PUT":
+		l := &dhcpLease{}
+		if err := json.NewDecoder(req.Body).Decode(l); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		if l.Hostname = dhcpHostname(l.Hostname); l.Hostname == "" {
+			http.Error(rw, "invalid hostname", http.StatusBadRequest)
+			return
+		}
+		if l.IP == nil {
+			http.Error(rw, "ip is required", http.StatusBadRequest)
+			return
+		}
+		before := dhcpLeases.set(l)
+		audit(apiActor(req), "dhcp-set", "dhcp:"+l.IP.String(), before, l)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(l)
+	case "DELETE":
+		ip := net.ParseIP(req.URL.Query().Get("ip"))
+		if ip == nil {
+			http.Error(rw, "invalid ip", http.StatusBadRequest)
+			return
+		}
+		before := dhcpLeases.remove(ip)
+		if before == nil {
+			http.Error(rw, "lease not found", http.StatusNotFound)
+			return
+		}
+		audit(apiActor(req), "dhcp-delete", "dhcp:"+ip.String(), before, nil)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
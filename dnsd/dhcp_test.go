@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+const testIscLeases = `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.20 {
+  starts 4 2026/10/15 10:00:00;
+  ends 4 2026/10/16 22:00:00;
+  binding state active;
+  client-hostname "Printer";
+}
+lease 192.168.1.21 {
+  ends never;
+  binding state active;
+  client-hostname "nas";
+}
+lease 192.168.1.20 {
+  ends 4 2026/10/16 23:00:00;
+  binding state active;
+  client-hostname "printer";
+}
+lease 192.168.1.22 {
+  ends 4 2026/10/16 22:00:00;
+  binding state free;
+  client-hostname "gone";
+}
+`
+
+func TestDhcpLeases(t *testing.T) {
+	openTestDb(t)
+	c := newManualClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{}; dhcpLeases = &dhcpTable{} }()
+
+	leases, err := parseIscLeases(strings.NewReader(testIscLeases))
+	if err != nil {
+		t.Fatalf("failed to parse ISC leases: %s", err)
+	}
+	if len(leases) != 2 || leases[0].Hostname != "printer" || leases[0].Expires.Hour() != 23 || !leases[1].Expires.IsZero() {
+		t.Errorf("unexpected ISC leases: %+v", leases)
+	}
+
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	exp := c.Now().Add(time.Hour).Unix()
+	data := strings.Join([]string{
+		fmt.Sprintf("%d 00:11:22:33:44:55 192.168.1.10 Laptop 01:00:11:22:33:44:55", exp),
+		"0 00:11:22:33:44:56 192.168.1.11 * *",
+		"duid 00:01:00:01:2c:3a:4b:5c:00:11:22:33:44:55",
+		fmt.Sprintf("%d 1234 2001:db8::10 laptop *", exp),
+	}, "\n")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dhcpLeases = &dhcpTable{}
+	if err := dhcpLeases.load(path, "dnsmasq"); err != nil {
+		t.Fatalf("failed to load leases: %s", err)
+	}
+	*dhcpDomain = "lan"
+
+	query := func(name string, typ dnsmsg.Type) *dnsmsg.Message {
+		t.Helper()
+		res, err := handleQuery(context.Background(), dnsmsg.NewQuery(name, dnsmsg.IN, typ), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", name, err)
+		}
+		return res
+	}
+
+	for _, test := range []struct {
+		name   string
+		typ    dnsmsg.Type
+		expect string
+	}{
+		{"laptop.lan.", dnsmsg.A, "laptop.lan. IN A 60 192.168.1.10"},
+		{"LAPTOP.lan.", dnsmsg.AAAA, "LAPTOP.lan. IN AAAA 60 2001:db8::10"},
+		{"laptop.lan.", dnsmsg.MX, ""},
+		{"10.1.168.192.in-addr.arpa.", dnsmsg.PTR, "10.1.168.192.in-addr.arpa. IN PTR 60 laptop.lan."},
+		{"0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", dnsmsg.PTR, "0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. IN PTR 60 laptop.lan."},
+	} {
+		res := query(test.name, test.typ)
+		var answer []string
+		for _, rr := range res.Answer {
+			answer = append(answer, rr.String())
+		}
+		if got := strings.Join(answer, ", "); got != test.expect || res.Bits.GetRCode() != dnsmsg.NoError || !res.Bits.IsAuth() {
+			t.Errorf("%s %s: got %q (%s), expected %q", test.name, test.typ, got, res.Bits.GetRCode(), test.expect)
+		}
+	}
+
+	// leases set through the API are served along the file
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("PUT", "/api/dhcp", strings.NewReader(`{"hostname":"phone","ip":"192.168.1.12"}`)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to set lease: status %d: %s", rw.Code, rw.Body)
+	}
+	if res := query("phone.lan.", dnsmsg.A); len(res.Answer) != 1 {
+		t.Errorf("API lease not served: %s", res)
+	}
+
+	// expired leases and unknown names are not answered
+	c.Advance(2 * time.Hour)
+	for _, name := range []string{"laptop.lan.", "other.lan."} {
+		if res := query(name, dnsmsg.A); res.Bits.GetRCode() != dnsmsg.ErrName {
+			t.Errorf("%s: unexpected response %s", name, res)
+		}
+	}
+	if l := dhcpLeases.list(c.Now()); len(l) != 1 || !l[0].IP.Equal(net.ParseIP("192.168.1.12")) {
+		t.Errorf("unexpected leases %+v", l)
+	}
+
+	// changes through the API are audited
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("DELETE", "/api/dhcp?ip=192.168.1.12", nil))
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("failed to delete lease: status %d: %s", rw.Code, rw.Body)
+	}
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/audit?target=dhcp:192.168.1.12", nil))
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit entries, got %q", rw.Body)
+	}
+	var e auditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("failed to decode entry: %s", err)
+	}
+	if e.Op != "dhcp-delete" || string(e.Before) != `{"hostname":"phone","ip":"192.168.1.12","expires":"0001-01-01T00:00:00Z"}` || e.After != nil {
+		t.Errorf("unexpected audit entry %s", lines[1])
+	}
+}
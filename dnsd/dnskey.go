@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+	"github.com/KarpelesLab/dns/dnszone"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	dnssecPropagation       = flag.Duration("dnssec-propagation", 5*time.Minute, "time for a zone change to reach all the name servers of the zone, for key rollovers")
+	dnssecParentPropagation = flag.Duration("dnssec-parent-propagation", time.Hour, "time for the parent zone to publish DS changes, for KSK rollovers")
+	dnssecParentDSTTL       = flag.Duration("dnssec-parent-ds-ttl", 24*time.Hour, "TTL of the DS records in the parent zone, for KSK rollovers")
+)
+
+// zoneKey is a DNSSEC key of a zone, stored in the dnssec-key bucket. The
+// times are the steps of the life of the key, set when it is created or when
+// its rollover is planned, zero meaning never.
+type zoneKey struct {
+	ID        uuid.UUID
+	KSK       bool
+	Algorithm uint8
+	PublicKey []byte
+	Private   []byte // PKCS #8 PEM
+
+	Created   time.Time
+	Publish   time.Time // DNSKEY added to the zone
+	Active    time.Time // key signs the zone (KSK: the DNSKEY RRset)
+	Retire    time.Time // key no longer signs
+	Remove    time.Time // DNSKEY removed from the zone
+	DSPublish time.Time // KSK: CDS and CDNSKEY records added to the zone
+	DSRemove  time.Time // KSK: CDS and CDNSKEY records removed from the zone
+}
+
+// reached returns true if at is set and not after t
+func reached(at, t time.Time) bool {
+	return !at.IsZero() && !at.After(t)
+}
+
+func (k *zoneKey) dnskey() *dnsmsg.RDataDNSKEY {
+	flags := uint16(dnssec.FlagZone)
+	if k.KSK {
+		flags |= dnssec.FlagSEP
+	}
+	return &dnsmsg.RDataDNSKEY{Flags: flags, Protocol: 3, Algorithm: k.Algorithm, PublicKey: k.PublicKey}
+}
+
+// published returns true if the DNSKEY of k is in the zone at t
+func (k *zoneKey) published(t time.Time) bool {
+	return reached(k.Publish, t) && !reached(k.Remove, t)
+}
+
+// active returns true if k signs at t
+func (k *zoneKey) active(t time.Time) bool {
+	return reached(k.Active, t) && !reached(k.Retire, t)
+}
+
+// dsPublished returns true if the parent is asked to have a DS for k at t
+func (k *zoneKey) dsPublished(t time.Time) bool {
+	return reached(k.DSPublish, t) && !reached(k.DSRemove, t)
+}
+
+// expired returns true if k has no use left at t
+func (k *zoneKey) expired(t time.Time) bool {
+	return reached(k.Remove, t) && (k.DSRemove.IsZero() || reached(k.DSRemove, t))
+}
+
+// nextEvent returns the first step of k after t, or a zero time
+func (k *zoneKey) nextEvent(t time.Time) time.Time {
+	var res time.Time
+	for _, at := range []time.Time{k.Publish, k.Active, k.Retire, k.Remove, k.DSPublish, k.DSRemove} {
+		if at.After(t) && (res.IsZero() || at.Before(res)) {
+			res = at
+		}
+	}
+	return res
+}
+
+// signer returns a signer for the zone at origin with k
+func (k *zoneKey) signer(origin dnsmsg.Name) (*dnssec.Signer, error) {
+	key := k.dnskey()
+	_, priv, err := dnssec.ParsePrivateKeyPEM(k.Private, key.Algorithm, key.Flags)
+	if err != nil {
+		return nil, err
+	}
+	return dnssec.NewSigner(origin, key, priv)
+}
+
+// newZoneKey generates a KSK or ZSK according to policy p
+func newZoneKey(p *dnssecPolicy, ksk bool, t time.Time) (*zoneKey, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	k := &zoneKey{ID: id, KSK: ksk, Algorithm: p.algorithm(), Created: t}
+	key, priv, err := dnssec.GenerateKeyBits(k.Algorithm, k.dnskey().Flags, p.keySize(ksk))
+	if err != nil {
+		return nil, err
+	}
+	k.PublicKey = key.PublicKey
+	if k.Private, err = dnssec.MarshalPrivateKeyPEM(priv); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (z dnsZone) keyKey(id uuid.UUID) []byte {
+	return append(z[:], id[:]...)
+}
+
+// listKeys returns the DNSSEC keys of z
+func (z dnsZone) listKeys() ([]*zoneKey, error) {
+	var res []*zoneKey
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("dnssec-key"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, v = c.Next() {
+			key := &zoneKey{}
+			if err := gob.NewDecoder(bytes.NewReader(v[12:])).Decode(key); err != nil {
+				return err
+			}
+			res = append(res, key)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (z dnsZone) putKey(k *zoneKey) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(k); err != nil {
+		return err
+	}
+	return simpleSet([]byte("dnssec-key"), z.keyKey(k.ID), append(now(), buf.Bytes()...))
+}
+
+func (z dnsZone) deleteKey(id uuid.UUID) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("dnssec-key"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(z.keyKey(id))
+	})
+}
+
+// updateKeys creates the keys of z, starts the rollovers of the keys past
+// their lifetime and deletes the keys that were rolled over. maxTTL is the
+// highest TTL of the records of the zone. It returns the keys of the zone.
+func (z dnsZone) updateKeys(p *dnssecPolicy, t time.Time, maxTTL time.Duration) ([]*zoneKey, error) {
+	keys, err := z.listKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*zoneKey
+	for _, k := range keys {
+		if k.expired(t) {
+			if err := z.deleteKey(k.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		res = append(res, k)
+	}
+
+	for _, ksk := range []bool{true, false} {
+		if ksk && p.OfflineKSK {
+			continue
+		}
+		// current key, and whether another one is already lined up
+		var cur *zoneKey
+		next := false
+		for _, k := range res {
+			if k.KSK != ksk || reached(k.Retire, t) {
+				continue
+			}
+			if k.active(t) && (cur == nil || k.Active.After(cur.Active)) {
+				cur = k
+			} else if !reached(k.Active, t) {
+				next = true
+			}
+		}
+
+		switch {
+		case cur == nil && !next:
+			// new zone, the key is used right away
+			k, err := newZoneKey(p, ksk, t)
+			if err != nil {
+				return nil, err
+			}
+			k.Publish, k.Active = t, t
+			if ksk {
+				k.DSPublish = t
+			}
+			if err := z.putKey(k); err != nil {
+				return nil, err
+			}
+			res = append(res, k)
+		case cur != nil && !next && cur.Retire.IsZero() && p.lifetime(ksk) > 0 && reached(cur.Active.Add(p.lifetime(ksk)), t):
+			k, err := z.rollKey(p, cur, t, maxTTL)
+			if err != nil {
+				// such as a change of algorithm, the current key is kept
+				log.Printf("[dnssec] zone %s: failed to roll over key %d: %s", z, dnssec.KeyTag(cur.dnskey()), err)
+				continue
+			}
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+// rollKey starts the rollover of cur, planned with the methods of RFC 6781:
+// pre-publish for ZSKs and double-DS for KSKs. It returns the new key.
+func (z dnsZone) rollKey(p *dnssecPolicy, cur *zoneKey, t time.Time, maxTTL time.Duration) (*zoneKey, error) {
+	k, err := newZoneKey(p, cur.KSK, t)
+	if err != nil {
+		return nil, err
+	}
+	r := &dnssec.Rollover{
+		Zone: ".", // only the times of the steps are used
+		Old:  cur.dnskey(),
+		New:  k.dnskey(),
+		Policy: dnssec.RolloverPolicy{
+			Method:            dnssec.PrePublish,
+			DNSKEYTTL:         time.Duration(p.dnskeyTTL()) * time.Second,
+			MaxZoneTTL:        maxTTL,
+			DSTTL:             *dnssecParentDSTTL,
+			Propagation:       *dnssecPropagation,
+			ParentPropagation: *dnssecParentPropagation,
+		},
+	}
+	if cur.KSK {
+		r.Policy.Method = dnssec.DoubleDS
+	}
+	steps, err := r.Plan(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range steps {
+		switch s.Action {
+		case dnssec.PublishKey:
+			k.Publish = s.At
+		case dnssec.StartSigning:
+			k.Active, cur.Retire = s.At, s.At
+		case dnssec.RemoveKey:
+			cur.Remove = s.At
+		case dnssec.SubmitDS:
+			k.DSPublish = s.At
+		case dnssec.SwapKey:
+			k.Publish, k.Active = s.At, s.At
+			cur.Retire, cur.Remove = s.At, s.At
+		case dnssec.RemoveDS:
+			cur.DSRemove = s.At
+		}
+	}
+	if err := z.putKey(k); err != nil {
+		return nil, err
+	}
+	if err := z.putKey(cur); err != nil {
+		return nil, err
+	}
+	log.Printf("[dnssec] zone %s: rolling over key %d, replaced by key %d", z, dnssec.KeyTag(cur.dnskey()), dnssec.KeyTag(k.dnskey()))
+	return k, nil
+}
+
+// keySet is a DNSKEY RRset signed offline by the KSKs of a zone served as
+// Domain, for zones with an offline KSK. It is uploaded through
+// /api/dnssec-dnskey and stored in the dnssec-dnskey bucket. It can also hold
+// the CDS and CDNSKEY RRsets signed by the same keys, which are otherwise not
+// published for these zones.
+type keySet struct {
+	Domain string // lowercase, without final dot
+	Wire   []byte // records, as the answer section of a message
+}
+
+// records returns the DNSKEY, CDS and CDNSKEY records of ks, and their
+// signatures
+func (ks *keySet) records() (rrs, sigs []*dnsmsg.Resource, err error) {
+	msg, err := dnsmsg.Parse(ks.Wire)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rr := range msg.Answer {
+		if rr.Type == dnsmsg.RRSIG {
+			sigs = append(sigs, rr)
+		} else {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, sigs, nil
+}
+
+func (z dnsZone) keySetKey(ks *keySet) []byte {
+	h := sha256.Sum256(append([]byte(ks.Domain+"\x00"), ks.Wire...))
+	return append(z[:], h[:16]...)
+}
+
+// listKeySets returns the key sets uploaded for z
+func (z dnsZone) listKeySets() ([]*keySet, error) {
+	var res []*keySet
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("dnssec-dnskey"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, v = c.Next() {
+			ks := &keySet{}
+			if err := gob.NewDecoder(bytes.NewReader(v[12:])).Decode(ks); err != nil {
+				return err
+			}
+			res = append(res, ks)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (z dnsZone) putKeySet(ks *keySet) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(ks); err != nil {
+		return err
+	}
+	return simpleSet([]byte("dnssec-dnskey"), z.keySetKey(ks), append(now(), buf.Bytes()...))
+}
+
+func (z dnsZone) deleteKeySet(ks *keySet) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("dnssec-dnskey"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(z.keySetKey(ks))
+	})
+}
+
+// checkKeySet returns the signatures of rrs, the records of a key set, made
+// by one of its SEP keys and valid at t, and the next time this changes: the
+// first expiration of these signatures, or inception of a later one
+func checkKeySet(rrs, sigs []*dnsmsg.Resource, t time.Time) (valid []*dnsmsg.Resource, next time.Time) {
+	var seps []*dnsmsg.Resource
+	for _, rr := range rrs {
+		if k, ok := rr.Data.(*dnsmsg.RDataDNSKEY); ok && k.Flags&dnssec.FlagSEP != 0 {
+			seps = append(seps, rr)
+		}
+	}
+	at := func(ts uint32) time.Time {
+		return time.Unix(int64(ts), 0)
+	}
+	for _, rr := range sigs {
+		sig := rr.Data.(*dnsmsg.RDataRRSIG)
+		var rrset []*dnsmsg.Resource
+		for _, r := range rrs {
+			if r.Type == sig.TypeCovered {
+				rrset = append(rrset, r)
+			}
+		}
+		for _, key := range seps {
+			if dnssec.VerifyRRSIG(rrset, sig, key, t) == nil {
+				valid = append(valid, rr)
+				if exp := at(sig.Expiration); next.IsZero() || exp.Before(next) {
+					next = exp
+				}
+				break
+			}
+			if inc := at(sig.Inception); inc.After(t) && dnssec.VerifyRRSIG(rrset, sig, key, inc) == nil {
+				if next.IsZero() || inc.Before(next) {
+					next = inc
+				}
+				break
+			}
+		}
+	}
+	return valid, next
+}
+
+// offlineKeys returns the records of the key set of z uploaded for domain
+// that matches the ZSKs published at t, with its signatures valid at t and
+// the time it has to be checked again. Key sets whose signatures have all
+// expired are deleted.
+func (z dnsZone) offlineKeys(domain string, zsks []*dnsmsg.RDataDNSKEY, t time.Time) (rrs, sigs []*dnsmsg.Resource, next time.Time, err error) {
+	sets, err := z.listKeySets()
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	// latest expiration of the DNSKEY signatures of the chosen set
+	var expiration uint32
+	for _, ks := range sets {
+		setRRs, setSigs, err := ks.records()
+		if err != nil {
+			return nil, nil, time.Time{}, err
+		}
+		expired := true
+		for _, rr := range setSigs {
+			if !time.Unix(int64(rr.Data.(*dnsmsg.RDataRRSIG).Expiration), 0).Before(t) {
+				expired = false
+			}
+		}
+		if expired {
+			if err := z.deleteKeySet(ks); err != nil {
+				return nil, nil, time.Time{}, err
+			}
+			continue
+		}
+		valid, setNext := checkKeySet(setRRs, setSigs, t)
+		if !setNext.IsZero() && (next.IsZero() || setNext.Before(next)) {
+			// a set of another domain or ZSK does no harm
+			next = setNext
+		}
+		if ks.Domain != domain || !sameZSKs(setRRs, zsks) {
+			continue
+		}
+		for _, rr := range valid {
+			sig := rr.Data.(*dnsmsg.RDataRRSIG)
+			if sig.TypeCovered == dnsmsg.DNSKEY && sig.Expiration > expiration {
+				expiration = sig.Expiration
+				rrs, sigs = setRRs, valid
+			}
+		}
+	}
+	if rrs == nil {
+		return nil, nil, time.Time{}, fmt.Errorf("no valid DNSKEY signatures uploaded for %s with the current ZSKs", domain)
+	}
+	return rrs, sigs, next, nil
+}
+
+// sameZSKs returns true if the keys of rrs without the SEP flag are zsks
+func sameZSKs(rrs []*dnsmsg.Resource, zsks []*dnsmsg.RDataDNSKEY) bool {
+	n := 0
+	for _, rr := range rrs {
+		k, ok := rr.Data.(*dnsmsg.RDataDNSKEY)
+		if !ok || k.Flags&dnssec.FlagSEP != 0 {
+			continue
+		}
+		n++
+		if !slices.ContainsFunc(zsks, func(z *dnsmsg.RDataDNSKEY) bool {
+			return z.Flags == k.Flags && z.Algorithm == k.Algorithm && bytes.Equal(z.PublicKey, k.PublicKey)
+		}) {
+			return false
+		}
+	}
+	return n == len(zsks)
+}
+
+// apiKey is a DNSSEC key of a zone, as listed by the API, without its
+// private key
+type apiKey struct {
+	ID        string    `json:"id"`
+	Tag       uint16    `json:"tag"`
+	KSK       bool      `json:"ksk"`
+	Algorithm uint8     `json:"algorithm"`
+	DNSKEY    string    `json:"dnskey"` // RDATA
+	Publish   time.Time `json:"publish"`
+	Active    time.Time `json:"active"`
+	Retire    time.Time `json:"retire,omitempty"`
+	Remove    time.Time `json:"remove,omitempty"`
+}
+
+// handleDnssecKeys lists the DNSSEC keys of the zone given in the "zone"
+// parameter, for instance to sign its ZSKs with an offline KSK
+func handleDnssecKeys(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+		return
+	}
+	z, _, sub, err := getZone(req.Context(), req.URL.Query().Get("zone"), nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+	keys, err := z.listKeys()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := []*apiKey{}
+	for _, k := range keys {
+		key := k.dnskey()
+		res = append(res, &apiKey{
+			ID:        k.ID.String(),
+			Tag:       dnssec.KeyTag(key),
+			KSK:       k.KSK,
+			Algorithm: k.Algorithm,
+			DNSKEY:    key.String(),
+			Publish:   k.Publish,
+			Active:    k.Active,
+			Retire:    k.Retire,
+			Remove:    k.Remove,
+		})
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
+
+// apiKeySet describes an uploaded key set
+type apiKeySet struct {
+	Domain     string    `json:"domain"`
+	Keys       []uint16  `json:"keys"`    // tags of the DNSKEY records
+	Signers    []uint16  `json:"signers"` // tags of the keys signing the DNSKEY RRset
+	Inception  time.Time `json:"inception"`
+	Expiration time.Time `json:"expiration"`
+	CDS        bool      `json:"cds,omitempty"` // CDS and CDNSKEY records are included
+}
+
+func (ks *keySet) describe() (*apiKeySet, error) {
+	rrs, sigs, err := ks.records()
+	if err != nil {
+		return nil, err
+	}
+	res := &apiKeySet{Domain: ks.Domain, Keys: []uint16{}, Signers: []uint16{}}
+	for _, rr := range rrs {
+		switch rd := rr.Data.(type) {
+		case *dnsmsg.RDataDNSKEY:
+			res.Keys = append(res.Keys, dnssec.KeyTag(rd))
+		default:
+			res.CDS = true
+		}
+	}
+	for _, rr := range sigs {
+		sig := rr.Data.(*dnsmsg.RDataRRSIG)
+		if sig.TypeCovered != dnsmsg.DNSKEY {
+			continue
+		}
+		if !slices.Contains(res.Signers, sig.KeyTag) {
+			res.Signers = append(res.Signers, sig.KeyTag)
+		}
+		inc, exp := time.Unix(int64(sig.Inception), 0), time.Unix(int64(sig.Expiration), 0)
+		if res.Inception.IsZero() || inc.Before(res.Inception) {
+			res.Inception = inc
+		}
+		if exp.After(res.Expiration) {
+			res.Expiration = exp
+		}
+	}
+	return res, nil
+}
+
+// handleDnssecDNSKEY lists (GET) or uploads (POST) the DNSKEY RRsets signed
+// offline for the zone given in the "zone" parameter, when its policy has an
+// offline KSK. Uploads are in master file format, with the DNSKEY records of
+// the KSKs and of the ZSKs listed by /api/dnssec-keys, and the RRSIG records
+// made by the KSKs. CDS and CDNSKEY records signed by the KSKs can be
+// included. Several sets can be uploaded ahead of time, the zone is served
+// with the valid set matching its current ZSKs.
+func handleDnssecDNSKEY(rw http.ResponseWriter, req *http.Request) {
+	z, domainRev, sub, err := getZone(req.Context(), req.URL.Query().Get("zone"), nil)
+	if err != nil || len(sub) > 0 {
+		http.Error(rw, "zone not found", http.StatusNotFound)
+		return
+	}
+	domain := string(reverseDnsName(domainRev))
+
+	switch req.Method {
+	case "GET":
+		sets, err := z.listKeySets()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res := []*apiKeySet{}
+		for _, ks := range sets {
+			if ks.Domain != domain {
+				continue
+			}
+			d, err := ks.describe()
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res = append(res, d)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(res)
+	case "POST":
+		origin := dnsmsg.Name(domain + ".")
+		rrs, err := dnszone.Parse(req.Body, string(origin))
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		var records, sigs []*dnsmsg.Resource
+		seps := 0
+		for _, rr := range rrs {
+			if !rr.Name.Equal(origin) {
+				http.Error(rw, fmt.Sprintf("record %s is not at the zone apex", rr.Name), http.StatusBadRequest)
+				return
+			}
+			switch rd := rr.Data.(type) {
+			case *dnsmsg.RDataDNSKEY:
+				if rd.Flags&dnssec.FlagSEP != 0 {
+					seps++
+				}
+				records = append(records, rr)
+			case *dnsmsg.RDataCDS, *dnsmsg.RDataCDNSKEY:
+				records = append(records, rr)
+			case *dnsmsg.RDataRRSIG:
+				switch rd.TypeCovered {
+				case dnsmsg.DNSKEY, dnsmsg.CDS, dnsmsg.CDNSKEY:
+				default:
+					http.Error(rw, fmt.Sprintf("unexpected signature of %s", rd.TypeCovered), http.StatusBadRequest)
+					return
+				}
+				sigs = append(sigs, rr)
+			default:
+				http.Error(rw, fmt.Sprintf("unexpected record type %s", rr.Type), http.StatusBadRequest)
+				return
+			}
+		}
+		if seps == 0 || len(sigs) == 0 {
+			http.Error(rw, "a KSK and its signatures are required", http.StatusBadRequest)
+			return
+		}
+		// each signature must be valid during its validity period
+		for _, rr := range sigs {
+			sig := rr.Data.(*dnsmsg.RDataRRSIG)
+			if valid, _ := checkKeySet(records, []*dnsmsg.Resource{rr}, time.Unix(int64(sig.Inception), 0)); len(valid) == 0 {
+				http.Error(rw, fmt.Sprintf("invalid signature of %s by key %d", sig.TypeCovered, sig.KeyTag), http.StatusBadRequest)
+				return
+			}
+		}
+
+		buf, err := (&dnsmsg.Message{Answer: append(records, sigs...), Compression: dnsmsg.CompressNone}).MarshalBinary()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ks := &keySet{Domain: domain, Wire: buf}
+		res, err := ks.describe()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(res.Signers) == 0 {
+			http.Error(rw, "the DNSKEY RRset is not signed", http.StatusBadRequest)
+			return
+		}
+		if !res.Expiration.After(clock.Now()) {
+			http.Error(rw, "the signatures have expired", http.StatusBadRequest)
+			return
+		}
+		if err := z.putKeySet(ks); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		queueSign(z)
+		audit(apiActor(req), "dnssec-dnskey", "zone:"+domain, nil, res)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(res)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
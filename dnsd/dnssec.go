@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+)
+
+// dnssecPolicy describes how a zone is signed, similar to BIND's
+// dnssec-policy. It is stored in the zone settings and read by the signing
+// and key rollover code. Durations are in seconds, 0 meaning the default
+// (or unlimited for key lifetimes).
+type dnssecPolicy struct {
+	Algorithm string `json:"algorithm,omitempty"` // mnemonic, see dnssecAlgorithms
+	KSKSize   int    `json:"ksk_size,omitempty"`  // key size in bits, RSA only
+	ZSKSize   int    `json:"zsk_size,omitempty"`  // key size in bits, RSA only
+
+	NSEC3           bool   `json:"nsec3,omitempty"` // NSEC3 instead of NSEC
+	NSEC3Iterations uint16 `json:"nsec3_iterations,omitempty"`
+	NSEC3SaltLength uint8  `json:"nsec3_salt_length,omitempty"`
+	NSEC3OptOut     bool   `json:"nsec3_opt_out,omitempty"`
+
+	SignaturesValidity uint32 `json:"signatures_validity,omitempty"`
+	SignaturesRefresh  uint32 `json:"signatures_refresh,omitempty"` // time before expiration when signatures are renewed
+	KSKLifetime        uint32 `json:"ksk_lifetime,omitempty"`
+	ZSKLifetime        uint32 `json:"zsk_lifetime,omitempty"`
+	DNSKEYTTL          uint32 `json:"dnskey_ttl,omitempty"`
+
+	// OfflineKSK keeps the KSKs out of dnsd: only ZSKs are generated, and
+	// the DNSKEY RRset is served with signatures made offline, uploaded
+	// through /api/dnssec-dnskey
+	OfflineKSK bool `json:"offline_ksk,omitempty"`
+}
+
+// dnssecAlgorithms lists the supported algorithms by mnemonic (RFC 8624)
+var dnssecAlgorithms = map[string]uint8{
+	"RSASHA256":       dnssec.RSASHA256,
+	"RSASHA512":       dnssec.RSASHA512,
+	"ECDSAP256SHA256": dnssec.ECDSAP256SHA256,
+	"ECDSAP384SHA384": dnssec.ECDSAP384SHA384,
+	"ED25519":         dnssec.ED25519,
+}
+
+// defaults, matching BIND's default policy
+const (
+	defaultDNSSECAlgorithm   = "ECDSAP256SHA256"
+	defaultRSAKeySize        = dnssec.DefaultRSAKeySize
+	defaultSignatureValidity = 14 * 24 * time.Hour
+	defaultSignatureRefresh  = 5 * 24 * time.Hour
+	defaultDNSKEYTTL         = 3600
+)
+
+var errInvalidPolicy = errors.New("invalid dnssec policy")
+
+// validate checks the policy values
+func (p *dnssecPolicy) validate() error {
+	if p.Algorithm != "" {
+		if _, ok := dnssecAlgorithms[p.Algorithm]; !ok {
+			return errInvalidPolicy
+		}
+	}
+	if !p.isRSA() && (p.KSKSize != 0 || p.ZSKSize != 0) {
+		// key size is given by the algorithm
+		return errInvalidPolicy
+	}
+	for _, sz := range []int{p.KSKSize, p.ZSKSize} {
+		if sz != 0 && (sz < 1024 || sz > 4096) {
+			return errInvalidPolicy
+		}
+	}
+	if !p.NSEC3 && (p.NSEC3Iterations != 0 || p.NSEC3SaltLength != 0 || p.NSEC3OptOut) {
+		return errInvalidPolicy
+	}
+	if p.NSEC3Iterations > 100 {
+		// RFC 9276 recommends 0, validators may treat more as insecure
+		return errInvalidPolicy
+	}
+	if p.refresh() >= p.validity() {
+		return errInvalidPolicy
+	}
+	if p.OfflineKSK && (p.KSKSize != 0 || p.KSKLifetime != 0) {
+		// offline KSKs are managed by their owner
+		return errInvalidPolicy
+	}
+	return nil
+}
+
+func (p *dnssecPolicy) algorithm() uint8 {
+	if p.Algorithm == "" {
+		return dnssecAlgorithms[defaultDNSSECAlgorithm]
+	}
+	return dnssecAlgorithms[p.Algorithm]
+}
+
+func (p *dnssecPolicy) isRSA() bool {
+	switch p.algorithm() {
+	case dnssec.RSASHA256, dnssec.RSASHA512:
+		return true
+	}
+	return false
+}
+
+// keySize returns the size of the KSK or ZSK, for RSA algorithms
+func (p *dnssecPolicy) keySize(ksk bool) int {
+	sz := p.ZSKSize
+	if ksk {
+		sz = p.KSKSize
+	}
+	if sz == 0 {
+		return defaultRSAKeySize
+	}
+	return sz
+}
+
+// validity returns the validity period of signatures
+func (p *dnssecPolicy) validity() time.Duration {
+	if p.SignaturesValidity == 0 {
+		return defaultSignatureValidity
+	}
+	return time.Duration(p.SignaturesValidity) * time.Second
+}
+
+// refresh returns how long before expiration signatures are renewed
+func (p *dnssecPolicy) refresh() time.Duration {
+	if p.SignaturesRefresh == 0 {
+		return defaultSignatureRefresh
+	}
+	return time.Duration(p.SignaturesRefresh) * time.Second
+}
+
+// lifetime returns the time after which a KSK or ZSK is rolled over, 0 if
+// keys are never rolled over
+func (p *dnssecPolicy) lifetime(ksk bool) time.Duration {
+	if ksk {
+		return time.Duration(p.KSKLifetime) * time.Second
+	}
+	return time.Duration(p.ZSKLifetime) * time.Second
+}
+
+func (p *dnssecPolicy) dnskeyTTL() uint32 {
+	if p.DNSKEYTTL == 0 {
+		return defaultDNSKEYTTL
+	}
+	return p.DNSKEYTTL
+}
+
+// nsec3Param returns the NSEC3 parameters of the zone, with a new random
+// salt, or nil if the zone uses NSEC
+func (p *dnssecPolicy) nsec3Param() (*dnsmsg.RDataNSEC3PARAM, error) {
+	if !p.NSEC3 {
+		return nil, nil
+	}
+	param := &dnsmsg.RDataNSEC3PARAM{Hash: dnssec.NSEC3SHA1, Iterations: p.NSEC3Iterations, Salt: make([]byte, p.NSEC3SaltLength)}
+	if p.NSEC3OptOut {
+		param.Flags = dnssec.NSEC3OptOut
+	}
+	if _, err := rand.Read(param.Salt); err != nil {
+		return nil, err
+	}
+	return param, nil
+}
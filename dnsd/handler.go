@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base32"
 	"errors"
 	"fmt"
@@ -11,14 +12,19 @@ import (
 	"github.com/KarpelesLab/dns/dnsmsg"
 )
 
-func performHandler(params []string, name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err error) {
+func performHandler(ctx context.Context, params []string, name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err error) {
 	if len(params) == 0 {
 		return nil, errors.New("handler missing")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	switch strings.ToLower(params[0]) {
 	case "base32addr":
 		return base32addrHandler(name, typ)
+	case "synth":
+		return synthHandler(queryName(ctx), params[1:], typ)
 	default:
 		return nil, fmt.Errorf("unsupported handler %s", params[0])
 	}
@@ -51,3 +57,103 @@ func base32addrHandler(name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err er
 	}
 	return
 }
+
+// synthHandler generates PTR records for whole reverse zones, and the
+// matching A/AAAA records, from a name template. params are the template,
+// where {ip} stands for the address with dashes (1-2-3-4, or 8 groups of 4
+// hex digits for IPv6), followed by the networks addresses are restricted to
+// (all if none). For example with "{ip}.dyn.example.net.", 4.3.2.1.in-addr.arpa
+// has PTR 1-2-3-4.dyn.example.net. which has A 1.2.3.4.
+func synthHandler(name string, params []string, typ dnsmsg.Type) (res []dnsmsg.RData, err error) {
+	if len(params) == 0 {
+		return nil, errors.New("synth: template missing")
+	}
+	tpl := strings.ToLower(strings.TrimSuffix(params[0], "."))
+
+	var ip net.IP
+	switch typ {
+	case dnsmsg.PTR:
+		ip = ptrAddr(name)
+	case dnsmsg.A, dnsmsg.AAAA:
+		ip = synthAddr(tpl, name)
+	default:
+		return nil, nil
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("synth: no address in %s", name)
+	}
+	if len(params) > 1 {
+		found := false
+		for _, n := range params[1:] {
+			_, ipn, err := net.ParseCIDR(n)
+			if err != nil {
+				return nil, fmt.Errorf("synth: %w", err)
+			}
+			if ipn.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("synth: %s not in networks", ip)
+		}
+	}
+
+	ip4 := ip.To4()
+	switch {
+	case typ == dnsmsg.PTR:
+		res = append(res, &dnsmsg.RDataLabel{Label: synthName(tpl, ip) + ".", Type: typ})
+	case typ == dnsmsg.A && ip4 != nil:
+		res = append(res, &dnsmsg.RDataIP{IP: ip4, Type: typ})
+	case typ == dnsmsg.AAAA && ip4 == nil:
+		res = append(res, &dnsmsg.RDataIP{IP: ip, Type: typ})
+	}
+	return
+}
+
+// synthName returns template tpl with {ip} replaced by ip
+func synthName(tpl string, ip net.IP) string {
+	var s string
+	if ip4 := ip.To4(); ip4 != nil {
+		s = fmt.Sprintf("%d-%d-%d-%d", ip4[0], ip4[1], ip4[2], ip4[3])
+	} else {
+		g := make([]string, 8)
+		for i := range g {
+			g[i] = fmt.Sprintf("%02x%02x", ip[2*i], ip[2*i+1])
+		}
+		s = strings.Join(g, "-")
+	}
+	return strings.Replace(tpl, "{ip}", s, 1)
+}
+
+// synthAddr returns the address in name if it matches template tpl, or nil
+func synthAddr(tpl, name string) net.IP {
+	prefix, suffix, ok := strings.Cut(tpl, "{ip}")
+	if !ok {
+		return nil
+	}
+	s, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return nil
+	}
+	if s, ok = strings.CutSuffix(s, suffix); !ok {
+		return nil
+	}
+	p := strings.Split(s, "-")
+	switch len(p) {
+	case 4:
+		ip := net.ParseIP(strings.Join(p, "."))
+		if ip == nil || ip.To4() == nil {
+			return nil
+		}
+		return ip.To4()
+	case 8:
+		for _, g := range p {
+			if len(g) != 4 {
+				return nil
+			}
+		}
+		return net.ParseIP(strings.Join(p, ":"))
+	}
+	return nil
+}
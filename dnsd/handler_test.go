@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestSynthHandler(t *testing.T) {
+	openTestDb(t)
+	const tpl = "host-{ip}.dyn.example.net."
+	for zone, types := range map[string][]dnsmsg.Type{
+		"192.in-addr.arpa":         {dnsmsg.PTR},
+		"8.b.d.0.1.0.0.2.ip6.arpa": {dnsmsg.PTR},
+		"dyn.example.net":          {dnsmsg.A, dnsmsg.AAAA},
+	} {
+		z, err := getOrCreateZone(zone)
+		if err != nil {
+			t.Fatalf("failed to create zone: %s", err)
+		}
+		for _, typ := range types {
+			z.setHandlerRecord("*", 3600, typ, "synth", tpl, "192.0.2.0/24", "2001:db8::/32")
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		typ    dnsmsg.Type
+		expect string
+	}{
+		{"1.2.0.192.in-addr.arpa.", dnsmsg.PTR, "1.2.0.192.in-addr.arpa. IN PTR 3600 host-192-0-2-1.dyn.example.net."},
+		{"host-192-0-2-1.dyn.example.net.", dnsmsg.A, "host-192-0-2-1.dyn.example.net. IN A 3600 192.0.2.1"},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", dnsmsg.PTR, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. IN PTR 3600 host-2001-0db8-0000-0000-0000-0000-0000-0001.dyn.example.net."},
+		{"HOST-2001-0db8-0000-0000-0000-0000-0000-0001.dyn.example.net.", dnsmsg.AAAA, "HOST-2001-0db8-0000-0000-0000-0000-0000-0001.dyn.example.net. IN AAAA 3600 2001:db8::1"},
+		{"host-192-0-2-1.dyn.example.net.", dnsmsg.AAAA, ""},
+	} {
+		res, err := handleQuery(context.Background(), dnsmsg.NewQuery(test.name, dnsmsg.IN, test.typ), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", test.name, err)
+		}
+		// relative owner names are completed from the zone
+		buf, err := res.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		res, _ = dnsmsg.Parse(buf)
+		var answer []string
+		for _, rr := range res.Answer {
+			answer = append(answer, rr.String())
+		}
+		if got := strings.Join(answer, ", "); got != test.expect || res.Bits.GetRCode() != dnsmsg.NoError {
+			t.Errorf("%s %s: got %q (%s), expected %q", test.name, test.typ, got, res.Bits.GetRCode(), test.expect)
+		}
+	}
+
+	// outside of the networks, or not matching the template
+	for _, name := range []string{"1.2.0.193.in-addr.arpa.", "1.0.0.192.in-addr.arpa.", "host-192-0-1-1.dyn.example.net.", "www.dyn.example.net."} {
+		typ := dnsmsg.PTR
+		if strings.HasSuffix(name, ".net.") {
+			typ = dnsmsg.A
+		}
+		res, _ := handleQuery(context.Background(), dnsmsg.NewQuery(name, dnsmsg.IN, typ), nil, nil)
+		if len(res.Answer) != 0 {
+			t.Errorf("%s: unexpected response %s", name, res)
+		}
+	}
+}
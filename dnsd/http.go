@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/KarpelesLab/shutdown"
+)
+
+var httpListen = flag.String("http-listen", "", "address (such as :80) of a plain HTTP listener for /dns-query, only for use behind a TLS terminating proxy (disabled if empty)")
+
+// initHttp starts the plain HTTP listener if enabled. It speaks the same
+// /dns-query protocol as the HTTPS listener but does not expose the API.
+func initHttp() {
+	if *httpListen == "" {
+		return
+	}
+
+	l, err := net.Listen("tcp", *httpListen)
+	if err != nil {
+		shutdown.Fatalf("failed to listen HTTP: %w", err)
+		return
+	}
+	serveHttp(l)
+}
+
+// serveHttp serves DNS over plain HTTP on connections accepted from l
+func serveHttp(l net.Listener) {
+	log.Printf("[http] WARNING: serving DNS over unencrypted HTTP on %s, queries and answers can be read and modified by anyone on the path", l.Addr())
+
+	srv := newDohServer(http.HandlerFunc(handleHttpReq))
+	err := srv.Serve(l)
+	log.Printf("[http] Serve failed: %s", err)
+}
+
+func handleHttpReq(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/dns-query" {
+		http.NotFound(rw, req)
+		return
+	}
+	handleHttpsReq(rw, req)
+}
@@ -1,22 +1,69 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/KarpelesLab/dns/dnsmsg"
 	"github.com/KarpelesLab/shutdown"
 )
 
+// settings specific to DNS over HTTPS, as encrypted transports need more
+// care than plain UDP and TCP
+var (
+	httpsPadBlock  = flag.Int("https-pad-block", dnsmsg.PadResponseBlock, "block size responses are padded to over HTTPS (0 to disable)")
+	httpsPadAlways = flag.Bool("https-pad-always", false, "pad all EDNS responses over HTTPS, not only responses to padded queries")
+	httpsEchoCase  = flag.Bool("https-echo-case", true, "echo the exact case of the query name in answers over HTTPS")
+
+	httpsMaxBody       = flag.Int64("https-max-body", 65535, "maximum size of DNS messages posted over HTTPS")
+	httpsMaxStreams    = flag.Int("https-max-streams", 100, "maximum number of queries processed concurrently per HTTPS connection")
+	httpsHeaderTimeout = flag.Duration("https-header-timeout", 5*time.Second, "deadline for reading request headers over HTTPS")
+	httpsIdleTimeout   = flag.Duration("https-idle-timeout", 2*time.Minute, "time after which idle HTTPS connections are closed")
+)
+
+// httpsConnKey is the context key of the per connection semaphore limiting
+// concurrent queries
+type httpsConnKey struct{}
+
+// newDohServer returns a HTTP server for h with the DNS over HTTPS limits
+// applied
+func newDohServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: *httpsHeaderTimeout,
+		IdleTimeout:       *httpsIdleTimeout,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, httpsConnKey{}, make(chan struct{}, max(*httpsMaxStreams, 1)))
+		},
+	}
+}
+
 func initHttps(ips []net.IP) {
+	srv := newHttpsServer()
+
+	if len(ips) == 0 {
+		httpsListen(srv, nil)
+		return
+	}
+
+	for _, ip := range ips {
+		httpsListen(srv, ip)
+	}
+}
+
+// newHttpsServer returns the DNS over HTTPS server, with its TLS settings
+func newHttpsServer() *http.Server {
 	cfg := &tls.Config{
 		NextProtos:               []string{"h2", "http/1.1"},
 		MinVersion:               tls.VersionTLS12,
@@ -32,19 +79,9 @@ func initHttps(ips []net.IP) {
 		},
 		Certificates: tlsLoadCertificate(),
 	}
-	srv := &http.Server{
-		TLSConfig: cfg,
-		Handler:   http.HandlerFunc(handleHttpsReq),
-	}
-
-	if len(ips) == 0 {
-		httpsListen(srv, nil)
-		return
-	}
-
-	for _, ip := range ips {
-		httpsListen(srv, ip)
-	}
+	srv := newDohServer(http.HandlerFunc(handleHttpsReq))
+	srv.TLSConfig = cfg
+	return srv
 }
 
 func httpsListen(srv *http.Server, ip net.IP) {
@@ -57,7 +94,12 @@ func httpsListen(srv *http.Server, ip net.IP) {
 			return
 		}
 	}
+	serveHttps(srv, l)
+}
 
+// serveHttps serves srv over TLS on connections accepted from l, which can
+// be any stream listener
+func serveHttps(srv *http.Server, l net.Listener) {
 	// one thread per cpu since we'll spawn extra threads per connected clients
 	cnt := runtime.NumCPU()
 
@@ -67,7 +109,7 @@ func httpsListen(srv *http.Server, ip net.IP) {
 	log.Printf("[https] listening on port %s with %d goroutines", l.Addr().String(), cnt)
 }
 
-func httpsThread(srv *http.Server, l *net.TCPListener) {
+func httpsThread(srv *http.Server, l net.Listener) {
 	tlsL := tls.NewListener(l, srv.TLSConfig)
 
 	err := srv.Serve(tlsL)
@@ -77,9 +119,25 @@ func httpsThread(srv *http.Server, l *net.TCPListener) {
 func handleHttpsReq(rw http.ResponseWriter, req *http.Request) {
 	switch req.URL.Path {
 	case "/dns-query":
+		// HTTP/2 streams of a connection are handled concurrently, limit
+		// how many queries each client can have in progress
+		if sem, ok := req.Context().Value(httpsConnKey{}).(chan struct{}); ok {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-req.Context().Done():
+				return
+			}
+		}
+
 		// can be GET or POST
 		switch req.Method {
 		case "GET":
+			if strings.Contains(req.Header.Get("Accept"), dnsmsg.DNSJSONType) || req.URL.Query().Get("ct") == dnsmsg.DNSJSONType {
+				// /dns-query?name=example.com&type=A
+				handleHttpsJSON(rw, req)
+				return
+			}
 			// /dns-query?dns=AAAA...
 			dns := req.URL.Query().Get("dns")
 			buf, err := base64.RawURLEncoding.DecodeString(dns)
@@ -95,10 +153,14 @@ func handleHttpsReq(rw http.ResponseWriter, req *http.Request) {
 				http.Error(rw, "bad content-type, should be application/dns-message", http.StatusBadRequest)
 				return
 			}
-			lr := &io.LimitedReader{req.Body, 512} // limit read to 512 bytes
-			buf, err := ioutil.ReadAll(lr)
+			buf, err := io.ReadAll(http.MaxBytesReader(rw, req.Body, *httpsMaxBody))
 			if err != nil {
-				http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+				code := http.StatusBadRequest
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					code = http.StatusRequestEntityTooLarge
+				}
+				http.Error(rw, fmt.Sprintf("failed to read: %s", err), code)
 				return
 			}
 			handleHttpsPacket(buf, rw, req)
@@ -108,7 +170,7 @@ func handleHttpsReq(rw http.ResponseWriter, req *http.Request) {
 			return
 		}
 	default:
-		if strings.HasPrefix(req.URL.Path, "/api/") {
+		if *httpsApi && strings.HasPrefix(req.URL.Path, "/api/") {
 			handleApi(rw, req)
 			return
 		}
@@ -117,6 +179,16 @@ func handleHttpsReq(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// httpsQueryContext returns the context of a query received over HTTPS,
+// with the HTTPS specific settings applied
+func httpsQueryContext(req *http.Request) context.Context {
+	ctx := req.Context()
+	if !*httpsEchoCase {
+		ctx = context.WithValue(ctx, noEchoCaseKey{}, true)
+	}
+	return ctx
+}
+
 func handleHttpsPacket(buf []byte, rw http.ResponseWriter, req *http.Request) {
 	// get localADdr (type net.Addr)
 	laddr := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
@@ -125,14 +197,17 @@ func handleHttpsPacket(buf []byte, rw http.ResponseWriter, req *http.Request) {
 	raddr := net.Addr(nil)
 
 	// parse pkg
-	msg, err := dnsmsg.Parse(buf)
+	msg, err := dnsmsg.ParseWithOptions(buf, queryParseOptions())
 	if err != nil {
 		log.Printf("[https] failed to parse msg from %s: %s", raddr, err)
 		http.Error(rw, fmt.Sprintf("failed to parse: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	res, err := handleQuery(msg, laddr, raddr)
+	// RFC 8467: pad responses to padded queries on encrypted transports
+	padded := msg.GetOpt(dnsmsg.OptPadding) != nil || *httpsPadAlways
+
+	res, err := handleQuery(httpsQueryContext(req), msg, laddr, raddr)
 	if err != nil {
 		log.Printf("[https] failed to respond to %s: %s", raddr, err)
 		return
@@ -142,6 +217,12 @@ func handleHttpsPacket(buf []byte, rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if padded && res.HasEDNS && *httpsPadBlock > 0 {
+		if err := res.PadTo(*httpsPadBlock); err != nil {
+			log.Printf("[https] failed to pad response to %s: %s", raddr, err)
+		}
+	}
+
 	buf, err = res.MarshalBinary()
 	if err != nil {
 		log.Printf("[https] failed to make response to %s: %s", raddr, err)
@@ -161,3 +242,39 @@ func handleHttpsPacket(buf []byte, rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 }
+
+// handleHttpsJSON answers queries in the dns-json format used by the JSON
+// APIs of public resolvers
+func handleHttpsJSON(rw http.ResponseWriter, req *http.Request) {
+	laddr, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	raddr := net.Addr(nil)
+
+	msg, err := dnsmsg.ParseDNSJSONQuery(req.URL.Query())
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("invalid query: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	res, err := handleQuery(httpsQueryContext(req), msg, laddr, raddr)
+	if err != nil {
+		log.Printf("[https] failed to respond to %s: %s", raddr, err)
+		http.Error(rw, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		http.Error(rw, "no response", http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := res.MarshalDNSJSON()
+	if err != nil {
+		log.Printf("[https] failed to make response to %s: %s", raddr, err)
+		http.Error(rw, "query failed", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", dnsmsg.DNSJSONType)
+	if _, err := rw.Write(buf); err != nil {
+		log.Printf("[https] failed to write to %s: %s", raddr, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// benchZone sets up a zone answering www.example.com for the benchmarks,
+// and silences the per query logs
+func benchZone(b *testing.B) []byte {
+	b.Helper()
+	openTestDb(b)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		b.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(out) })
+
+	q, err := dnsmsg.NewQuery("www.example.com.", dnsmsg.IN, dnsmsg.A).MarshalBinary()
+	if err != nil {
+		b.Fatalf("failed to make query: %s", err)
+	}
+	return q
+}
+
+func TestHttpsMaxBody(t *testing.T) {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/dns-query", strings.NewReader(strings.Repeat("x", int(*httpsMaxBody)+1)))
+	req.Header.Set("Content-Type", "application/dns-message")
+	handleHttpsReq(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rw.Code)
+	}
+}
+
+func TestHttpsEchoCase(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	// dns-json answers show the names as returned, while compression in wire
+	// format always points answers to the name of the question
+	defer func(v bool) { *httpsEchoCase = v }(*httpsEchoCase)
+	for _, echo := range []bool{true, false} {
+		*httpsEchoCase = echo
+		rw := httptest.NewRecorder()
+		handleHttpsReq(rw, httptest.NewRequest("GET", "/dns-query?name=WwW.eXample.com&type=A&ct="+dnsmsg.DNSJSONType, nil))
+		expect := `"Answer":[{"name":"www.example.com."`
+		if echo {
+			expect = `"Answer":[{"name":"WwW.eXample.com."`
+		}
+		if !strings.Contains(rw.Body.String(), expect) {
+			t.Errorf("echo %v: unexpected answer %s", echo, rw.Body)
+		}
+	}
+}
+
+// BenchmarkDoH measures queries over HTTP/2 with TLS, to compare with
+// BenchmarkDo53
+func BenchmarkDoH(b *testing.B) {
+	q := benchZone(b)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(handleHttpsReq))
+	srv.Config = newDohServer(srv.Config.Handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := srv.Client()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := client.Post(srv.URL+"/dns-query", "application/dns-message", bytes.NewReader(q))
+			if err != nil {
+				b.Errorf("query failed: %s", err)
+				return
+			}
+			buf, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if _, err := dnsmsg.Parse(buf); err != nil {
+				b.Errorf("invalid response: %s", err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkDo53 measures queries over UDP
+func BenchmarkDo53(b *testing.B) {
+	q := benchZone(b)
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to listen: %s", err)
+	}
+	defer l.Close()
+	for i := 0; i < 4; i++ {
+		go udpThread(l)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		c, err := net.Dial("udp", l.LocalAddr().String())
+		if err != nil {
+			b.Errorf("failed to connect: %s", err)
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 1500)
+		for pb.Next() {
+			if _, err := c.Write(q); err != nil {
+				b.Errorf("query failed: %s", err)
+				return
+			}
+			n, err := c.Read(buf)
+			if err != nil {
+				b.Errorf("query failed: %s", err)
+				return
+			}
+			if _, err := dnsmsg.Parse(buf[:n]); err != nil {
+				b.Errorf("invalid response: %s", err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+// Zones can be imported from other providers. Route53 and Cloudflare JSON
+// exports are converted to master file format, then all formats go through
+// dnszone. Provider specific ALIAS records and apex CNAMEs (flattened by
+// the provider) cannot be served by dnsd at the apex, since we do not
+// resolve names; elsewhere they become CNAMEs.
+
+// route53 holds the output of "aws route53 list-resource-record-sets"
+type route53 struct {
+	ResourceRecordSets []struct {
+		Name            string
+		Type            string
+		TTL             uint32
+		SetIdentifier   string
+		ResourceRecords []struct {
+			Value string
+		}
+		AliasTarget *struct {
+			DNSName string
+		}
+	}
+}
+
+// cloudflareRecord is a record as returned by the Cloudflare API
+type cloudflareRecord struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      uint32 `json:"ttl"`
+	Priority *int   `json:"priority"`
+	Proxied  bool   `json:"proxied"`
+}
+
+// zoneImport converts a provider export into master file text
+type zoneImport struct {
+	origin   string // zone name with trailing dot
+	lines    []string
+	warnings []string
+}
+
+func (imp *zoneImport) warn(format string, args ...any) {
+	imp.warnings = append(imp.warnings, fmt.Sprintf(format, args...))
+}
+
+func (imp *zoneImport) add(name string, ttl uint32, typ, value string) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	if typ == "ALIAS" || (typ == "CNAME" && dnsmsg.EqualFoldASCII(name, imp.origin)) {
+		if dnsmsg.EqualFoldASCII(name, imp.origin) {
+			imp.warn("%s %s %s: alias at zone apex is not supported, skipped", name, typ, value)
+			return
+		}
+		typ = "CNAME"
+	}
+	imp.lines = append(imp.lines, fmt.Sprintf("%s %d IN %s %s", name, ttl, typ, value))
+}
+
+// route53Name decodes the octal escapes used by Route53 in names (\052 for *)
+func route53Name(s string) string {
+	var res []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				if v > ' ' && v <= '~' && v != '.' && v != '\\' {
+					res = append(res, byte(v))
+				} else {
+					res = append(res, fmt.Sprintf("\\%03d", v)...)
+				}
+				i += 3
+				continue
+			}
+		}
+		res = append(res, s[i])
+	}
+	return string(res)
+}
+
+func (imp *zoneImport) route53(r io.Reader) error {
+	var data route53
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	for _, rrs := range data.ResourceRecordSets {
+		name := route53Name(rrs.Name)
+		if rrs.SetIdentifier != "" {
+			imp.warn("%s %s: routing policy %q ignored, values are merged", name, rrs.Type, rrs.SetIdentifier)
+		}
+		if rrs.AliasTarget != nil {
+			imp.add(name, 300, "ALIAS", rrs.AliasTarget.DNSName)
+			continue
+		}
+		for _, v := range rrs.ResourceRecords {
+			imp.add(name, rrs.TTL, rrs.Type, v.Value)
+		}
+	}
+	return nil
+}
+
+func (imp *zoneImport) cloudflare(r io.Reader) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// accept both the API response and the bare list of records
+	var recs []cloudflareRecord
+	if err := json.Unmarshal(buf, &recs); err != nil {
+		var resp struct {
+			Result []cloudflareRecord `json:"result"`
+		}
+		if err := json.Unmarshal(buf, &resp); err != nil {
+			return err
+		}
+		recs = resp.Result
+	}
+
+	for _, rec := range recs {
+		ttl := rec.TTL
+		if ttl <= 1 {
+			// "automatic"
+			ttl = 300
+		}
+		if rec.Proxied {
+			imp.warn("%s %s: record was proxied by Cloudflare, imported with its origin value", rec.Name, rec.Type)
+		}
+		value := rec.Content
+		switch rec.Type {
+		case "TXT", "SPF":
+			if !strings.HasPrefix(value, "\"") {
+				value = dnsmsg.NewTXT(value).String()
+			}
+		case "MX", "SRV", "URI":
+			if rec.Priority != nil {
+				value = strconv.Itoa(*rec.Priority) + " " + value
+			}
+		}
+		switch rec.Type {
+		case "CNAME", "NS", "PTR", "DNAME", "ALIAS", "MX", "SRV":
+			// names are fully qualified, without the final dot
+			if !strings.HasSuffix(value, ".") {
+				value += "."
+			}
+		}
+		imp.add(rec.Name, ttl, rec.Type, value)
+	}
+	return nil
+}
+
+// importRecords parses an export in the given format (bind, route53 or
+// cloudflare) and returns the records for the zone
+func importRecords(origin, format string, r io.Reader) ([]*dnsmsg.Resource, []string, error) {
+	imp := &zoneImport{origin: strings.TrimSuffix(origin, ".") + "."}
+
+	var err error
+	switch format {
+	case "", "bind":
+		rrs, err := dnszone.Parse(r, imp.origin)
+		return rrs, nil, err
+	case "route53":
+		err = imp.route53(r)
+	case "cloudflare":
+		err = imp.cloudflare(r)
+	default:
+		return nil, nil, errors.New("unsupported format")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rrs, err := dnszone.Parse(strings.NewReader(strings.Join(imp.lines, "\n")), imp.origin)
+	return rrs, imp.warnings, err
+}
+
+// storeImport groups rrs into record sets and stores them in zone z. The SOA
+// record is skipped as dnsd maintains its own.
+func storeImport(z dnsZone, origin string, rrs []*dnsmsg.Resource) (int, []string, error) {
+	type setKey struct {
+		name string
+		typ  dnsmsg.Type
+	}
+	var warnings []string
+	var order []setKey
+	sets := make(map[setKey]*Record)
+	origin = strings.TrimSuffix(origin, ".") + "."
+
+	for _, rr := range rrs {
+		if rr.Type == dnsmsg.SOA {
+			continue
+		}
+		name, ok := relativeName(string(rr.Name), origin)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s %s: outside of zone, skipped", rr.Name, rr.Type))
+			continue
+		}
+		value := rr.Data.String()
+		if _, err := dnsmsg.RDataFromString(rr.Type, value); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s %s: type not supported, skipped", rr.Name, rr.Type))
+			continue
+		}
+		k := setKey{name, rr.Type}
+		rec, ok := sets[k]
+		if !ok {
+			rec = &Record{Type: rr.Type, TTL: rr.TTL}
+			sets[k] = rec
+			order = append(order, k)
+		}
+		rec.TTL = min(rec.TTL, rr.TTL)
+		rec.Value = append(rec.Value, value)
+	}
+
+	for _, k := range order {
+		if err := z.putRecord(k.name, sets[k]); err != nil {
+			return 0, warnings, err
+		}
+	}
+	return len(order), warnings, nil
+}
+
+// relativeName returns the fully qualified name n relative to origin, as
+// used in record keys
+func relativeName(n, origin string) (string, bool) {
+	switch name := dnsmsg.Name(n); {
+	case name.Equal(dnsmsg.Name(origin)):
+		return "", true
+	case name.IsSubDomainOf(dnsmsg.Name(origin)):
+		return n[:len(n)-len(origin)-1], true
+	}
+	return "", false
+}
+
+// handleZoneImport imports records posted in the request body into the zone
+// given in the "zone" parameter, creating it if needed. The "format"
+// parameter selects the export format: bind (default), route53 or
+// cloudflare.
+func handleZoneImport(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+		return
+	}
+	q := req.URL.Query()
+	zone := strings.TrimSuffix(q.Get("zone"), ".")
+	if zone == "" {
+		http.Error(rw, "zone is required", http.StatusBadRequest)
+		return
+	}
+
+	z, _, sub, err := getZone(req.Context(), zone, nil)
+	if err == os.ErrNotExist {
+		z, err = getOrCreateZone(zone)
+	} else if err == nil && len(sub) > 0 {
+		err = errors.New("name is part of another zone")
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rrs, warnings, err := importRecords(zone, q.Get("format"), &io.LimitedReader{R: req.Body, N: 16 << 20})
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("failed to parse: %s", err), http.StatusBadRequest)
+		return
+	}
+	n, w, err := storeImport(z, zone, rrs)
+	warnings = append(warnings, w...)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := struct {
+		Records  int      `json:"records"`
+		Warnings []string `json:"warnings,omitempty"`
+	}{n, warnings}
+	audit(apiActor(req), "zone-import", "zone:"+zone, nil, res)
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZoneImport(t *testing.T) {
+	openTestDb(t)
+	c := newManualClock(time.Date(2024, 7, 29, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+
+	tests := []struct {
+		format   string
+		body     string
+		warnings int
+		expect   string
+	}{
+		{
+			"route53",
+			`{"ResourceRecordSets":[
+				{"Name":"example.com.","Type":"SOA","TTL":900,"ResourceRecords":[{"Value":"ns-1.awsdns-00.com. awsdns-hostmaster.amazon.com. 1 7200 900 1209600 86400"}]},
+				{"Name":"example.com.","Type":"MX","TTL":300,"ResourceRecords":[{"Value":"10 mail.example.com."},{"Value":"20 mail2.example.com."}]},
+				{"Name":"example.com.","Type":"TXT","TTL":300,"ResourceRecords":[{"Value":"\"v=spf1 -all\""}]},
+				{"Name":"\\052.example.com.","Type":"A","TTL":60,"ResourceRecords":[{"Value":"192.0.2.1"}]},
+				{"Name":"cdn.example.com.","Type":"A","AliasTarget":{"HostedZoneId":"Z2FDTNDATAQYW2","DNSName":"d111111abcdef8.cloudfront.net."}},
+				{"Name":"example.com.","Type":"A","AliasTarget":{"HostedZoneId":"Z2FDTNDATAQYW2","DNSName":"d111111abcdef8.cloudfront.net."}}
+			]}`,
+			1,
+			`$ORIGIN example.com.
+$TTL 300
+@	60	IN	SOA	ns1.example.com. admin.example.com. 20240729 900 900 1800 60
+@	IN	MX	10 mail.example.com.
+@	IN	MX	20 mail2.example.com.
+@	IN	TXT	"v=spf1 -all"
+*	60	IN	A	192.0.2.1
+cdn	IN	CNAME	d111111abcdef8.cloudfront.net.
+`,
+		},
+		{
+			"cloudflare",
+			`{"result":[
+				{"name":"example.org","type":"CNAME","content":"app.herokudns.com","ttl":1},
+				{"name":"example.org","type":"MX","content":"mx.example.org","priority":5,"ttl":3600},
+				{"name":"www.example.org","type":"A","content":"192.0.2.2","ttl":1,"proxied":true},
+				{"name":"example.org","type":"TXT","content":"hello world","ttl":3600},
+				{"name":"txt.example.org","type":"TXT","content":"say \"hi\"\t\u00e9","ttl":3600}
+			],"success":true}`,
+			2,
+			`$ORIGIN example.org.
+$TTL 3600
+@	60	IN	SOA	ns1.example.org. admin.example.org. 20240729 900 900 1800 60
+@	IN	MX	5 mx.example.org.
+@	IN	TXT	"hello world"
+txt	IN	TXT	"say \"hi\"\009\195\169"
+www	300	IN	A	192.0.2.2
+`,
+		},
+		{
+			"bind",
+			`$ORIGIN example.net.
+$TTL 600
+@	IN	SOA	ns.example.net. admin.example.net. 1 2 3 4 5
+	IN	NS	ns.example.net.
+ns	IN	A	192.0.2.3
+other.example.	IN	A	192.0.2.4
+`,
+			1,
+			`$ORIGIN example.net.
+$TTL 600
+@	60	IN	SOA	ns1.example.net. admin.example.net. 20240729 900 900 1800 60
+@	IN	NS	ns.example.net.
+ns	IN	A	192.0.2.3
+`,
+		},
+	}
+
+	for _, test := range tests {
+		zone := "example." + map[string]string{"route53": "com", "cloudflare": "org", "bind": "net"}[test.format]
+
+		rw := httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("POST", "/api/zone-import?zone="+zone+"&format="+test.format, strings.NewReader(test.body)))
+		if rw.Code != 200 {
+			t.Errorf("failed to import %s: %s", test.format, rw.Body)
+			continue
+		}
+		var res struct {
+			Warnings []string `json:"warnings"`
+		}
+		json.NewDecoder(rw.Body).Decode(&res)
+		if len(res.Warnings) != test.warnings {
+			t.Errorf("unexpected warnings for %s: %q", test.format, res.Warnings)
+		}
+
+		rw = httptest.NewRecorder()
+		handleApi(rw, httptest.NewRequest("GET", "/api/zone-export?zone="+zone, nil))
+		if rw.Body.String() != test.expect {
+			t.Errorf("unexpected export after %s import:\n%s", test.format, rw.Body)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/zone-import?zone=example.com&format=xml", strings.NewReader("<a/>")))
+	if rw.Code != 400 {
+		t.Errorf("unsupported format was accepted")
+	}
+
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/zone-import?format=bind", strings.NewReader("@ IN A 192.0.2.1")))
+	if rw.Code != 400 {
+		t.Errorf("import without zone was accepted")
+	}
+}
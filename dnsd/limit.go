@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var (
+	maxRecords      = flag.Int("max-records", 0, "maximum number of answer records in a response (0 for no limit), can be overridden per zone")
+	recordLimitMode = flag.String("record-limit-mode", limitSubset, "how to handle responses over the record limit: subset or truncate")
+)
+
+const (
+	// return a random subset of the records
+	limitSubset = "subset"
+	// return the first records and set TC so UDP clients retry over TCP,
+	// where a subset is returned
+	limitTruncate = "truncate"
+)
+
+// recordLimit returns the limit that applies to answers from zone z
+func recordLimit(z dnsZone) (int, string) {
+	limit, mode := *maxRecords, *recordLimitMode
+	if s, err := z.getSettings(); err == nil {
+		if s.MaxRecords > 0 {
+			limit = s.MaxRecords
+		}
+		if s.LimitMode != "" {
+			mode = s.LimitMode
+		}
+	}
+	return limit, mode
+}
+
+// limitValues reduces the list of values of a record to the limit of the
+// query being processed, so we never decode more values than needed
+func limitValues(ctx context.Context, values []string) []string {
+	st := getQueryState(ctx)
+	if st == nil || st.maxRecords <= 0 || len(values) <= st.maxRecords {
+		return values
+	}
+	st.overLimit = true
+	if st.limitMode == limitTruncate {
+		return values[:st.maxRecords]
+	}
+
+	// pick a random subset, without modifying the original list
+	res := make([]string, len(values))
+	copy(res, values)
+	rand.Shuffle(len(res), func(i, j int) { res[i], res[j] = res[j], res[i] })
+	return res[:st.maxRecords]
+}
+
+// applyRecordLimit enforces the record limit on the answer section of a
+// response
+func applyRecordLimit(st *queryState, pkt *dnsmsg.Message, udp bool) {
+	if st.maxRecords <= 0 {
+		return
+	}
+	if len(pkt.Answer) > st.maxRecords {
+		st.overLimit = true
+		if st.limitMode != limitTruncate {
+			rand.Shuffle(len(pkt.Answer), func(i, j int) { pkt.Answer[i], pkt.Answer[j] = pkt.Answer[j], pkt.Answer[i] })
+		}
+		pkt.Answer = pkt.Answer[:st.maxRecords]
+	}
+	if st.overLimit && udp && st.limitMode == limitTruncate {
+		pkt.Bits.SetTrunc(true)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFlag holds the -listen options, service=address
+type listenFlag []string
+
+func (f *listenFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *listenFlag) Set(v string) error {
+	if _, _, err := parseListen(v); err != nil {
+		return err
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+var listenSpecs = func() *listenFlag {
+	f := &listenFlag{}
+	flag.Var(f, "listen", "socket to serve a service on, as service=address with service one of udp, tcp, https or http and address host:port, unix:path or fd:N (inherited descriptor). Can be repeated, and replaces the default listeners on ports 53 and 853")
+	return f
+}()
+
+// listenServices are the services that can be given to -listen
+var listenServices = map[string]bool{"udp": true, "tcp": true, "https": true, "http": true}
+
+// listener is a socket of a service, given by -listen or systemd
+type listener struct {
+	service string
+	l       net.Listener   // stream services
+	pc      net.PacketConn // udp
+}
+
+// parseListen splits a -listen value into service and address
+func parseListen(spec string) (service, addr string, err error) {
+	service, addr, ok := strings.Cut(spec, "=")
+	if !ok || !listenServices[service] || addr == "" {
+		return "", "", fmt.Errorf("invalid listener %q, expected service=address with service one of udp, tcp, https or http", spec)
+	}
+	return service, addr, nil
+}
+
+// openListener opens addr, host:port, unix:path or fd:N, for service
+func openListener(service, addr string) (*listener, error) {
+	res := &listener{service: service}
+
+	if n, ok := strings.CutPrefix(addr, "fd:"); ok {
+		fd, err := strconv.Atoi(n)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor %q", n)
+		}
+		return fileListener(service, os.NewFile(uintptr(fd), addr))
+	}
+
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// remove a socket left over by a previous instance
+		if st, err := os.Lstat(path); err == nil && st.Mode()&fs.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		var err error
+		if service == "udp" {
+			res.pc, err = net.ListenPacket("unixgram", path)
+		} else {
+			res.l, err = net.Listen("unix", path)
+		}
+		return res, err
+	}
+
+	var err error
+	if service == "udp" {
+		cfg := &net.ListenConfig{Control: udpControl}
+		res.pc, err = cfg.ListenPacket(context.Background(), "udp", addr)
+	} else {
+		res.l, err = net.Listen("tcp", addr)
+	}
+	return res, err
+}
+
+// fileListener returns a listener for service on f, an inherited socket
+func fileListener(service string, f *os.File) (*listener, error) {
+	defer f.Close() // the listener works on a copy
+	res := &listener{service: service}
+	var err error
+	if service == "udp" {
+		res.pc, err = net.FilePacketConn(f)
+	} else {
+		res.l, err = net.FileListener(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name(), err)
+	}
+	return res, nil
+}
+
+// initListeners serves the sockets given by systemd and -listen, and returns
+// false if there are none, the default listeners being used instead
+func initListeners() (bool, error) {
+	ls, err := systemdListeners()
+	if err != nil {
+		return false, err
+	}
+	for _, spec := range *listenSpecs {
+		service, addr, _ := parseListen(spec)
+		l, err := openListener(service, addr)
+		if err != nil {
+			return false, fmt.Errorf("failed to listen on %s: %w", spec, err)
+		}
+		ls = append(ls, l)
+	}
+	if len(ls) == 0 {
+		return false, nil
+	}
+
+	var srv *http.Server
+	for _, l := range ls {
+		switch l.service {
+		case "udp":
+			serveUdp(l.pc)
+		case "tcp":
+			serveTcp(l.l)
+		case "https":
+			if srv == nil {
+				srv = newHttpsServer()
+			}
+			serveHttps(srv, l.l)
+		case "http":
+			go serveHttp(l.l)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestParseListen(t *testing.T) {
+	var tests = []struct {
+		spec    string
+		service string
+		addr    string
+		ok      bool
+	}{
+		{"udp=:53", "udp", ":53", true},
+		{"tcp=unix:/run/dnsd.sock", "tcp", "unix:/run/dnsd.sock", true},
+		{"https=fd:3", "https", "fd:3", true},
+		{"dns=:53", "", "", false},
+		{"udp=", "", "", false},
+		{":53", "", "", false},
+	}
+	for _, test := range tests {
+		service, addr, err := parseListen(test.spec)
+		if (err == nil) != test.ok || service != test.service || addr != test.addr {
+			t.Errorf("%s: got %q %q %v", test.spec, service, addr, err)
+		}
+	}
+}
+
+func TestOpenListener(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	path := filepath.Join(t.TempDir(), "dns.sock")
+	l, err := openListener("tcp", "unix:"+path)
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.l.Close()
+	serveTcp(l.l)
+	testStreamQuery(t, "unix", path)
+}
+
+// testStreamQuery queries www.example.com over a stream connection to addr
+func testStreamQuery(t *testing.T, network, addr string) {
+	t.Helper()
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	q := dnsmsg.NewQuery("www.example.com.", dnsmsg.IN, dnsmsg.A)
+	if err := dnsmsg.WriteStreamMessage(c, q); err != nil {
+		t.Fatalf("failed to send query: %s", err)
+	}
+	res, err := dnsmsg.ReadStreamMessage(c)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+	if res.ID != q.ID || len(res.Answer) != 1 {
+		t.Errorf("unexpected response %s", res)
+	}
+}
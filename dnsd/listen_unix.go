@@ -0,0 +1,49 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// systemdListeners returns the sockets passed by systemd socket activation
+// (sd_listen_fds). The service of each socket is given by its
+// FileDescriptorName, or is udp or tcp according to the type of socket.
+func systemdListeners() ([]*listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// not inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var res []*listener
+	for i := 0; i < n; i++ {
+		fd := 3 + i // SD_LISTEN_FDS_START
+		syscall.CloseOnExec(fd)
+		service := ""
+		if i < len(names) && listenServices[names[i]] {
+			service = names[i]
+		} else if typ, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE); err == nil && typ == syscall.SOCK_DGRAM {
+			service = "udp"
+		} else {
+			service = "tcp"
+		}
+		l, err := fileListener(service, os.NewFile(uintptr(fd), "systemd:"+strconv.Itoa(fd)))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestOpenListenerFd(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	tl, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer tl.Close()
+	f, err := tl.File()
+	if err != nil {
+		t.Fatalf("failed to get file: %s", err)
+	}
+	// the descriptor is handed over, as if inherited
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to dup: %s", err)
+	}
+
+	l, err := openListener("tcp", "fd:"+strconv.Itoa(fd))
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.l.Close()
+	serveTcp(l.l)
+	testStreamQuery(t, "tcp", tl.Addr().String())
+}
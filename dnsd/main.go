@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
 	"os"
@@ -10,6 +11,7 @@ import (
 )
 
 func main() {
+	flag.Parse()
 	shutdown.SetupSignals()
 	log.Printf("[main] Initializing dnsd...")
 	goupd.AutoUpdate(false)
@@ -23,11 +25,27 @@ func main() {
 
 	log.Printf("[main] API access key for this instance is: %s", getApiKey())
 
-	ips := getIps()
+	go auditPruneThread()
+	go dhcpThread()
 
-	go initUdp(ips)
-	go initTcp(ips)
-	go initHttps(ips)
+	// signed zones are ready before the first query
+	initDnssec()
+	go dnssecThread()
+	go cdsThread()
+
+	// sockets given by systemd or -listen replace the default listeners
+	if ok, err := initListeners(); err != nil {
+		log.Printf("[main] %s", err)
+		os.Exit(1)
+	} else if !ok {
+		ips := getIps()
+
+		go initUdp(ips)
+		go initTcp(ips)
+		go initHttps(ips)
+	}
+	go initHttp()
+	go initApiSocket()
 
 	shutdown.Wait()
 
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Zones can be published to cloud providers: dnsd is the source of truth
+// and every record change is pushed to the provider, which serves the zone
+// publicly. SOA and apex NS records are managed by the provider and are not
+// published, and records served by handlers have no static value.
+
+const publishAttempts = 3
+
+var errPublishFailed = errors.New("provider rejected the change")
+
+// publishTarget is a zone at a cloud provider kept in sync with a dnsd zone
+type publishTarget struct {
+	ID       string `json:"id"`
+	Zone     string `json:"zone"`             // dnsd zone id
+	Domain   string `json:"domain"`           // zone name, without final dot
+	Provider string `json:"provider"`         // route53 or cloudflare
+	RemoteID string `json:"remote_id"`        // hosted zone id (route53) or zone id (cloudflare)
+	KeyID    string `json:"key_id,omitempty"` // access key id (route53)
+	Secret   string `json:"secret,omitempty"` // secret access key (route53) or API token (cloudflare)
+}
+
+// publishSet is a record set as sent to providers
+type publishSet struct {
+	Name   string // fully qualified, with final dot
+	Type   dnsmsg.Type
+	TTL    uint32
+	Values []dnsmsg.RData // none if the record set was deleted
+}
+
+type publisher interface {
+	publish(ctx context.Context, t *publishTarget, sets []*publishSet) error
+}
+
+var publishers = map[string]publisher{
+	"route53":    route53Publisher{},
+	"cloudflare": cloudflarePublisher{},
+}
+
+type publishJob struct {
+	target *publishTarget
+	name   string // relative to the zone
+	typ    dnsmsg.Type
+}
+
+var (
+	publishQueue  = make(chan *publishJob, 256)
+	publishStart  sync.Once
+	publishClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// queuePublish schedules the record set name/typ of zone z to be pushed to
+// the zone's publish targets
+func queuePublish(z dnsZone, name string, typ dnsmsg.Type) {
+	targets, err := listPublishTargets()
+	if err != nil {
+		log.Printf("[publish] failed to load targets: %s", err)
+		return
+	}
+
+	for _, t := range targets {
+		if t.Zone != z.String() {
+			continue
+		}
+		// a single worker keeps changes in order
+		publishStart.Do(func() { go publishThread() })
+
+		select {
+		case publishQueue <- &publishJob{target: t, name: name, typ: typ}:
+		default:
+			log.Printf("[publish] queue full, dropping change of %s %s for %s", name, typ, t.Domain)
+		}
+	}
+}
+
+func publishThread() {
+	for j := range publishQueue {
+		var sets []*publishSet
+		rec, err := getZoneRecord(j.target, j.name, j.typ)
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted, publish an empty set
+			rec, err = &Record{Type: j.typ}, nil
+		}
+		if err == nil {
+			sets, err = j.target.recordSets(j.name, rec)
+		}
+		if err != nil {
+			log.Printf("[publish] failed to read %s %s for %s: %s", j.name, j.typ, j.target.Domain, err)
+			continue
+		}
+		if len(sets) == 0 {
+			continue
+		}
+
+		for i := 0; i < publishAttempts; i++ {
+			if i > 0 {
+				time.Sleep(time.Duration(1<<i) * time.Second)
+			}
+			err = j.target.publish(context.Background(), sets)
+			if err == nil {
+				break
+			}
+			log.Printf("[publish] failed to publish %s %s to %s (attempt %d): %s", j.name, j.typ, j.target.Domain, i+1, err)
+		}
+	}
+}
+
+func (t *publishTarget) publish(ctx context.Context, sets []*publishSet) error {
+	p, ok := publishers[t.Provider]
+	if !ok {
+		return fmt.Errorf("unsupported provider %s", t.Provider)
+	}
+	return p.publish(ctx, t, sets)
+}
+
+// recordSets returns the record sets to publish for rec, stored at name
+func (t *publishTarget) recordSets(name string, rec *Record) ([]*publishSet, error) {
+	if rec.Handler || rec.Type == dnsmsg.SOA || (rec.Type == dnsmsg.NS && name == "") {
+		return nil, nil
+	}
+
+	fqdn := t.Domain + "."
+	if name != "" {
+		fqdn = name + "." + fqdn
+	}
+	set := &publishSet{Name: fqdn, Type: rec.Type, TTL: rec.TTL}
+	for _, v := range rec.Value {
+		rd, err := dnsmsg.RDataFromString(rec.Type, v)
+		if err != nil {
+			return nil, err
+		}
+		set.Values = append(set.Values, rd)
+	}
+	return []*publishSet{set}, nil
+}
+
+// getZoneRecord loads the record set name/typ of the zone published by t
+func getZoneRecord(t *publishTarget, name string, typ dnsmsg.Type) (*Record, error) {
+	z, err := uuid.Parse(t.Zone)
+	if err != nil {
+		return nil, err
+	}
+	key := append(z[:], reverseDnsName([]byte(name))...)
+	key = append(key, 0, byte(typ>>8), byte(typ))
+
+	v, err := simpleGet([]byte("record"), key)
+	if err != nil {
+		return nil, err
+	}
+	return ReadRecord(v[12:])
+}
+
+// syncAll pushes all the records of the zone to the provider
+func (t *publishTarget) syncAll(ctx context.Context) (int, error) {
+	z, err := uuid.Parse(t.Zone)
+	if err != nil {
+		return 0, err
+	}
+
+	var sets []*publishSet
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+
+		for k, v := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, v = c.Next() {
+			rec, err := ReadRecord(v[12:])
+			if err != nil {
+				return err
+			}
+			name := k[16:]
+			name = name[:bytes.IndexByte(name, 0)]
+			s, err := t.recordSets(string(reverseDnsName(name)), rec)
+			if err != nil {
+				return fmt.Errorf("record %s %s: %w", reverseDnsName(name), rec.Type, err)
+			}
+			sets = append(sets, s...)
+		}
+		return nil
+	})
+	if err != nil || len(sets) == 0 {
+		return 0, err
+	}
+	return len(sets), t.publish(ctx, sets)
+}
+
+func listPublishTargets() ([]*publishTarget, error) {
+	var res []*publishTarget
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("publish"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			t := &publishTarget{}
+			if err := gob.NewDecoder(bytes.NewReader(v[12:])).Decode(t); err != nil {
+				return err
+			}
+			res = append(res, t)
+			return nil
+		})
+	})
+	return res, err
+}
+
+func getPublishTarget(id string) (*publishTarget, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := simpleGet([]byte("publish"), u[:])
+	if err != nil {
+		return nil, err
+	}
+	t := &publishTarget{}
+	err = gob.NewDecoder(bytes.NewReader(v[12:])).Decode(t)
+	return t, err
+}
+
+// handlePublish lists (GET), adds (POST) or removes (DELETE, with the "id"
+// parameter) publish targets
+func handlePublish(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		targets, err := listPublishTargets()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, t := range targets {
+			t.Secret = ""
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(targets)
+	case "POST":
+		t := &publishTarget{}
+		if err := json.NewDecoder(req.Body).Decode(t); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		if _, ok := publishers[t.Provider]; !ok {
+			http.Error(rw, "unsupported provider", http.StatusBadRequest)
+			return
+		}
+		if t.RemoteID == "" || t.Secret == "" || (t.Provider == "route53" && t.KeyID == "") {
+			http.Error(rw, "remote_id and credentials are required", http.StatusBadRequest)
+			return
+		}
+		t.Domain = strings.TrimSuffix(t.Domain, ".")
+		z, _, sub, err := getZone(req.Context(), t.Domain, nil)
+		if err != nil || len(sub) > 0 {
+			http.Error(rw, "zone not found", http.StatusNotFound)
+			return
+		}
+		id := uuid.New()
+		t.ID = id.String()
+		t.Zone = z.String()
+
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(t); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := simpleSet([]byte("publish"), id[:], append(now(), buf.Bytes()...)); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		t.Secret = ""
+		audit(apiActor(req), "publish-add", "publish:"+t.ID, nil, t)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(t)
+	case "DELETE":
+		t, err := getPublishTarget(req.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(rw, "publish target not found", http.StatusNotFound)
+			return
+		}
+		id := uuid.MustParse(t.ID)
+		err = db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte("publish")).Delete(id[:])
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.Secret = ""
+		audit(apiActor(req), "publish-delete", "publish:"+t.ID, t, nil)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
+
+// handlePublishSync pushes all records of a zone to the publish target given
+// in the "id" parameter, typically after adding it
+func handlePublishSync(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+		return
+	}
+	t, err := getPublishTarget(req.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(rw, "publish target not found", http.StatusNotFound)
+		return
+	}
+	n, err := t.syncAll(req.Context())
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("failed to publish: %s", err), http.StatusBadGateway)
+		return
+	}
+	audit(apiActor(req), "publish-sync", "publish:"+t.ID, nil, map[string]int{"records": n})
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]int{"records": n})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// cloudflarePublisher replaces record sets through the Cloudflare API, which
+// has no notion of record set: existing records of the same name and type
+// are removed before the new values, if any, are created.
+type cloudflarePublisher struct{}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (cloudflarePublisher) publish(ctx context.Context, t *publishTarget, sets []*publishSet) error {
+	base := cloudflareEndpoint + "/zones/" + url.PathEscape(t.RemoteID) + "/dns_records"
+
+	for _, s := range sets {
+		name := strings.TrimSuffix(s.Name, ".")
+		typ := s.Type.String()
+
+		var existing []struct {
+			ID string `json:"id"`
+		}
+		q := url.Values{"name": {name}, "type": {typ}, "per_page": {"1000"}}
+		if err := cloudflareCall(ctx, t, "GET", base+"?"+q.Encode(), nil, &existing); err != nil {
+			return err
+		}
+		for _, r := range existing {
+			if err := cloudflareCall(ctx, t, "DELETE", base+"/"+url.PathEscape(r.ID), nil, nil); err != nil {
+				return err
+			}
+		}
+
+		for _, v := range s.Values {
+			rec := &cloudflareRecord{Name: name, Type: typ, TTL: s.TTL}
+			switch rd := v.(type) {
+			case *dnsmsg.RDataMX:
+				prio := int(rd.Pref)
+				rec.Priority = &prio
+				rec.Content = strings.TrimSuffix(rd.Server, ".")
+			case dnsmsg.RDataTXT:
+				// quoted character strings of at most 255 bytes
+				rec.Content = rd.String()
+			case *dnsmsg.RDataLabel:
+				rec.Content = strings.TrimSuffix(rd.Label, ".")
+			default:
+				rec.Content = v.String()
+			}
+			if err := cloudflareCall(ctx, t, "POST", base, rec, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cloudflareCall performs an API call, decoding the result in res if not nil
+func cloudflareCall(ctx context.Context, t *publishTarget, method, u string, body, res any) error {
+	var buf []byte
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Secret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := publishClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	r := &cloudflareResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return fmt.Errorf("HTTP status %s: %w", resp.Status, err)
+	}
+	if !r.Success {
+		msg := resp.Status
+		if len(r.Errors) > 0 {
+			msg = r.Errors[0].Message
+		}
+		return fmt.Errorf("%w: %s", errPublishFailed, msg)
+	}
+	if res != nil {
+		return json.Unmarshal(r.Result, res)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var route53Endpoint = "https://route53.amazonaws.com"
+
+// route53 accepts up to 1000 changes per request
+const route53MaxChanges = 500
+
+type route53Publisher struct{}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string
+	Set    route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ListResponse struct {
+	Sets []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+}
+
+type route53RecordSet struct {
+	Name   string
+	Type   string
+	TTL    uint32
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+func (route53Publisher) publish(ctx context.Context, t *publishTarget, sets []*publishSet) error {
+	base := route53Endpoint + "/2013-04-01/hostedzone/" + strings.TrimPrefix(t.RemoteID, "/hostedzone/") + "/rrset"
+
+	for len(sets) > 0 {
+		n := min(len(sets), route53MaxChanges)
+		req := &route53ChangeRequest{}
+		for _, s := range sets[:n] {
+			if len(s.Values) == 0 {
+				// a DELETE must give the current values of the set
+				rs, err := route53Lookup(ctx, t, base, s)
+				if err != nil {
+					return err
+				}
+				if rs != nil {
+					req.Changes = append(req.Changes, route53Change{Action: "DELETE", Set: *rs})
+				}
+				continue
+			}
+			rs := route53RecordSet{Name: s.Name, Type: s.Type.String(), TTL: s.TTL}
+			for _, v := range s.Values {
+				rs.Values = append(rs.Values, v.String())
+			}
+			req.Changes = append(req.Changes, route53Change{Action: "UPSERT", Set: rs})
+		}
+		sets = sets[n:]
+		if len(req.Changes) == 0 {
+			continue
+		}
+
+		body, err := xml.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = append([]byte(xml.Header), body...)
+		if _, err := route53Call(ctx, t, "POST", base, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// route53Lookup returns the record set of the hosted zone matching s, or nil
+// if there is none
+func route53Lookup(ctx context.Context, t *publishTarget, base string, s *publishSet) (*route53RecordSet, error) {
+	q := url.Values{"name": {s.Name}, "type": {s.Type.String()}, "maxitems": {"1"}}
+	body, err := route53Call(ctx, t, "GET", base+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &route53ListResponse{}
+	if err := xml.Unmarshal(body, res); err != nil {
+		return nil, err
+	}
+	// the list starts at the given name and type, but may go past them
+	for _, rs := range res.Sets {
+		if rs.Type == s.Type.String() && strings.EqualFold(route53Unescape(rs.Name), s.Name) && len(rs.Values) > 0 {
+			return &rs, nil
+		}
+	}
+	return nil, nil
+}
+
+// route53Call performs a signed API call and returns the response body
+func route53Call(ctx context.Context, t *publishTarget, method, u string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	signAWSv4(req, body, t.KeyID, t.Secret, "us-east-1", "route53", clock.Now())
+
+	resp, err := publishClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: HTTP status %s: %s", errPublishFailed, resp.Status, msg[:min(len(msg), 4096)])
+	}
+	return msg, nil
+}
+
+// route53Unescape resolves the \ooo octal escapes of names returned by
+// route53, such as \052 for *
+func route53Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// signAWSv4 adds an AWS signature version 4 to req
+func signAWSv4(req *http.Request, body []byte, keyID, secret, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// headers are sorted by name
+	signed := "content-type;host;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type") + "\nhost:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n",
+		signed,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	h := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	key := []byte("AWS4" + secret)
+	for _, v := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+keyID+"/"+scope+", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestPublishRoute53(t *testing.T) {
+	openTestDb(t)
+
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("", 3600, dnsmsg.NS, "ns1.example.net.")
+	z.setRecord("", 300, dnsmsg.MX, "10 mail.example.com.")
+	z.setRecord("www", 300, dnsmsg.A, "192.0.2.1", "192.0.2.2")
+	z.setRecord("www", 300, dnsmsg.TXT, `"say \"hi\""`, `"`+strings.Repeat("a", 300)+`"`)
+	z.setHandlerRecord("*", 300, dnsmsg.A, "base32addr")
+
+	var got *route53ChangeRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/2013-04-01/hostedzone/Z123/rrset" {
+			t.Errorf("unexpected path %s", req.URL.Path)
+		}
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("unexpected authorization %s", req.Header.Get("Authorization"))
+		}
+		got = &route53ChangeRequest{}
+		if err := xml.NewDecoder(req.Body).Decode(got); err != nil {
+			t.Errorf("failed to decode request: %s", err)
+		}
+	}))
+	defer srv.Close()
+	route53Endpoint = srv.URL
+
+	rw := httptest.NewRecorder()
+	body := `{"domain":"example.com","provider":"route53","remote_id":"/hostedzone/Z123","key_id":"AKID","secret":"s3cret"}`
+	handleApi(rw, httptest.NewRequest("POST", "/api/publish", strings.NewReader(body)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to add publish target: %s", rw.Body)
+	}
+	tgt := &publishTarget{}
+	json.NewDecoder(rw.Body).Decode(tgt)
+
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/publish-sync?id="+tgt.ID, nil))
+	if rw.Code != 200 {
+		t.Fatalf("failed to sync: %s", rw.Body)
+	}
+
+	// SOA, apex NS and handler records are not published
+	var sets []string
+	for _, c := range got.Changes {
+		sets = append(sets, c.Action+" "+c.Set.Name+" "+c.Set.Type+" "+strings.Join(c.Set.Values, ","))
+	}
+	expect := "UPSERT example.com. MX 10 mail.example.com.|UPSERT www.example.com. A 192.0.2.1,192.0.2.2|" +
+		`UPSERT www.example.com. TXT "say \"hi\"",` + `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 45) + `"`
+	if strings.Join(sets, "|") != expect {
+		t.Errorf("unexpected changes %q", sets)
+	}
+}
+
+func TestPublishCloudflare(t *testing.T) {
+	openTestDb(t)
+
+	z, err := getOrCreateZone("example.org")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	var lk sync.Mutex
+	var calls []string
+	done := make(chan struct{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("unexpected authorization %s", req.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(req.Body)
+		lk.Lock()
+		calls = append(calls, req.Method+" "+req.URL.RequestURI()+" "+string(body))
+		lk.Unlock()
+
+		switch req.Method {
+		case "GET":
+			io.WriteString(rw, `{"success":true,"result":[{"id":"old1"}]}`)
+		case "POST":
+			io.WriteString(rw, `{"success":true,"result":{}}`)
+			done <- struct{}{}
+		default:
+			io.WriteString(rw, `{"success":true,"result":{}}`)
+		}
+	}))
+	defer srv.Close()
+	cloudflareEndpoint = srv.URL
+
+	rw := httptest.NewRecorder()
+	body := `{"domain":"example.org","provider":"cloudflare","remote_id":"cf1","secret":"t0ken"}`
+	handleApi(rw, httptest.NewRequest("POST", "/api/publish", strings.NewReader(body)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to add publish target: %s", rw.Body)
+	}
+
+	// record changes are pushed in the background
+	z.setRecord("", 300, dnsmsg.MX, "10 mail.example.org.")
+	z.setRecord("", 300, dnsmsg.TXT, `"v=spf1" "-all"`)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for record creation")
+		}
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+	expect := []string{
+		"GET /zones/cf1/dns_records?name=example.org&per_page=1000&type=MX ",
+		"DELETE /zones/cf1/dns_records/old1 ",
+		`POST /zones/cf1/dns_records {"name":"example.org","type":"MX","content":"mail.example.org","ttl":300,"priority":10,"proxied":false}`,
+		"GET /zones/cf1/dns_records?name=example.org&per_page=1000&type=TXT ",
+		"DELETE /zones/cf1/dns_records/old1 ",
+		`POST /zones/cf1/dns_records {"name":"example.org","type":"TXT","content":"\"v=spf1\" \"-all\"","ttl":300,"priority":null,"proxied":false}`,
+	}
+	if strings.Join(calls, "|") != strings.Join(expect, "|") {
+		t.Errorf("unexpected calls %q", calls)
+	}
+}
+
+func TestPublishDelete(t *testing.T) {
+	openTestDb(t)
+
+	z, err := getOrCreateZone("example.net")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("*", 300, dnsmsg.A, "192.0.2.1")
+	z.setRecord("mail", 300, dnsmsg.A, "192.0.2.2")
+
+	var lk sync.Mutex
+	var calls []string
+	done := make(chan struct{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lk.Lock()
+		defer lk.Unlock()
+		switch req.Method {
+		case "GET":
+			// route53 escapes * as \052
+			name := req.URL.Query().Get("name")
+			calls = append(calls, "GET "+name)
+			io.WriteString(rw, `<ListResourceRecordSetsResponse><ResourceRecordSets>`+
+				`<ResourceRecordSet><Name>`+strings.ReplaceAll(name, "*", `\052`)+`</Name><Type>A</Type><TTL>300</TTL>`+
+				`<ResourceRecords><ResourceRecord><Value>192.0.2.9</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>`+
+				`</ResourceRecordSets></ListResourceRecordSetsResponse>`)
+		case "POST":
+			got := &route53ChangeRequest{}
+			if err := xml.NewDecoder(req.Body).Decode(got); err != nil {
+				t.Errorf("failed to decode request: %s", err)
+			}
+			for _, c := range got.Changes {
+				calls = append(calls, c.Action+" "+c.Set.Name+" "+c.Set.Type+" "+strings.Join(c.Set.Values, ","))
+			}
+			done <- struct{}{}
+		}
+	}))
+	defer srv.Close()
+	route53Endpoint = srv.URL
+
+	rw := httptest.NewRecorder()
+	body := `{"domain":"example.net","provider":"route53","remote_id":"Z456","key_id":"AKID","secret":"s3cret"}`
+	handleApi(rw, httptest.NewRequest("POST", "/api/publish", strings.NewReader(body)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to add publish target: %s", rw.Body)
+	}
+
+	// deletions are published with the values known to the provider
+	wait := func() {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for deletion")
+		}
+	}
+	if _, err := z.deleteRecord("*", dnsmsg.A); err != nil {
+		t.Fatalf("failed to delete record: %s", err)
+	}
+	wait()
+	if err := deleteZone(z); err != nil {
+		t.Fatalf("failed to delete zone: %s", err)
+	}
+	wait()
+
+	lk.Lock()
+	defer lk.Unlock()
+	expect := []string{
+		"GET *.example.net.",
+		`DELETE \052.example.net. A 192.0.2.9`,
+		"GET mail.example.net.",
+		"DELETE mail.example.net. A 192.0.2.9",
+	}
+	if strings.Join(calls, "|") != strings.Join(expect, "|") {
+		t.Errorf("unexpected calls %q", calls)
+	}
+}
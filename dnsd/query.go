@@ -1,40 +1,204 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"log"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/KarpelesLab/dns/dnsmsg"
 )
 
-func handleQuery(pkt *dnsmsg.Message, laddr, raddr net.Addr) (*dnsmsg.Message, error) {
+var (
+	queryTimeout = flag.Duration("query-timeout", 5*time.Second, "maximum time spent answering a single query (0 to disable)")
+	serverNSID   = flag.String("nsid", "", "server identifier returned to clients requesting NSID (RFC 5001)")
+	ednsUDPSize  = flag.Uint("edns-udp-size", 1232, "UDP payload size advertised in EDNS responses")
+
+	maxQueryRecords = flag.Int("max-query-records", 16, "maximum number of records in each section of a query (0 for no limit)")
+	maxQueryLabels  = flag.Int("max-query-labels", 256, "maximum number of labels read from the names of a query (0 for no limit)")
+)
+
+// queryParseOptions returns the limits applied to incoming queries, so
+// abusive packets are dropped before anything is allocated for them
+func queryParseOptions() *dnsmsg.ParseOptions {
+	return &dnsmsg.ParseOptions{
+		MaxQuestions: 1,
+		MaxRecords:   *maxQueryRecords,
+		MaxLabels:    *maxQueryLabels,
+	}
+}
+
+func handleQuery(ctx context.Context, pkt *dnsmsg.Message, laddr, raddr net.Addr) (*dnsmsg.Message, error) {
 	log.Printf("handle query: %s", pkt)
 
-	if pkt.Bits.IsResponse() || pkt.Bits.OpCode() != dnsmsg.Query || len(pkt.Question) != 1 {
+	if pkt.Bits.IsResponse() {
+		return nil, errors.New("not a query")
+	}
+	if pkt.Bits.OpCode() != dnsmsg.Query {
+		// NOTIFY, UPDATE, etc. are not implemented (RFC 1035 section 4.1.1)
+		res := dnsmsg.NewResponse(pkt, uint16(*ednsUDPSize))
+		if res.ExtendedRCode() != dnsmsg.ErrBadVers {
+			res.Bits.SetRCode(dnsmsg.ErrNotImpl)
+		}
+		return res, nil
+	}
+	if len(pkt.Question) != 1 {
 		return nil, errors.New("not a query")
 	}
 
-	q := pkt.Question[0]
-	pkt.Bits.SetResponse(true)
+	res := dnsmsg.NewResponse(pkt, uint16(*ednsUDPSize))
+	// some resolvers choke on compressed names in the RDATA of newer types
+	res.Compression = dnsmsg.CompressStandard
+	q := res.Question[0]
+
+	st := &queryState{name: q.Name}
+	ctx = context.WithValue(ctx, queryStateKey{}, st)
+	defer reportAnswerSource(st, q, res)
+
+	if res.ExtendedRCode() == dnsmsg.ErrBadVers {
+		// unsupported EDNS version
+		return res, nil
+	}
+
+	ecs := pkt.GetClientSubnet()
+	if _, nsid := pkt.GetNSID(); nsid && *serverNSID != "" {
+		res.SetNSID([]byte(*serverNSID))
+	}
+
+	if !handleCookie(res, pkt.GetOpt(dnsmsg.OptCookie), raddr) {
+		return res, nil
+	}
+
+	if ecs != nil {
+		// answers are not tailored to the client subnet unless a handler
+		// says otherwise by setting the scope
+		ecs.ScopePrefix = 0
+		st.ecs = ecs
+		defer res.SetClientSubnet(ecs)
+	}
+
+	if *queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *queryTimeout)
+		defer cancel()
+	}
+
+	if applyRewrite(ctx, res, q, laddr, false) {
+		return res, nil
+	}
+	if answerDhcp(ctx, res, q) {
+		return res, nil
+	}
 
-	zone, name, sub, err := getZone(q.Name, laddr)
+	zone, name, sub, err := getZone(ctx, string(q.Name), laddr)
+	if ctx.Err() != nil {
+		return queryExpired(ctx, res), nil
+	}
 	if err != nil {
 		// not found
-		pkt.Bits.SetRCode(dnsmsg.ErrName)
-		return pkt, nil
+		if applyRewrite(ctx, res, q, laddr, true) {
+			return res, nil
+		}
+		res.Bits.SetRCode(dnsmsg.ErrName)
+		if res.HasEDNS {
+			res.AddExtendedError(dnsmsg.EDENotAuthoritative, "")
+		}
+		return res, nil
 	}
 
 	// we have authority
-	pkt.Bits.SetAuth(true)
-	pkt.Base = string(reverseDnsName(name))
-	err = zone.handleQuery(pkt, q, sub)
+	res.Bits.SetAuth(true)
+	res.Base = string(reverseDnsName(name))
+	st.maxRecords, st.limitMode = recordLimit(zone)
+	sz := signedZones.get(zone, res.Base)
+	if !sz.answerApex(res, q, sub) {
+		err = zone.handleQuery(ctx, res, q, sub)
+	}
+	if ctx.Err() != nil {
+		return queryExpired(ctx, res), nil
+	}
+	// names are stored in lower case, echo the case of the query unless
+	// the transport is set not to
+	if ctx.Value(noEchoCaseKey{}) == nil {
+		res.MatchQuestionCase()
+	}
+	_, udp := raddr.(*net.UDPAddr)
+	applyRecordLimit(st, res, udp)
 
+	if (err != nil || len(res.Answer) == 0) && applyRewrite(ctx, res, q, laddr, true) {
+		return res, nil
+	}
 	if err != nil {
 		// not found, or something?
 		log.Printf("query failed: %s", err)
-		pkt.Bits.SetRCode(dnsmsg.ErrName)
+		res.Bits.SetRCode(dnsmsg.ErrName)
+	}
+	if sz != nil && res.DO() && !st.overLimit {
+		// signatures would not match a subset of the records
+		sz.addDNSSEC(res, q, sub, zone.wildcard(sub))
 	}
 
-	return pkt, nil
+	return res, nil
+}
+
+// queryExpired turns pkt into a SERVFAIL response after ctx expired while
+// processing it, dropping any partial answer
+func queryExpired(ctx context.Context, pkt *dnsmsg.Message) *dnsmsg.Message {
+	log.Printf("query aborted: %s", ctx.Err())
+	if st := getQueryState(ctx); st != nil {
+		st.source = sourceSynthesized
+	}
+	pkt.Bits.SetAuth(false)
+	pkt.Bits.SetRCode(dnsmsg.ErrServFail)
+	pkt.Answer = nil
+	pkt.Authority = nil
+	pkt.Additional = nil
+	if pkt.HasEDNS {
+		pkt.AddExtendedError(dnsmsg.EDEOther, "query timed out")
+	}
+	return pkt
+}
+
+// queryState holds information about the query being processed, shared with
+// lower layers through the query context
+type queryState struct {
+	name   dnsmsg.Name
+	ecs    *dnsmsg.EDNSClientSubnet
+	source answerSource
+
+	maxRecords int    // record limit for the answer, 0 if none
+	limitMode  string // limitSubset or limitTruncate
+	overLimit  bool   // answer had more records than the limit
+}
+
+type queryStateKey struct{}
+
+// noEchoCaseKey is set in the context of queries received on a transport
+// configured to answer with names in the case they are stored in
+type noEchoCaseKey struct{}
+
+func getQueryState(ctx context.Context) *queryState {
+	st, _ := ctx.Value(queryStateKey{}).(*queryState)
+	return st
+}
+
+// queryName returns the name being queried in ctx, lowercase and without
+// final dot
+func queryName(ctx context.Context) string {
+	if st := getQueryState(ctx); st != nil {
+		return strings.ToLower(strings.TrimSuffix(string(st.name), "."))
+	}
+	return ""
+}
+
+// clientSubnet returns the EDNS client subnet of the query being processed,
+// if any. Handlers returning subnet-specific answers should set ScopePrefix.
+func clientSubnet(ctx context.Context) *dnsmsg.EDNSClientSubnet {
+	if st := getQueryState(ctx); st != nil {
+		return st.ecs
+	}
+	return nil
 }
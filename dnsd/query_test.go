@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestQueryCase(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("case.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	z.setRecord("*.dyn", 3600, dnsmsg.A, "192.0.2.2")
+	z.setRecord("", 3600, dnsmsg.TXT, "\"apex\"")
+
+	for _, name := range []string{"case.example.com.", "www.case.example.com.", "WwW.CaSe.ExAmPlE.cOm.", "Host.DYN.case.example.com.", "CASE.example.COM."} {
+		typ := dnsmsg.A
+		if strings.EqualFold(name, "case.example.com.") {
+			typ = dnsmsg.TXT
+		}
+		res, err := handleQuery(context.Background(), dnsmsg.NewQuery(name, dnsmsg.IN, typ), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", name, err)
+		}
+		buf, err := res.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		res, _ = dnsmsg.Parse(buf)
+		if len(res.Answer) != 1 || res.Answer[0].Name != dnsmsg.Name(name) {
+			t.Errorf("%s: unexpected answer %s", name, res)
+		}
+	}
+}
+
+func TestQueryWildcard(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("wild.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("*", 3600, dnsmsg.A, "192.0.2.1")
+	z.setRecord("b", 3600, dnsmsg.A, "192.0.2.2")
+	z.setRecord("x.c", 3600, dnsmsg.A, "192.0.2.3")
+
+	// the wildcard only covers names whose closest encloser is the apex
+	// (RFC 4592 section 2.2.1)
+	var tests = []struct {
+		name   string
+		typ    dnsmsg.Type
+		rcode  dnsmsg.RCode
+		answer string
+	}{
+		{"a.wild.example.com.", dnsmsg.A, dnsmsg.NoError, "192.0.2.1"},
+		{"x.y.wild.example.com.", dnsmsg.A, dnsmsg.NoError, "192.0.2.1"},
+		{"b.wild.example.com.", dnsmsg.A, dnsmsg.NoError, "192.0.2.2"},
+		{"a.wild.example.com.", dnsmsg.AAAA, dnsmsg.NoError, ""},
+		{"b.wild.example.com.", dnsmsg.AAAA, dnsmsg.NoError, ""},
+		{"a.b.wild.example.com.", dnsmsg.A, dnsmsg.ErrName, ""},
+		{"c.wild.example.com.", dnsmsg.A, dnsmsg.NoError, ""},
+		{"a.c.wild.example.com.", dnsmsg.A, dnsmsg.ErrName, ""},
+	}
+	for _, test := range tests {
+		res, err := handleQuery(context.Background(), dnsmsg.NewQuery(test.name, dnsmsg.IN, test.typ), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", test.name, err)
+		}
+		var answer []string
+		for _, rr := range res.Answer {
+			answer = append(answer, rr.Data.String())
+		}
+		if got := strings.Join(answer, ", "); got != test.answer || res.Bits.GetRCode() != test.rcode {
+			t.Errorf("%s %s: got %q (%s), expected %q (%s)", test.name, test.typ, got, res.Bits.GetRCode(), test.answer, test.rcode)
+		}
+	}
+}
+
+func TestQueryNSID(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("nsid.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	defer func(v string) { *serverNSID = v }(*serverNSID)
+	for _, test := range []struct {
+		nsid   string
+		ask    bool
+		expect bool
+	}{
+		{"ns1.test", true, true},
+		{"ns1.test", false, false},
+		{"", true, false},
+	} {
+		*serverNSID = test.nsid
+		q := dnsmsg.NewQuery("www.nsid.example.com.", dnsmsg.IN, dnsmsg.A)
+		if test.ask {
+			q.SetNSID(nil)
+		}
+		res, err := handleQuery(context.Background(), q, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to query: %s", err)
+		}
+		id, ok := res.GetNSID()
+		if ok != test.expect || (ok && string(id) != test.nsid) {
+			t.Errorf("nsid %q, asked %v: unexpected NSID %q in %s", test.nsid, test.ask, id, res)
+		}
+		if len(res.Answer) != 1 {
+			t.Errorf("unexpected answer %s", res)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
+	"slices"
 
 	"github.com/KarpelesLab/dns/dnsmsg"
 )
@@ -32,7 +34,26 @@ func (r *Record) Bytes() []byte {
 	return buf.Bytes()
 }
 
-func (r *Record) RData(name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err error) {
+// equal returns true if r and o hold the same values, in any order
+func (r *Record) equal(o *Record) bool {
+	if r.Type != o.Type || r.Handler != o.Handler || r.TTL != o.TTL || len(r.Value) != len(o.Value) {
+		return false
+	}
+	a, b := slices.Clone(r.Value), slices.Clone(o.Value)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// source returns where answers built from this record come from
+func (r *Record) source() answerSource {
+	if r.Handler {
+		return sourceHandler
+	}
+	return sourceZone
+}
+
+func (r *Record) RData(ctx context.Context, name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err error) {
 	var t dnsmsg.RData
 
 	if r.Handler {
@@ -41,10 +62,10 @@ func (r *Record) RData(name []byte, typ dnsmsg.Type) (res []dnsmsg.RData, err er
 			err = errors.New("handler missing")
 			return
 		}
-		return performHandler(r.Value, name, typ)
+		return performHandler(ctx, r.Value, name, typ)
 	}
 
-	for _, v := range r.Value {
+	for _, v := range limitValues(ctx, r.Value) {
 		t, err = dnsmsg.RDataFromString(r.Type, v)
 		if err != nil {
 			return
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var resolveBatchMax = flag.Int("resolve-batch-max", 100, "maximum number of queries in a single resolve-batch API call")
+
+// resolveQuery is a query of a resolve-batch call. Type is a type name or
+// number, and defaults to A.
+type resolveQuery struct {
+	Name string          `json:"name"`
+	Type json.RawMessage `json:"type,omitempty"`
+}
+
+// handleResolveBatch answers a JSON array of queries posted in the body,
+// such as [{"name":"example.com","type":"A"}], as if they were received by
+// the server. The response is an array with the answer to each query, in
+// order, in the same dns-json format as the DoH JSON endpoint.
+func handleResolveBatch(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+		return
+	}
+
+	var queries []*resolveQuery
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 1<<20)).Decode(&queries); err != nil {
+		http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(queries) > *resolveBatchMax {
+		http.Error(rw, fmt.Sprintf("too many queries (maximum %d)", *resolveBatchMax), http.StatusBadRequest)
+		return
+	}
+
+	msgs := make([]*dnsmsg.Message, len(queries))
+	for i, q := range queries {
+		v := url.Values{"name": {q.Name}}
+		if len(q.Type) > 0 {
+			v.Set("type", strings.Trim(string(q.Type), `"`))
+		}
+		msg, err := dnsmsg.ParseDNSJSONQuery(v)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("query %d: invalid query: %s", i, err), http.StatusBadRequest)
+			return
+		}
+		msgs[i] = msg
+	}
+
+	laddr, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	res := make([]json.RawMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		r, err := handleQuery(req.Context(), msg, laddr, nil)
+		if err == nil && r == nil {
+			err = errors.New("no response")
+		}
+		if err != nil {
+			log.Printf("[api] failed to resolve %s: %s", msg.Question[0].Name, err)
+			http.Error(rw, "query failed", http.StatusInternalServerError)
+			return
+		}
+		buf, err := r.MarshalDNSJSON()
+		if err != nil {
+			log.Printf("[api] failed to encode response for %s: %s", msg.Question[0].Name, err)
+			http.Error(rw, "query failed", http.StatusInternalServerError)
+			return
+		}
+		res = append(res, buf)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
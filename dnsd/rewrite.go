@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rewrite rule match modes
+const (
+	rewriteExact  = "exact"
+	rewriteSuffix = "suffix"
+	rewriteRegex  = "regex"
+)
+
+// rewriteRule answers queries for matching names with a CNAME or fixed
+// records, either instead of the zones (internal aliases, migrations) or only
+// for queries the zones have no answer for (After)
+type rewriteRule struct {
+	ID       string   `json:"id"`
+	Priority int      `json:"priority"`        // rules are tried by increasing priority
+	Match    string   `json:"match"`           // exact, suffix or regex
+	Name     string   `json:"name"`            // name, suffix or regular expression (case insensitive, without final dot)
+	After    bool     `json:"after,omitempty"` // only apply if the zones have no answer
+	View     string   `json:"view,omitempty"`  // only apply to queries received on this local IP
+	CNAME    string   `json:"cname,omitempty"` // answer with a CNAME to this name
+	Type     string   `json:"type,omitempty"`  // or with records of this type
+	Values   []string `json:"values,omitempty"`
+	TTL      uint32   `json:"ttl"`
+}
+
+// rewriteRegexps caches compiled regular expressions of rules
+var rewriteRegexps sync.Map
+
+// rewriteCache holds the rewrite rules applied to queries, loaded from the
+// database when first needed and after each change through the API
+type rewriteCache struct {
+	rules []*rewriteRule
+	db    *bolt.DB // database the rules were loaded from
+	lk    sync.RWMutex
+}
+
+var rewriteRules = &rewriteCache{}
+
+// get returns the rewrite rules, by increasing priority
+func (c *rewriteCache) get() ([]*rewriteRule, error) {
+	c.lk.RLock()
+	rules, from := c.rules, c.db
+	c.lk.RUnlock()
+	if from == db {
+		return rules, nil
+	}
+	return c.reload()
+}
+
+// reload loads the rewrite rules from the database
+func (c *rewriteCache) reload() ([]*rewriteRule, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	rules, err := listRewrites()
+	if err != nil {
+		return nil, err
+	}
+	c.rules, c.db = rules, db
+	return rules, nil
+}
+
+func (r *rewriteRule) validate() error {
+	switch r.Match {
+	case rewriteExact, rewriteSuffix:
+		r.Name = strings.ToLower(strings.TrimSuffix(r.Name, "."))
+	case rewriteRegex:
+		if _, err := regexp.Compile(r.Name); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid match %q", r.Match)
+	}
+	if r.View != "" && net.ParseIP(r.View) == nil {
+		return fmt.Errorf("invalid view %q", r.View)
+	}
+	if (r.CNAME == "") == (r.Type == "") {
+		return fmt.Errorf("one of cname or type is required")
+	}
+	if r.CNAME != "" {
+		r.CNAME = strings.TrimSuffix(r.CNAME, ".") + "."
+		return nil
+	}
+	typ, err := dnsmsg.ParseType(r.Type)
+	if err != nil {
+		return fmt.Errorf("invalid type %q", r.Type)
+	}
+	if len(r.Values) == 0 {
+		return fmt.Errorf("values are required")
+	}
+	for _, v := range r.Values {
+		if _, err := dnsmsg.RDataFromString(typ, v); err != nil {
+			return fmt.Errorf("invalid value %q: %w", v, err)
+		}
+	}
+	r.Type = typ.String()
+	return nil
+}
+
+// matches returns true if r applies to name (lowercase, without final dot)
+// received on local IP ip
+func (r *rewriteRule) matches(name string, ip net.IP) bool {
+	if r.View != "" && !net.ParseIP(r.View).Equal(ip) {
+		return false
+	}
+	switch r.Match {
+	case rewriteExact:
+		return name == r.Name
+	case rewriteSuffix:
+		return name == r.Name || strings.HasSuffix(name, "."+r.Name)
+	case rewriteRegex:
+		v, ok := rewriteRegexps.Load(r.Name)
+		if !ok {
+			re, err := regexp.Compile(r.Name)
+			if err != nil {
+				return false
+			}
+			v, _ = rewriteRegexps.LoadOrStore(r.Name, re)
+		}
+		return v.(*regexp.Regexp).MatchString(name)
+	}
+	return false
+}
+
+// answer sets the answer of pkt to question q from r
+func (r *rewriteRule) answer(pkt *dnsmsg.Message, q *dnsmsg.Question) error {
+	if r.CNAME != "" {
+		pkt.Answer = append(pkt.Answer, &dnsmsg.Resource{
+			Name:  q.Name,
+			Type:  dnsmsg.CNAME,
+			Class: dnsmsg.IN,
+			TTL:   r.TTL,
+			Data:  &dnsmsg.RDataLabel{Label: r.CNAME, Type: dnsmsg.CNAME},
+		})
+		return nil
+	}
+	typ, err := dnsmsg.ParseType(r.Type)
+	if err != nil {
+		return err
+	}
+	if q.Type != typ && q.Type != dnsmsg.ANY {
+		// the name exists, but not with this type
+		return nil
+	}
+	for _, v := range r.Values {
+		rd, err := dnsmsg.RDataFromString(typ, v)
+		if err != nil {
+			return err
+		}
+		pkt.Answer = append(pkt.Answer, &dnsmsg.Resource{Name: q.Name, Type: typ, Class: dnsmsg.IN, TTL: r.TTL, Data: rd})
+	}
+	return nil
+}
+
+// applyRewrite answers q in pkt with the first matching rewrite rule of the
+// given phase, and returns true if a rule applied
+func applyRewrite(ctx context.Context, pkt *dnsmsg.Message, q *dnsmsg.Question, laddr net.Addr, after bool) bool {
+	rules, err := rewriteRules.get()
+	if err != nil {
+		log.Printf("[rewrite] failed to load rules: %s", err)
+		return false
+	}
+	if len(rules) == 0 {
+		return false
+	}
+
+	var ip net.IP
+	switch v := laddr.(type) {
+	case *net.TCPAddr:
+		ip = v.IP
+	case *net.UDPAddr:
+		ip = v.IP
+	}
+	name := strings.ToLower(strings.TrimSuffix(string(q.Name), "."))
+
+	for _, r := range rules {
+		if r.After != after || !r.matches(name, ip) {
+			continue
+		}
+		pkt.Answer, pkt.Authority = nil, nil
+		if err := r.answer(pkt, q); err != nil {
+			log.Printf("[rewrite] rule %s failed: %s", r.ID, err)
+			return false
+		}
+		pkt.Bits.SetAuth(false)
+		pkt.Bits.SetRCode(dnsmsg.NoError)
+		setAnswerSource(ctx, sourceRewrite)
+		return true
+	}
+	return false
+}
+
+// listRewrites returns the rewrite rules, by increasing priority
+func listRewrites() ([]*rewriteRule, error) {
+	var res []*rewriteRule
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("rewrite"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			r := &rewriteRule{}
+			if err := gob.NewDecoder(bytes.NewReader(v[12:])).Decode(r); err != nil {
+				return err
+			}
+			res = append(res, r)
+			return nil
+		})
+	})
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Priority < res[j].Priority })
+	return res, err
+}
+
+// handleRewrites lists (GET), adds (POST) or removes (DELETE, with the "id"
+// parameter) rewrite rules
+func handleRewrites(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		rules, err := listRewrites()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rules == nil {
+			rules = []*rewriteRule{}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(rules)
+	case "POST":
+		r := &rewriteRule{}
+		if err := json.NewDecoder(req.Body).Decode(r); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := r.validate(); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := uuid.New()
+		r.ID = id.String()
+
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(r); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := simpleSet([]byte("rewrite"), id[:], append(now(), buf.Bytes()...)); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := rewriteRules.reload(); err != nil {
+			log.Printf("[rewrite] failed to load rules: %s", err)
+		}
+		audit(apiActor(req), "rewrite-add", "rewrite:"+r.ID, nil, r)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(r)
+	case "DELETE":
+		id, err := uuid.Parse(req.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(rw, "invalid id", http.StatusBadRequest)
+			return
+		}
+		var before *rewriteRule
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("rewrite"))
+			if b == nil {
+				return nil
+			}
+			if v := b.Get(id[:]); v != nil {
+				before = &rewriteRule{}
+				gob.NewDecoder(bytes.NewReader(v[12:])).Decode(before)
+			}
+			return b.Delete(id[:])
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before == nil {
+			http.Error(rw, "rewrite rule not found", http.StatusNotFound)
+			return
+		}
+		if _, err := rewriteRules.reload(); err != nil {
+			log.Printf("[rewrite] failed to load rules: %s", err)
+		}
+		audit(apiActor(req), "rewrite-delete", "rewrite:"+id.String(), before, nil)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
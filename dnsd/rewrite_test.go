@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func addRewrite(t *testing.T, rule string) string {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/rewrites", strings.NewReader(rule)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to add rule %s: status %d: %s", rule, rw.Code, rw.Body)
+	}
+	var r rewriteRule
+	if err := json.NewDecoder(rw.Body).Decode(&r); err != nil {
+		t.Fatalf("failed to decode rule: %s", err)
+	}
+	return r.ID
+}
+
+func TestRewrite(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	z.setRecord("old", 3600, dnsmsg.A, "192.0.2.2")
+
+	oldID := addRewrite(t, `{"match":"exact","name":"old.example.com.","cname":"www.example.com","ttl":60}`)
+	addRewrite(t, `{"match":"suffix","name":"example.com","after":true,"type":"A","values":["192.0.2.99"],"ttl":60,"priority":10}`)
+	addRewrite(t, `{"match":"regex","name":"^test[0-9]+\\.example\\.com$","after":true,"type":"A","values":["192.0.2.42"],"ttl":60}`)
+	addRewrite(t, `{"match":"exact","name":"view.example.com","view":"192.0.2.53","type":"A","values":["192.0.2.53"],"ttl":60}`)
+
+	query := func(name string, typ dnsmsg.Type, laddr net.Addr) *dnsmsg.Message {
+		t.Helper()
+		res, err := handleQuery(context.Background(), dnsmsg.NewQuery(name, dnsmsg.IN, typ), laddr, nil)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", name, err)
+		}
+		return res
+	}
+
+	for _, test := range []struct {
+		name   string
+		typ    dnsmsg.Type
+		laddr  net.Addr
+		expect string
+	}{
+		// before the lookup, even though the name exists
+		{"old.example.com.", dnsmsg.A, nil, "old.example.com. IN CNAME 60 www.example.com."},
+		// answers from the zone are not affected by rules applied after the
+		// lookup
+		{"www.example.com.", dnsmsg.A, nil, "www.example.com. IN A 3600 192.0.2.1"},
+		// rules are tried by priority
+		{"test1.example.com.", dnsmsg.A, nil, "test1.example.com. IN A 60 192.0.2.42"},
+		{"other.example.com.", dnsmsg.A, nil, "other.example.com. IN A 60 192.0.2.99"},
+		{"other.example.com.", dnsmsg.AAAA, nil, ""},
+		{"view.example.com.", dnsmsg.A, &net.UDPAddr{IP: net.ParseIP("192.0.2.53")}, "view.example.com. IN A 60 192.0.2.53"},
+		{"view.example.com.", dnsmsg.A, nil, "view.example.com. IN A 60 192.0.2.99"},
+	} {
+		res := query(test.name, test.typ, test.laddr)
+		var answer []string
+		for _, rr := range res.Answer {
+			answer = append(answer, rr.String())
+		}
+		if got := strings.Join(answer, ", "); got != test.expect || res.Bits.GetRCode() != dnsmsg.NoError {
+			t.Errorf("%s %s: got %q (%s), expected %q", test.name, test.typ, got, res.Bits.GetRCode(), test.expect)
+		}
+	}
+
+	// names outside of rules still do not exist
+	if res := query("www.example.org.", dnsmsg.A, nil); res.Bits.GetRCode() != dnsmsg.ErrName {
+		t.Errorf("unexpected response %s", res)
+	}
+
+	// deleted rules stop applying at once
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("DELETE", "/api/rewrites?id="+oldID, nil))
+	if rw.Code != 204 {
+		t.Fatalf("failed to delete rule: status %d: %s", rw.Code, rw.Body)
+	}
+	if res := query("old.example.com.", dnsmsg.A, nil); len(res.Answer) != 1 || res.Answer[0].String() != "old.example.com. IN A 3600 192.0.2.2" {
+		t.Errorf("unexpected response after deletion %s", res)
+	}
+
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/rewrites", strings.NewReader(`{"match":"regex","name":"(","cname":"x"}`)))
+	if rw.Code != 400 {
+		t.Errorf("invalid regex accepted: status %d", rw.Code)
+	}
+}
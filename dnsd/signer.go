@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"expvar"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Zones with a DNSSEC policy are signed in memory: the zone records stay
+// unsigned in the database, and the signatures, keys and NSEC or NSEC3 chain
+// are added to the answers of queries with the DO bit. Zones are signed
+// again when changed, when signatures are due for renewal and when a key
+// rollover reaches its next step. Records served by handlers have no static
+// value and are not signed.
+
+var dnssecInterval = flag.Duration("dnssec-interval", time.Hour, "how often signed zones are checked for signature renewals and key rollovers")
+
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// dnssecStats counts the signatures made and checked, served with the other
+// runtime counters by /api/vars
+var dnssecStats = &dnssec.Stats{}
+
+// signedKey identifies an RRset of a signed zone
+type signedKey struct {
+	name dnsmsg.Name // canonical
+	typ  dnsmsg.Type
+}
+
+// signedZone is a zone signed under one of its names
+type signedZone struct {
+	origin dnsmsg.Name
+	sigs   map[signedKey][]*dnsmsg.Resource   // RRSIG records by covered RRset
+	apex   map[dnsmsg.Type][]*dnsmsg.Resource // DNSKEY, CDS, CDNSKEY and NSEC3PARAM records
+	nsec   []*dnsmsg.Resource                 // NSEC records in canonical order, or NSEC3 records in hash order
+	hashes [][]byte                           // NSEC3 only, hashes of the owners of nsec
+	param  *dnsmsg.RDataNSEC3PARAM
+	next   time.Time // time the zone has to be signed again
+}
+
+// signedZoneKey identifies a signed zone: a zone can be served under
+// several names, signed separately
+type signedZoneKey struct {
+	zone   dnsZone
+	domain string // lowercase, without final dot
+}
+
+// signedTable holds the signed zones
+type signedTable struct {
+	zones   map[signedZoneKey]*signedZone
+	pending map[dnsZone]bool // zones to sign again
+	notify  chan struct{}
+	lk      sync.RWMutex
+}
+
+var signedZones = &signedTable{
+	zones:   make(map[signedZoneKey]*signedZone),
+	pending: make(map[dnsZone]bool),
+	notify:  make(chan struct{}, 1),
+}
+
+// get returns zone z signed as domain, or nil if it is not signed
+func (s *signedTable) get(z dnsZone, domain string) *signedZone {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.zones[signedZoneKey{z, domain}]
+}
+
+// set replaces the signed versions of zone z by zones, by domain
+func (s *signedTable) set(z dnsZone, zones map[string]*signedZone) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for k := range s.zones {
+		if k.zone == z {
+			delete(s.zones, k)
+		}
+	}
+	for domain, sz := range zones {
+		s.zones[signedZoneKey{z, domain}] = sz
+	}
+}
+
+// due returns the zones that need to be signed at t, clearing the pending
+// list
+func (s *signedTable) due(t time.Time) []dnsZone {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for k, sz := range s.zones {
+		if reached(sz.next, t) {
+			s.pending[k.zone] = true
+		}
+	}
+	res := make([]dnsZone, 0, len(s.pending))
+	for z := range s.pending {
+		res = append(res, z)
+	}
+	clear(s.pending)
+	return res
+}
+
+// queueSign schedules zone z to be signed again, after a change
+func queueSign(z dnsZone) {
+	signedZones.lk.Lock()
+	signedZones.pending[z] = true
+	signedZones.lk.Unlock()
+
+	select {
+	case signedZones.notify <- struct{}{}:
+	default:
+		// already notified
+	}
+}
+
+// initDnssec sets up the DNSSEC counters and signs the zones with a DNSSEC
+// policy
+func initDnssec() {
+	dnssec.SetMetrics(dnssecStats)
+	expvar.Publish("dnssec", expvar.Func(func() any { return dnssecStats.Snapshot() }))
+	signAllZones()
+}
+
+// dnssecThread signs the zones with a DNSSEC policy again as needed
+func dnssecThread() {
+	t := time.NewTicker(*dnssecInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-signedZones.notify:
+		}
+		for _, z := range signedZones.due(clock.Now()) {
+			if err := signZone(z); err != nil {
+				log.Printf("[dnssec] failed to sign zone %s: %s", z, err)
+			}
+		}
+	}
+}
+
+// signAllZones signs all the zones with a DNSSEC policy
+func signAllZones() {
+	var zones []dnsZone
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("zone"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var z dnsZone
+			copy(z[:], k)
+			zones = append(zones, z)
+			return nil
+		})
+	})
+	for _, z := range zones {
+		if err := signZone(z); err != nil {
+			log.Printf("[dnssec] failed to sign zone %s: %s", z, err)
+		}
+	}
+}
+
+// signZone signs zone z under each of its names according to its DNSSEC
+// policy, rolling keys over as needed. Zones without a policy are dropped
+// from the signed zones.
+func signZone(z dnsZone) error {
+	s, err := z.getSettings()
+	if err == os.ErrNotExist {
+		s, err = &zoneSettings{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	p := s.DNSSEC
+	if p == nil {
+		signedZones.set(z, nil)
+		return nil
+	}
+
+	t := clock.Now()
+	rrs, maxTTL, err := z.zoneRecords()
+	if err != nil {
+		return err
+	}
+	keys, err := z.updateKeys(p, t, maxTTL)
+	if err != nil {
+		return err
+	}
+	domains, err := z.domains()
+	if err != nil {
+		return err
+	}
+
+	// time of the next key rollover step
+	var next time.Time
+	for _, k := range keys {
+		at := k.nextEvent(t)
+		if k.active(t) && k.Retire.IsZero() && p.lifetime(k.KSK) > 0 {
+			if due := k.Active.Add(p.lifetime(k.KSK)); at.IsZero() || due.Before(at) {
+				at = due
+			}
+		}
+		if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	// signatures are renewed before they expire
+	expiration := t.Add(p.validity())
+	if renew := expiration.Add(-p.refresh()); next.IsZero() || renew.Before(next) {
+		next = renew
+	}
+
+	res := make(map[string]*signedZone)
+	for _, domain := range domains {
+		prev := signedZones.get(z, domain)
+		sz, err := z.signDomain(p, domain, rrs, keys, t, expiration, prev)
+		if err != nil {
+			return err
+		}
+		if sz.next.IsZero() || next.Before(sz.next) {
+			sz.next = next
+		}
+		res[domain] = sz
+	}
+	signedZones.set(z, res)
+	return nil
+}
+
+// zoneRecords returns the records of z, with names relative to the zone,
+// and their highest TTL. Records served by handlers are skipped.
+func (z dnsZone) zoneRecords() ([]*dnsmsg.Resource, time.Duration, error) {
+	var rrs []*dnsmsg.Resource
+	var maxTTL uint32
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(z[:]); bytes.HasPrefix(k, z[:]); k, v = c.Next() {
+			rec, err := ReadRecord(v[12:])
+			if err != nil {
+				return err
+			}
+			if rec.Handler {
+				continue
+			}
+			name := k[16:]
+			name = name[:bytes.IndexByte(name, 0)]
+			rdata, err := rec.RData(context.Background(), name, rec.Type)
+			if err != nil {
+				return err
+			}
+			for _, rd := range rdata {
+				rrs = append(rrs, &dnsmsg.Resource{Name: dnsmsg.Name(reverseDnsName(name)), Type: rec.Type, Class: dnsmsg.IN, TTL: rec.TTL, Data: rd})
+			}
+			maxTTL = max(maxTTL, rec.TTL)
+		}
+		return nil
+	})
+	return rrs, time.Duration(maxTTL) * time.Second, err
+}
+
+// domains returns the names z is served under, lowercase and without final
+// dot
+func (z dnsZone) domains() ([]string, error) {
+	seen := make(map[string]bool)
+	var res []string
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{"domain", "ip-domain"} {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+			b.ForEach(func(k, v []byte) error {
+				if !bytes.Equal(v[12:], z[:]) {
+					return nil
+				}
+				if name == "ip-domain" {
+					k = k[16:]
+				}
+				if d := string(reverseDnsName(k)); !seen[d] {
+					seen[d] = true
+					res = append(res, d)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// qualify returns rrs, with names relative to domain, with fully qualified
+// names, as they appear in answers
+func qualify(domain string, rrs []*dnsmsg.Resource) ([]*dnsmsg.Resource, error) {
+	var res []*dnsmsg.Resource
+	for len(rrs) > 0 {
+		// one message per batch keeps away from the size limits
+		n := min(len(rrs), 256)
+		buf, err := (&dnsmsg.Message{Base: domain, Answer: rrs[:n], Compression: dnsmsg.CompressNone}).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := dnsmsg.Parse(buf)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, msg.Answer...)
+		rrs = rrs[n:]
+	}
+	return res, nil
+}
+
+// signDomain signs the records of a zone served as domain. The NSEC3 salt
+// of prev, the previous version, is kept if the parameters did not change.
+// With an offline KSK, the zone is served with an uploaded DNSKEY RRset
+// matching the published ZSKs, and fails to sign without one.
+func (z dnsZone) signDomain(p *dnssecPolicy, domain string, rrs []*dnsmsg.Resource, keys []*zoneKey, t, expiration time.Time, prev *signedZone) (*signedZone, error) {
+	origin := dnsmsg.Name(domain + ".")
+	rrs, err := qualify(domain, rrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var ksks, zsks []*dnssec.Signer
+	var dsKeys, published []*dnsmsg.RDataDNSKEY
+	ttl := p.dnskeyTTL()
+	for _, k := range keys {
+		if k.KSK && p.OfflineKSK {
+			// left from before the KSK was taken offline
+			continue
+		}
+		if k.published(t) {
+			if p.OfflineKSK {
+				// the DNSKEY RRset is uploaded, with these keys
+				published = append(published, k.dnskey())
+			} else {
+				rrs = append(rrs, &dnsmsg.Resource{Name: origin, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: ttl, Data: k.dnskey()})
+			}
+		}
+		if k.KSK && k.dsPublished(t) {
+			dsKeys = append(dsKeys, k.dnskey())
+		}
+		if !k.active(t) {
+			continue
+		}
+		s, err := k.signer(origin)
+		if err != nil {
+			return nil, err
+		}
+		if k.KSK {
+			ksks = append(ksks, s)
+		} else {
+			zsks = append(zsks, s)
+		}
+	}
+	// offline KSK: the uploaded DNSKEY RRset and its signatures replace
+	// the ones made by the ZSKs
+	var offlineSigs []*dnsmsg.Resource
+	var offlineNext time.Time
+	if p.OfflineKSK {
+		var keyRRs []*dnsmsg.Resource
+		keyRRs, offlineSigs, offlineNext, err = z.offlineKeys(domain, published, t)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, keyRRs...)
+		ksks = zsks
+	}
+	if len(dsKeys) > 0 {
+		// ask the parent to follow the KSK rollovers (RFC 7344)
+		cds, cdnskey, err := dnssec.NewCDS(origin, dsKeys, ttl)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(append(rrs, cds...), cdnskey...)
+	}
+
+	param, err := p.nsec3Param()
+	if err != nil {
+		return nil, err
+	}
+	if param != nil && prev != nil && prev.param != nil && prev.param.Flags == param.Flags && prev.param.Iterations == param.Iterations && len(prev.param.Salt) == len(param.Salt) {
+		param.Salt = prev.param.Salt
+	}
+
+	// allow for clocks running late
+	inception := t.Add(-time.Hour)
+	var signed []*dnsmsg.Resource
+	if param != nil {
+		signed, err = dnssec.SignZoneNSEC3(origin, rrs, ksks, zsks, inception, expiration, param)
+	} else {
+		signed, err = dnssec.SignZone(origin, rrs, ksks, zsks, inception, expiration)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sz := &signedZone{
+		origin: origin,
+		sigs:   make(map[signedKey][]*dnsmsg.Resource),
+		apex:   make(map[dnsmsg.Type][]*dnsmsg.Resource),
+		param:  param,
+	}
+	for _, rr := range signed {
+		switch rr.Type {
+		case dnsmsg.RRSIG:
+			sig := rr.Data.(*dnsmsg.RDataRRSIG)
+			k := signedKey{rr.Name.Canonical(), sig.TypeCovered}
+			sz.sigs[k] = append(sz.sigs[k], rr)
+		case dnsmsg.NSEC:
+			sz.nsec = append(sz.nsec, rr)
+		case dnsmsg.NSEC3:
+			h, err := nsec3OwnerHash(rr.Name)
+			if err != nil {
+				return nil, err
+			}
+			sz.nsec = append(sz.nsec, rr)
+			sz.hashes = append(sz.hashes, h)
+		case dnsmsg.DNSKEY, dnsmsg.CDS, dnsmsg.CDNSKEY, dnsmsg.NSEC3PARAM:
+			if rr.Name.Equal(origin) {
+				sz.apex[rr.Type] = append(sz.apex[rr.Type], rr)
+			}
+		}
+	}
+	if p.OfflineKSK {
+		for _, typ := range []dnsmsg.Type{dnsmsg.DNSKEY, dnsmsg.CDS, dnsmsg.CDNSKEY} {
+			delete(sz.sigs, signedKey{origin.Canonical(), typ})
+		}
+		for _, rr := range offlineSigs {
+			k := signedKey{origin.Canonical(), rr.Data.(*dnsmsg.RDataRRSIG).TypeCovered}
+			sz.sigs[k] = append(sz.sigs[k], rr)
+		}
+		sz.next = offlineNext
+	}
+	return sz, nil
+}
+
+// nsec3OwnerHash returns the hash in the first label of the owner of an
+// NSEC3 record
+func nsec3OwnerHash(name dnsmsg.Name) ([]byte, error) {
+	return nsec3Encoding.DecodeString(strings.ToUpper(name.SplitLabels()[0]))
+}
+
+// answerApex answers q with the records added to the apex of the zone,
+// such as its DNSKEY records, and returns true if it did. sub is the
+// queried name relative to the zone.
+func (sz *signedZone) answerApex(res *dnsmsg.Message, q *dnsmsg.Question, sub []byte) bool {
+	if sz == nil || len(sub) > 0 {
+		return false
+	}
+	rrs, ok := sz.apex[q.Type]
+	if !ok {
+		return false
+	}
+	res.Answer = append(res.Answer, copyRecords(rrs)...)
+	return true
+}
+
+// addDNSSEC adds to res, the answer to q, the signatures of its RRsets and
+// the NSEC or NSEC3 records proving the names and types it does not have
+// (RFC 4035 section 3.1). name is the queried name relative to the zone,
+// in reverse order, and wild the wildcard that answered, or name itself.
+func (sz *signedZone) addDNSSEC(res *dnsmsg.Message, q *dnsmsg.Question, name, wild []byte) {
+	qname := q.Name.Canonical()
+	var wildName dnsmsg.Name
+	if !bytes.Equal(name, wild) {
+		wildName = sz.absolute(wild)
+	}
+
+	res.Answer = sz.withSignatures(res.Answer, qname, wildName)
+	res.Authority = sz.withSignatures(res.Authority, "", "")
+
+	var proof []*dnsmsg.Resource
+	switch {
+	case len(res.Answer) > 0:
+		if wildName != "" {
+			// the name was synthesized from the wildcard, prove that it
+			// does not exist (RFC 4035 section 3.1.3.3)
+			if sz.param == nil {
+				proof = append(proof, sz.cover(qname))
+			} else {
+				proof = append(proof, sz.cover(sz.nextCloser(qname, parentOf(wildName))))
+			}
+		}
+	case res.Bits.GetRCode() == dnsmsg.ErrName:
+		// RFC 4035 section 3.1.3.2, RFC 5155 section 7.2.2
+		ce := parentOf(sz.absolute(wild))
+		if sz.param == nil {
+			proof = append(proof, sz.cover(qname), sz.cover("*."+ce))
+		} else {
+			proof = append(proof, sz.match(ce), sz.cover(sz.nextCloser(qname, ce)), sz.cover("*."+ce))
+		}
+	case wildName != "":
+		// no data at the wildcard (RFC 4035 section 3.1.3.4, RFC 5155
+		// section 7.2.5)
+		if sz.param == nil {
+			proof = append(proof, sz.cover(qname), sz.match(wildName))
+		} else {
+			ce := parentOf(wildName)
+			proof = append(proof, sz.match(ce), sz.cover(sz.nextCloser(qname, ce)), sz.match(wildName))
+		}
+	default:
+		// no data, the name exists or is an empty non-terminal, which only
+		// has an NSEC3 record (RFC 4035 section 3.1.3.1)
+		if rr := sz.match(qname); rr != nil || sz.param != nil {
+			proof = append(proof, rr)
+		} else {
+			proof = append(proof, sz.cover(qname))
+		}
+	}
+
+	var added []*dnsmsg.Resource
+	for _, rr := range proof {
+		if rr == nil || containsRecord(added, rr) {
+			continue
+		}
+		added = append(added, rr)
+		res.Authority = append(res.Authority, copyRecords([]*dnsmsg.Resource{rr})...)
+		res.Authority = append(res.Authority, copyRecords(sz.sigs[signedKey{rr.Name.Canonical(), rr.Type}])...)
+	}
+}
+
+// withSignatures returns rrs with the signatures of its RRsets appended.
+// RRsets owned by qname synthesized from wildName get the signatures of the
+// wildcard.
+func (sz *signedZone) withSignatures(rrs []*dnsmsg.Resource, qname, wildName dnsmsg.Name) []*dnsmsg.Resource {
+	seen := make(map[signedKey]bool)
+	res := rrs
+	for _, rr := range rrs {
+		name := sz.fqdn(rr.Name).Canonical()
+		k := signedKey{name, rr.Type}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if sigs, ok := sz.sigs[k]; ok {
+			res = append(res, copyRecords(sigs)...)
+			continue
+		}
+		if wildName == "" || name != qname {
+			continue
+		}
+		for _, sig := range sz.sigs[signedKey{wildName, rr.Type}] {
+			c := *sig
+			c.Name = rr.Name
+			res = append(res, &c)
+		}
+	}
+	return res
+}
+
+// absolute returns name, relative to the zone and in reverse order as
+// stored, fully qualified
+func (sz *signedZone) absolute(name []byte) dnsmsg.Name {
+	if len(name) == 0 {
+		return sz.origin
+	}
+	return dnsmsg.Name(string(reverseDnsName(name)) + "." + string(sz.origin))
+}
+
+// fqdn returns name, from an answer, fully qualified
+func (sz *signedZone) fqdn(name dnsmsg.Name) dnsmsg.Name {
+	switch {
+	case name.IsFQDN():
+		return name
+	case name == "":
+		return sz.origin
+	}
+	return name + "." + sz.origin
+}
+
+// parentOf returns name without its first label
+func parentOf(name dnsmsg.Name) dnsmsg.Name {
+	_, p, _ := strings.Cut(string(name), ".")
+	if p == "" {
+		return "."
+	}
+	return dnsmsg.Name(p)
+}
+
+// nextCloser returns the ancestor of name, or name itself, one label below
+// its closest encloser ce (RFC 5155 section 1.3)
+func (sz *signedZone) nextCloser(name, ce dnsmsg.Name) dnsmsg.Name {
+	for n := name; n != ce && n != "."; n = parentOf(n) {
+		if parentOf(n) == ce {
+			return n
+		}
+	}
+	return name
+}
+
+// match returns the NSEC or NSEC3 record of name, or nil if there is none
+func (sz *signedZone) match(name dnsmsg.Name) *dnsmsg.Resource {
+	if sz.param != nil {
+		h, err := dnssec.NSEC3Hash(name, sz.param.Hash, sz.param.Iterations, sz.param.Salt)
+		if err != nil {
+			return nil
+		}
+		i, ok := sort.Find(len(sz.hashes), func(i int) int { return bytes.Compare(h, sz.hashes[i]) })
+		if !ok {
+			return nil
+		}
+		return sz.nsec[i]
+	}
+	i, ok := sort.Find(len(sz.nsec), func(i int) int { return name.Compare(sz.nsec[i].Name) })
+	if !ok {
+		return nil
+	}
+	return sz.nsec[i]
+}
+
+// cover returns the NSEC or NSEC3 record whose interval holds name, or the
+// record of name if it has one
+func (sz *signedZone) cover(name dnsmsg.Name) *dnsmsg.Resource {
+	if len(sz.nsec) == 0 {
+		return nil
+	}
+	var i int
+	if sz.param != nil {
+		h, err := dnssec.NSEC3Hash(name, sz.param.Hash, sz.param.Iterations, sz.param.Salt)
+		if err != nil {
+			return nil
+		}
+		i = sort.Search(len(sz.hashes), func(i int) bool { return bytes.Compare(sz.hashes[i], h) > 0 })
+	} else {
+		i = sort.Search(len(sz.nsec), func(i int) bool { return sz.nsec[i].Name.Compare(name) > 0 })
+	}
+	if i == 0 {
+		// before the first record, covered by the last one
+		i = len(sz.nsec)
+	}
+	return sz.nsec[i-1]
+}
+
+// copyRecords returns copies of rrs, which can be changed while answering
+// without affecting the signed zone
+func copyRecords(rrs []*dnsmsg.Resource) []*dnsmsg.Resource {
+	res := make([]*dnsmsg.Resource, len(rrs))
+	for i, rr := range rrs {
+		c := *rr
+		res[i] = &c
+	}
+	return res
+}
+
+// containsRecord returns true if rrs has a record with the owner and type of
+// rr
+func containsRecord(rrs []*dnsmsg.Resource, rr *dnsmsg.Resource) bool {
+	for _, o := range rrs {
+		if o.Type == rr.Type && o.Name.Equal(rr.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnssec"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+// querySigned queries name/typ with the DO bit and returns the response as
+// seen on the wire
+func querySigned(t *testing.T, name string, typ dnsmsg.Type) *dnsmsg.Message {
+	t.Helper()
+	q := dnsmsg.NewQuery(name, dnsmsg.IN, typ)
+	q.SetDO(true)
+	res, err := handleQuery(context.Background(), q, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to query %s: %s", name, err)
+	}
+	buf, err := res.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	res, err = dnsmsg.Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	return res
+}
+
+// splitSigs returns the records of rrs, and their signatures
+func splitSigs(rrs []*dnsmsg.Resource) (records, sigs []*dnsmsg.Resource) {
+	for _, rr := range rrs {
+		if rr.Type == dnsmsg.RRSIG {
+			sigs = append(sigs, rr)
+		} else {
+			records = append(records, rr)
+		}
+	}
+	return
+}
+
+func TestSignedZone(t *testing.T) {
+	for _, nsec3 := range []bool{false, true} {
+		openTestDb(t)
+		z, err := getOrCreateZone("signed.example.com")
+		if err != nil {
+			t.Fatalf("failed to create zone: %s", err)
+		}
+		z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+		z.setRecord("*.dyn", 3600, dnsmsg.A, "192.0.2.2")
+		z.setRecord("x.c", 3600, dnsmsg.A, "192.0.2.3")
+		z.setRecord("", 3600, dnsmsg.MX, "10 mail.signed.example.com.")
+		if err := z.setSettings(&zoneSettings{DNSSEC: &dnssecPolicy{NSEC3: nsec3}}); err != nil {
+			t.Fatalf("failed to set policy: %s", err)
+		}
+		if err := signZone(z); err != nil {
+			t.Fatalf("failed to sign zone: %s", err)
+		}
+		now := time.Now()
+
+		res := querySigned(t, "signed.example.com.", dnsmsg.DNSKEY)
+		keys, sigs := splitSigs(res.Answer)
+		if len(keys) != 2 {
+			t.Fatalf("nsec3 %v: expected a KSK and a ZSK, got %s", nsec3, res)
+		}
+		if _, err := dnssec.VerifyRRset(keys, sigs, keys, now); err != nil {
+			t.Errorf("nsec3 %v: failed to verify DNSKEY: %s", nsec3, err)
+		}
+
+		var tests = []struct {
+			name     string
+			typ      dnsmsg.Type
+			rcode    dnsmsg.RCode
+			answer   bool
+			wildcard bool
+		}{
+			{"www.signed.example.com.", dnsmsg.A, dnsmsg.NoError, true, false},
+			{"signed.example.com.", dnsmsg.MX, dnsmsg.NoError, true, false},
+			{"signed.example.com.", dnsmsg.CDS, dnsmsg.NoError, true, false},
+			{"host.dyn.signed.example.com.", dnsmsg.A, dnsmsg.NoError, true, true},
+			{"www.signed.example.com.", dnsmsg.AAAA, dnsmsg.NoError, false, false},
+			{"c.signed.example.com.", dnsmsg.A, dnsmsg.NoError, false, false},
+			{"host.dyn.signed.example.com.", dnsmsg.AAAA, dnsmsg.NoError, false, true},
+			{"nope.signed.example.com.", dnsmsg.A, dnsmsg.ErrName, false, false},
+			{"a.b.c.signed.example.com.", dnsmsg.A, dnsmsg.ErrName, false, false},
+		}
+		for _, test := range tests {
+			res := querySigned(t, test.name, test.typ)
+			if res.Bits.GetRCode() != test.rcode || (len(res.Answer) > 0) != test.answer {
+				t.Errorf("nsec3 %v: %s %s: unexpected response %s", nsec3, test.name, test.typ, res)
+				continue
+			}
+			answer, answerSigs := splitSigs(res.Answer)
+			authority, authSigs := splitSigs(res.Authority)
+			if test.answer {
+				sig, err := dnssec.VerifyRRset(answer, answerSigs, keys, now)
+				if err != nil {
+					t.Errorf("nsec3 %v: %s %s: failed to verify answer: %s", nsec3, test.name, test.typ, err)
+					continue
+				}
+				if test.wildcard {
+					if err := dnssec.VerifyWildcardAt(dnsmsg.Name(test.name), sig.Labels, authority, authSigs, keys, now); err != nil {
+						t.Errorf("nsec3 %v: %s %s: failed to verify wildcard: %s", nsec3, test.name, test.typ, err)
+					}
+				}
+				continue
+			}
+			q := &dnsmsg.Question{Name: dnsmsg.Name(test.name), Type: test.typ, Class: dnsmsg.IN}
+			if err := dnssec.VerifyDenialAt(q, test.rcode, authority, authSigs, keys, now); err != nil {
+				t.Errorf("nsec3 %v: %s %s: failed to verify denial: %s", nsec3, test.name, test.typ, err)
+			}
+		}
+
+		// no DNSSEC records without the DO bit
+		res, err = handleQuery(context.Background(), dnsmsg.NewQuery("www.signed.example.com.", dnsmsg.IN, dnsmsg.A), nil, nil)
+		if err != nil || len(res.Answer) != 1 {
+			t.Errorf("nsec3 %v: unexpected answer without DO: %s", nsec3, res)
+		}
+
+		// the zone is dropped once its policy is removed
+		z.setSettings(&zoneSettings{})
+		signZone(z)
+		res = querySigned(t, "www.signed.example.com.", dnsmsg.A)
+		if _, sigs := splitSigs(res.Answer); len(sigs) > 0 {
+			t.Errorf("nsec3 %v: unsigned zone answered with signatures", nsec3)
+		}
+	}
+}
+
+func TestKeyRollover(t *testing.T) {
+	openTestDb(t)
+	c := newManualClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+
+	z, err := getOrCreateZone("roll.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 600, dnsmsg.A, "192.0.2.1")
+	day := uint32(24 * 3600)
+	z.setSettings(&zoneSettings{DNSSEC: &dnssecPolicy{ZSKLifetime: 30 * day, KSKLifetime: 365 * day, DNSKEYTTL: 600}})
+
+	// count returns the number of KSK and ZSK published, and the number of
+	// CDS records
+	count := func() (ksks, zsks, cds int) {
+		t.Helper()
+		if err := signZone(z); err != nil {
+			t.Fatalf("failed to sign zone: %s", err)
+		}
+		sz := signedZones.get(z, "roll.example.com")
+		for _, rr := range sz.apex[dnsmsg.DNSKEY] {
+			if rr.Data.(*dnsmsg.RDataDNSKEY).Flags&dnssec.FlagSEP != 0 {
+				ksks++
+			} else {
+				zsks++
+			}
+		}
+		return ksks, zsks, len(sz.apex[dnsmsg.CDS])
+	}
+	// signer returns the tag of the key signing www
+	signer := func() uint16 {
+		t.Helper()
+		sz := signedZones.get(z, "roll.example.com")
+		sigs := sz.sigs[signedKey{"www.roll.example.com.", dnsmsg.A}]
+		if len(sigs) != 1 {
+			t.Fatalf("expected one signature, got %d", len(sigs))
+		}
+		return sigs[0].Data.(*dnsmsg.RDataRRSIG).KeyTag
+	}
+
+	if k, zk, cds := count(); k != 1 || zk != 1 || cds != 1 {
+		t.Fatalf("new zone: got %d KSK, %d ZSK, %d CDS", k, zk, cds)
+	}
+	old := signer()
+
+	// ZSK pre-publication: the new key is published first, signs once in
+	// all caches, then the old one is removed
+	c.Advance(31 * 24 * time.Hour)
+	if _, zk, _ := count(); zk != 2 || signer() != old {
+		t.Errorf("rollover start: got %d ZSK, signed by %d", zk, signer())
+	}
+	c.Advance(*dnssecPropagation + 600*time.Second)
+	if _, zk, _ := count(); zk != 2 || signer() == old {
+		t.Errorf("new key active: got %d ZSK, signed by %d", zk, signer())
+	}
+	c.Advance(*dnssecPropagation + 600*time.Second)
+	if _, zk, _ := count(); zk != 1 {
+		t.Errorf("rollover end: got %d ZSK", zk)
+	}
+
+	// KSK double-DS: the parent gets the new DS first, through CDS
+	c.Advance(365 * 24 * time.Hour)
+	if k, _, cds := count(); k != 1 || cds != 2 {
+		t.Errorf("KSK rollover start: got %d KSK, %d CDS", k, cds)
+	}
+	c.Advance(*dnssecParentPropagation + *dnssecParentDSTTL)
+	if k, _, cds := count(); k != 1 || cds != 2 {
+		t.Errorf("KSK swapped: got %d KSK, %d CDS", k, cds)
+	}
+	c.Advance(*dnssecPropagation + 600*time.Second)
+	if k, _, cds := count(); k != 1 || cds != 1 {
+		t.Errorf("KSK rollover end: got %d KSK, %d CDS", k, cds)
+	}
+	keys, _ := z.listKeys()
+	if len(keys) != 2 {
+		t.Errorf("expected the old keys to be deleted, got %d keys", len(keys))
+	}
+}
+
+func TestOfflineKSK(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("offline.example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	z.setRecord("", 3600, dnsmsg.MX, "10 mail.offline.example.com.")
+	policy := &dnssecPolicy{OfflineKSK: true}
+	if err := policy.validate(); err != nil {
+		t.Fatalf("invalid policy: %s", err)
+	}
+	if err := (&dnssecPolicy{OfflineKSK: true, KSKLifetime: 3600}).validate(); err == nil {
+		t.Errorf("offline KSK with a lifetime was accepted")
+	}
+	z.setSettings(&zoneSettings{DNSSEC: policy})
+
+	// the zone cannot be served until the DNSKEY RRset is signed
+	if err := signZone(z); err == nil {
+		t.Fatalf("zone signed without a DNSKEY RRset")
+	}
+	keys, err := z.listKeys()
+	if err != nil || len(keys) != 1 || keys[0].KSK {
+		t.Fatalf("expected a single ZSK, got %d keys (%v)", len(keys), err)
+	}
+
+	rw := httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/dnssec-keys?zone=offline.example.com", nil))
+	var list []*apiKey
+	if err := json.NewDecoder(rw.Body).Decode(&list); err != nil || len(list) != 1 {
+		t.Fatalf("failed to list keys: %s %v", rw.Body, err)
+	}
+	zsk, err := dnszone.Parse(strings.NewReader("@ 3600 IN DNSKEY "+list[0].DNSKEY+"\n"), "offline.example.com.")
+	if err != nil {
+		t.Fatalf("failed to parse ZSK: %s", err)
+	}
+
+	// the KSK signs the DNSKEY RRset and the CDS records offline
+	key, priv, err := dnssec.GenerateKey(dnssec.ECDSAP256SHA256, dnssec.FlagZone|dnssec.FlagSEP)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	ksk, err := dnssec.NewSigner("offline.example.com.", key, priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+	now := time.Now()
+	dnskeys := append(zsk, ksk.DNSKEY(3600))
+	cds, _, err := dnssec.NewCDS("offline.example.com.", []*dnsmsg.RDataDNSKEY{key}, 3600)
+	if err != nil {
+		t.Fatalf("failed to create CDS: %s", err)
+	}
+	upload := append(append([]*dnsmsg.Resource{}, dnskeys...), cds...)
+	for _, rrset := range [][]*dnsmsg.Resource{dnskeys, cds} {
+		sig, err := ksk.Sign(rrset, now.Add(-time.Hour), now.Add(30*24*time.Hour))
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+		upload = append(upload, sig)
+	}
+	buf := &bytes.Buffer{}
+	if err := dnszone.Write(buf, "offline.example.com.", upload); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	// a signature by a key that is not in the set is rejected
+	bad := strings.Replace(buf.String(), "257 3 13", "256 3 13", 1)
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/dnssec-dnskey?zone=offline.example.com", strings.NewReader(bad)))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("set without KSK: expected 400, got %d", rw.Code)
+	}
+
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("POST", "/api/dnssec-dnskey?zone=offline.example.com", buf))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("failed to upload: %d %s", rw.Code, rw.Body)
+	}
+	if err := signZone(z); err != nil {
+		t.Fatalf("failed to sign zone: %s", err)
+	}
+
+	res := querySigned(t, "offline.example.com.", dnsmsg.DNSKEY)
+	served, sigs := splitSigs(res.Answer)
+	if len(served) != 2 || len(sigs) != 1 || sigs[0].Data.(*dnsmsg.RDataRRSIG).KeyTag != dnssec.KeyTag(key) {
+		t.Fatalf("unexpected DNSKEY answer %s", res)
+	}
+	anchor := []*dnsmsg.Resource{ksk.DNSKEY(3600)}
+	if _, err := dnssec.VerifyRRset(served, sigs, anchor, now); err != nil {
+		t.Errorf("failed to verify DNSKEY with the KSK: %s", err)
+	}
+	res = querySigned(t, "offline.example.com.", dnsmsg.CDS)
+	if answer, sigs := splitSigs(res.Answer); len(answer) != 1 {
+		t.Errorf("unexpected CDS answer %s", res)
+	} else if _, err := dnssec.VerifyRRset(answer, sigs, anchor, now); err != nil {
+		t.Errorf("failed to verify CDS with the KSK: %s", err)
+	}
+	res = querySigned(t, "www.offline.example.com.", dnsmsg.A)
+	if answer, sigs := splitSigs(res.Answer); len(answer) != 1 {
+		t.Errorf("unexpected answer %s", res)
+	} else if _, err := dnssec.VerifyRRset(answer, sigs, served, now); err != nil {
+		t.Errorf("failed to verify answer: %s", err)
+	}
+
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/dnssec-dnskey?zone=offline.example.com", nil))
+	var sets []*apiKeySet
+	if err := json.NewDecoder(rw.Body).Decode(&sets); err != nil || len(sets) != 1 || !sets[0].CDS || len(sets[0].Keys) != 2 {
+		t.Errorf("unexpected key sets %s (%v)", rw.Body, err)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+var (
+	soakDuration = flag.Duration("soak", 0, "duration of TestSoak, which only runs for a few seconds by default")
+	soakRestart  = flag.Duration("soak-restart", 0, "interval between restarts of the transports in TestSoak (default a tenth of the duration)")
+	soakWorkers  = flag.Int("soak-workers", 8, "number of concurrent clients in TestSoak")
+)
+
+// soakServer runs the UDP, TCP and DNS over HTTPS transports on loopback
+// addresses, and can restart them while clients are using them
+type soakServer struct {
+	lk  sync.Mutex
+	udp net.PacketConn
+	tcp net.Listener
+	doh *httptest.Server
+
+	udpAddr atomic.Value // string
+	tcpAddr atomic.Value // string
+}
+
+func newSoakServer(t *testing.T) *soakServer {
+	s := &soakServer{}
+	if err := s.startUdp(); err != nil {
+		t.Fatalf("failed to listen UDP: %s", err)
+	}
+	if err := s.startTcp(); err != nil {
+		t.Fatalf("failed to listen TCP: %s", err)
+	}
+
+	h := http.HandlerFunc(handleHttpsReq)
+	s.doh = httptest.NewUnstartedServer(h)
+	s.doh.Config = newDohServer(h)
+	s.doh.EnableHTTP2 = true
+	s.doh.StartTLS()
+	return s
+}
+
+func (s *soakServer) startUdp() error {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	serveUdp(l)
+	s.udp = l
+	s.udpAddr.Store(l.LocalAddr().String())
+	return nil
+}
+
+func (s *soakServer) startTcp() error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	serveTcp(l)
+	s.tcp = l
+	s.tcpAddr.Store(l.Addr().String())
+	return nil
+}
+
+// restart stops and starts again one of the transports at random. Clients
+// of the previous listeners get errors or timeouts.
+func (s *soakServer) restart(rnd *rand.Rand) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	switch rnd.Intn(3) {
+	case 0:
+		s.udp.Close()
+		return s.startUdp()
+	case 1:
+		s.tcp.Close()
+		return s.startTcp()
+	default:
+		s.doh.CloseClientConnections()
+		return nil
+	}
+}
+
+func (s *soakServer) stop() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.udp.Close()
+	s.tcp.Close()
+	s.doh.Close()
+}
+
+// query sends q over transport tr, and returns the response
+func (s *soakServer) query(client *http.Client, tr string, q *dnsmsg.Message) (*dnsmsg.Message, error) {
+	switch tr {
+	case "udp":
+		c, err := net.Dial("udp", s.udpAddr.Load().(string))
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(time.Second))
+		buf, err := q.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Write(buf); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 1500)
+		n, err := c.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return dnsmsg.Parse(buf[:n])
+	case "tcp":
+		c, err := net.Dial("tcp", s.tcpAddr.Load().(string))
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(time.Second))
+		if err := dnsmsg.WriteStreamMessage(c, q); err != nil {
+			return nil, err
+		}
+		return dnsmsg.ReadStreamMessage(c)
+	default:
+		buf, err := q.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Post(s.doh.URL+"/dns-query", "application/dns-message", bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if buf, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("status %d: %s", resp.StatusCode, buf)
+		}
+		return dnsmsg.Parse(buf)
+	}
+}
+
+// soakUpdate sets the generation counter of the soak zone through the API
+func soakUpdate(gen int) error {
+	rw := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"name":"gen","type":"TXT","ttl":60,"values":["\"%d\""]}`, gen)
+	handleApi(rw, httptest.NewRequest("PUT", "/api/records?zone=soak.example", strings.NewReader(body)))
+	if rw.Code != 200 {
+		return fmt.Errorf("status %d: %s", rw.Code, rw.Body)
+	}
+	return nil
+}
+
+// soakGen returns the generation counter in the TXT record rr
+func soakGen(rr *dnsmsg.Resource) (int, error) {
+	s, err := strconv.Unquote(rr.Data.String())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+// openFds returns the number of open file descriptors, or -1 if unknown
+func openFds() int {
+	f, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(f)
+}
+
+// TestSoak runs all transports under a mix of queries, updates and zone
+// exports while restarting them, and checks that answers are always correct
+// and that nothing leaks once everything is stopped. Run it for hours with
+// the -soak flag, for example:
+//
+//	go test -run TestSoak -soak 4h -timeout 0
+func TestSoak(t *testing.T) {
+	duration := *soakDuration
+	if duration == 0 {
+		if testing.Short() {
+			t.Skip("skipping soak test in short mode")
+		}
+		duration = 2 * time.Second
+	}
+	restart := *soakRestart
+	if restart == 0 {
+		restart = duration / 10
+	}
+
+	openTestDb(t)
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	z, err := getOrCreateZone("soak.example")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+	if err := soakUpdate(0); err != nil {
+		t.Fatalf("failed to set generation: %s", err)
+	}
+
+	goroutines, fds := runtime.NumGoroutine(), openFds()
+	s := newSoakServer(t)
+	client := s.doh.Client()
+
+	var (
+		wg      sync.WaitGroup
+		gen     atomic.Int64
+		queries [3]atomic.Int64
+		errs    [3]atomic.Int64
+		exports atomic.Int64
+	)
+	transports := []string{"udp", "tcp", "https"}
+	done := make(chan struct{})
+	var failOnce sync.Once
+	fail := func(format string, args ...any) {
+		t.Errorf(format, args...)
+		failOnce.Do(func() { close(done) })
+	}
+	stopped := func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// clients, checking answers are correct and never go back in time
+	for i := 0; i < *soakWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(i)))
+			last := 0
+			for !stopped() {
+				n := rnd.Intn(len(transports))
+				q := dnsmsg.NewQuery("www.soak.example.", dnsmsg.IN, dnsmsg.A)
+				if rnd.Intn(2) == 0 {
+					q = dnsmsg.NewQuery("GEN.soak.example.", dnsmsg.IN, dnsmsg.TXT)
+				}
+				res, err := s.query(client, transports[n], q)
+				queries[n].Add(1)
+				if err != nil {
+					// expected while the transport restarts
+					errs[n].Add(1)
+					continue
+				}
+				if res.ID != q.ID || len(res.Answer) != 1 || res.Answer[0].Name != q.Question[0].Name {
+					fail("%s: unexpected response to %s: %s", transports[n], q.Question[0], res)
+					return
+				}
+				if q.Question[0].Type == dnsmsg.A {
+					if s := res.Answer[0].Data.String(); s != "192.0.2.1" {
+						fail("%s: got address %s", transports[n], s)
+						return
+					}
+					continue
+				}
+				v, err := soakGen(res.Answer[0])
+				if err != nil || v < last {
+					fail("%s: got generation %s after %d", transports[n], res.Answer[0].Data, last)
+					return
+				}
+				last = v
+			}
+		}(i)
+	}
+
+	// updates
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stopped() {
+			if err := soakUpdate(int(gen.Load() + 1)); err != nil {
+				fail("failed to update: %s", err)
+				return
+			}
+			gen.Add(1)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// zone exports, the closest dnsd has to transfers
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stopped() {
+			rw := httptest.NewRecorder()
+			handleApi(rw, httptest.NewRequest("GET", "/api/zone-export?zone=soak.example", nil))
+			rrs, err := dnszone.Parse(rw.Body, "soak.example.")
+			if err != nil {
+				fail("failed to parse export: %s\n%s", err, rw.Body)
+				return
+			}
+			found := 0
+			for _, rr := range rrs {
+				switch {
+				case rr.Type == dnsmsg.A && rr.Data.String() == "192.0.2.1":
+					found += 1
+				case rr.Type == dnsmsg.TXT:
+					if _, err := soakGen(rr); err == nil {
+						found += 1
+					}
+				}
+			}
+			if found != 2 {
+				fail("unexpected export:\n%s", rw.Body)
+				return
+			}
+			exports.Add(1)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	// chaos
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		tick := time.NewTicker(restart)
+		defer tick.Stop()
+		end := time.After(duration)
+		for {
+			select {
+			case <-tick.C:
+				if err := s.restart(rnd); err != nil {
+					fail("failed to restart: %s", err)
+					return
+				}
+			case <-end:
+				failOnce.Do(func() { close(done) })
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	s.stop()
+	client.CloseIdleConnections()
+
+	for n, tr := range transports {
+		q, e := queries[n].Load(), errs[n].Load()
+		t.Logf("%s: %d queries, %d errors", tr, q, e)
+		if q == 0 || e*2 > q {
+			t.Errorf("%s: too many errors (%d out of %d queries)", tr, e, q)
+		}
+	}
+	t.Logf("%d updates, %d exports", gen.Load(), exports.Load())
+
+	// everything started by the test must be gone after a moment
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g, f := runtime.NumGoroutine(), openFds()
+		if g <= goroutines && f <= fds {
+			break
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Errorf("leak: %d goroutines (%d before), %d open files (%d before)\n%s", g, goroutines, f, fds, buf[:runtime.Stack(buf, true)])
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
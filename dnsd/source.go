@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"log"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var debugSource = flag.Bool("debug-source", false, "report where answers come from as extended error text in EDNS responses")
+
+// answerSourceStats counts responses by answer source
+var answerSourceStats = expvar.NewMap("answer_source")
+
+// answerSource tells where the answer to a query came from. When several
+// sources contributed to a response, the highest value wins.
+type answerSource int
+
+const (
+	sourceSynthesized answerSource = iota // generated by dnsd (errors, timeouts, ...)
+	sourceZone                            // records stored in a zone
+	sourceHandler                         // records generated by a handler
+	sourceRewrite                         // rewrite rule
+	sourceDhcp                            // DHCP lease
+)
+
+func (s answerSource) String() string {
+	switch s {
+	case sourceSynthesized:
+		return "synthesized"
+	case sourceZone:
+		return "zone"
+	case sourceHandler:
+		return "handler"
+	case sourceRewrite:
+		return "rewrite"
+	case sourceDhcp:
+		return "dhcp"
+	default:
+		return "unknown"
+	}
+}
+
+// setAnswerSource records that src contributed to the answer of the query
+// being processed in ctx
+func setAnswerSource(ctx context.Context, src answerSource) {
+	if st := getQueryState(ctx); st != nil && src > st.source {
+		st.source = src
+	}
+}
+
+// reportAnswerSource logs and counts the answer source of a response, and
+// adds it to the response if -debug-source is enabled
+func reportAnswerSource(st *queryState, q *dnsmsg.Question, pkt *dnsmsg.Message) {
+	src := st.source.String()
+	answerSourceStats.Add(src, 1)
+	log.Printf("answered %s from %s: %s", q, src, pkt.Bits.GetRCode().String())
+
+	if *debugSource && pkt.HasEDNS {
+		pkt.AddExtendedError(dnsmsg.EDEOther, "answer source: "+src)
+	}
+}
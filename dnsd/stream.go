@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	streamWriteTimeout = flag.Duration("stream-write-timeout", 10*time.Second, "deadline for writing responses on stream connections")
+	streamPipeline     = flag.Int("stream-pipeline", 16, "maximum number of queries processed concurrently per stream connection")
+)
+
+// maxCoalesce is the amount of data above which we stop merging queued
+// responses into a single write
+const maxCoalesce = 16 * 1024
+
+var errWriterClosed = errors.New("stream writer is closed")
+
+// streamWriter sends length-prefixed responses on a stream connection (TCP
+// and other transports using the same framing). Responses can be submitted
+// from multiple goroutines in any order, as RFC 7766 allows answering
+// pipelined queries out of order. Responses queued while a write is in
+// progress are coalesced into a single write, so that small responses end
+// up in the same segment.
+type streamWriter struct {
+	c       net.Conn
+	ch      chan []byte
+	done    chan struct{}
+	timeout time.Duration
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func newStreamWriter(c net.Conn, timeout time.Duration) *streamWriter {
+	w := &streamWriter{
+		c:       c,
+		ch:      make(chan []byte, 16),
+		done:    make(chan struct{}),
+		timeout: timeout,
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// WriteMsg queues a response for writing
+func (w *streamWriter) WriteMsg(buf []byte) error {
+	if len(buf) > 65535 {
+		return errors.New("packet too big")
+	}
+	pkt := make([]byte, 2, len(buf)+2)
+	binary.BigEndian.PutUint16(pkt, uint16(len(buf)))
+	pkt = append(pkt, buf...)
+
+	select {
+	case w.ch <- pkt:
+		return nil
+	case <-w.done:
+		return errWriterClosed
+	}
+}
+
+// Close flushes queued responses and stops the writer. No call to WriteMsg
+// may happen after or during Close.
+func (w *streamWriter) Close() {
+	w.once.Do(func() { close(w.ch) })
+	w.wg.Wait()
+}
+
+func (w *streamWriter) run() {
+	defer w.wg.Done()
+	defer close(w.done)
+
+	var buf []byte
+
+	for pkt := range w.ch {
+		buf = append(buf[:0], pkt...)
+
+		// grab whatever else is already waiting
+	coalesce:
+		for len(buf) < maxCoalesce {
+			select {
+			case pkt, ok := <-w.ch:
+				if !ok {
+					break coalesce
+				}
+				buf = append(buf, pkt...)
+			default:
+				break coalesce
+			}
+		}
+
+		if w.timeout > 0 {
+			// deadlines are enforced by the OS, so use real time here
+			w.c.SetWriteDeadline(time.Now().Add(w.timeout))
+		}
+		if _, err := w.c.Write(buf); err != nil {
+			log.Printf("[stream] failed to write to %s: %s", w.c.RemoteAddr(), err)
+			w.c.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// pipeListener is an in-memory net.Listener returning the server side of
+// pipes created by dial
+type pipeListener struct {
+	ch   chan net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{ch: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.ch:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) dial() net.Conn {
+	a, b := net.Pipe()
+	l.ch <- a
+	return b
+}
+
+func TestStreamWriter(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	w := newStreamWriter(a, time.Second)
+
+	// submit responses concurrently, they may arrive in any order
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := w.WriteMsg([]byte{byte(i)}); err != nil {
+				t.Errorf("failed to write: %s", err)
+			}
+		}(i)
+	}
+
+	seen := make(map[byte]bool)
+	go func() {
+		wg.Wait()
+		w.Close()
+		a.Close()
+	}()
+
+	for {
+		var l uint16
+		if err := binary.Read(b, binary.BigEndian, &l); err != nil {
+			if err != io.EOF {
+				t.Errorf("failed to read: %s", err)
+			}
+			break
+		}
+		buf := make([]byte, l)
+		if _, err := io.ReadFull(b, buf); err != nil || l != 1 {
+			t.Fatalf("bad frame of length %d: %v", l, err)
+		}
+		seen[buf[0]] = true
+	}
+
+	if len(seen) != 50 {
+		t.Errorf("expected 50 responses, got %d", len(seen))
+	}
+}
+
+func TestServeTcpPipe(t *testing.T) {
+	openTestDb(t)
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+	z.setRecord("www", 3600, dnsmsg.A, "192.0.2.1")
+
+	l := newPipeListener()
+	defer l.Close()
+	serveTcp(l)
+
+	c := l.dial()
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	q := dnsmsg.NewQuery("www.example.com.", dnsmsg.IN, dnsmsg.A)
+	if err := dnsmsg.WriteStreamMessage(c, q); err != nil {
+		t.Fatalf("failed to send query: %s", err)
+	}
+	res, err := dnsmsg.ReadStreamMessage(c)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+	if res.ID != q.ID || len(res.Answer) != 1 || res.Answer[0].Data.String() != "192.0.2.1" {
+		t.Errorf("unexpected response %s", res)
+	}
+}
+
+func TestQueryNotImpl(t *testing.T) {
+	openTestDb(t)
+
+	q := dnsmsg.NewNotify("example.com.", 1)
+	res, err := handleQuery(context.Background(), q, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to handle NOTIFY: %s", err)
+	}
+	if res.Bits.GetRCode() != dnsmsg.ErrNotImpl || res.Bits.OpCode() != dnsmsg.Notify || res.ID != q.ID || len(res.Question) != 1 {
+		t.Errorf("unexpected response %s", res)
+	}
+}
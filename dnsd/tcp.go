@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"io"
 	"log"
 	"net"
 	"runtime"
+	"sync"
 
 	"github.com/KarpelesLab/dns/dnsmsg"
 	"github.com/KarpelesLab/shutdown"
@@ -33,6 +35,12 @@ func tcpListen(ip net.IP) {
 		}
 	}
 
+	serveTcp(l)
+}
+
+// serveTcp answers queries on connections accepted from l, which can be any
+// stream listener (TCP, unix socket, in-memory pipe...)
+func serveTcp(l net.Listener) {
 	// one thread per cpu since we'll spawn extra threads per connected clients
 	cnt := runtime.NumCPU()
 
@@ -42,9 +50,9 @@ func tcpListen(ip net.IP) {
 	log.Printf("[tcp] listening on port %s with %d goroutines", l.Addr().String(), cnt)
 }
 
-func tcpThread(l *net.TCPListener) {
+func tcpThread(l net.Listener) {
 	for {
-		c, err := l.AcceptTCP()
+		c, err := l.Accept()
 		if err != nil {
 			log.Printf("[tcp] failed to accept connection: %s", err)
 			return
@@ -54,9 +62,21 @@ func tcpThread(l *net.TCPListener) {
 	}
 }
 
-func tcpClient(c *net.TCPConn) {
+func tcpClient(c net.Conn) {
 	defer c.Close()
 
+	// context is cancelled when the connection goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newStreamWriter(c, *streamWriteTimeout)
+	defer w.Close()
+
+	// queries are processed concurrently and answered as soon as ready
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sem := make(chan struct{}, max(*streamPipeline, 1))
+
 	for {
 		// tcp packet first has 2 bytes packet len
 		var l uint16
@@ -78,19 +98,25 @@ func tcpClient(c *net.TCPConn) {
 			return
 		}
 
-		handleTcpPacket(buf, c)
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			handleTcpPacket(ctx, buf, c, w)
+		}()
 	}
 }
 
-func handleTcpPacket(buf []byte, c *net.TCPConn) {
+func handleTcpPacket(ctx context.Context, buf []byte, c net.Conn, w *streamWriter) {
 	// parse pkg
-	msg, err := dnsmsg.Parse(buf)
+	msg, err := dnsmsg.ParseWithOptions(buf, queryParseOptions())
 	if err != nil {
 		log.Printf("[tcp] failed to parse msg from %s: %s", c.RemoteAddr(), err)
 		return
 	}
 
-	res, err := handleQuery(msg, c.LocalAddr(), c.RemoteAddr())
+	res, err := handleQuery(ctx, msg, c.LocalAddr(), c.RemoteAddr())
 	if err != nil {
 		log.Printf("[tcp] failed to respond to %s: %s", c.RemoteAddr(), err)
 		return
@@ -106,17 +132,9 @@ func handleTcpPacket(buf []byte, c *net.TCPConn) {
 		return
 	}
 
-	// write packet len + packet
-	if len(buf) > 65535 {
-		log.Printf("[tcp] failed to respond (packet too big) to %s", c.RemoteAddr())
-		return
-	}
-
-	binary.Write(c, binary.BigEndian, uint16(len(buf)))
-	_, err = c.Write(buf)
+	err = w.WriteMsg(buf)
 	if err != nil {
-		log.Printf("[tcp] failed to write to %s: %s", c.RemoteAddr(), err)
-		c.Close()
+		log.Printf("[tcp] failed to respond to %s: %s", c.RemoteAddr(), err)
 		return
 	}
 }
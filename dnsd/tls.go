@@ -28,7 +28,7 @@ func tlsLoadCertificate() []tls.Certificate {
 		MaxPathLen: 1,
 	}
 
-	ctpl.NotBefore = time.Now()
+	ctpl.NotBefore = clock.Now()
 	ctpl.NotAfter = ctpl.NotBefore.Add(30 * 24 * time.Hour) // 30 days
 
 	key := getSelfKey()
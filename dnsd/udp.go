@@ -38,7 +38,11 @@ func listenUdp(ip net.IP) {
 			return
 		}
 	}
+	serveUdp(l)
+}
 
+// serveUdp answers queries received on l, which can be any packet conn
+func serveUdp(l net.PacketConn) {
 	// two threads per cpu
 	cnt := runtime.NumCPU() * 2
 
@@ -50,7 +54,9 @@ func listenUdp(ip net.IP) {
 
 func udpThread(l net.PacketConn) {
 	buf := make([]byte, 1500)
+	p := &dnsmsg.Parser{Options: queryParseOptions()} // queries are handled one at a time, reuse memory
 	laddr := l.LocalAddr()
+	ctx := context.Background()
 
 	for {
 		n, addr, err := l.ReadFrom(buf)
@@ -60,19 +66,20 @@ func udpThread(l net.PacketConn) {
 			return
 		}
 
-		handleUdpPacket(buf[:n], l, laddr, addr)
+		handleUdpPacket(ctx, p, buf[:n], l, laddr, addr)
 	}
 }
 
-func handleUdpPacket(buf []byte, l net.PacketConn, laddr, raddr net.Addr) {
+func handleUdpPacket(ctx context.Context, p *dnsmsg.Parser, buf []byte, l net.PacketConn, laddr, raddr net.Addr) {
 	// parse pkg
-	msg, err := dnsmsg.Parse(buf)
+	msg, err := p.Parse(buf)
 	if err != nil {
 		log.Printf("[udp] failed to parse msg from %s: %s", raddr, err)
 		return
 	}
+	size := udpResponseSize(msg)
 
-	res, err := handleQuery(msg, laddr, raddr)
+	res, err := handleQuery(ctx, msg, laddr, raddr)
 	if err != nil {
 		log.Printf("[udp] failed to respond to %s: %s", raddr, err)
 		return
@@ -82,6 +89,10 @@ func handleUdpPacket(buf []byte, l net.PacketConn, laddr, raddr net.Addr) {
 		return
 	}
 
+	if _, err = res.Truncate(size, dnsmsg.TruncateAdditionalFirst); err != nil {
+		log.Printf("[udp] failed to make response to %s: %s", raddr, err)
+		return
+	}
 	buf, err = res.MarshalBinary()
 	if err != nil {
 		log.Printf("[udp] failed to make response to %s: %s", raddr, err)
@@ -90,3 +101,13 @@ func handleUdpPacket(buf []byte, l net.PacketConn, laddr, raddr net.Addr) {
 
 	l.WriteTo(buf, raddr)
 }
+
+// udpResponseSize returns the maximum size of a UDP response to query q,
+// which is the payload size advertised by the client, capped to ours (RFC
+// 6891 section 6.2.5)
+func udpResponseSize(q *dnsmsg.Message) int {
+	if !q.HasEDNS {
+		return 512
+	}
+	return max(512, min(int(q.ReqUDPSize), int(*ednsUDPSize)))
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
 )
 
 func reverseDnsName(n []byte) []byte {
 	// reverse dns name, make lowercase, etc
-	n = bytes.ToLower(n)
+	n = dnsmsg.AppendLowerASCII(make([]byte, 0, len(n)), n)
 
 	var res []byte
 
@@ -29,6 +34,42 @@ func reverseDnsName(n []byte) []byte {
 	}
 }
 
+// ptrAddr returns the address of reverse lookup name n (lowercase, without
+// final dot), or nil if n is not a complete in-addr.arpa or ip6.arpa name
+func ptrAddr(n string) net.IP {
+	if v, ok := strings.CutSuffix(n, ".in-addr.arpa"); ok {
+		p := strings.Split(v, ".")
+		if len(p) != 4 {
+			return nil
+		}
+		ip := make(net.IP, 4)
+		for i, s := range p {
+			b, err := strconv.ParseUint(s, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[3-i] = byte(b)
+		}
+		return ip
+	}
+	if v, ok := strings.CutSuffix(n, ".ip6.arpa"); ok {
+		p := strings.Split(v, ".")
+		if len(p) != 32 {
+			return nil
+		}
+		ip := make(net.IP, 16)
+		for i, s := range p {
+			b, err := strconv.ParseUint(s, 16, 4)
+			if err != nil || len(s) != 1 {
+				return nil
+			}
+			ip[15-i/2] |= byte(b) << (4 * (i % 2))
+		}
+		return ip
+	}
+	return nil
+}
+
 // bdup is a simple byte duplication function used for bolt results
 func bdup(v []byte) []byte {
 	if len(v) == 0 {
@@ -41,18 +82,26 @@ func bdup(v []byte) []byte {
 }
 
 func now() []byte {
-	// return now as a 12 bytes slice. Big endian is important for ordering
-	now := time.Now()
+	return timeKey(clock.Now())
+}
+
+// timeKey returns t as a 12 bytes slice. Big endian is important for ordering
+func timeKey(t time.Time) []byte {
 	res := make([]byte, 12)
 
-	binary.BigEndian.PutUint64(res[:8], uint64(now.Unix()))       // no way "now" can be negative
-	binary.BigEndian.PutUint32(res[8:], uint32(now.Nanosecond())) // max=3b9ac9ff
+	binary.BigEndian.PutUint64(res[:8], uint64(t.Unix()))       // no way "now" can be negative
+	binary.BigEndian.PutUint32(res[8:], uint32(t.Nanosecond())) // max=3b9ac9ff
 	return res
 }
 
+// parseTimeKey decodes a value returned by timeKey
+func parseTimeKey(v []byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint64(v[:8])), int64(binary.BigEndian.Uint32(v[8:12])))
+}
+
 func makeSOA() string {
 	// tbqh serial is quite meaningless since we do not use AXFR. Let's just set it to today for now.
-	now := time.Now()
+	now := clock.Now()
 	serial := now.Year()*10000 + int(now.Month())*100 + now.Day()
 
 	return fmt.Sprintf("%s %s %d %d %d %d %d", "ns1", "admin", serial, 900, 900, 1800, 60)
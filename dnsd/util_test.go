@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestClockNow(t *testing.T) {
+	c := newManualClock(time.Date(2024, 7, 29, 12, 0, 0, 5, time.UTC))
+	clock = c
+	defer func() { clock = systemClock{} }()
+
+	v := now()
+	if binary.BigEndian.Uint64(v[:8]) != uint64(c.Now().Unix()) || binary.BigEndian.Uint32(v[8:]) != 5 {
+		t.Errorf("unexpected now() value %x", v)
+	}
+
+	if soa := makeSOA(); soa != "ns1 admin 20240729 900 900 1800 60" {
+		t.Errorf("unexpected SOA %s", soa)
+	}
+
+	c.Advance(24 * time.Hour)
+	if soa := makeSOA(); soa != "ns1 admin 20240730 900 900 1800 60" {
+		t.Errorf("unexpected SOA after advance %s", soa)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// events sent to webhooks
+const (
+	eventZoneCreate   = "zone.create"
+	eventZoneUpdate   = "zone.update"
+	eventZoneDelete   = "zone.delete"
+	eventRecordCreate = "record.create"
+	eventRecordUpdate = "record.update"
+	eventRecordDelete = "record.delete"
+)
+
+const (
+	webhookWorkers  = 4
+	webhookAttempts = 3
+)
+
+// webhook is an URL notified of zone changes. Payloads are signed with
+// HMAC-SHA256 using Secret, and the signature is sent in the
+// X-Dnsd-Signature header.
+type webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Zone   string   `json:"zone,omitempty"`   // only notify changes of this zone
+	Events []string `json:"events,omitempty"` // only notify these events
+}
+
+type webhookEvent struct {
+	Event string    `json:"event"`
+	Zone  string    `json:"zone"`
+	Name  string    `json:"name,omitempty"`
+	Type  string    `json:"type,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+type webhookDelivery struct {
+	hook *webhook
+	body []byte
+	ev   string
+}
+
+var (
+	webhookQueue  = make(chan *webhookDelivery, 256)
+	webhookStart  sync.Once
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+func (h *webhook) matches(ev *webhookEvent) bool {
+	if h.Zone != "" && h.Zone != ev.Zone {
+		return false
+	}
+	return len(h.Events) == 0 || slices.Contains(h.Events, ev.Event)
+}
+
+// fireWebhooks queues ev for delivery to all matching webhooks
+func fireWebhooks(ev *webhookEvent) {
+	hooks, err := listWebhooks()
+	if err != nil {
+		log.Printf("[webhook] failed to load webhooks: %s", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	ev.Time = clock.Now().UTC()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	webhookStart.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			go webhookThread()
+		}
+	})
+
+	for _, h := range hooks {
+		if !h.matches(ev) {
+			continue
+		}
+		select {
+		case webhookQueue <- &webhookDelivery{hook: h, body: body, ev: ev.Event}:
+		default:
+			log.Printf("[webhook] queue full, dropping %s event for %s", ev.Event, h.URL)
+		}
+	}
+}
+
+func webhookThread() {
+	for d := range webhookQueue {
+		for i := 0; i < webhookAttempts; i++ {
+			if i > 0 {
+				time.Sleep(time.Duration(1<<i) * time.Second)
+			}
+			err := d.send()
+			if err == nil {
+				break
+			}
+			log.Printf("[webhook] failed to deliver %s event to %s (attempt %d): %s", d.ev, d.hook.URL, i+1, err)
+		}
+	}
+}
+
+func (d *webhookDelivery) send() error {
+	req, err := http.NewRequest("POST", d.hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Dnsd-Event", d.ev)
+	req.Header.Set("X-Dnsd-Signature", "sha256="+webhookSignature(d.hook.Secret, d.body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	return nil
+}
+
+func webhookSignature(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func listWebhooks() ([]*webhook, error) {
+	var res []*webhook
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("webhook"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			h := &webhook{}
+			if err := gob.NewDecoder(bytes.NewReader(v[12:])).Decode(h); err != nil {
+				return err
+			}
+			res = append(res, h)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// handleWebhooks lists (GET), adds (POST) or removes (DELETE, with the "id"
+// parameter) webhooks
+func handleWebhooks(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		hooks, err := listWebhooks()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, h := range hooks {
+			h.Secret = ""
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(hooks)
+	case "POST":
+		h := &webhook{}
+		if err := json.NewDecoder(req.Body).Decode(h); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read: %s", err), http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			http.Error(rw, "invalid url", http.StatusBadRequest)
+			return
+		}
+		if h.Secret == "" {
+			http.Error(rw, "secret is required", http.StatusBadRequest)
+			return
+		}
+		id := uuid.New()
+		h.ID = id.String()
+
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(h); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := simpleSet([]byte("webhook"), id[:], append(now(), buf.Bytes()...)); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		h.Secret = ""
+		audit(apiActor(req), "webhook-add", "webhook:"+h.ID, nil, h)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(h)
+	case "DELETE":
+		id, err := uuid.Parse(req.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(rw, "invalid id", http.StatusBadRequest)
+			return
+		}
+		var before *webhook
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("webhook"))
+			if b == nil {
+				return nil
+			}
+			if v := b.Get(id[:]); v != nil {
+				before = &webhook{}
+				gob.NewDecoder(bytes.NewReader(v[12:])).Decode(before)
+				before.Secret = ""
+			}
+			return b.Delete(id[:])
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before == nil {
+			http.Error(rw, "webhook not found", http.StatusNotFound)
+			return
+		}
+		audit(apiActor(req), "webhook-delete", "webhook:"+id.String(), before, nil)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(rw, "unsupported method", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestWebhooks(t *testing.T) {
+	openTestDb(t)
+
+	z, err := getOrCreateZone("example.com")
+	if err != nil {
+		t.Fatalf("failed to create zone: %s", err)
+	}
+
+	received := make(chan *webhookEvent, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Header.Get("X-Dnsd-Signature") != "sha256="+webhookSignature("s3cret", body) {
+			t.Errorf("invalid signature for %s", body)
+		}
+		ev := &webhookEvent{}
+		json.Unmarshal(body, ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	rw := httptest.NewRecorder()
+	body := `{"url":"` + srv.URL + `","secret":"s3cret","zone":"` + z.String() + `","events":["record.create","record.update"]}`
+	handleApi(rw, httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(body)))
+	if rw.Code != 200 {
+		t.Fatalf("failed to add webhook: %s", rw.Body)
+	}
+
+	z.setRecord("www", 300, dnsmsg.A, "192.0.2.1")
+	z.setRecord("www", 300, dnsmsg.A, "192.0.2.2")
+	z.setSettings(&zoneSettings{MaxRecords: 1}) // filtered out
+
+	// deliveries run in parallel and may arrive in any order
+	events := map[string]bool{}
+	for range 2 {
+		select {
+		case ev := <-received:
+			if ev.Zone != z.String() || ev.Name != "www" || ev.Type != "A" {
+				t.Errorf("unexpected event %+v", ev)
+			}
+			events[ev.Event] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for events")
+		}
+	}
+	if !events[eventRecordCreate] || !events[eventRecordUpdate] {
+		t.Errorf("unexpected events %v", events)
+	}
+	select {
+	case ev := <-received:
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// secrets are never returned
+	rw = httptest.NewRecorder()
+	handleApi(rw, httptest.NewRequest("GET", "/api/webhooks", nil))
+	if strings.Contains(rw.Body.String(), "s3cret") {
+		t.Errorf("secret leaked in listing: %s", rw.Body)
+	}
+}
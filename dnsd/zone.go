@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/gob"
 	"errors"
 	"os"
 
@@ -22,23 +24,26 @@ func createZone() (dnsZone, error) {
 	return dnsZone(r), err
 }
 
-func (z dnsZone) handleQuery(pkt *dnsmsg.Message, q *dnsmsg.Question, sub []byte) error {
+func (z dnsZone) handleQuery(ctx context.Context, pkt *dnsmsg.Message, q *dnsmsg.Question, sub []byte) error {
 	if len(sub) > 0 {
 		// check for cname
-		rec, err := z.getRecord(sub, dnsmsg.CNAME)
+		rec, err := z.getRecord(ctx, sub, dnsmsg.CNAME)
 		if err == nil && len(rec) > 0 {
 			pkt.Answer = append(pkt.Answer, rec...)
 			return nil
 		}
 	}
 
-	rec, err := z.getRecord(sub, q.Type)
+	rec, err := z.getRecord(ctx, sub, q.Type)
 	if err != nil {
 		// attempt to find authority
-		auth, err := z.getRecord(nil, dnsmsg.SOA)
-		if err == nil {
+		if auth, err := z.getRecord(ctx, nil, dnsmsg.SOA); err == nil {
 			pkt.Authority = append(pkt.Authority, auth...)
 		}
+		if err == os.ErrNotExist && z.nameExists(z.wildcard(sub)) {
+			// the name exists, but has no record of this type
+			return nil
+		}
 		return err
 	}
 
@@ -47,32 +52,86 @@ func (z dnsZone) handleQuery(pkt *dnsmsg.Message, q *dnsmsg.Question, sub []byte
 	return nil
 }
 
-// getRecord will attempt to fetch records for name, and will fallback to * lookup if not found
-func (z dnsZone) getRecord(name []byte, typ dnsmsg.Type) ([]*dnsmsg.Resource, error) {
-	res, err := z.getExactRecord(name, name, typ)
+// getRecord will attempt to fetch records for name, and will fallback to the
+// * record of its closest encloser if name does not exist (RFC 4592 section
+// 3.3.1). name is in reversed order, as returned by getZone.
+func (z dnsZone) getRecord(ctx context.Context, name []byte, typ dnsmsg.Type) ([]*dnsmsg.Resource, error) {
+	res, err := z.getExactRecord(ctx, name, name, typ)
 	if len(res) == 0 && err != nil {
 		err = os.ErrNotExist
 	}
-	if err == os.ErrNotExist && len(name) > 0 {
-		originalName := name
-		if pos := bytes.LastIndexByte(name, '.'); pos > 0 {
-			name = append(name[:pos+1], '*')
+	if err != os.ErrNotExist {
+		return res, err
+	}
+	wild := z.wildcard(name)
+	if bytes.Equal(wild, name) {
+		return res, err
+	}
+	res, err = z.getExactRecord(ctx, wild, name, typ)
+	if len(res) == 0 && err != nil {
+		err = os.ErrNotExist
+	}
+	return res, err
+}
+
+// wildcard returns the name of the * record that may answer for name, or
+// name itself if it exists
+func (z dnsZone) wildcard(name []byte) []byte {
+	if len(name) == 0 || z.nameExists(name) {
+		return name
+	}
+	// the closest encloser is the nearest existing ancestor, which may have
+	// no records but names below it
+	parent := name
+	for len(parent) > 0 {
+		if pos := bytes.LastIndexByte(parent, '.'); pos > 0 {
+			parent = parent[:pos]
 		} else {
-			name = []byte{'*'}
+			parent = nil
 		}
-		res, err = z.getExactRecord(name, originalName, typ)
-		if len(res) == 0 && err != nil {
-			err = os.ErrNotExist
+		if len(parent) > 0 && z.nameExists(parent) {
+			break
 		}
 	}
-	return res, err
+	if len(parent) == 0 {
+		return []byte{'*'}
+	}
+	return append(append(make([]byte, 0, len(parent)+2), parent...), '.', '*')
+}
+
+// nameExists returns true if name, in reversed order, has records or names
+// below it
+func (z dnsZone) nameExists(name []byte) bool {
+	key := append(z[:], name...)
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		// records of name are followed by a 0, names below it by a dot
+		for _, sep := range []byte{0, '.'} {
+			p := append(key[:len(key):len(key)], sep)
+			if k, _ := c.Seek(p); bytes.HasPrefix(k, p) {
+				found = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return found
 }
 
 // getExactRecord will return one exact record
-func (z dnsZone) getExactRecord(name, originalName []byte, typ dnsmsg.Type) ([]*dnsmsg.Resource, error) {
+func (z dnsZone) getExactRecord(ctx context.Context, name, originalName []byte, typ dnsmsg.Type) ([]*dnsmsg.Resource, error) {
 	var res []*dnsmsg.Resource
 	var err error
 
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	key := append(z[:], name...)
 
 	if typ == dnsmsg.ANY {
@@ -88,19 +147,24 @@ func (z dnsZone) getExactRecord(name, originalName []byte, typ dnsmsg.Type) ([]*
 			k, v := c.Seek(key)
 
 			for bytes.HasPrefix(k, key) {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
 				// decodo
 				rec, err := ReadRecord(v[12:])
 				if err != nil {
 					return err
 				}
-				rdata, err := rec.RData(originalName, typ)
+				rdata, err := rec.RData(ctx, originalName, typ)
 				if err != nil {
 					return err
 				}
+				setAnswerSource(ctx, rec.source())
 
 				for _, r := range rdata {
 					res = append(res, &dnsmsg.Resource{
-						Name:  string(originalName),
+						Name:  dnsmsg.Name(reverseDnsName(originalName)),
 						Class: dnsmsg.IN,
 						Type:  r.GetType(),
 						TTL:   rec.TTL,
@@ -132,14 +196,15 @@ func (z dnsZone) getExactRecord(name, originalName []byte, typ dnsmsg.Type) ([]*
 			if err != nil {
 				return err
 			}
-			rdata, err := rec.RData(originalName, typ)
+			rdata, err := rec.RData(ctx, originalName, typ)
 			if err != nil {
 				return err
 			}
+			setAnswerSource(ctx, rec.source())
 
 			for _, r := range rdata {
 				res = append(res, &dnsmsg.Resource{
-					Name:  string(originalName),
+					Name:  dnsmsg.Name(reverseDnsName(originalName)),
 					Class: dnsmsg.IN,
 					Type:  r.GetType(),
 					TTL:   rec.TTL,
@@ -155,29 +220,14 @@ func (z dnsZone) getExactRecord(name, originalName []byte, typ dnsmsg.Type) ([]*
 }
 
 func (z dnsZone) setRecord(name string, ttl uint32, typ dnsmsg.Type, value ...string) error {
-	key := reverseDnsName([]byte(name))
-	key = append(z[:], key...)
 	if len(value) == 0 {
 		return errors.New("invalid record set")
 	}
-	key = append(key, 0, byte(typ>>8), byte(typ))
 
-	rec := &Record{
+	return z.putRecord(name, &Record{
 		Type:  typ,
 		TTL:   ttl,
 		Value: value,
-	}
-
-	// encode val
-	buf := rec.Bytes()
-
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("record"))
-		if err != nil {
-			return err
-		}
-
-		return b.Put(key, append(now(), buf...))
 	})
 }
 
@@ -186,26 +236,145 @@ func (z dnsZone) setHandlerRecord(name string, ttl uint32, typ dnsmsg.Type, valu
 		return errors.New("invalid record set")
 	}
 
-	key := reverseDnsName([]byte(name))
-	key = append(z[:], key...)
-	key = append(key, 0, byte(typ>>8), byte(typ))
-
-	rec := &Record{
+	return z.putRecord(name, &Record{
 		Type:    typ,
 		Handler: true,
 		TTL:     ttl,
 		Value:   value,
-	}
+	})
+}
+
+// recordKey returns the key of the record set name/typ in the record bucket
+func (z dnsZone) recordKey(name string, typ dnsmsg.Type) []byte {
+	key := append(z[:], reverseDnsName([]byte(name))...)
+	return append(key, 0, byte(typ>>8), byte(typ))
+}
+
+// putRecord stores rec for name, replacing any record of the same type
+func (z dnsZone) putRecord(name string, rec *Record) error {
+	key := z.recordKey(name, rec.Type)
 
 	// encode val
 	buf := rec.Bytes()
+	event := eventRecordCreate
 
-	return db.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("record"))
 		if err != nil {
 			return err
 		}
 
+		if b.Get(key) != nil {
+			event = eventRecordUpdate
+		}
 		return b.Put(key, append(now(), buf...))
 	})
+	if err == nil {
+		fireWebhooks(&webhookEvent{Event: event, Zone: z.String(), Name: name, Type: rec.Type.String()})
+		queuePublish(z, name, rec.Type)
+		queueSign(z)
+	}
+	return err
+}
+
+// upsertRecord makes rec the record set stored for name, comparing with the
+// current set in the same transaction. Values are compared regardless of
+// order. It returns the previous record, if any, and whether anything was
+// changed.
+func (z dnsZone) upsertRecord(name string, rec *Record) (*Record, bool, error) {
+	key := z.recordKey(name, rec.Type)
+	var prev *Record
+	changed := false
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("record"))
+		if err != nil {
+			return err
+		}
+
+		if v := b.Get(key); v != nil {
+			prev, err = ReadRecord(v[12:])
+			if err != nil {
+				return err
+			}
+			if prev.equal(rec) {
+				return nil
+			}
+		}
+		changed = true
+		return b.Put(key, append(now(), rec.Bytes()...))
+	})
+	if err != nil || !changed {
+		return prev, false, err
+	}
+
+	event := eventRecordCreate
+	if prev != nil {
+		event = eventRecordUpdate
+	}
+	fireWebhooks(&webhookEvent{Event: event, Zone: z.String(), Name: name, Type: rec.Type.String()})
+	queuePublish(z, name, rec.Type)
+	queueSign(z)
+	return prev, true, nil
+}
+
+// deleteRecord removes the record set name/typ. It returns the deleted
+// record, or nil if there was none.
+func (z dnsZone) deleteRecord(name string, typ dnsmsg.Type) (*Record, error) {
+	key := z.recordKey(name, typ)
+	var prev *Record
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("record"))
+		if b == nil {
+			return nil
+		}
+		v := b.Get(key)
+		if v == nil {
+			return nil
+		}
+		var err error
+		if prev, err = ReadRecord(v[12:]); err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+	if err != nil || prev == nil {
+		return nil, err
+	}
+	fireWebhooks(&webhookEvent{Event: eventRecordDelete, Zone: z.String(), Name: name, Type: typ.String()})
+	queuePublish(z, name, typ)
+	queueSign(z)
+	return prev, nil
+}
+
+// zoneSettings holds per-zone configuration
+type zoneSettings struct {
+	MaxRecords int    `json:"max_records,omitempty"` // 0 to use the global limit
+	LimitMode  string `json:"limit_mode,omitempty"`  // empty to use the global mode
+
+	DNSSEC *dnssecPolicy `json:"dnssec,omitempty"` // nil if the zone is not signed
+}
+
+func (z dnsZone) getSettings() (*zoneSettings, error) {
+	v, err := simpleGet([]byte("zone"), z[:])
+	if err != nil {
+		return nil, err
+	}
+	s := &zoneSettings{}
+	err = gob.NewDecoder(bytes.NewReader(v[12:])).Decode(s)
+	return s, err
+}
+
+func (z dnsZone) setSettings(s *zoneSettings) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(s); err != nil {
+		return err
+	}
+	err := simpleSet([]byte("zone"), z[:], append(now(), buf.Bytes()...))
+	if err == nil {
+		fireWebhooks(&webhookEvent{Event: eventZoneUpdate, Zone: z.String()})
+		queueSign(z)
+	}
+	return err
 }
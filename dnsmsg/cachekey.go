@@ -0,0 +1,76 @@
+package dnsmsg
+
+import "encoding/binary"
+
+// CacheKey identifies a query for the purpose of caching, rate limiting and
+// statistics. Two queries with the same CacheKey can be given the same
+// answer.
+type CacheKey struct {
+	Name   string // query name, lower case
+	Type   Type
+	Class  Class
+	DO     bool   // DNSSEC records requested
+	Subnet string // client subnet the answer applies to, if any
+}
+
+// CacheKey returns the cache key for the message, which must have exactly
+// one question. For queries the client subnet source prefix is used, while
+// for responses the scope prefix returned by the server is used, with a
+// scope of zero meaning the answer is valid for any client.
+func (m *Message) CacheKey() (CacheKey, bool) {
+	if len(m.Question) != 1 {
+		return CacheKey{}, false
+	}
+	q := m.Question[0]
+	k := CacheKey{
+		Name:  string(q.Name.Canonical()),
+		Type:  q.Type,
+		Class: q.Class,
+		DO:    m.DO(),
+	}
+
+	if ecs := m.GetClientSubnet(); ecs != nil {
+		prefix := ecs.SourcePrefix
+		if m.Bits.IsResponse() {
+			prefix = ecs.ScopePrefix
+		}
+		if prefix > 0 {
+			ecs.SourcePrefix = prefix
+			k.Subnet = ecs.IPNet().String()
+		}
+	}
+	return k, true
+}
+
+// Hash returns a 64 bits hash of the key, names differing only by case
+// hash the same
+func (k CacheKey) Hash() uint64 {
+	var buf [5]byte
+	binary.BigEndian.PutUint16(buf[0:2], uint16(k.Type))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(k.Class))
+	if k.DO {
+		buf[4] = 1
+	}
+
+	h := HashName(k.Name)
+	for _, b := range buf {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	for i := 0; i < len(k.Subnet); i++ {
+		h ^= uint64(k.Subnet[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (k CacheKey) String() string {
+	res := k.Name + " " + k.Class.String() + " " + k.Type.String()
+	if k.DO {
+		res += " +do"
+	}
+	if k.Subnet != "" {
+		res += " subnet=" + k.Subnet
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Canonical form and order of records (RFC 4034 section 6)
+
+// canonicalLower returns true if the names in the RDATA of records of type t
+// are converted to lower case in canonical form (RFC 4034 section 6.2, as
+// updated by RFC 6840 section 5.1 which removes NSEC)
+func canonicalLower(t Type) bool {
+	switch t {
+	case NS, MD, MF, CNAME, SOA, MB, MG, MR, PTR, HINFO, MINFO, MX, RP, AFSDB, SIG, NAPTR, KX, SRV, DNAME, RRSIG:
+		return true
+	}
+	return false
+}
+
+// CanonicalRData returns the RDATA of r in canonical form: names are not
+// compressed, and in lower case for the types listed in RFC 4034 section 6.2.
+// Names must be fully qualified.
+func (r *Resource) CanonicalRData() ([]byte, error) {
+	if r.Data == nil {
+		return nil, nil
+	}
+	c := &context{noCompress: true, compression: CompressNone, lower: canonicalLower(r.Type)}
+	if err := r.Data.encode(c); err != nil {
+		return nil, err
+	}
+	return c.rawMsg, nil
+}
+
+// CanonicalWire returns r in canonical wire format (RFC 4034 section 6.2),
+// as used to compute signatures and zone digests. The TTL is written as is.
+func (r *Resource) CanonicalWire() ([]byte, error) {
+	rdata, err := r.CanonicalRData()
+	if err != nil {
+		return nil, err
+	}
+	if len(rdata) > 0xffff {
+		return nil, ErrInvalidLen
+	}
+	c := &context{noCompress: true, compression: CompressNone, lower: true}
+	if err := c.appendLabel(string(r.Name)); err != nil {
+		return nil, err
+	}
+	buf := binary.BigEndian.AppendUint16(c.rawMsg, uint16(r.Type))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(r.Class))
+	buf = binary.BigEndian.AppendUint32(buf, r.TTL)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(rdata)))
+	return append(buf, rdata...), nil
+}
+
+// CanonicalWire returns the name in canonical wire format: uncompressed and
+// in lower case (RFC 4034 section 6.2). The name must be fully qualified.
+func (n Name) CanonicalWire() ([]byte, error) {
+	c := &context{noCompress: true, compression: CompressNone, lower: true}
+	if err := c.appendLabel(string(n)); err != nil {
+		return nil, err
+	}
+	return c.rawMsg, nil
+}
+
+// Compare compares n and o in canonical order (RFC 4034 section 6.1): labels
+// are compared from the right as lower case octet strings. It returns -1, 0
+// or +1.
+func (n Name) Compare(o Name) int {
+	a, b := n.SplitLabels(), o.SplitLabels()
+	for len(a) > 0 && len(b) > 0 {
+		la, _ := appendUnescaped(nil, a[len(a)-1])
+		lb, _ := appendUnescaped(nil, b[len(b)-1])
+		if c := bytes.Compare(AppendLowerASCII(nil, la), AppendLowerASCII(nil, lb)); c != 0 {
+			return c
+		}
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	switch {
+	case len(a) == len(b):
+		return 0
+	case len(a) == 0:
+		return -1
+	}
+	return 1
+}
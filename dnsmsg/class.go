@@ -1,6 +1,11 @@
 package dnsmsg
 
-//go:generate stringer -type=Class
+import (
+	"strconv"
+	"strings"
+)
+
+//go:generate stringer -type=Class -trimprefix=Class
 
 type Class uint16
 
@@ -10,4 +15,34 @@ const (
 	CS Class = 2 // Unassigned
 	CH Class = 3 // CHaos
 	HS Class = 4 // Hesiod
+
+	// RFC 2136
+	ClassNONE Class = 254
+	ClassANY  Class = 255 // "*"
 )
+
+// ParseClass returns the Class matching the given name (case insensitive),
+// including the generic CLASSnnn form from RFC 3597
+func ParseClass(s string) (Class, error) {
+	s = strings.ToUpper(s)
+	for c := IN; c <= HS; c++ {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	if v, ok := strings.CutPrefix(s, "CLASS"); ok {
+		if n, err := strconv.ParseUint(v, 10, 16); err == nil {
+			return Class(n), nil
+		}
+	}
+	return 0, ErrNotSupport
+}
+
+// text returns the presentation form of c, using the generic CLASSnnn form
+// of RFC 3597 for unknown classes
+func (c Class) text() string {
+	if c >= IN && c <= HS || c == ClassNONE || c == ClassANY {
+		return c.String()
+	}
+	return "CLASS" + strconv.FormatUint(uint64(c), 10)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"io"
 	"log"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +16,14 @@ type context struct {
 	rpos     int               // read position
 	name     string            // default suffix
 	marshal  bool              // marshal mode
+	idn      bool              // convert Unicode names to punycode
+	parser   *Parser           // reusable parser, if any
+	opts     *ParseOptions     // parse limits, if any
+	labels   int               // number of labels read
+
+	compression Compression // name compression mode when marshalling
+	noCompress  bool        // do not compress the names being written
+	lower       bool        // write names in lower case (canonical form)
 }
 
 func (c *context) Write(p []byte) (int, error) {
@@ -32,6 +41,26 @@ func (c *context) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// readUint16 reads a 16 bits big endian value
+func (c *context) readUint16() (uint16, error) {
+	if c.rpos+2 > len(c.rawMsg) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint16(c.rawMsg[c.rpos:])
+	c.rpos += 2
+	return v, nil
+}
+
+// readUint32 reads a 32 bits big endian value
+func (c *context) readUint32() (uint32, error) {
+	if c.rpos+4 > len(c.rawMsg) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint32(c.rawMsg[c.rpos:])
+	c.rpos += 4
+	return v, nil
+}
+
 func (c *context) Len() int {
 	return len(c.rawMsg)
 }
@@ -58,7 +87,13 @@ func (c *context) readLen(l int) ([]byte, error) {
 }
 
 func (c *context) appendLabel(lbl string) error {
-	if len(lbl) > 255 {
+	if c.idn && !isASCII(lbl) {
+		var err error
+		if lbl, err = ToASCII(lbl); err != nil {
+			return err
+		}
+	}
+	if len(lbl) > 255 && strings.IndexByte(lbl, '\\') == -1 {
 		return ErrNameTooLong
 	}
 	if c.marshal {
@@ -68,7 +103,7 @@ func (c *context) appendLabel(lbl string) error {
 		return nil
 	}
 
-	if !strings.HasSuffix(lbl, ".") {
+	if !Name(lbl).IsFQDN() {
 		if c.name == "" {
 			log.Printf("missing default name")
 			return ErrLabelInvalid
@@ -78,56 +113,161 @@ func (c *context) appendLabel(lbl string) error {
 		} else {
 			lbl = lbl + "." + c.name
 		}
-		if len(lbl) > 255 {
+		if len(lbl) > 255 && strings.IndexByte(lbl, '\\') == -1 {
 			return ErrNameTooLong
 		}
 	} else {
 		lbl = lbl[:len(lbl)-1]
+		if lbl == "" {
+			// root name
+			c.rawMsg = append(c.rawMsg, 0)
+			return nil
+		}
 	}
 
 	// append label to msg, compress if possible
+	wireLen := 1
 	for {
-		if p, ok := c.labelMap[strings.ToLower(lbl)]; ok {
-			// found label in cache!
-			// (cache offset already includes bits 0xc000)
-			return binary.Write(c, binary.BigEndian, p)
-		}
+		if !c.noCompress {
+			key := ToLowerASCII(lbl)
+			if p, ok := c.labelMap[key]; ok {
+				// found label in cache!
+				// (cache offset already includes bits 0xc000)
+				return binary.Write(c, binary.BigEndian, p)
+			}
 
-		if cachePos := len(c.rawMsg); cachePos < 0x3fff {
-			// store this pointer into cache so we can compress future labels
-			c.labelMap[strings.ToLower(lbl)] = uint16(cachePos | 0xc000)
+			if cachePos := len(c.rawMsg); cachePos < 0x3fff {
+				// store this pointer into cache so we can compress future labels
+				c.labelMap[key] = uint16(cachePos | 0xc000)
+			}
 		}
 
-		pos := strings.IndexByte(lbl, '.')
+		pos := labelEnd(lbl)
 		if pos == 0 {
 			// got ".." in label?
 			log.Printf("bad name = %s", lbl)
 			return ErrLabelInvalid
 		}
-		if pos == -1 {
+		last := pos == -1
+		if last {
 			// we reached end of label
 			if len(lbl) == 0 {
 				log.Printf("bad name end = %s", lbl)
 				return ErrLabelInvalid
 			}
-			if len(lbl) > 63 {
-				return ErrLabelTooLong
+			pos = len(lbl)
+		}
+
+		// append, resolving escapes
+		start := len(c.rawMsg)
+		c.rawMsg = append(c.rawMsg, 0)
+		var err error
+		if c.rawMsg, err = appendUnescaped(c.rawMsg, lbl[:pos]); err != nil {
+			return err
+		}
+		if c.lower {
+			// after unescaping, as \065 is an upper case A
+			for i := start + 1; i < len(c.rawMsg); i++ {
+				c.rawMsg[i] = lowerByte(c.rawMsg[i])
 			}
+		}
+		l := len(c.rawMsg) - start - 1
+		if l > 63 {
+			return ErrLabelTooLong
+		}
+		c.rawMsg[start] = byte(l)
+		wireLen += l + 1
+		if wireLen > 255 {
+			return ErrNameTooLong
+		}
 
-			// append
-			c.rawMsg = append(append(append(c.rawMsg, byte(len(lbl))), []byte(lbl)...), 0)
+		if last {
+			c.rawMsg = append(c.rawMsg, 0)
 			return nil
 		}
+		lbl = lbl[pos+1:]
+	}
+}
 
-		// encode, move forward
-		if pos > 63 {
-			return ErrLabelTooLong
+// appendUncompressedLabel appends lbl without compression whatever the
+// compression mode, for names in RDATA that must never be compressed, such as
+// the names of types defined after RFC 1035 (RFC 3597 section 4)
+func (c *context) appendUncompressedLabel(lbl string) error {
+	noCompress := c.noCompress
+	c.noCompress = true
+	err := c.appendLabel(lbl)
+	c.noCompress = noCompress
+	return err
+}
+
+// labelEnd returns the position of the first unescaped dot in s, or -1
+func labelEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '.':
+			return i
 		}
+	}
+	return -1
+}
 
-		// append
-		c.rawMsg = append(append(c.rawMsg, byte(pos)), []byte(lbl[:pos])...)
-		lbl = lbl[pos+1:]
+// appendUnescaped appends the label s to buf, resolving \X and \DDD escapes
+func appendUnescaped(buf []byte, s string) ([]byte, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf = append(buf, s[i])
+			continue
+		}
+		i++
+		switch {
+		case i == len(s):
+			return buf, ErrLabelInvalid
+		case s[i] >= '0' && s[i] <= '9':
+			if i+3 > len(s) {
+				return buf, ErrLabelInvalid
+			}
+			v, err := strconv.ParseUint(s[i:i+3], 10, 8)
+			if err != nil {
+				return buf, ErrLabelInvalid
+			}
+			buf = append(buf, byte(v))
+			i += 2
+		default:
+			buf = append(buf, s[i])
+		}
 	}
+	return buf, nil
+}
+
+// labelSafe lists the bytes that need no escaping in presentation format
+var labelSafe = func() (res [256]bool) {
+	for b := '!'; b <= '~'; b++ {
+		res[b] = !strings.ContainsRune(`."()\;@$`, b)
+	}
+	return
+}()
+
+// appendEscaped appends the wire label l to buf in presentation format,
+// escaping special and non-printable characters (RFC 1035 section 5.1)
+func appendEscaped(buf []byte, l []byte) []byte {
+	i := 0
+	for i < len(l) && labelSafe[l[i]] {
+		i++
+	}
+	buf = append(buf, l[:i]...)
+	for _, b := range l[i:] {
+		switch {
+		case b <= ' ' || b > '~':
+			buf = append(buf, '\\', '0'+b/100, '0'+b/10%10, '0'+b%10)
+		case b == '.' || b == '\\' || b == '"' || b == '(' || b == ')' || b == ';' || b == '@' || b == '$':
+			buf = append(buf, '\\', b)
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
 }
 
 func (c *context) parseLabel() (string, error) {
@@ -144,10 +284,22 @@ func (c *context) parseLabel() (string, error) {
 	return lbl, err
 }
 
+// maxLabelPointers is the maximum number of compression pointers followed
+// while reading a single name, a name cannot have more labels than that
+const maxLabelPointers = 127
+
 func (c *context) readLabel(buf []byte) (string, int, error) {
-	var res []byte
-	var read int
+	// names are at most 255 bytes long on the wire, which means the dotted
+	// form fits in this buffer and we only allocate the final string
+	var tmp [256]byte
+	res := tmp[:0]
+	var read, wireLen, ptrCount int
 	readMode := true
+	lastPtr := -1 // offset of last pointer target
+
+	if len(buf) == 0 {
+		return "", 0, ErrLabelInvalid
+	}
 
 	if c.marshal {
 		// simple read
@@ -163,11 +315,21 @@ func (c *context) readLabel(buf []byte) (string, int, error) {
 	}
 
 	for {
+		if len(buf) == 0 {
+			return string(res), read, ErrLabelInvalid
+		}
 		v := int(buf[0])
 		if readMode {
 			read += 1
 		}
 		if v == 0 {
+			if len(res) == 0 {
+				// root name
+				return ".", read, nil
+			}
+			if c.parser != nil {
+				return c.parser.intern(res), read, nil
+			}
 			return string(res), read, nil
 		}
 		if v&0xc0 == 0xc0 {
@@ -178,17 +340,28 @@ func (c *context) readLabel(buf []byte) (string, int, error) {
 				read += 1
 				readMode = false
 			}
-			// this is a label pointer
+			// this is a label pointer. Pointers must always move backward
+			// compared to the previous one, which prevents loops without
+			// having to remember visited offsets.
 			pos := int(binary.BigEndian.Uint16(buf[:2]) & ^uint16(0xc000))
-			if pos >= len(c.rawMsg) {
+			if pos >= len(c.rawMsg) || (lastPtr != -1 && pos >= lastPtr) {
+				return string(res), read, ErrLabelInvalid
+			}
+			ptrCount += 1
+			if ptrCount > maxLabelPointers {
 				return string(res), read, ErrLabelInvalid
 			}
+			lastPtr = pos
 			buf = c.rawMsg[pos:]
 			continue
 		}
 		if v > 63 {
 			return string(res), read, ErrLabelInvalid
 		}
+		c.labels += 1
+		if c.opts != nil && c.opts.MaxLabels > 0 && c.labels > c.opts.MaxLabels {
+			return string(res), read, ErrLimit
+		}
 
 		buf = buf[1:] // move buffer forward to skip len byte
 		if v >= len(buf) {
@@ -199,7 +372,12 @@ func (c *context) readLabel(buf []byte) (string, int, error) {
 			read += v
 		}
 
-		res = append(res, buf[:v]...)
+		wireLen += v + 1
+		if wireLen > 255 {
+			return string(res), read, ErrNameTooLong
+		}
+
+		res = appendEscaped(res, buf[:v])
 		res = append(res, '.')
 
 		buf = buf[v:]
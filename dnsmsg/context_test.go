@@ -0,0 +1,152 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestReadLabelLoop(t *testing.T) {
+	for _, hexB := range []string{
+		// question name pointing to itself
+		"000001000001000000000000c00c00010001",
+		// two pointers pointing at each other
+		"000001000001000000000000c00ec00c00010001",
+		// empty rdata for NS record
+		"000081000000000100000000000000020001000000000000",
+	} {
+		b, _ := hex.DecodeString(hexB)
+		if _, err := Parse(b); err == nil {
+			t.Errorf("parsing invalid message %s should fail", hexB)
+		}
+	}
+}
+
+var benchResponse = "236f8180000100040000000106676f6f676c6503636f6d00000f0001c00c000f0001000000cd0009000a04736d7470c00cc00c000f0001000000cd0009001404616c7431c02ac00c000f0001000000cd0009001e04616c7432c02ac00c000f0001000000cd0009002804616c7433c02a0000290200000000000000"
+
+func BenchmarkReadLabel(b *testing.B) {
+	buf, _ := hex.DecodeString(benchResponse)
+	c := &context{rawMsg: buf}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// read MX exchange name with two levels of compression
+		if _, _, err := c.readLabel(buf[105:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	buf, _ := hex.DecodeString(benchResponse)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	buf, _ := hex.DecodeString(benchResponse)
+	p := &Parser{}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// query for example.com A with an EDNS cookie
+var benchQuery = "123401200001000000000001076578616d706c6503636f6d0000010001000029100000000000000c000a00080102030405060708"
+
+func BenchmarkParseQuery(b *testing.B) {
+	buf, _ := hex.DecodeString(benchQuery)
+	for _, test := range []struct {
+		name  string
+		parse func([]byte) (*Message, error)
+	}{
+		{"Parse", Parse},
+		{"Parser", (&Parser{}).Parse},
+		{"Borrow", (&Parser{Borrow: true}).Parse},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := test.parse(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParser(t *testing.T) {
+	buf, _ := hex.DecodeString(benchResponse)
+	expect, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	p := &Parser{}
+	for i := 0; i < 3; i++ {
+		msg, err := p.Parse(buf)
+		if err != nil {
+			t.Fatalf("failed to parse with Parser: %s", err)
+		}
+		if msg.String() != expect.String() {
+			t.Errorf("Parser result differs:\n%s\nexpected:\n%s", msg, expect)
+		}
+	}
+
+	// a smaller message must not keep records of the previous one
+	q, _ := NewQuery("example.com.", IN, A).MarshalBinary()
+	msg, err := p.Parse(q)
+	if err != nil {
+		t.Fatalf("failed to parse query: %s", err)
+	}
+	if len(msg.Answer) != 0 || len(msg.Additional) != 0 || msg.HasEDNS || msg.QueryString() != "example.com. IN A" {
+		t.Errorf("unexpected reused message: %s", msg)
+	}
+}
+
+func TestEscapedLabels(t *testing.T) {
+	// labels "a.b c\x00", "q\\" and "example"
+	wire := []byte("\x06a.b c\x00\x02q\\\x07example\x00")
+	c := &context{rawMsg: wire}
+	name, err := c.parseLabel()
+	if err != nil {
+		t.Fatalf("failed to read name: %s", err)
+	}
+	if expect := `a\.b\032c\000.q\\.example.`; name != expect {
+		t.Errorf("unexpected name %s, expected %s", name, expect)
+	}
+	if n := Name(name).CountLabels(); n != 3 {
+		t.Errorf("unexpected label count %d", n)
+	}
+
+	c = &context{labelMap: make(map[string]uint16)}
+	if err := c.appendLabel(name); err != nil {
+		t.Fatalf("failed to encode name: %s", err)
+	}
+	if string(c.rawMsg) != string(wire) {
+		t.Errorf("round trip mismatch: %q", c.rawMsg)
+	}
+
+	// equivalent spelling
+	c = &context{labelMap: make(map[string]uint16)}
+	if err := c.appendLabel(`a\.b\ c\000.q\092.ex\097mple.`); err != nil || string(c.rawMsg) != string(wire) {
+		t.Errorf("unexpected encoding %q (%v)", c.rawMsg, err)
+	}
+
+	for _, bad := range []string{`a\`, `a\25.`, `a\999.`, "a..b."} {
+		c = &context{labelMap: make(map[string]uint16)}
+		if err := c.appendLabel(bad); err == nil {
+			t.Errorf("invalid name %q was encoded", bad)
+		}
+	}
+}
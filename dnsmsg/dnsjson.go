@@ -0,0 +1,197 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DNS JSON API (application/dns-json)
+//
+// This is the format served by Google Public DNS and Cloudflare on their
+// JSON endpoints. Unlike RFC 8427 it only represents responses, with the
+// RDATA of records in presentation format, and queries are sent as URL
+// parameters (see ParseDNSJSONQuery).
+
+const DNSJSONType = "application/dns-json"
+
+type dnsJSON struct {
+	Status     RCode
+	TC         bool
+	RD         bool
+	RA         bool
+	AD         bool
+	CD         bool
+	Question   []dnsJSONQuestion `json:",omitempty"`
+	Answer     []dnsJSONRecord   `json:",omitempty"`
+	Authority  []dnsJSONRecord   `json:",omitempty"`
+	Additional []dnsJSONRecord   `json:",omitempty"`
+	Comment    string            `json:",omitempty"`
+}
+
+type dnsJSONQuestion struct {
+	Name Name `json:"name"`
+	Type Type `json:"type"`
+}
+
+type dnsJSONRecord struct {
+	Name Name `json:"name"`
+	Type Type `json:"type"`
+	TTL  uint32
+	Data string `json:"data"`
+}
+
+// MarshalDNSJSON encodes the message in the dns-json format
+func (m *Message) MarshalDNSJSON() ([]byte, error) {
+	j := &dnsJSON{
+		Status: m.ExtendedRCode(),
+		TC:     m.Bits.IsTrunc(),
+		RD:     m.Bits.IsRecDesired(),
+		RA:     m.Bits.IsRecAvailable(),
+		AD:     m.Bits&hAuthData != 0,
+		CD:     m.Bits&hChkDis != 0,
+	}
+	for _, q := range m.Question {
+		j.Question = append(j.Question, dnsJSONQuestion{Name: m.fqdn(q.Name), Type: q.Type})
+	}
+	j.Answer = m.dnsJSONRecords(m.Answer)
+	j.Authority = m.dnsJSONRecords(m.Authority)
+	j.Additional = m.dnsJSONRecords(m.Additional)
+
+	return json.Marshal(j)
+}
+
+// fqdn returns n fully qualified, names without final dot being relative to
+// the message base name
+func (m *Message) fqdn(n Name) Name {
+	if n.IsFQDN() || m.Base == "" {
+		return n
+	}
+	if n == "" || n == "@" {
+		return Name(m.Base + ".")
+	}
+	return n + "." + Name(m.Base) + "."
+}
+
+func (m *Message) dnsJSONRecords(rrs []*Resource) []dnsJSONRecord {
+	var res []dnsJSONRecord
+	for _, rr := range rrs {
+		res = append(res, dnsJSONRecord{Name: m.fqdn(rr.Name), Type: rr.Type, TTL: rr.TTL, Data: rdataText(rr.Data)})
+	}
+	return res
+}
+
+// UnmarshalDNSJSON decodes a response in the dns-json format. Records are
+// in class IN.
+func (m *Message) UnmarshalDNSJSON(b []byte) error {
+	j := &dnsJSON{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return err
+	}
+
+	*m = Message{}
+	m.Bits.SetResponse(true)
+	m.Bits.SetTrunc(j.TC)
+	m.Bits.SetRecDesired(j.RD)
+	m.Bits.SetRecAvailable(j.RA)
+	if j.AD {
+		m.Bits |= hAuthData
+	}
+	if j.CD {
+		m.Bits |= hChkDis
+	}
+	m.SetExtendedRCode(j.Status)
+
+	for _, q := range j.Question {
+		m.Question = append(m.Question, &Question{Name: q.Name, Type: q.Type, Class: IN})
+	}
+
+	var err error
+	if m.Answer, err = parseDNSJSONRecords(j.Answer); err != nil {
+		return err
+	}
+	if m.Authority, err = parseDNSJSONRecords(j.Authority); err != nil {
+		return err
+	}
+	m.Additional, err = parseDNSJSONRecords(j.Additional)
+	return err
+}
+
+func parseDNSJSONRecords(recs []dnsJSONRecord) ([]*Resource, error) {
+	var res []*Resource
+	for _, r := range recs {
+		rr := &Resource{Name: r.Name, Type: r.Type, Class: IN, TTL: r.TTL}
+		if f := strings.Fields(r.Data); len(f) >= 2 && f[0] == `\#` {
+			data, err := hex.DecodeString(strings.Join(f[2:], ""))
+			if err != nil {
+				return nil, err
+			}
+			if strconv.Itoa(len(data)) != f[1] {
+				return nil, ErrInvalidLen
+			}
+			rr.Data = &RDataRaw{Data: data, Type: r.Type}
+		} else {
+			rd, err := RDataFromString(r.Type, r.Data)
+			if err != nil {
+				return nil, err
+			}
+			rr.Data = rd
+		}
+		res = append(res, rr)
+	}
+	return res, nil
+}
+
+// ParseDNSJSONQuery builds a query from the URL parameters of a dns-json
+// request: name, type (name or number, defaults to A), cd, do and
+// edns_client_subnet
+func ParseDNSJSONQuery(v url.Values) (*Message, error) {
+	name := v.Get("name")
+	if name == "" || len(name) > 253 {
+		return nil, ErrLabelInvalid
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	typ := A
+	if s := v.Get("type"); s != "" {
+		if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+			typ = Type(n)
+		} else if typ, err = ParseType(strings.ToUpper(s)); err != nil {
+			return nil, err
+		}
+	}
+
+	m := NewQuery(name, IN, typ)
+	if dnsJSONFlag(v.Get("cd")) {
+		m.Bits |= hChkDis
+	}
+	if dnsJSONFlag(v.Get("do")) {
+		m.SetDO(true)
+	}
+	if s := v.Get("edns_client_subnet"); s != "" {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.SetClientSubnet(NewClientSubnet(n)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func dnsJSONFlag(s string) bool {
+	return s == "1" || strings.EqualFold(s, "true")
+}
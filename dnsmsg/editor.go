@@ -0,0 +1,277 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+)
+
+// Section identifies a section of resource records in a message
+type Section int
+
+const (
+	SectionAnswer Section = iota
+	SectionAuthority
+	SectionAdditional
+)
+
+// Editor modifies a message in wire format in place, without decoding and
+// encoding it again. Bytes that are not modified are kept as is, including
+// name compression, which makes it suitable for adjusting cached responses
+// or rewriting IDs when forwarding.
+//
+// Compression pointers are fixed when a record is removed. This covers owner
+// names and the names in the RDATA of all the types whose names are
+// decompressed when parsing: compression is only allowed for the types of
+// RFC 1035 (RFC 3597 section 4), but some implementations use it for newer
+// types too.
+type Editor struct {
+	buf []byte
+	rrs [3][]editRecord
+}
+
+// editRecord locates a record in the edited message
+type editRecord struct {
+	off   int // start of the record (owner name)
+	typ   Type
+	rdata int // start of RDATA
+	end   int
+}
+
+// NewEditor returns an editor for the message in buf. The editor works on
+// buf directly.
+func NewEditor(buf []byte) (*Editor, error) {
+	if len(buf) < 12 {
+		return nil, ErrInvalidLen
+	}
+	e := &Editor{buf: buf}
+	c := &context{rawMsg: buf}
+
+	pos := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(buf[4:])); i++ {
+		_, n, err := c.readLabel(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n + 4
+		if pos > len(buf) {
+			return nil, ErrInvalidLen
+		}
+	}
+
+	for s := range e.rrs {
+		count := int(binary.BigEndian.Uint16(buf[6+2*s:]))
+		for i := 0; i < count; i++ {
+			if pos >= len(buf) {
+				return nil, ErrInvalidLen
+			}
+			_, n, err := c.readLabel(buf[pos:])
+			if err != nil {
+				return nil, err
+			}
+			r := editRecord{off: pos, rdata: pos + n + 10}
+			if r.rdata > len(buf) {
+				return nil, ErrInvalidLen
+			}
+			r.typ = Type(binary.BigEndian.Uint16(buf[pos+n:]))
+			r.end = r.rdata + int(binary.BigEndian.Uint16(buf[r.rdata-2:]))
+			if r.end > len(buf) {
+				return nil, ErrInvalidLen
+			}
+			e.rrs[s] = append(e.rrs[s], r)
+			pos = r.end
+		}
+	}
+	if pos != len(buf) {
+		return nil, ErrInvalidLen
+	}
+	return e, nil
+}
+
+// Bytes returns the edited message
+func (e *Editor) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Editor) ID() uint16 {
+	return binary.BigEndian.Uint16(e.buf)
+}
+
+func (e *Editor) SetID(id uint16) {
+	binary.BigEndian.PutUint16(e.buf, id)
+}
+
+func (e *Editor) Bits() HeaderBits {
+	return HeaderBits(binary.BigEndian.Uint16(e.buf[2:]))
+}
+
+func (e *Editor) SetBits(b HeaderBits) {
+	binary.BigEndian.PutUint16(e.buf[2:], uint16(b))
+}
+
+// Count returns the number of records in section s, the OPT record included
+func (e *Editor) Count(s Section) int {
+	return len(e.rrs[s])
+}
+
+// Type returns the type of the record at index i of section s
+func (e *Editor) Type(s Section, i int) Type {
+	return e.rrs[s][i].typ
+}
+
+// TTL returns the TTL of the record at index i of section s
+func (e *Editor) TTL(s Section, i int) uint32 {
+	return binary.BigEndian.Uint32(e.buf[e.rrs[s][i].rdata-6:])
+}
+
+// SetTTL sets the TTL of the record at index i of section s
+func (e *Editor) SetTTL(s Section, i int, ttl uint32) {
+	binary.BigEndian.PutUint32(e.buf[e.rrs[s][i].rdata-6:], ttl)
+}
+
+// AgeTTL decreases the TTL of all records by d, down to zero. The OPT
+// record, which has no TTL, is not modified.
+func (e *Editor) AgeTTL(d uint32) {
+	for s := range e.rrs {
+		for i, r := range e.rrs[s] {
+			if r.typ == OPT {
+				continue
+			}
+			ttl := e.TTL(Section(s), i)
+			e.SetTTL(Section(s), i, ttl-min(ttl, d))
+		}
+	}
+}
+
+// Remove removes the record at index i of section s. It fails with
+// ErrNotSupport if another name in the message is compressed using a name
+// in this record.
+func (e *Editor) Remove(s Section, i int) error {
+	rm := e.rrs[s][i]
+	size := rm.end - rm.off
+
+	// check pointers first so that the message is unchanged on failure
+	for pass := 0; pass < 2; pass++ {
+		err := e.eachName(func(pos int) error {
+			if pos >= rm.off && pos < rm.end {
+				return nil
+			}
+			return e.fixPointer(pos, rm.off, rm.end, pass == 1)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.buf = append(e.buf[:rm.off], e.buf[rm.end:]...)
+	e.rrs[s] = append(e.rrs[s][:i], e.rrs[s][i+1:]...)
+	binary.BigEndian.PutUint16(e.buf[6+2*int(s):], uint16(len(e.rrs[s])))
+	for s := range e.rrs {
+		for n := range e.rrs[s] {
+			if r := &e.rrs[s][n]; r.off > rm.off {
+				r.off -= size
+				r.rdata -= size
+				r.end -= size
+			}
+		}
+	}
+	return nil
+}
+
+// eachName calls f with the position of each name of the message that may
+// be compressed
+func (e *Editor) eachName(f func(pos int) error) error {
+	pos := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(e.buf[4:])); i++ {
+		if err := f(pos); err != nil {
+			return err
+		}
+		pos = e.skipName(pos) + 4
+	}
+	for s := range e.rrs {
+		for _, r := range e.rrs[s] {
+			if err := f(r.off); err != nil {
+				return err
+			}
+			var names []int
+			switch r.typ {
+			case NS, MD, MF, CNAME, MB, MG, MR, PTR, DNAME, NSEC:
+				names = []int{r.rdata}
+			case SOA, MINFO, RP:
+				names = []int{r.rdata, e.skipName(r.rdata)}
+			case MX, AFSDB, KX:
+				names = []int{r.rdata + 2}
+			case SRV:
+				names = []int{r.rdata + 6}
+			case SIG, RRSIG:
+				names = []int{r.rdata + 18}
+			case NAPTR:
+				// after order, preference, flags, services and regexp
+				pos := r.rdata + 4
+				for i := 0; i < 3 && pos < r.end; i++ {
+					pos += int(e.buf[pos]) + 1
+				}
+				names = []int{pos}
+			case HIP:
+				// rendezvous servers after the HIT and public key
+				if r.rdata+4 <= r.end {
+					pos := r.rdata + 4 + int(e.buf[r.rdata]) + int(binary.BigEndian.Uint16(e.buf[r.rdata+2:]))
+					for ; pos < r.end; pos = e.skipName(pos) {
+						names = append(names, pos)
+					}
+				}
+			}
+			for _, n := range names {
+				if n < r.end {
+					if err := f(n); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// skipName returns the position following the name at pos
+func (e *Editor) skipName(pos int) int {
+	for pos < len(e.buf) {
+		v := int(e.buf[pos])
+		switch {
+		case v == 0:
+			return pos + 1
+		case v&0xc0 == 0xc0:
+			return pos + 2
+		}
+		pos += v + 1
+	}
+	return pos
+}
+
+// fixPointer checks the compression pointer ending the name at pos, if any,
+// against the removal of [start, end). If apply is true, pointers after the
+// removed range are moved.
+func (e *Editor) fixPointer(pos, start, end int, apply bool) error {
+	// find the last label, which is the pointer if there is one
+	for pos < len(e.buf) {
+		v := int(e.buf[pos])
+		if v == 0 {
+			return nil
+		}
+		if v&0xc0 == 0xc0 {
+			break
+		}
+		pos += v + 1
+	}
+	if pos+1 >= len(e.buf) {
+		return nil
+	}
+	target := int(binary.BigEndian.Uint16(e.buf[pos:]) & 0x3fff)
+	switch {
+	case target >= end:
+		if apply {
+			binary.BigEndian.PutUint16(e.buf[pos:], uint16(target-(end-start))|0xc000)
+		}
+	case target >= start:
+		return ErrNotSupport
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+func TestClientSubnet(t *testing.T) {
+	_, n, _ := net.ParseCIDR("192.0.2.130/25")
+
+	msg := NewQuery("example.com.", IN, A)
+	if err := msg.SetClientSubnet(NewClientSubnet(n)); err != nil {
+		t.Fatalf("failed to set client subnet: %s", err)
+	}
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	msg, err = Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	opt := msg.GetOpt(OptClientSubnet)
+	if opt == nil || string(opt.Data) != "\x00\x01\x19\x00\xc0\x00\x02\x80" {
+		t.Errorf("unexpected client subnet option %+v", opt)
+	}
+
+	ecs := msg.GetClientSubnet()
+	if ecs == nil || ecs.String() != "192.0.2.128/25/0" {
+		t.Errorf("unexpected client subnet %s", ecs)
+	}
+}
+
+func TestCookie(t *testing.T) {
+	// query from TestParse has a client cookie
+	b, _ := hex.DecodeString("236f0120000100000000000106676f6f676c6503636f6d0000010001000029100000000000000c000a0008773d66c995247430")
+	msg, err := Parse(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	c := msg.GetCookie()
+	if c == nil || c.String() != "773d66c995247430" {
+		t.Fatalf("unexpected cookie %s", c)
+	}
+
+	c.Server = []byte("0123456789abcdef")
+	if err := msg.SetCookie(c); err != nil {
+		t.Fatalf("failed to set cookie: %s", err)
+	}
+	if c = msg.GetCookie(); c == nil || string(c.Server) != "0123456789abcdef" || len(msg.Opts) != 1 {
+		t.Errorf("unexpected cookie after update %s", c)
+	}
+
+	if _, err := ParseCookie(&DnsOpt{Code: OptCookie, Data: make([]byte, 12)}); err == nil {
+		t.Errorf("cookie with short server part should be rejected")
+	}
+}
+
+func TestExtendedError(t *testing.T) {
+	msg := NewQuery("example.com.", IN, A)
+	msg.Bits.SetResponse(true)
+	msg.Bits.SetRCode(ErrServFail)
+	msg.AddExtendedError(EDEDNSSECBogus, "")
+	msg.AddExtendedError(EDEBlocked, "blocked by policy")
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	msg, err = Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	res := msg.ExtendedErrors()
+	if len(res) != 2 || res[0].String() != "6 (DNSSEC Bogus)" || res[1].String() != "15 (Blocked): blocked by policy" {
+		t.Errorf("unexpected extended errors %v", res)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	_, n, _ := net.ParseCIDR("192.0.2.0/24")
+
+	q1 := NewQuery("WWW.Example.com.", IN, A)
+	q1.SetClientSubnet(NewClientSubnet(n))
+	q1.SetDO(true)
+	q2 := NewQuery("www.example.COM.", IN, A)
+	q2.SetClientSubnet(NewClientSubnet(n))
+	q2.SetDO(true)
+
+	k1, _ := q1.CacheKey()
+	k2, _ := q2.CacheKey()
+	if k1 != k2 || k1.Hash() != k2.Hash() || k1.String() != "www.example.com. IN A +do subnet=192.0.2.0/24" {
+		t.Errorf("unexpected cache keys %s / %s", k1, k2)
+	}
+
+	// response with a scope of 0 applies to everyone
+	q2.Bits.SetResponse(true)
+	if k2, _ = q2.CacheKey(); k2.Subnet != "" {
+		t.Errorf("unexpected subnet in response key %s", k2)
+	}
+}
+
+func TestPadTo(t *testing.T) {
+	msg := NewQuery("example.com.", IN, A)
+	for _, siz := range []int{PadQueryBlock, PadResponseBlock, 1} {
+		if err := msg.PadTo(siz); err != nil {
+			t.Fatalf("failed to pad: %s", err)
+		}
+		buf, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		if len(buf)%siz != 0 || len(msg.Opts) != 1 {
+			t.Errorf("padding to %d produced %d bytes", siz, len(buf))
+		}
+	}
+}
+
+func TestExtendedRCode(t *testing.T) {
+	msg := NewQuery("example.com.", IN, A)
+	msg.SetDO(true)
+	msg.SetExtendedRCode(ErrBadCookie)
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	msg, err = Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	if msg.ExtendedRCode() != ErrBadCookie || msg.Bits.GetRCode() != 7 || !msg.DO() {
+		t.Errorf("unexpected rcode %d or DO flag", msg.ExtendedRCode())
+	}
+
+	msg.SetExtendedRCode(ErrName)
+	if msg.ExtendedRCode() != ErrName || msg.OptRCode != optDO {
+		t.Errorf("unexpected rcode %d after reset", msg.ExtendedRCode())
+	}
+}
+
+func TestNegotiateEDNS(t *testing.T) {
+	q := NewQuery("example.com.", IN, A)
+	q.ReqUDPSize = 4096
+	q.SetDO(true)
+	q.OptRCode |= 0x4000 // unknown flag, not echoed
+
+	res := &Message{}
+	if !res.NegotiateEDNS(q, 1232) {
+		t.Errorf("version 0 was refused")
+	}
+	if !res.HasEDNS || !res.DO() || res.EDNSVersion() != 0 || res.ReqUDPSize != 1232 || res.OptRCode != optDO {
+		t.Errorf("unexpected response EDNS: %+v", res)
+	}
+
+	q.SetEDNSVersion(1)
+	if q.EDNSVersion() != 1 || !q.DO() {
+		t.Errorf("unexpected version %d", q.EDNSVersion())
+	}
+	if q.NegotiateEDNS(q, 1232) {
+		t.Errorf("version 1 was accepted")
+	}
+	if q.ExtendedRCode() != ErrBadVers || q.EDNSVersion() != 0 || !q.DO() {
+		t.Errorf("unexpected response rcode %s version %d", q.ExtendedRCode().String(), q.EDNSVersion())
+	}
+
+	q = NewQuery("example.com.", IN, A)
+	if !res.NegotiateEDNS(q, 1232) || res.HasEDNS {
+		t.Errorf("EDNS enabled in response to a query without EDNS")
+	}
+}
+
+func TestRCodeStrings(t *testing.T) {
+	for s, rc := range StringToRCode {
+		if rc.String() != s && !(s == "BADSIG" && rc.String() == "BADVERS") {
+			t.Errorf("%s has value %d, which prints as %s", s, rc, rc)
+		}
+		if rc != NoError && rc.Error() == "unknown error" {
+			t.Errorf("%s has no error message", s)
+		}
+	}
+	if s := RCode(3841).String(); s != "RCODE3841" {
+		t.Errorf("unexpected string for unknown rcode: %s", s)
+	}
+}
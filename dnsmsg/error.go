@@ -8,4 +8,18 @@ var (
 	ErrNameTooLong  = errors.New("name is too long")
 	ErrLabelTooLong = errors.New("label is too long")
 	ErrLabelInvalid = errors.New("label is invalid")
+	ErrOptInvalid   = errors.New("EDNS option is invalid")
+	ErrInvalidJSON  = errors.New("invalid DNS JSON object")
+	ErrPunycode     = errors.New("invalid punycode")
+	ErrNotify       = errors.New("invalid NOTIFY message")
+	ErrDSO          = errors.New("invalid DSO message")
+	ErrXfr          = errors.New("invalid zone transfer")
+	ErrLimit        = errors.New("message exceeds parse limits")
+	ErrRegistered   = errors.New("type is already registered")
+
+	// strict parsing errors
+	ErrTrailingData  = errors.New("trailing data after the last record")
+	ErrCountMismatch = errors.New("section counts do not match the message")
+	ErrOptSection    = errors.New("OPT record outside of the additional section")
+	ErrMultipleOpt   = errors.New("multiple OPT records")
 )
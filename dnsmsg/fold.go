@@ -0,0 +1,112 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// DNS names are case insensitive for ASCII letters only (RFC 4343). The
+// helpers in this file perform this case folding without allocating when
+// possible, processing 8 bytes at a time.
+
+const (
+	foldOnes = 0x0101010101010101
+	foldHigh = 0x8080808080808080
+)
+
+// upperMask returns a word with bit 7 set in each byte of w that is an ASCII
+// upper case letter
+func upperMask(w uint64) uint64 {
+	h := w &^ foldHigh                  // clear high bits so additions cannot carry
+	geA := h + (0x80-'A')*foldOnes      // bit 7 set if byte >= 'A'
+	gtZ := h + (0x80-'Z'-1)*foldOnes    // bit 7 set if byte > 'Z'
+	return (geA &^ gtZ) &^ w & foldHigh // exclude non-ASCII bytes
+}
+
+// load64 reads the first 8 bytes of s as a little endian word
+func load64[T string | []byte](s T) uint64 {
+	_ = s[7]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func lowerByte(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// hasUpperASCII returns true if s contains any ASCII upper case letter
+func hasUpperASCII(s string) bool {
+	for len(s) >= 8 {
+		if upperMask(load64(s)) != 0 {
+			return true
+		}
+		s = s[8:]
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// ToLowerASCII returns s with ASCII upper case letters converted to lower
+// case. s is returned as is when it has no upper case letters.
+func ToLowerASCII(s string) string {
+	if !hasUpperASCII(s) {
+		return s
+	}
+	buf := AppendLowerASCII(make([]byte, 0, len(s)), s)
+	// buf is not referenced anywhere else, same as strings.Builder does
+	return unsafe.String(unsafe.SliceData(buf), len(buf))
+}
+
+// AppendLowerASCII appends the lower case form of s to dst and returns the
+// extended buffer
+func AppendLowerASCII[T string | []byte](dst []byte, s T) []byte {
+	for len(s) >= 8 {
+		w := load64(s)
+		w |= upperMask(w) >> 2 // 0x80 >> 2 = 0x20, the case bit
+		dst = binary.LittleEndian.AppendUint64(dst, w)
+		s = s[8:]
+	}
+	for i := 0; i < len(s); i++ {
+		dst = append(dst, lowerByte(s[i]))
+	}
+	return dst
+}
+
+// EqualFoldASCII reports whether a and b are equal ignoring ASCII case, which
+// is how DNS names compare
+func EqualFoldASCII(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for len(a) >= 8 {
+		wa, wb := load64(a), load64(b)
+		if wa != wb && wa|upperMask(wa)>>2 != wb|upperMask(wb)>>2 {
+			return false
+		}
+		a, b = a[8:], b[8:]
+	}
+	for i := 0; i < len(a); i++ {
+		if lowerByte(a[i]) != lowerByte(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// HashName returns a 64 bits FNV-1a hash of s ignoring ASCII case, so that
+// names equal per EqualFoldASCII have the same hash
+func HashName(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(lowerByte(s[i]))
+		h *= 1099511628211
+	}
+	return h
+}
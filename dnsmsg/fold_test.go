@@ -0,0 +1,42 @@
+package dnsmsg
+
+import "testing"
+
+func TestFoldASCII(t *testing.T) {
+	for _, s := range []string{"", "a", "WWW.Example.COM.", "@[`{ AZaz 09", "xn--BCHER-KVA.example.", "ÀÉ.ExAmPlE\xff.Z"} {
+		lower := []byte(s)
+		for i, c := range lower {
+			if c >= 'A' && c <= 'Z' {
+				lower[i] = c + 'a' - 'A'
+			}
+		}
+
+		if v := ToLowerASCII(s); v != string(lower) {
+			t.Errorf("ToLowerASCII(%q) = %q, expected %q", s, v, lower)
+		}
+		if v := AppendLowerASCII(nil, []byte(s)); string(v) != string(lower) {
+			t.Errorf("AppendLowerASCII(%q) = %q, expected %q", s, v, lower)
+		}
+		if !EqualFoldASCII(s, string(lower)) || HashName(s) != HashName(string(lower)) {
+			t.Errorf("%q and %q should compare equal", s, lower)
+		}
+	}
+
+	if EqualFoldASCII("www.example.com", "www.example.con") || EqualFoldASCII("@", "`") || EqualFoldASCII("exam[le", "exam{le") {
+		t.Errorf("EqualFoldASCII matched different names")
+	}
+}
+
+func BenchmarkToLowerASCII(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ToLowerASCII("www.subdomain.example.com")
+	}
+}
+
+func BenchmarkEqualFoldASCII(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EqualFoldASCII("www.subdomain.example.com", "WWW.SubDomain.Example.COM")
+	}
+}
@@ -0,0 +1,123 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format returns the message in a multi-line text form similar to the
+// output of dig, with the header, EDNS pseudo-section and one block per
+// section
+func (m *Message) Format() string {
+	b := &strings.Builder{}
+	m.WriteTo(b)
+	return b.String()
+}
+
+// WriteTo writes the message to w as returned by Format
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n", strings.ToUpper(m.Bits.OpCode().String()), m.ExtendedRCode().String(), m.ID)
+
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{m.Bits.IsResponse(), "qr"},
+		{m.Bits.IsAuth(), "aa"},
+		{m.Bits.IsTrunc(), "tc"},
+		{m.Bits.IsRecDesired(), "rd"},
+		{m.Bits.IsRecAvailable(), "ra"},
+		{m.Bits&hAuthData != 0, "ad"},
+		{m.Bits&hChkDis != 0, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	ar := len(m.Additional)
+	if m.HasEDNS {
+		ar += 1
+	}
+	fmt.Fprintf(b, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n", strings.Join(flags, " "), len(m.Question), len(m.Answer), len(m.Authority), ar)
+
+	if m.HasEDNS {
+		b.WriteString("\n;; OPT PSEUDOSECTION:\n")
+		flags := ""
+		if m.DO() {
+			flags = " do"
+		}
+		fmt.Fprintf(b, "; EDNS: version: %d, flags:%s; udp: %d\n", byte(m.OptRCode>>16), flags, m.ReqUDPSize)
+		for n := range m.Opts {
+			b.WriteString("; " + formatOpt(&m.Opts[n]) + "\n")
+		}
+	}
+
+	if len(m.Question) > 0 {
+		b.WriteString("\n;; QUESTION SECTION:\n")
+		for _, q := range m.Question {
+			fmt.Fprintf(b, ";%s\t\t%s\t%s\n", m.fqdn(q.Name), q.Class.text(), q.Type.text())
+		}
+	}
+
+	for _, s := range []struct {
+		name string
+		rrs  []*Resource
+	}{
+		{"ANSWER", m.Answer},
+		{"AUTHORITY", m.Authority},
+		{"ADDITIONAL", m.Additional},
+	} {
+		if len(s.rrs) == 0 {
+			continue
+		}
+		b.WriteString("\n;; " + s.name + " SECTION:\n")
+		for _, rr := range s.rrs {
+			fmt.Fprintf(b, "%s\t%d\t%s\t%s\t%s\n", m.fqdn(rr.Name), rr.TTL, rr.Class.text(), rr.Type.text(), rdataText(rr.Data))
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// rdataText returns rd in presentation format, using the RFC 3597 generic
+// form for unknown types
+func rdataText(rd RData) string {
+	switch rd := rd.(type) {
+	case nil:
+		return ""
+	case *RDataRaw:
+		return `\# ` + strconv.Itoa(len(rd.Data)) + " " + strings.ToUpper(hex.EncodeToString(rd.Data))
+	default:
+		return rd.String()
+	}
+}
+
+// formatOpt returns an EDNS option as shown in the OPT pseudo-section
+func formatOpt(opt *DnsOpt) string {
+	switch opt.Code {
+	case OptNSID:
+		return fmt.Sprintf("NSID: %s (%q)", hex.EncodeToString(opt.Data), opt.Data)
+	case OptClientSubnet:
+		if ecs, err := ParseClientSubnet(opt); err == nil {
+			return "CLIENT-SUBNET: " + ecs.String()
+		}
+	case OptCookie:
+		if c, err := ParseCookie(opt); err == nil {
+			return "COOKIE: " + c.String()
+		}
+	case OptPadding:
+		return fmt.Sprintf("PADDING: %d bytes", len(opt.Data))
+	case OptExtendedError:
+		if e, err := ParseExtendedError(opt); err == nil {
+			return "EDE: " + e.String()
+		}
+	}
+	return fmt.Sprintf("OPT=%d: %s", opt.Code, hex.EncodeToString(opt.Data))
+}
@@ -0,0 +1,226 @@
+package dnsmsg
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Internationalized domain names (RFC 5890)
+//
+// Labels containing non-ASCII characters are encoded as "xn--" followed by
+// their punycode form (RFC 3492). Only lowercase mapping is applied to
+// Unicode labels, the full UTS #46 mapping tables are not included.
+
+// punycode parameters, RFC 3492 section 5
+const (
+	pcBase        = 36
+	pcTMin        = 1
+	pcTMax        = 26
+	pcSkew        = 38
+	pcDamp        = 700
+	pcInitialBias = 72
+	pcInitialN    = 128
+	pcMaxInt      = 1<<31 - 1
+)
+
+// ToASCII converts name to its ASCII form, encoding labels with non-ASCII
+// characters in punycode. ASCII labels are returned unchanged.
+func ToASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	if !utf8.ValidString(name) {
+		return "", ErrLabelInvalid
+	}
+	// ideographic full stops are label separators too (RFC 3490)
+	name = strings.NewReplacer("。", ".", "．", ".", "｡", ".").Replace(name)
+
+	labels := strings.Split(name, ".")
+	for i, l := range labels {
+		if isASCII(l) {
+			continue
+		}
+		l = "xn--" + punyEncode([]rune(strings.ToLower(l)))
+		if len(l) > 63 {
+			return "", ErrLabelTooLong
+		}
+		labels[i] = l
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode converts name to its Unicode form, decoding punycode labels
+func ToUnicode(name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i, l := range labels {
+		if len(l) < 4 || !EqualFoldASCII(l[:4], "xn--") {
+			continue
+		}
+		r, err := punyDecode(ToLowerASCII(l[4:]))
+		if err != nil {
+			return "", err
+		}
+		labels[i] = string(r)
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= pcDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((pcBase-pcTMin)*pcTMax)/2 {
+		delta /= pcBase - pcTMin
+		k += pcBase
+	}
+	return k + (pcBase-pcTMin+1)*delta/(delta+pcSkew)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return pcTMin
+	case k >= bias+pcTMax:
+		return pcTMax
+	default:
+		return k - bias
+	}
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
+
+// punyEncode implements the encoding procedure of RFC 3492 section 6.3
+func punyEncode(input []rune) string {
+	var out []byte
+	for _, c := range input {
+		if c < 0x80 {
+			out = append(out, byte(c))
+		}
+	}
+	b := len(out)
+	h := b
+	if b > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := pcInitialN, 0, pcInitialBias
+	for h < len(input) {
+		m := pcMaxInt
+		for _, c := range input {
+			if int(c) >= n && int(c) < m {
+				m = int(c)
+			}
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+		for _, c := range input {
+			if int(c) < n {
+				delta++
+			}
+			if int(c) != n {
+				continue
+			}
+			q := delta
+			for k := pcBase; ; k += pcBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(pcBase-t)))
+				q = (q - t) / (pcBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+// punyDecode implements the decoding procedure of RFC 3492 section 6.2
+func punyDecode(s string) ([]rune, error) {
+	var out []rune
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b > 0 {
+		for i := 0; i < b; i++ {
+			if s[i] >= 0x80 {
+				return nil, ErrPunycode
+			}
+			out = append(out, rune(s[i]))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := pcInitialN, 0, pcInitialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := pcBase; ; k += pcBase {
+			if pos >= len(s) {
+				return nil, ErrPunycode
+			}
+			d, ok := punyValue(s[pos])
+			pos++
+			if !ok || d > (pcMaxInt-i)/w {
+				return nil, ErrPunycode
+			}
+			i += d * w
+			t := punyThreshold(k, bias)
+			if d < t {
+				break
+			}
+			if w > pcMaxInt/(pcBase-t) {
+				return nil, ErrPunycode
+			}
+			w *= pcBase - t
+		}
+		l := len(out) + 1
+		bias = punyAdapt(i-oldi, l, oldi == 0)
+		n += i / l
+		i %= l
+		if n > utf8.MaxRune || (n >= 0xd800 && n <= 0xdfff) {
+			return nil, ErrPunycode
+		}
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = rune(n)
+		i++
+	}
+	if isASCII(string(out)) {
+		// would not have been encoded
+		return nil, ErrPunycode
+	}
+	return out, nil
+}
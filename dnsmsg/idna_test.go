@@ -0,0 +1,50 @@
+package dnsmsg
+
+import "testing"
+
+func TestIDNA(t *testing.T) {
+	tests := []struct{ unicode, ascii string }{
+		{"example.com.", "example.com."},
+		{"münchen.de.", "xn--mnchen-3ya.de."},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"日本語.jp", "xn--wgv71a119e.jp"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"ñ", "xn--ida"},
+	}
+	for _, test := range tests {
+		a, err := ToASCII(test.unicode)
+		if err != nil || a != test.ascii {
+			t.Errorf("ToASCII(%q) = %q, %v, expected %q", test.unicode, a, err, test.ascii)
+		}
+		u, err := ToUnicode(test.ascii)
+		if err != nil || u != test.unicode {
+			t.Errorf("ToUnicode(%q) = %q, %v, expected %q", test.ascii, u, err, test.unicode)
+		}
+	}
+
+	if a, _ := ToASCII("Bücher。example"); a != "xn--bcher-kva.example" {
+		t.Errorf("unexpected mapping %q", a)
+	}
+	if _, err := ToUnicode("xn--a-ecp.ru"); err != nil {
+		t.Errorf("failed to decode: %s", err)
+	}
+	for _, bad := range []string{"xn--99999999999.com", "xn--ab-.com", "xn--a-é.com"} {
+		if _, err := ToUnicode(bad); err == nil {
+			t.Errorf("ToUnicode(%q) succeeded", bad)
+		}
+	}
+
+	msg := NewQuery("münchen.de.", IN, A)
+	msg.IDN = true
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	res, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if res.Question[0].Name != "xn--mnchen-3ya.de." {
+		t.Errorf("unexpected name %s", res.Question[0].Name)
+	}
+}
@@ -0,0 +1,123 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMessageJSON(t *testing.T) {
+	b, _ := hex.DecodeString("236f8180000100010000000106676f6f676c6503636f6d0000010001c00c00010001000000cd0004acd9af6e0000290200000000000000")
+	msg, err := Parse(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	msg.Additional = append(msg.Additional, &Resource{Name: "x.google.com.", Type: 1234, Class: IN, TTL: 60, Data: &RDataRaw{Data: []byte{1, 2, 3}, Type: 1234}})
+	msg.SetNSID([]byte("ns1"))
+
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	for _, s := range []string{`"ID":9071`, `"QR":1`, `"RD":1`, `"RA":1`, `"ANCOUNT":1`, `"ARCOUNT":2`, `"rdataA":"172.217.175.110"`, `"RDATAHEX":"010203"`, `"NAME":"google.com."`, `"TYPEname":"A"`} {
+		if !strings.Contains(string(buf), s) {
+			t.Errorf("expected %s in %s", s, buf)
+		}
+	}
+	if strings.Contains(string(buf), "EDNS") {
+		t.Errorf("EDNS data in standard mode: %s", buf)
+	}
+
+	res := &Message{}
+	if err := json.Unmarshal(buf, res); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	msg.HasEDNS, msg.Opts, msg.ReqUDPSize = false, nil, 0
+	if res.String() != msg.String() {
+		t.Errorf("round trip mismatch:\n%s\n%s", res, msg)
+	}
+
+	// lossless mode keeps EDNS
+	msg.SetNSID([]byte("ns1"))
+	msg.ReqUDPSize = 1232
+	buf, err = msg.MarshalJSONLossless()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if !strings.Contains(string(buf), `"RDATAB64":"AQID"`) {
+		t.Errorf("expected base64 RDATA in %s", buf)
+	}
+	res = &Message{}
+	if err := json.Unmarshal(buf, res); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	if res.String() != msg.String() {
+		t.Errorf("lossless round trip mismatch:\n%s\n%s", res, msg)
+	}
+	if id, ok := res.GetNSID(); !ok || string(id) != "ns1" {
+		t.Errorf("NSID lost in lossless round trip")
+	}
+	b1, _ := msg.MarshalBinary()
+	b2, _ := res.MarshalBinary()
+	if hex.EncodeToString(b1) != hex.EncodeToString(b2) {
+		t.Errorf("wire format differs after lossless round trip")
+	}
+
+	// records without RDATA
+	rr := &Resource{Name: "www.example.com.", Type: ANY, Class: ClassANY}
+	buf, err = json.Marshal(rr)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	rr = &Resource{}
+	if err := json.Unmarshal(buf, rr); err != nil {
+		t.Fatalf("failed to unmarshal record without RDATA: %s", err)
+	}
+	if rr.Name != "www.example.com." || rr.Type != ANY || rr.Class != ClassANY || rr.Data != nil {
+		t.Errorf("unexpected record %s", rr)
+	}
+}
+
+func TestDNSJSON(t *testing.T) {
+	q, err := ParseDNSJSONQuery(url.Values{"name": {"example.com"}, "type": {"mx"}, "do": {"1"}, "edns_client_subnet": {"192.0.2.0/24"}})
+	if err != nil {
+		t.Fatalf("failed to parse query: %s", err)
+	}
+	if q.Question[0].Name != "example.com." || q.Question[0].Type != MX || !q.DO() || q.GetClientSubnet() == nil {
+		t.Errorf("unexpected query %s", q)
+	}
+	if _, err := ParseDNSJSONQuery(url.Values{"name": {"example.com"}, "type": {"NOPE"}}); err == nil {
+		t.Errorf("invalid type was accepted")
+	}
+
+	msg := &Message{Question: q.Question, Base: "example.com"}
+	msg.Bits.SetResponse(true)
+	msg.Bits.SetRecDesired(true)
+	msg.Answer = []*Resource{
+		{Name: "example.com.", Type: MX, Class: IN, TTL: 300, Data: &RDataMX{Pref: 10, Server: "mail.example.com."}},
+		{Name: "x", Type: 1234, Class: IN, TTL: 60, Data: &RDataRaw{Data: []byte{1, 2, 3}, Type: 1234}},
+	}
+
+	buf, err := msg.MarshalDNSJSON()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expect := `{"Status":0,"TC":false,"RD":true,"RA":false,"AD":false,"CD":false,"Question":[{"name":"example.com.","type":15}],"Answer":[{"name":"example.com.","type":15,"TTL":300,"data":"10 mail.example.com."},{"name":"x.example.com.","type":1234,"TTL":60,"data":"\\# 3 010203"}]}`
+	if string(buf) != expect {
+		t.Errorf("unexpected dns-json:\n%s", buf)
+	}
+
+	res := &Message{}
+	if err := res.UnmarshalDNSJSON(buf); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	if res.Answer[1].Name != "x.example.com." {
+		t.Errorf("relative name was not qualified: %s", res.Answer[1].Name)
+	}
+	res.Answer[1].Name = "x"
+	if res.String() != msg.String() {
+		t.Errorf("round trip mismatch:\n%s\n%s", res, msg)
+	}
+}
@@ -22,9 +22,34 @@ type Message struct {
 	ReqUDPSize uint16   // requestor's UDP payload size
 	OptRCode   OptRCode // extended RCODE and flags
 
+	DSO []DSOTLV // TLVs of DSO messages (RFC 8490)
+
 	Base string // base name (always empty for parsed queries)
+	IDN  bool   // if true, Unicode names are encoded in punycode
+
+	Compression Compression // name compression mode
+
+	raw []byte // wire form, if kept when parsing
 }
 
+// Compression selects which names are compressed when marshalling a message
+type Compression int
+
+const (
+	// CompressAll compresses all names where the encoder of the RDATA
+	// allows it. Names in the RDATA of DNAME, RP, AFSDB, SRV, KX, NAPTR,
+	// SIG, RRSIG, NSEC and HIP are always written in full (RFC 3597 section
+	// 4, RFC 6672 section 2.5), so for the types known to this package this
+	// is the same as CompressStandard.
+	CompressAll Compression = iota
+	// CompressStandard compresses owner names, and names in RDATA only for
+	// the types of RFC 1035 where this is allowed (RFC 3597 section 4).
+	// Names in newer types such as SRV, DNAME or RRSIG are written in full.
+	CompressStandard
+	// CompressNone does not compress any name
+	CompressNone
+)
+
 func New() *Message {
 	msg := &Message{
 		ID: uint16(rand.Int31n(0xffff) + 1),
@@ -33,10 +58,48 @@ func New() *Message {
 	return msg
 }
 
+// NewResponse returns the skeleton of a response to query q, with the same
+// ID, opcode, RD and CD bits and a copy of the question keeping its original
+// case. Other header bits are cleared. EDNS is set up as by NegotiateEDNS
+// with udpSize, so the response code is BADVERS if the query used an
+// unsupported EDNS version.
+func NewResponse(q *Message, udpSize uint16) *Message {
+	res := &Message{
+		ID:   q.ID,
+		Bits: hQResp | q.Bits&(hRecD|hChkDis),
+		IDN:  q.IDN,
+	}
+	res.Bits.SetOpCode(q.Bits.OpCode())
+	for _, qq := range q.Question {
+		c := *qq
+		res.Question = append(res.Question, &c)
+	}
+	res.NegotiateEDNS(q, udpSize)
+	return res
+}
+
+// MarshalBinary encodes m in wire format. The output only depends on the
+// content of m: names are compressed against the first occurrence of each
+// suffix, in section order, so identical messages give identical bytes.
 func (m *Message) MarshalBinary() ([]byte, error) {
+	return m.marshal(nil)
+}
+
+// marshal encodes m, storing the wire size of each record in sizes if not nil
+func (m *Message) marshal(sizes map[*Resource]int) ([]byte, error) {
 	c := &context{
 		labelMap: make(map[string]uint16),
 		name:     m.Base,
+		idn:      m.IDN,
+
+		compression: m.Compression,
+		noCompress:  m.Compression == CompressNone,
+	}
+	if m.IDN {
+		var err error
+		if c.name, err = ToASCII(c.name); err != nil {
+			return nil, err
+		}
 	}
 
 	err := binary.Write(c, binary.BigEndian, m.ID)
@@ -59,7 +122,12 @@ func (m *Message) MarshalBinary() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Write(c, binary.BigEndian, uint16(len(m.Additional)))
+	arCount := len(m.Additional)
+	if m.HasEDNS {
+		// OPT pseudo-RR will be added to the additional section
+		arCount += 1
+	}
+	err = binary.Write(c, binary.BigEndian, uint16(arCount))
 	if err != nil {
 		return nil, err
 	}
@@ -70,19 +138,45 @@ func (m *Message) MarshalBinary() ([]byte, error) {
 		}
 	}
 	for _, r := range m.Answer {
+		pos := c.Len()
 		if err = r.encode(c); err != nil {
 			return nil, err
 		}
+		if sizes != nil {
+			sizes[r] = c.Len() - pos
+		}
 	}
 	for _, r := range m.Authority {
+		pos := c.Len()
 		if err = r.encode(c); err != nil {
 			return nil, err
 		}
+		if sizes != nil {
+			sizes[r] = c.Len() - pos
+		}
 	}
 	for _, r := range m.Additional {
+		pos := c.Len()
 		if err = r.encode(c); err != nil {
 			return nil, err
 		}
+		if sizes != nil {
+			sizes[r] = c.Len() - pos
+		}
+	}
+	if m.HasEDNS {
+		if err = m.optResource().encode(c); err != nil {
+			return nil, err
+		}
+	}
+	if m.Bits.OpCode() == DSO {
+		if arCount > 0 || len(m.Question) > 0 || len(m.Answer) > 0 || len(m.Authority) > 0 {
+			// RFC 8490 section 5.4
+			return nil, ErrDSO
+		}
+		if err = m.encodeDSO(c); err != nil {
+			return nil, err
+		}
 	}
 
 	return c.rawMsg, nil
@@ -113,6 +207,9 @@ func (m *Message) String() string {
 			res = append(res, opt.String())
 		}
 	}
+	for _, tlv := range m.DSO {
+		res = append(res, "DSO(type="+strconv.FormatUint(uint64(tlv.Type), 10)+")")
+	}
 
 	return strings.Join(res, " ")
 }
@@ -1,9 +1,15 @@
 package dnsmsg
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParse(t *testing.T) {
@@ -16,7 +22,7 @@ func TestParse(t *testing.T) {
 		t.Errorf("failed to parse: %s", err)
 	}
 
-	if msg.String() != "ID: 9071 Query rd NOERROR QD: google.com. IN A ReqUDPSize=4096" {
+	if msg.String() != "ID: 9071 Query rd NOERROR QD: google.com. IN A ReqUDPSize=4096 OPT(code=10)" {
 		t.Errorf("failed to parse simple, got %s", msg.String())
 	}
 
@@ -37,3 +43,866 @@ func TestParse(t *testing.T) {
 
 	log.Printf("parsed: %s", msg.String())
 }
+
+func TestMarshalEDNS(t *testing.T) {
+	for _, hexB := range []string{
+		"236f0120000100000000000106676f6f676c6503636f6d0000010001000029100000000000000c000a0008773d66c995247430",
+		"236f8180000100010000000106676f6f676c6503636f6d0000010001c00c00010001000000cd0004acd9af6e0000290200000000000000",
+	} {
+		b, _ := hex.DecodeString(hexB)
+
+		msg, err := Parse(b)
+		if err != nil {
+			t.Errorf("failed to parse: %s", err)
+			continue
+		}
+
+		res, err := msg.MarshalBinary()
+		if err != nil {
+			t.Errorf("failed to marshal: %s", err)
+			continue
+		}
+
+		if !bytes.Equal(b, res) {
+			t.Errorf("EDNS round-trip failed, got %x", res)
+		}
+	}
+}
+
+func TestMessageFormat(t *testing.T) {
+	b, _ := hex.DecodeString("236f8180000100010000000106676f6f676c6503636f6d0000010001c00c00010001000000cd0004acd9af6e0000290200000000000000")
+	msg, err := Parse(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	msg.SetNSID([]byte("ns1"))
+	msg.SetDO(true)
+
+	expect := `;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 9071
+;; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 1
+
+;; OPT PSEUDOSECTION:
+; EDNS: version: 0, flags: do; udp: 512
+; NSID: 6e7331 ("ns1")
+
+;; QUESTION SECTION:
+;google.com.		IN	A
+
+;; ANSWER SECTION:
+google.com.	205	IN	A	172.217.175.110
+`
+	if s := msg.Format(); s != expect {
+		t.Errorf("unexpected format:\n%s", s)
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	msg := &Message{ID: 1, Answer: []*Resource{
+		{Name: "a.example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}},
+		{Name: "b.example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 2}, Type: A}},
+	}, Additional: []*Resource{
+		{Name: "c.example.com.", Type: TXT, Class: IN, TTL: 60, Data: NewTXT("hello")},
+	}}
+	msg.SetDO(true)
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+
+	res, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	end := 12
+	for i, r := range res.Answer {
+		if r.Name != msg.Answer[i].Name || r.Pos.Index != i || r.Pos.Offset != end {
+			t.Errorf("unexpected answer %d: %s at %+v", i, r, r.Pos)
+		}
+		end = r.Pos.Offset + r.Pos.Len
+	}
+	// followed by the OPT record (11 bytes without options)
+	r := res.Additional[0]
+	if r.Pos.Index != 0 || r.Pos.Offset != end || r.Pos.Offset+r.Pos.Len+11 != len(buf) {
+		t.Errorf("unexpected additional position %+v", r.Pos)
+	}
+	if !bytes.HasSuffix(buf[r.Pos.Offset:r.Pos.Offset+r.Pos.Len], []byte("\x05hello")) {
+		t.Errorf("unexpected record bytes %x", buf[r.Pos.Offset:r.Pos.Offset+r.Pos.Len])
+	}
+}
+
+func TestEditor(t *testing.T) {
+	msg := &Message{ID: 1, Bits: hQResp, Question: []*Question{{Name: "example.com.", Type: A, Class: IN}}, Answer: []*Resource{
+		{Name: "example.com.", Type: CNAME, Class: IN, TTL: 300, Data: &RDataLabel{Label: "www.example.com.", Type: CNAME}},
+		{Name: "www.example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}},
+	}, Authority: []*Resource{
+		{Name: "example.com.", Type: NS, Class: IN, TTL: 3600, Data: &RDataLabel{Label: "ns.example.com.", Type: NS}},
+	}, Additional: []*Resource{
+		{Name: "ns.example.com.", Type: A, Class: IN, TTL: 3600, Data: &RDataIP{IP: []byte{192, 0, 2, 53}, Type: A}},
+	}}
+	msg.SetDO(true)
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+
+	e, err := NewEditor(buf)
+	if err != nil {
+		t.Fatalf("failed to load message: %s", err)
+	}
+	if e.Count(SectionAdditional) != 2 || e.Type(SectionAdditional, 1) != OPT {
+		t.Errorf("unexpected additional section")
+	}
+	e.SetID(0x1234)
+	e.AgeTTL(100)
+
+	// the A record is compressed using the CNAME target
+	if err := e.Remove(SectionAnswer, 0); err != ErrNotSupport {
+		t.Errorf("removing the CNAME record: expected ErrNotSupport, got %v", err)
+	}
+	if err := e.Remove(SectionAnswer, 1); err != nil {
+		t.Fatalf("failed to remove record: %s", err)
+	}
+
+	res, err := Parse(e.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse edited message: %s", err)
+	}
+	if res.ID != 0x1234 || len(res.Answer) != 1 || !res.DO() {
+		t.Errorf("unexpected edited message %s", res)
+	}
+	if r := res.Answer[0]; r.TTL != 200 || r.Data.String() != "www.example.com." {
+		t.Errorf("unexpected answer %s", r)
+	}
+	if r := res.Additional[0]; r.Name != "ns.example.com." || r.TTL != 3500 {
+		t.Errorf("unexpected additional record %s", r)
+	}
+}
+
+func TestEditorRDataPointers(t *testing.T) {
+	// names in the RDATA of newer types may be compressed by other
+	// implementations, build such a message by changing the type of a CNAME
+	msg := &Message{ID: 1, Bits: hQResp, Answer: []*Resource{
+		{Name: "x.example.net.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}},
+		{Name: "y.d.org.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 2}, Type: A}},
+		{Name: "z.example.com.", Type: CNAME, Class: IN, TTL: 60, Data: &RDataLabel{Label: "d.org.", Type: CNAME}},
+	}}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	// type, class and TTL of the CNAME record
+	pos := bytes.Index(buf, []byte{0, byte(CNAME), 0, byte(IN), 0, 0, 0, 60})
+	buf[pos+1] = byte(DNAME)
+	e, err := NewEditor(buf)
+	if err != nil {
+		t.Fatalf("failed to load message: %s", err)
+	}
+
+	if err := e.Remove(SectionAnswer, 0); err != nil {
+		t.Fatalf("failed to remove record: %s", err)
+	}
+	res, err := Parse(e.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse edited message: %s", err)
+	}
+	if len(res.Answer) != 2 || res.Answer[1].Type != DNAME || res.Answer[1].Data.String() != "d.org." {
+		t.Errorf("unexpected edited message %s", res)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	msg := &Message{ID: 1, Question: []*Question{{Name: "example.com.", Type: A, Class: IN}}}
+	for i := 0; i < 40; i++ {
+		msg.Answer = append(msg.Answer, &Resource{Name: "example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, byte(i)}, Type: A}})
+	}
+	msg.Answer = append(msg.Answer, &Resource{Name: "example.com.", Type: TXT, Class: IN, TTL: 60, Data: NewTXT("hello")})
+	for i := 0; i < 10; i++ {
+		msg.Additional = append(msg.Additional, &Resource{Name: "ns.example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, byte(i)}, Type: A}})
+	}
+
+	// dropping the additional records is enough
+	n, err := msg.Truncate(700, TruncateAdditionalFirst)
+	if err != nil {
+		t.Fatalf("failed to truncate: %s", err)
+	}
+	if n > 700 || len(msg.Additional) != 0 || len(msg.Answer) != 41 || msg.Bits.IsTrunc() {
+		t.Errorf("unexpected truncation to %d bytes: %s", n, msg)
+	}
+
+	// the A RRset is dropped as a whole
+	n, err = msg.Truncate(100, TruncateAdditionalFirst)
+	if err != nil {
+		t.Fatalf("failed to truncate: %s", err)
+	}
+	if n > 100 || len(msg.Answer) != 0 || !msg.Bits.IsTrunc() {
+		t.Errorf("unexpected truncation to %d bytes: %s", n, msg)
+	}
+	if buf, _ := msg.MarshalBinary(); len(buf) != n {
+		t.Errorf("returned size %d, message is %d bytes", n, len(buf))
+	}
+
+	// the additional record grows once the answer it was compressed against
+	// is dropped, 50 bytes instead of the 45 computed
+	msg = &Message{ID: 1, Question: []*Question{{Name: "example.com.", Type: A, Class: IN}}}
+	msg.Answer = append(msg.Answer, &Resource{Name: "host.example.com.", Type: TXT, Class: IN, TTL: 60, Data: NewTXT("hello")})
+	msg.Additional = append(msg.Additional, &Resource{Name: "host.example.com.", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}})
+	n, err = msg.Truncate(46, TruncateAnswerFirst)
+	if err != nil {
+		t.Fatalf("failed to truncate: %s", err)
+	}
+	if n != 29 || len(msg.Answer) != 0 || len(msg.Additional) != 0 {
+		t.Errorf("unexpected truncation to %d bytes: %s", n, msg)
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	q := NewQuery("WwW.Example.COM.", IN, A)
+	q.Bits |= hChkDis | 0x0040 // Z bit, not copied
+	q.ReqUDPSize = 4096
+	q.SetDO(true)
+	q.SetNSID(nil)
+
+	res := NewResponse(q, 1232)
+	if res.ID != q.ID || res.Bits != hQResp|hRecD|hChkDis || res.Bits.OpCode() != Query {
+		t.Errorf("unexpected response header: %s", res)
+	}
+	if len(res.Question) != 1 || res.Question[0] == q.Question[0] || res.Question[0].Name != "WwW.Example.COM." {
+		t.Errorf("unexpected response question: %s", res)
+	}
+	if !res.HasEDNS || !res.DO() || res.ReqUDPSize != 1232 || len(res.Opts) != 0 {
+		t.Errorf("unexpected response EDNS: %s", res)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	a := &Resource{Name: "www.example.com.", Type: A, TTL: 300, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}}
+
+	msg := NewUpdate("example.com.")
+	msg.RequireRRSetExists("www.example.com.", A)
+	msg.RequireRRSet(a)
+	msg.RequireRRSetNotExists("www.example.com.", AAAA)
+	msg.RequireNameInUse("example.com.")
+	msg.RequireNameNotInUse("new.example.com.")
+	msg.AddRecords(a)
+	msg.DeleteRRSet("www.example.com.", TXT)
+	msg.DeleteName("old.example.com.")
+	msg.DeleteRecords(a)
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	res, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if res.Bits.OpCode() != Update || res.Zone() == nil || res.Zone().Name != "example.com." {
+		t.Fatalf("unexpected update message %s", res)
+	}
+
+	zc := res.Zone().Class
+	var prereqs []PrereqKind
+	for _, r := range res.Prerequisites() {
+		prereqs = append(prereqs, r.PrereqKind(zc))
+	}
+	if fmt.Sprint(prereqs) != fmt.Sprint([]PrereqKind{PrereqRRSetExists, PrereqRRSetValue, PrereqRRSetNotExists, PrereqNameInUse, PrereqNameNotInUse}) {
+		t.Errorf("unexpected prerequisites %v", prereqs)
+	}
+	var updates []UpdateKind
+	for _, r := range res.Updates() {
+		updates = append(updates, r.UpdateKind(zc))
+	}
+	if fmt.Sprint(updates) != fmt.Sprint([]UpdateKind{UpdateAdd, UpdateDeleteRRSet, UpdateDeleteName, UpdateDeleteRecord}) {
+		t.Errorf("unexpected updates %v", updates)
+	}
+	if r := res.Updates()[3]; r.Class.String() != "NONE" || r.TTL != 0 || r.Data.String() != "192.0.2.1" {
+		t.Errorf("unexpected delete record %s", r)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	buf, err := NewNotify("example.com.", 2024010101).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	msg, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	zone, serial, ok, err := ValidateNotify(msg)
+	if err != nil || zone != "example.com." || serial != 2024010101 || !ok || !msg.Bits.IsAuth() {
+		t.Errorf("unexpected notify %s: %v", msg, err)
+	}
+
+	msg.Answer[0].Name = "other.com."
+	if _, _, _, err := ValidateNotify(msg); err != ErrNotify {
+		t.Errorf("expected ErrNotify for a mismatched SOA, got %v", err)
+	}
+	msg.Answer = nil
+	if _, _, ok, err := ValidateNotify(msg); err != nil || ok {
+		t.Errorf("unexpected result for a notify without serial: %v %v", ok, err)
+	}
+	msg.Bits.SetOpCode(Query)
+	if _, _, _, err := ValidateNotify(msg); err != ErrNotify {
+		t.Errorf("expected ErrNotify for a query, got %v", err)
+	}
+}
+
+func TestMatchQuestionCase(t *testing.T) {
+	msg := NewQuery("wWw.ExAmPlE.cOm.", IN, A)
+	msg.Base = "example.com"
+	msg.Answer = []*Resource{
+		{Name: "www", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}},
+		{Name: "other", Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, 2}, Type: A}},
+	}
+	msg.MatchQuestionCase()
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	res, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if res.Answer[0].Name != "wWw.ExAmPlE.cOm." || !res.Answer[1].Name.Equal("other.example.com.") {
+		t.Errorf("unexpected answer names %s, %s", res.Answer[0].Name, res.Answer[1].Name)
+	}
+}
+
+func TestDSO(t *testing.T) {
+	msg := NewDSO(NewDSOKeepAlive(15*time.Second, time.Minute), NewDSOPadding(3))
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if len(buf) != 12+4+8+4+3 {
+		t.Errorf("unexpected message length %d", len(buf))
+	}
+
+	res, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if res.Bits.OpCode() != DSO || len(res.DSO) != 2 || res.DSO[1].Type != DSOEncryptionPadding {
+		t.Fatalf("unexpected DSO message %s", res)
+	}
+	inactivity, interval, err := ParseDSOKeepAlive(res.PrimaryTLV())
+	if err != nil || inactivity != 15*time.Second || interval != time.Minute {
+		t.Errorf("unexpected keepalive %s %s: %v", inactivity, interval, err)
+	}
+	if _, err := ParseDSORetryDelay(res.PrimaryTLV()); err != ErrDSO {
+		t.Errorf("expected ErrDSO for a keepalive TLV, got %v", err)
+	}
+
+	// DSO messages have no records
+	buf[5] = 1
+	if _, err := Parse(buf); err != ErrDSO {
+		t.Errorf("expected ErrDSO for a DSO message with a question, got %v", err)
+	}
+	msg.Question = []*Question{{Name: "example.com.", Type: A, Class: IN}}
+	if _, err := msg.MarshalBinary(); err != ErrDSO {
+		t.Errorf("expected ErrDSO when marshaling a question, got %v", err)
+	}
+}
+
+func TestAXFR(t *testing.T) {
+	soa := &Resource{Name: "example.com.", Type: SOA, Class: IN, TTL: 3600, Data: &RDataSOA{MName: "ns.example.com.", RName: "hostmaster.example.com.", Serial: 42}}
+	q := NewQuery("example.com.", IN, AXFR)
+
+	buf := &bytes.Buffer{}
+	w := NewAXFRWriter(buf, q)
+	w.MaxSize = 512
+	if err := w.Write(soa); err != nil {
+		t.Fatalf("failed to write SOA: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		rr := &Resource{Name: Name(fmt.Sprintf("host%d.example.com.", i)), Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, byte(i)}, Type: A}}
+		if err := w.Write(rr); err != nil {
+			t.Fatalf("failed to write record: %s", err)
+		}
+	}
+	if err := w.Close(); err != ErrXfr {
+		t.Errorf("expected ErrXfr when closing without SOA, got %v", err)
+	}
+	w.Write(soa)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// check messages
+	data := buf.Bytes()
+	msgs := 0
+	for r := bytes.NewReader(data); r.Len() > 0; msgs++ {
+		msg, err := ReadStreamMessage(r)
+		if err != nil {
+			t.Fatalf("failed to read message: %s", err)
+		}
+		if buf, _ := msg.MarshalBinary(); len(buf) > 512 {
+			t.Errorf("message %d is %d bytes", msgs, len(buf))
+		}
+		if (len(msg.Question) == 1) != (msgs == 0) {
+			t.Errorf("message %d has %d questions", msgs, len(msg.Question))
+		}
+	}
+	if msgs < 4 {
+		t.Errorf("expected transfer to be split, got %d messages", msgs)
+	}
+
+	x := NewAXFRReader(bytes.NewReader(data), q.ID)
+	n := 0
+	for {
+		_, err := x.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record %d: %s", n, err)
+		}
+		n++
+	}
+	if n != 101 || x.SOA().Data.(*RDataSOA).Serial != 42 {
+		t.Errorf("read %d records", n)
+	}
+
+	// truncated transfer
+	x = NewAXFRReader(bytes.NewReader(data[:len(data)-40]), q.ID)
+	var err error
+	for err == nil {
+		_, err = x.Next()
+	}
+	if err == io.EOF {
+		t.Errorf("truncated transfer was accepted")
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	soa := func(serial uint32) *Resource {
+		return &Resource{Name: "example.com.", Type: SOA, Class: IN, TTL: 3600, Data: &RDataSOA{MName: "ns.example.com.", RName: "hostmaster.example.com.", Serial: serial}}
+	}
+	a := func(name string, ip byte) *Resource {
+		return &Resource{Name: Name(name), Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, ip}, Type: A}}
+	}
+
+	zone := []*Resource{soa(1), a("www.example.com.", 1), a("mail.example.com.", 2)}
+
+	// RFC 1995 section 7 layout: version 1 to 2 then 2 to 3
+	rrs := []*Resource{
+		soa(3),
+		soa(1), a("www.example.com.", 1), soa(2), a("www.example.com.", 10),
+		soa(2), a("mail.example.com.", 2), soa(3), a("mail.example.com.", 20), a("ftp.example.com.", 30),
+		soa(3),
+	}
+	x, err := ParseIXFR(rrs)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if len(x.Diffs) != 2 || len(x.Diffs[1].Added) != 2 || x.Full != nil {
+		t.Fatalf("unexpected transfer %+v", x)
+	}
+	if out := x.Records(); len(out) != len(rrs) {
+		t.Errorf("serialized to %d records instead of %d", len(out), len(rrs))
+	}
+
+	res, err := x.Apply(zone)
+	if err != nil {
+		t.Fatalf("failed to apply: %s", err)
+	}
+	var names []string
+	for _, rr := range res {
+		names = append(names, rr.String())
+	}
+	expect := []string{
+		"example.com. IN SOA 3600 ns.example.com. hostmaster.example.com. 3 0 0 0 0",
+		"www.example.com. IN A 60 192.0.2.10",
+		"mail.example.com. IN A 60 192.0.2.20",
+		"ftp.example.com. IN A 60 192.0.2.30",
+	}
+	if fmt.Sprint(names) != fmt.Sprint(expect) {
+		t.Errorf("unexpected zone after transfer:\n%s", strings.Join(names, "\n"))
+	}
+
+	// the transfer does not start at our version
+	if _, err := x.Apply(res); err != ErrXfr {
+		t.Errorf("expected ErrXfr, got %v", err)
+	}
+
+	// up to date, and full transfer
+	if x, err := ParseIXFR([]*Resource{soa(3)}); err != nil || len(x.Diffs) != 0 || x.Full != nil {
+		t.Errorf("unexpected up to date transfer %+v: %v", x, err)
+	}
+	if x, err := ParseIXFR([]*Resource{soa(3), a("www.example.com.", 1), soa(3)}); err != nil || len(x.Full) != 1 {
+		t.Errorf("unexpected full transfer %+v: %v", x, err)
+	}
+	if _, err := ParseIXFR(rrs[:len(rrs)-1]); err != ErrXfr {
+		t.Errorf("expected ErrXfr for a truncated transfer, got %v", err)
+	}
+}
+
+func TestXFRReader(t *testing.T) {
+	soa := func(serial uint32) *Resource {
+		return &Resource{Name: "example.com.", Type: SOA, Class: IN, TTL: 3600, Data: &RDataSOA{MName: "ns.example.com.", RName: "hostmaster.example.com.", Serial: serial}}
+	}
+	a := func(name string, ip byte) *Resource {
+		return &Resource{Name: Name(name), Type: A, Class: IN, TTL: 60, Data: &RDataIP{IP: []byte{192, 0, 2, ip}, Type: A}}
+	}
+	stream := func(q *Message, rrs []*Resource) []byte {
+		buf := &bytes.Buffer{}
+		w := NewAXFRWriter(buf, q)
+		w.MaxSize = 128
+		for _, rr := range rrs {
+			w.Write(rr)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to write transfer: %s", err)
+		}
+		return buf.Bytes()
+	}
+	read := func(x *XFRReader) ([]string, error) {
+		var res []string
+		for {
+			set, err := x.Next()
+			if err == io.EOF {
+				return res, nil
+			}
+			if err != nil {
+				return res, err
+			}
+			res = append(res, fmt.Sprintf("%s %d %s %d", set.Op, set.Serial, set.Records[0].Name, len(set.Records)))
+		}
+	}
+
+	// incremental, with a RRset split across messages
+	q := NewIXFRQuery("example.com.", 1)
+	rrs := []*Resource{
+		soa(3),
+		soa(1), a("www.example.com.", 1), soa(2), a("www.example.com.", 10), a("www.example.com.", 11), a("www.example.com.", 12),
+		soa(2), soa(3), a("mail.example.com.", 20),
+		soa(3),
+	}
+	x := NewXFRReader(bytes.NewReader(stream(q, rrs)), q)
+	sets, err := read(x)
+	expect := "[delete 1 www.example.com. 1 add 2 www.example.com. 3 add 3 mail.example.com. 1]"
+	if err != nil || fmt.Sprint(sets) != expect || !x.Incremental() || mustSerial(x.SOA()) != 3 {
+		t.Errorf("unexpected incremental transfer %v: %v", sets, err)
+	}
+
+	// differences not starting at our version, or not ending at the
+	// announced one
+	for _, bad := range [][]*Resource{
+		{soa(3), soa(2), soa(3), a("www.example.com.", 1), soa(3)},
+		{soa(3), soa(1), soa(2), a("www.example.com.", 1), soa(2), soa(4), soa(3)},
+	} {
+		if _, err := read(NewXFRReader(bytes.NewReader(stream(q, bad)), q)); err != ErrXfr {
+			t.Errorf("expected ErrXfr, got %v", err)
+		}
+	}
+
+	// up to date
+	buf := &bytes.Buffer{}
+	WriteStreamMessage(buf, &Message{ID: q.ID, Bits: hQResp, Answer: []*Resource{soa(1)}})
+	x = NewXFRReader(buf, q)
+	if sets, err := read(x); err != nil || len(sets) != 0 || mustSerial(x.SOA()) != 1 {
+		t.Errorf("unexpected up to date transfer %v: %v", sets, err)
+	}
+
+	// full transfer through Transfer
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("failed to listen: %s", err)
+	}
+	defer l.Close()
+	q = NewQuery("example.com.", IN, AXFR)
+	data := stream(q, []*Resource{soa(5), a("a.example.com.", 1), a("b.example.com.", 2), a("b.example.com.", 3), soa(5)})
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		ReadStreamMessage(c)
+		c.Write(data)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer conn.Close()
+	sets = nil
+	soaRR, err := Transfer(conn, q, func(set *XFRSet) error {
+		sets = append(sets, fmt.Sprintf("%s %d %s %d", set.Op, set.Serial, set.Records[0].Name, len(set.Records)))
+		return nil
+	})
+	expect = "[zone 5 a.example.com. 1 zone 5 b.example.com. 2]"
+	if err != nil || fmt.Sprint(sets) != expect || mustSerial(soaRR) != 5 {
+		t.Errorf("unexpected full transfer %v: %v", sets, err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	msg := NewQuery("a.b.c.example.com.", IN, A)
+	msg.Answer = []*Resource{
+		{Name: "example.com.", Type: A, Class: IN, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}},
+		{Name: "example.com.", Type: A, Class: IN, Data: &RDataIP{IP: []byte{192, 0, 2, 2}, Type: A}},
+	}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+
+	for _, test := range []struct {
+		opts *ParseOptions
+		err  error
+	}{
+		{&ParseOptions{}, nil},
+		{&ParseOptions{MaxSize: len(buf), MaxQuestions: 1, MaxRecords: 2, MaxLabels: 9}, nil},
+		{&ParseOptions{MaxSize: len(buf) - 1}, ErrLimit},
+		{&ParseOptions{MaxRecords: 1}, ErrLimit},
+		// the question has 5 labels, answer names point to the last 2 of
+		// them, which are counted again
+		{&ParseOptions{MaxLabels: 8}, ErrLimit},
+	} {
+		_, err := ParseWithOptions(buf, test.opts)
+		if err != test.err {
+			t.Errorf("options %+v: got error %v, expected %v", test.opts, err, test.err)
+		}
+	}
+
+	// counts that cannot fit in the message are rejected before parsing
+	if _, err := Parse([]byte("\x00\x01\x00\x00\xff\xff\x00\x00\x00\x00\x00\x00")); err != io.ErrUnexpectedEOF {
+		t.Errorf("unexpected error for bogus counts: %v", err)
+	}
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	msg := NewQuery("www.example.com.", IN, A)
+	msg.Bits.SetResponse(true)
+	for i := 0; i < 20; i++ {
+		name := Name(fmt.Sprintf("h%d.Example.COM.", i%7))
+		msg.Answer = append(msg.Answer, &Resource{Name: name, Type: MX, Class: IN, TTL: 300, Data: &RDataMX{Pref: uint16(i), Server: fmt.Sprintf("mx%d.example.net.", i%3)}})
+	}
+	msg.HasEDNS, msg.ReqUDPSize = true, 1232
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if buf2, _ := msg.MarshalBinary(); !bytes.Equal(buf, buf2) {
+			t.Fatalf("marshal output changed:\n%x\n%x", buf, buf2)
+		}
+	}
+
+	// parsing and marshalling again gives the same bytes
+	parsed, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if buf2, _ := parsed.MarshalBinary(); !bytes.Equal(buf, buf2) {
+		t.Errorf("re-marshalled message differs:\n%x\n%x", buf, buf2)
+	}
+}
+
+func TestQuestionHash(t *testing.T) {
+	buf, _ := NewQuery("WWW.Example.com.", IN, A).MarshalBinary()
+	msg, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	q := msg.Question[0]
+	if q.Hash == 0 || q.Hash != q.HashKey() {
+		t.Errorf("hash not set when parsing: %x", q.Hash)
+	}
+	if k := (&Question{Name: "www.example.com", Type: A, Class: IN}).HashKey(); k != q.Hash {
+		t.Errorf("hash depends on case or final dot: %x != %x", k, q.Hash)
+	}
+	for _, other := range []*Question{
+		{Name: "www.example.com.", Type: AAAA, Class: IN},
+		{Name: "www.example.com.", Type: A, Class: CH},
+		{Name: "ww.example.com.", Type: A, Class: IN},
+	} {
+		if other.HashKey() == q.Hash {
+			t.Errorf("%s has the same hash as %s", other, q)
+		}
+	}
+
+	if n := testing.AllocsPerRun(100, func() { q.HashKey() }); n != 0 {
+		t.Errorf("HashKey allocates %v times", n)
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	msg := NewQuery("example.com.", IN, A)
+	msg.Answer = []*Resource{{Name: "example.com.", Type: A, Class: IN, Data: &RDataIP{IP: []byte{192, 0, 2, 1}, Type: A}}}
+	msg.HasEDNS, msg.ReqUDPSize = true, 1232
+	buf, _ := msg.MarshalBinary()
+	if _, err := ParseStrict(buf); err != nil {
+		t.Fatalf("valid message rejected: %s", err)
+	}
+
+	// OPT pseudo-record, as encoded at the end of buf
+	opt := buf[len(buf)-11:]
+
+	withCount := func(b []byte, pos int, n uint16) []byte {
+		b = bytes.Clone(b)
+		b[pos], b[pos+1] = byte(n>>8), byte(n)
+		return b
+	}
+
+	for _, test := range []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"trailing data", append(bytes.Clone(buf), 0, 0), ErrTrailingData},
+		{"count too large", withCount(buf, 10, 2), ErrCountMismatch},
+		{"multiple OPT", withCount(append(bytes.Clone(buf), opt...), 10, 2), ErrMultipleOpt},
+		{"OPT in authority", withCount(withCount(buf, 8, 1), 10, 0), ErrOptSection},
+	} {
+		if _, err := ParseStrict(test.buf); err != test.err {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		}
+		if _, err := Parse(test.buf); err == test.err {
+			t.Errorf("%s: rejected by Parse", test.name)
+		}
+	}
+}
+
+func TestParseKeepRaw(t *testing.T) {
+	msg := NewQuery("example.com.", IN, MX)
+	msg.Answer = []*Resource{{Name: "example.com.", Type: MX, Class: IN, Data: &RDataMX{Pref: 10, Server: "mx.example.com."}}}
+	buf, _ := msg.MarshalBinary()
+
+	parsed, err := ParseWithOptions(buf, &ParseOptions{KeepRaw: true})
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if !bytes.Equal(parsed.RawBytes(), buf) {
+		t.Errorf("unexpected raw message %x", parsed.RawBytes())
+	}
+	rr := parsed.Answer[0]
+	// preference then "mx" and a pointer to example.com
+	if raw := rr.RawData(); !bytes.Equal(raw, buf[len(buf)-len(raw):]) || len(raw) != 7 {
+		t.Errorf("unexpected raw RDATA %x", raw)
+	}
+	if end := rr.Pos.Offset + rr.Pos.Len; end != len(buf) {
+		t.Errorf("record ends at %d, expected %d", end, len(buf))
+	}
+
+	parsed, _ = Parse(buf)
+	if parsed.RawBytes() != nil || parsed.Answer[0].RawData() != nil {
+		t.Errorf("raw data kept without KeepRaw")
+	}
+}
+
+func TestParseOpCode(t *testing.T) {
+	for _, op := range []OpCode{Query, IQuery, Status, Notify, Update, DSO, 3, 15} {
+		res, err := ParseOpCode(op.String())
+		if err != nil || res != op {
+			t.Errorf("ParseOpCode(%q) = %d, %v", op.String(), res, err)
+		}
+	}
+	if op, err := ParseOpCode("notify"); err != nil || op != Notify {
+		t.Errorf("ParseOpCode is case sensitive: %d, %v", op, err)
+	}
+	for _, s := range []string{"", "16", "OpCode(16)", "Refresh"} {
+		if _, err := ParseOpCode(s); err == nil {
+			t.Errorf("ParseOpCode(%q) should fail", s)
+		}
+	}
+}
+
+func TestMDNSClass(t *testing.T) {
+	msg := &Message{Question: []*Question{{Name: "printer.local.", Type: A, Class: IN}}}
+	msg.Question[0].SetUnicastResponse(true)
+	msg.Bits.SetResponse(true)
+	msg.Answer = []*Resource{{Name: "printer.local.", Type: A, Class: IN, TTL: 120, Data: &RDataIP{IP: []byte{192, 168, 1, 2}, Type: A}}}
+	msg.Answer[0].SetCacheFlush(true)
+
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	parsed, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	q, rr := parsed.Question[0], parsed.Answer[0]
+	if !q.UnicastResponse() || q.MDNSClass() != IN || q.Class != 0x8001 {
+		t.Errorf("unexpected question class %d", q.Class)
+	}
+	if !rr.CacheFlush() || rr.MDNSClass() != IN || rr.Data.String() != "192.168.1.2" {
+		t.Errorf("unexpected record %s", rr)
+	}
+	rr.SetCacheFlush(false)
+	if rr.CacheFlush() || rr.Class != IN {
+		t.Errorf("cache-flush flag not cleared: %d", rr.Class)
+	}
+}
+
+func TestCompressionModes(t *testing.T) {
+	msg := NewQuery("a.example.com.", IN, A)
+	msg.Answer = []*Resource{
+		{Name: "example.com.", Type: DNAME, Class: IN, TTL: 60, Data: &RDataLabel{Label: "example.net.", Type: DNAME}},
+		{Name: "a.example.com.", Type: CNAME, Class: IN, TTL: 60, Data: &RDataLabel{Label: "a.example.net.", Type: CNAME}},
+	}
+
+	var sizes []int
+	for _, mode := range []Compression{CompressAll, CompressStandard, CompressNone} {
+		msg.Compression = mode
+		buf, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatalf("mode %d: failed to marshal: %s", mode, err)
+		}
+		parsed, err := Parse(buf)
+		if err != nil {
+			t.Fatalf("mode %d: failed to parse: %s", mode, err)
+		}
+		if parsed.String() != msg.String() {
+			t.Errorf("mode %d: got %s", mode, parsed)
+		}
+		if mode == CompressNone && bytes.IndexByte(buf, 0xc0) != -1 {
+			t.Errorf("mode %d: compression pointer found in %x", mode, buf)
+		}
+		sizes = append(sizes, len(buf))
+	}
+	// the DNAME target is never compressed (RFC 6672 section 2.5), and owner
+	// names are not either without compression
+	if sizes[0] != sizes[1] || sizes[1] >= sizes[2] {
+		t.Errorf("unexpected message sizes %v", sizes)
+	}
+}
+
+func TestUncompressedRData(t *testing.T) {
+	msg := NewQuery("example.com.", IN, ANY)
+	for _, rr := range []struct {
+		typ  Type
+		text string
+	}{
+		{NAPTR, `100 10 "S" "SIP+D2U" "" example.com.`},
+		{RRSIG, "A 13 2 3600 20240801000000 20240718000000 12345 example.com. AA=="},
+		{NSEC, "example.com. A RRSIG NSEC"},
+		{DNAME, "example.com."},
+	} {
+		rd, err := RDataFromString(rr.typ, rr.text)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", rr.typ, err)
+		}
+		msg.Answer = append(msg.Answer, &Resource{Name: "example.com.", Type: rr.typ, Class: IN, TTL: 60, Data: rd})
+	}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	// the question, then each name in RDATA in full even with CompressAll
+	if n := bytes.Count(buf, []byte("\x07example\x03com\x00")); n != 5 {
+		t.Errorf("found %d uncompressed names in %x, expected 5", n, buf)
+	}
+	parsed, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if parsed.String() != msg.String() {
+		t.Errorf("got %s", parsed)
+	}
+}
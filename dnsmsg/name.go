@@ -0,0 +1,88 @@
+package dnsmsg
+
+import "strings"
+
+// Name is a domain name in presentation format. Names ending with a dot are
+// fully qualified, others are relative to the base name of their message.
+// Labels may contain escaped characters (\. or \DDD, RFC 1035 section 5.1).
+type Name string
+
+func (n Name) String() string {
+	return string(n)
+}
+
+// IsFQDN returns true if the name is fully qualified
+func (n Name) IsFQDN() bool {
+	s := string(n)
+	if !strings.HasSuffix(s, ".") {
+		return false
+	}
+	// the final dot must not be escaped
+	i := len(s) - 2
+	for i >= 0 && s[i] == '\\' {
+		i--
+	}
+	return (len(s)-2-i)%2 == 0
+}
+
+// Canonical returns the name in lower case, as used for comparisons and in
+// DNSSEC (RFC 4034 section 6.2)
+func (n Name) Canonical() Name {
+	return Name(ToLowerASCII(string(n)))
+}
+
+// Equal reports whether n and o are the same name, ignoring ASCII case (RFC
+// 4343). A fully qualified name is never equal to a relative name.
+func (n Name) Equal(o Name) bool {
+	return EqualFoldASCII(string(n), string(o))
+}
+
+// SplitLabels returns the labels of the name from left to right, without
+// the empty root label. Escapes are kept as is.
+func (n Name) SplitLabels() []string {
+	var res []string
+	s := string(n)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip escaped character
+		case '.':
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		res = append(res, s[start:])
+	}
+	if len(res) == 1 && res[0] == "" {
+		// "."
+		return nil
+	}
+	return res
+}
+
+// CountLabels returns the number of labels of the name, not counting the
+// root label
+func (n Name) CountLabels() int {
+	return len(n.SplitLabels())
+}
+
+// IsSubDomainOf returns true if n is parent or a name below it. Both names
+// must be either fully qualified or relative to the same base.
+func (n Name) IsSubDomainOf(parent Name) bool {
+	if n.IsFQDN() != parent.IsFQDN() {
+		return false
+	}
+	a, b := n.SplitLabels(), parent.SplitLabels()
+	if len(a) < len(b) {
+		return false
+	}
+	a = a[len(a)-len(b):]
+	for i := range b {
+		if !EqualFoldASCII(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package dnsmsg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name   Name
+		fqdn   bool
+		labels string
+	}{
+		{".", true, ""},
+		{"example.com.", true, "example|com"},
+		{"www.Example.COM", false, "www|Example|COM"},
+		{`a\.b.example.com.`, true, `a\.b|example|com`},
+		{`a\\.example.`, true, `a\\|example`},
+		{`weird\.`, false, `weird\.`},
+		{"", false, ""},
+	}
+	for _, test := range tests {
+		if test.name.IsFQDN() != test.fqdn {
+			t.Errorf("%q: IsFQDN = %v", test.name, !test.fqdn)
+		}
+		if l := strings.Join(test.name.SplitLabels(), "|"); l != test.labels {
+			t.Errorf("%q: unexpected labels %q", test.name, l)
+		}
+	}
+
+	if !Name("WWW.example.com.").Equal("www.EXAMPLE.com.") || Name("www.example.com").Equal("www.example.com.") {
+		t.Errorf("unexpected Equal result")
+	}
+	if Name("WWW.Example.COM.").Canonical() != "www.example.com." {
+		t.Errorf("unexpected canonical form")
+	}
+	if Name("a.b.example.com.").CountLabels() != 4 {
+		t.Errorf("unexpected label count")
+	}
+
+	sub := []struct {
+		name, parent Name
+		ok           bool
+	}{
+		{"www.example.com.", "example.com.", true},
+		{"www.EXAMPLE.com.", "Example.Com.", true},
+		{"example.com.", "example.com.", true},
+		{"example.com.", ".", true},
+		{"badexample.com.", "example.com.", false},
+		{`a\.b.example.com.`, "example.com.", true},
+		{`a\.example.com.`, "example.com.", false},
+		{`www.a\.example.com.`, "example.com.", false},
+		{"com.", "example.com.", false},
+		{"www.example.com", "example.com.", false},
+	}
+	for _, test := range sub {
+		if test.name.IsSubDomainOf(test.parent) != test.ok {
+			t.Errorf("%q.IsSubDomainOf(%q) = %v", test.name, test.parent, !test.ok)
+		}
+	}
+}
+
+func TestNameCompare(t *testing.T) {
+	// RFC 4034 section 6.1
+	names := []Name{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", `\001.z.example.`, "*.z.example.", `\200.z.example.`}
+	for i := range names {
+		for j := range names {
+			expect := 0
+			if i < j {
+				expect = -1
+			} else if i > j {
+				expect = 1
+			}
+			if c := names[i].Compare(names[j]); c != expect {
+				t.Errorf("%s vs %s: got %d, expected %d", names[i], names[j], c, expect)
+			}
+		}
+	}
+}
+
+func TestCanonicalWire(t *testing.T) {
+	rr := &Resource{Name: "WWW.Example.com.", Type: MX, Class: IN, TTL: 3600, Data: &RDataMX{Pref: 10, Server: "Mail.Example.com."}}
+	buf, err := rr.CanonicalWire()
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	expect := "\x03www\x07example\x03com\x00\x00\x0f\x00\x01\x00\x00\x0e\x10\x00\x14\x00\x0a\x04mail\x07example\x03com\x00"
+	if string(buf) != expect {
+		t.Errorf("unexpected canonical form %q", buf)
+	}
+
+	// NSEC next names keep their case (RFC 6840 section 5.1)
+	rr = &Resource{Name: "example.com.", Type: NSEC, Class: IN, Data: &RDataNSEC{NextDomain: "WWW.example.com.", Types: []Type{A}}}
+	if buf, _ := rr.CanonicalRData(); !strings.HasPrefix(string(buf), "\x03WWW") {
+		t.Errorf("unexpected NSEC canonical form %q", buf)
+	}
+
+	if buf, _ := Name(`A\.B.Example.`).CanonicalWire(); string(buf) != "\x03a.b\x07example\x00" {
+		t.Errorf("unexpected name canonical form %q", buf)
+	}
+}
+
+func TestCanonicalRData(t *testing.T) {
+	// names are in lower case for the types of RFC 4034 section 6.2, other
+	// fields keep their case
+	var tests = []struct {
+		typ    Type
+		rdata  string
+		expect string
+	}{
+		{NS, "NS1.Example.", "\x03ns1\x07example\x00"},
+		{CNAME, "Target.Example.", "\x06target\x07example\x00"},
+		{CNAME, `\065\066.Example.`, "\x02ab\x07example\x00"},
+		{SOA, "NS.Example. Admin.Example. 1 2 3 4 5", "\x02ns\x07example\x00\x05admin\x07example\x00\x00\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00\x03\x00\x00\x00\x04\x00\x00\x00\x05"},
+		{PTR, "Host.Example.", "\x04host\x07example\x00"},
+		{HINFO, `"PC" "Linux"`, "\x02PC\x05Linux"},
+		{MINFO, "RMail.Example. EMail.Example.", "\x05rmail\x07example\x00\x05email\x07example\x00"},
+		{MX, "10 Mail.Example.", "\x00\x0a\x04mail\x07example\x00"},
+		{RP, "Admin.Example. TXT.Example.", "\x05admin\x07example\x00\x03txt\x07example\x00"},
+		{AFSDB, "1 AFS.Example.", "\x00\x01\x03afs\x07example\x00"},
+		{SRV, "1 2 3 SRV.Example.", "\x00\x01\x00\x02\x00\x03\x03srv\x07example\x00"},
+		{NAPTR, `100 10 "S" "SIP+D2U" "" _SIP._UDP.Example.`, "\x00\x64\x00\x0a\x01S\x07SIP+D2U\x00\x04_sip\x04_udp\x07example\x00"},
+		{KX, "10 KX.Example.", "\x00\x0a\x02kx\x07example\x00"},
+		{DNAME, "Target.Example.", "\x06target\x07example\x00"},
+		{RRSIG, "A 13 2 3600 20200101000000 20190101000000 12345 Example. AAAA", "\x00\x01\x0d\x02\x00\x00\x0e\x10\x5e\x0b\xe1\x00\x5c\x2a\xad\x80\x30\x39\x07example\x00\x00\x00\x00"},
+		{NSEC, "WWW.Example. A", "\x03WWW\x07Example\x00\x00\x01\x40"},
+	}
+	for _, test := range tests {
+		data, err := RDataFromString(test.typ, test.rdata)
+		if err != nil {
+			t.Errorf("%s %s: failed to parse: %s", test.typ, test.rdata, err)
+			continue
+		}
+		buf, err := (&Resource{Name: "example.", Type: test.typ, Class: IN, Data: data}).CanonicalRData()
+		if err != nil {
+			t.Errorf("%s %s: failed to encode: %s", test.typ, test.rdata, err)
+			continue
+		}
+		if string(buf) != test.expect {
+			t.Errorf("%s %s: got %q, expected %q", test.typ, test.rdata, buf, test.expect)
+		}
+	}
+}
@@ -1,12 +1,43 @@
 package dnsmsg
 
+import (
+	"strconv"
+	"strings"
+)
+
 //go:generate stringer -type=OpCode
 
+// OpCode is the kind of query of a message, set by the originator and copied
+// into the response
 type OpCode byte
 
 const (
 	// RFC 1035
-	Query  OpCode = 0
-	IQuery OpCode = 1
-	Status OpCode = 2
+	Query  OpCode = 0 // standard query
+	IQuery OpCode = 1 // inverse query, obsoleted by RFC 3425
+	Status OpCode = 2 // server status request
+
+	// RFC 1996
+	Notify OpCode = 4 // zone change notification
+
+	// RFC 2136
+	Update OpCode = 5 // dynamic update
+
+	// RFC 8490
+	DSO OpCode = 6 // DNS stateful operations
 )
+
+// ParseOpCode returns the OpCode matching the given name (case insensitive),
+// as returned by OpCode.String, or a number
+func ParseOpCode(s string) (OpCode, error) {
+	for op := Query; op <= DSO; op++ {
+		if n := op.String(); !strings.HasPrefix(n, "OpCode(") && strings.EqualFold(n, s) {
+			return op, nil
+		}
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "OpCode("), ")")
+	if n, err := strconv.ParseUint(s, 10, 4); err == nil {
+		return OpCode(n), nil
+	}
+	return 0, ErrNotSupport
+}
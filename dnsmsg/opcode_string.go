@@ -11,15 +11,29 @@ func _() {
 	_ = x[Query-0]
 	_ = x[IQuery-1]
 	_ = x[Status-2]
+	_ = x[Notify-4]
+	_ = x[Update-5]
+	_ = x[DSO-6]
 }
 
-const _OpCode_name = "QueryIQueryStatus"
+const (
+	_OpCode_name_0 = "QueryIQueryStatus"
+	_OpCode_name_1 = "NotifyUpdateDSO"
+)
 
-var _OpCode_index = [...]uint8{0, 5, 11, 17}
+var (
+	_OpCode_index_0 = [...]uint8{0, 5, 11, 17}
+	_OpCode_index_1 = [...]uint8{0, 6, 12, 15}
+)
 
 func (i OpCode) String() string {
-	if i >= OpCode(len(_OpCode_index)-1) {
+	switch {
+	case i <= 2:
+		return _OpCode_name_0[_OpCode_index_0[i]:_OpCode_index_0[i+1]]
+	case 4 <= i && i <= 6:
+		i -= 4
+		return _OpCode_name_1[_OpCode_index_1[i]:_OpCode_index_1[i+1]]
+	default:
 		return "OpCode(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _OpCode_name[_OpCode_index[i]:_OpCode_index[i+1]]
 }
@@ -2,8 +2,12 @@ package dnsmsg
 
 import (
 	"encoding/binary"
+	"io"
 )
 
+// Parse decodes a message in wire format. Questions and records are kept in
+// wire order within each section, and records know their position in d (see
+// Resource.Pos).
 func Parse(d []byte) (*Message, error) {
 	msg := &Message{}
 	err := msg.UnmarshalBinary(d)
@@ -13,40 +17,128 @@ func Parse(d []byte) (*Message, error) {
 	return msg, nil
 }
 
-func (msg *Message) UnmarshalBinary(d []byte) error {
-	c := &context{rawMsg: d}
+// ParseOptions limits the resources used to parse a message, so abusive
+// messages can be rejected before anything is allocated for them. Zero
+// values mean no limit.
+type ParseOptions struct {
+	MaxSize      int // maximum message size in bytes
+	MaxQuestions int // maximum number of questions
+	MaxRecords   int // maximum number of records in each section
+	MaxLabels    int // maximum number of labels read, pointers followed included
+
+	// Strict rejects messages that are otherwise tolerated: data after the
+	// last record, section counts larger than the actual contents, OPT
+	// records outside of the additional section and multiple OPT records
+	Strict bool
+
+	// KeepRaw keeps references to the wire form of the message and the
+	// RDATA of its records, see Message.RawBytes and Resource.RawData. The
+	// parsed buffer must then not be modified while the message is in use.
+	KeepRaw bool
+}
 
-	// read stuff
-	err := binary.Read(c, binary.BigEndian, &msg.ID)
+// ParseStrict is like Parse, with the checks of ParseOptions.Strict. Each
+// violation is reported with its own error: ErrTrailingData,
+// ErrCountMismatch, ErrOptSection or ErrMultipleOpt.
+func ParseStrict(d []byte) (*Message, error) {
+	return ParseWithOptions(d, &ParseOptions{Strict: true})
+}
+
+// ParseWithOptions is like Parse, but fails with ErrLimit if d exceeds the
+// limits of opts. As any other parse error, this should be answered with
+// FORMERR or by dropping the message.
+func ParseWithOptions(d []byte, opts *ParseOptions) (*Message, error) {
+	msg := &Message{}
+	err := msg.unmarshal(&context{rawMsg: d, opts: opts})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = binary.Read(c, binary.BigEndian, &msg.Bits)
-	if err != nil {
-		return err
+	return msg, nil
+}
+
+func (msg *Message) UnmarshalBinary(d []byte) error {
+	return msg.unmarshal(&context{rawMsg: d})
+}
+
+func (c *context) keepRaw() bool {
+	return c.opts != nil && c.opts.KeepRaw
+}
+
+func (c *context) strict() bool {
+	return c.opts != nil && c.opts.Strict
+}
+
+// checkMore returns an error in strict mode if the message ended before an
+// entry announced by the section counts
+func (c *context) checkMore() error {
+	if c.strict() && c.rpos >= len(c.rawMsg) {
+		return ErrCountMismatch
 	}
+	return nil
+}
 
-	// count of the various types
-	var QD, AN, NS, AR uint16
+// checkCounts checks the section counts of a message against c.opts
+func (c *context) checkCounts(qd, an, ns, ar uint16) error {
+	o := c.opts
+	if o == nil {
+		return nil
+	}
+	if o.MaxQuestions > 0 && int(qd) > o.MaxQuestions {
+		return ErrLimit
+	}
+	if o.MaxRecords > 0 && int(max(an, ns, ar)) > o.MaxRecords {
+		return ErrLimit
+	}
+	return nil
+}
 
-	err = binary.Read(c, binary.BigEndian, &QD)
-	if err != nil {
-		return err
+func (msg *Message) unmarshal(c *context) error {
+	d := c.rawMsg
+	if c.opts != nil && c.opts.MaxSize > 0 && len(d) > c.opts.MaxSize {
+		return ErrLimit
 	}
-	err = binary.Read(c, binary.BigEndian, &AN)
-	if err != nil {
-		return err
+	if len(d) < 12 {
+		return io.ErrUnexpectedEOF
 	}
-	err = binary.Read(c, binary.BigEndian, &NS)
-	if err != nil {
+	if c.keepRaw() {
+		msg.raw = d
+	}
+	msg.ID = binary.BigEndian.Uint16(d)
+	msg.Bits = HeaderBits(binary.BigEndian.Uint16(d[2:]))
+
+	// count of the various types
+	QD := binary.BigEndian.Uint16(d[4:])
+	AN := binary.BigEndian.Uint16(d[6:])
+	NS := binary.BigEndian.Uint16(d[8:])
+	AR := binary.BigEndian.Uint16(d[10:])
+	c.rpos = 12
+
+	if err := c.checkCounts(QD, AN, NS, AR); err != nil {
 		return err
 	}
-	err = binary.Read(c, binary.BigEndian, &AR)
-	if err != nil {
+	// questions take at least 5 bytes and records 11, do not go further
+	// with counts that cannot match the message length
+	if 5*int(QD)+11*(int(AN)+int(NS)+int(AR)) > len(d)-12 {
+		if c.strict() {
+			return ErrCountMismatch
+		}
+		return io.ErrUnexpectedEOF
+	}
+
+	if msg.Bits.OpCode() == DSO {
+		// RFC 8490 section 5.4
+		if QD != 0 || AN != 0 || NS != 0 || AR != 0 {
+			return ErrDSO
+		}
+		var err error
+		msg.DSO, err = c.parseDSO()
 		return err
 	}
 
 	for i := 0; i < int(QD); i++ {
+		if err := c.checkMore(); err != nil {
+			return err
+		}
 		q, err := c.parseQuestion()
 		if err != nil {
 			return err
@@ -54,26 +146,47 @@ func (msg *Message) UnmarshalBinary(d []byte) error {
 		msg.Question = append(msg.Question, q)
 	}
 	for i := 0; i < int(AN); i++ {
+		if err := c.checkMore(); err != nil {
+			return err
+		}
 		r, err := c.parseResource()
 		if err != nil {
 			return err
 		}
+		r.Pos.Index = i
+		if r.Type == OPT && c.strict() {
+			return ErrOptSection
+		}
 		msg.Answer = append(msg.Answer, r)
 	}
 	for i := 0; i < int(NS); i++ {
+		if err := c.checkMore(); err != nil {
+			return err
+		}
 		r, err := c.parseResource()
 		if err != nil {
 			return err
 		}
+		r.Pos.Index = i
+		if r.Type == OPT && c.strict() {
+			return ErrOptSection
+		}
 		msg.Authority = append(msg.Authority, r)
 	}
 	for i := 0; i < int(AR); i++ {
+		if err := c.checkMore(); err != nil {
+			return err
+		}
 		r, err := c.parseResource()
 		if err != nil {
 			return err
 		}
+		r.Pos.Index = i
 		if r.Type == OPT {
 			// RFC 6891 - Special case
+			if msg.HasEDNS && c.strict() {
+				return ErrMultipleOpt
+			}
 			msg.HasEDNS = true
 			msg.Opts = r.Data.(*RDataOPT).Opts
 			msg.ReqUDPSize = uint16(r.Class)
@@ -83,5 +196,15 @@ func (msg *Message) UnmarshalBinary(d []byte) error {
 		msg.Additional = append(msg.Additional, r)
 	}
 
+	if c.strict() && c.rpos != len(d) {
+		return ErrTrailingData
+	}
 	return nil
 }
+
+// RawBytes returns the message as it was parsed, if it was parsed with
+// ParseOptions.KeepRaw, and nil otherwise. Records can be located in it with
+// Resource.Pos.
+func (msg *Message) RawBytes() []byte {
+	return msg.raw
+}
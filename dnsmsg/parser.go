@@ -0,0 +1,99 @@
+package dnsmsg
+
+// maxInterned is the number of names a Parser remembers before starting over
+const maxInterned = 4096
+
+// Parser decodes messages like Parse, but reuses its memory from one message
+// to the next: questions, records, EDNS options and the message itself are
+// kept in pools, and names already seen are not allocated again. This makes
+// it suitable for servers parsing one query after the other.
+//
+// The message returned by Parse, and everything it references, is only valid
+// until the next call to Parse. A Parser must not be used concurrently.
+type Parser struct {
+	// Borrow makes EDNS option data reference the parsed buffer instead of
+	// being copied, in which case the buffer must not be modified while the
+	// message is in use. Binary fields of record data, such as the
+	// addresses of A and AAAA records, the keys, digests and signatures of
+	// DNSKEY, DS and RRSIG records, or the data of NULL, TLSA and SSHFP
+	// records, always reference the buffer, with or without Borrow.
+	Borrow bool
+
+	// Options limits the messages accepted by Parse, see ParseWithOptions
+	Options *ParseOptions
+
+	ctx   context
+	msg   Message
+	qs    []Question
+	rrs   []Resource
+	nq    int
+	nrr   int
+	opt   RDataOPT
+	opts  []DnsOpt
+	names map[string]string
+}
+
+// Parse decodes message d, see Parse
+func (p *Parser) Parse(d []byte) (*Message, error) {
+	p.msg = Message{
+		Question:   p.msg.Question[:0],
+		Answer:     p.msg.Answer[:0],
+		Authority:  p.msg.Authority[:0],
+		Additional: p.msg.Additional[:0],
+	}
+	p.nq, p.nrr = 0, 0
+
+	p.ctx = context{rawMsg: d, parser: p, opts: p.Options}
+	if err := p.msg.unmarshal(&p.ctx); err != nil {
+		return nil, err
+	}
+	return &p.msg, nil
+}
+
+// intern returns b as a string, reusing a previous allocation for the same
+// name if any
+func (p *Parser) intern(b []byte) string {
+	if s, ok := p.names[string(b)]; ok {
+		return s
+	}
+	if p.names == nil || len(p.names) >= maxInterned {
+		p.names = make(map[string]string)
+	}
+	s := string(b)
+	p.names[s] = s
+	return s
+}
+
+// newQuestion returns a zeroed question, from the pool of the parser if any
+func (c *context) newQuestion() *Question {
+	p := c.parser
+	if p == nil {
+		return &Question{}
+	}
+	if p.nq == len(p.qs) {
+		// grow the pool; questions handed out before stay valid as they
+		// still reference the previous array
+		p.qs = make([]Question, 2*len(p.qs)+1)
+		p.nq = 0
+	}
+	q := &p.qs[p.nq]
+	*q = Question{}
+	p.nq += 1
+	return q
+}
+
+// newResource returns a zeroed record, from the pool of the parser if any
+func (c *context) newResource() *Resource {
+	p := c.parser
+	if p == nil {
+		return &Resource{}
+	}
+	if p.nrr == len(p.rrs) {
+		p.rrs = make([]Resource, 2*len(p.rrs)+4)
+		p.nrr = 0
+	}
+	r := &p.rrs[p.nrr]
+	*r = Resource{}
+	p.nrr += 1
+	return r
+}
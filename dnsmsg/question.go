@@ -6,9 +6,11 @@ import (
 )
 
 type Question struct {
-	Name  string
+	Name  Name
 	Type  Type
 	Class Class
+
+	Hash uint64 // HashKey of the question, set when parsed
 }
 
 func NewQuery(name string, class Class, typ Type) *Message {
@@ -16,7 +18,7 @@ func NewQuery(name string, class Class, typ Type) *Message {
 	msg.Bits |= hRecD // recursion desired
 	msg.Question = []*Question{
 		{
-			Name:  name,
+			Name:  Name(name),
 			Class: class,
 			Type:  typ,
 		},
@@ -30,22 +32,45 @@ func (c *context) parseQuestion() (*Question, error) {
 	if err != nil {
 		return nil, err
 	}
-	q := &Question{Name: lbl}
-
-	err = binary.Read(c, binary.BigEndian, &q.Type)
+	typ, err := c.readUint16()
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Read(c, binary.BigEndian, &q.Class)
+	class, err := c.readUint16()
 	if err != nil {
 		return nil, err
 	}
 
+	q := c.newQuestion()
+	q.Name, q.Type, q.Class = Name(lbl), Type(typ), Class(class)
+	q.Hash = q.HashKey()
 	return q, nil
 }
 
+// HashKey returns a 64 bits FNV-1a hash of the name of the question, ignoring
+// ASCII case and the final dot, and of its type and class. Questions asking
+// for the same thing have the same key, which makes it usable to index
+// caches or rate limiting tables. It does not allocate.
+func (q *Question) HashKey() uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+
+	name := strings.TrimSuffix(string(q.Name), ".")
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		h = (h ^ uint64(b)) * prime
+	}
+	for _, b := range [4]byte{byte(q.Type >> 8), byte(q.Type), byte(q.Class >> 8), byte(q.Class)} {
+		h = (h ^ uint64(b)) * prime
+	}
+	return h
+}
+
 func (q *Question) encode(c *context) error {
-	err := c.appendLabel(q.Name)
+	err := c.appendLabel(string(q.Name))
 	if err != nil {
 		return err
 	}
@@ -58,5 +83,23 @@ func (q *Question) encode(c *context) error {
 }
 
 func (q *Question) String() string {
-	return strings.Join([]string{q.Name, q.Class.String(), q.Type.String()}, " ")
+	return strings.Join([]string{string(q.Name), q.Class.String(), q.Type.String()}, " ")
+}
+
+// MatchQuestionCase sets the owner name of records matching the name of the
+// question to the exact name of the question, so that responses echo the
+// case of the query, which some resolvers randomize for extra entropy
+// (draft-vixie-dnsext-dns0x20)
+func (m *Message) MatchQuestionCase() {
+	if len(m.Question) != 1 {
+		return
+	}
+	qn := m.fqdn(m.Question[0].Name)
+	for _, rrs := range [][]*Resource{m.Answer, m.Authority, m.Additional} {
+		for _, rr := range rrs {
+			if m.fqdn(rr.Name).Equal(qn) {
+				rr.Name = qn
+			}
+		}
+	}
 }
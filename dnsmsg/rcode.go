@@ -1,6 +1,10 @@
 package dnsmsg
 
-type RCode byte
+import "strconv"
+
+// RCode is a response code. Values above 15 are extended RCODEs (RFC 6891)
+// which can only be used in messages with EDNS, or in TSIG and TKEY records.
+type RCode uint16
 
 const (
 	// RFC 1035
@@ -10,8 +14,56 @@ const (
 	ErrName     RCode = 3
 	ErrNotImpl  RCode = 4
 	ErrRefused  RCode = 5
+
+	// RFC 2136
+	ErrYXDomain RCode = 6  // name exists when it should not
+	ErrYXRRSet  RCode = 7  // RRset exists when it should not
+	ErrNXRRSet  RCode = 8  // RRset that should exist does not
+	ErrNotAuth  RCode = 9  // server not authoritative for the zone (RFC 8945: not authorized)
+	ErrNotZone  RCode = 10 // name not contained in zone
+
+	ErrDSOTypeNI RCode = 11 // DSO-TYPE not implemented (RFC 8490)
+
+	// Extended RCODEs, only available with EDNS
+	ErrBadVers   RCode = 16 // RFC 6891
+	ErrBadCookie RCode = 23 // RFC 7873
+
+	// TSIG and TKEY errors (RFC 8945, RFC 2930), in the error field of
+	// these records
+	ErrBadSig   RCode = 16 // TSIG signature failure, same value as ErrBadVers
+	ErrBadKey   RCode = 17 // key not recognized
+	ErrBadTime  RCode = 18 // signature out of time window
+	ErrBadMode  RCode = 19 // bad TKEY mode
+	ErrBadName  RCode = 20 // duplicate key name
+	ErrBadAlg   RCode = 21 // algorithm not supported
+	ErrBadTrunc RCode = 22 // bad truncation (RFC 4635)
 )
 
+// StringToRCode maps the mnemonics of response codes to their value
+var StringToRCode = map[string]RCode{
+	"NOERROR":   NoError,
+	"FORMERR":   ErrFormat,
+	"SERVFAIL":  ErrServFail,
+	"NXDOMAIN":  ErrName,
+	"NOTIMP":    ErrNotImpl,
+	"REFUSED":   ErrRefused,
+	"YXDOMAIN":  ErrYXDomain,
+	"YXRRSET":   ErrYXRRSet,
+	"NXRRSET":   ErrNXRRSet,
+	"NOTAUTH":   ErrNotAuth,
+	"NOTZONE":   ErrNotZone,
+	"DSOTYPENI": ErrDSOTypeNI,
+	"BADVERS":   ErrBadVers,
+	"BADSIG":    ErrBadSig,
+	"BADKEY":    ErrBadKey,
+	"BADTIME":   ErrBadTime,
+	"BADMODE":   ErrBadMode,
+	"BADNAME":   ErrBadName,
+	"BADALG":    ErrBadAlg,
+	"BADTRUNC":  ErrBadTrunc,
+	"BADCOOKIE": ErrBadCookie,
+}
+
 func (rc RCode) Error() string {
 	switch rc {
 	// RFC 1035
@@ -27,13 +79,42 @@ func (rc RCode) Error() string {
 		return "query is not supported"
 	case ErrRefused:
 		return "operation refused"
+	case ErrYXDomain:
+		return "name exists when it should not"
+	case ErrYXRRSet:
+		return "RRset exists when it should not"
+	case ErrNXRRSet:
+		return "RRset that should exist does not"
+	case ErrNotAuth:
+		return "not authoritative for zone"
+	case ErrNotZone:
+		return "name not contained in zone"
+	case ErrDSOTypeNI:
+		return "DSO-TYPE not implemented"
+	case ErrBadVers:
+		return "unsupported EDNS version"
+	case ErrBadKey:
+		return "key not recognized"
+	case ErrBadTime:
+		return "signature out of time window"
+	case ErrBadMode:
+		return "bad TKEY mode"
+	case ErrBadName:
+		return "duplicate key name"
+	case ErrBadAlg:
+		return "algorithm not supported"
+	case ErrBadTrunc:
+		return "bad truncation"
+	case ErrBadCookie:
+		return "bad or missing server cookie"
 	default:
 		return "unknown error"
 	}
 }
 
+// String returns the mnemonic of rc, or RCODEnnn for unknown values. BADVERS
+// is returned for 16, which is also BADSIG in TSIG records.
 func (rc RCode) String() string {
-	// TODO check these
 	switch rc {
 	case NoError:
 		return "NOERROR"
@@ -47,7 +128,35 @@ func (rc RCode) String() string {
 		return "NOTIMP"
 	case ErrRefused:
 		return "REFUSED"
+	case ErrYXDomain:
+		return "YXDOMAIN"
+	case ErrYXRRSet:
+		return "YXRRSET"
+	case ErrNXRRSet:
+		return "NXRRSET"
+	case ErrNotAuth:
+		return "NOTAUTH"
+	case ErrNotZone:
+		return "NOTZONE"
+	case ErrDSOTypeNI:
+		return "DSOTYPENI"
+	case ErrBadVers:
+		return "BADVERS"
+	case ErrBadKey:
+		return "BADKEY"
+	case ErrBadTime:
+		return "BADTIME"
+	case ErrBadMode:
+		return "BADMODE"
+	case ErrBadName:
+		return "BADNAME"
+	case ErrBadAlg:
+		return "BADALG"
+	case ErrBadTrunc:
+		return "BADTRUNC"
+	case ErrBadCookie:
+		return "BADCOOKIE"
 	default:
-		return "unknown error"
+		return "RCODE" + strconv.FormatUint(uint64(rc), 10)
 	}
 }
@@ -50,6 +50,10 @@ func (lbl *RDataLabel) String() string {
 }
 
 func (lbl *RDataLabel) encode(c *context) error {
+	if lbl.Type == DNAME {
+		// RFC 6672 section 2.5
+		return c.appendUncompressedLabel(lbl.Label)
+	}
 	return c.appendLabel(lbl.Label)
 }
 
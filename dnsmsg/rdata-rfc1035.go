@@ -3,20 +3,69 @@ package dnsmsg
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 )
 
+// RDataTXT holds the RDATA of a TXT record as found on the wire: one or more
+// character strings, each preceded by its length (RFC 1035 section 3.3.14)
 type RDataTXT string
 
+// NewTXT returns the TXT RDATA holding strs, strings longer than 255 bytes
+// being split
+func NewTXT(strs ...string) RDataTXT {
+	var buf []byte
+	for _, s := range strs {
+		for {
+			n := min(len(s), 255)
+			buf = append(buf, byte(n))
+			buf = append(buf, s[:n]...)
+			s = s[n:]
+			if s == "" {
+				break
+			}
+		}
+	}
+	return RDataTXT(buf)
+}
+
+// Strings returns the character strings of txt
+func (txt RDataTXT) Strings() []string {
+	var res []string
+	for s := string(txt); s != ""; {
+		n := min(int(s[0])+1, len(s))
+		res = append(res, s[1:n])
+		s = s[n:]
+	}
+	return res
+}
+
 func (txt RDataTXT) GetType() Type {
 	return TXT
 }
 
 func (txt RDataTXT) String() string {
-	return strconv.QuoteToASCII(string(txt))
+	strs := txt.Strings()
+	for i, s := range strs {
+		strs[i] = quoteString(s)
+	}
+	return strings.Join(strs, " ")
+}
+
+// valid returns true if txt is made of whole character strings
+func (txt RDataTXT) valid() bool {
+	s := string(txt)
+	for s != "" && int(s[0]) < len(s) {
+		s = s[int(s[0])+1:]
+	}
+	return s == ""
 }
 
 func (txt RDataTXT) encode(c *context) error {
+	if !txt.valid() {
+		return ErrInvalidLen
+	}
 	_, err := c.Write([]byte(txt))
 	return err
 }
@@ -123,3 +172,190 @@ func (soa *RDataSOA) encode(c *context) error {
 
 	return nil
 }
+
+// RDataMINFO gives the mailbox responsible for a mailing list or mailbox,
+// and the mailbox receiving errors about it
+type RDataMINFO struct {
+	RMailbox string
+	EMailbox string
+}
+
+func (mi *RDataMINFO) GetType() Type {
+	return MINFO
+}
+
+func (mi *RDataMINFO) String() string {
+	return mi.RMailbox + " " + mi.EMailbox
+}
+
+func (mi *RDataMINFO) decode(c *context, d []byte) error {
+	var n int
+	var err error
+	if mi.RMailbox, n, err = c.readLabel(d); err != nil {
+		return err
+	}
+	mi.EMailbox, _, err = c.readLabel(d[n:])
+	return err
+}
+
+func (mi *RDataMINFO) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return ErrInvalidLen
+	}
+	mi.RMailbox, mi.EMailbox = f[0], f[1]
+	return nil
+}
+
+func (mi *RDataMINFO) encode(c *context) error {
+	if err := c.appendLabel(mi.RMailbox); err != nil {
+		return err
+	}
+	return c.appendLabel(mi.EMailbox)
+}
+
+// RDataHINFO describes the CPU and operating system of a host
+type RDataHINFO struct {
+	CPU string
+	OS  string
+}
+
+func (hi *RDataHINFO) GetType() Type {
+	return HINFO
+}
+
+func (hi *RDataHINFO) String() string {
+	return quoteString(hi.CPU) + " " + quoteString(hi.OS)
+}
+
+func (hi *RDataHINFO) decode(c *context, d []byte) error {
+	var err error
+	if hi.CPU, d, err = readCharString(d); err != nil {
+		return err
+	}
+	hi.OS, _, err = readCharString(d)
+	return err
+}
+
+func (hi *RDataHINFO) fromString(s string) error {
+	f, err := splitFields(s)
+	if err != nil {
+		return err
+	}
+	if len(f) != 2 {
+		return ErrInvalidLen
+	}
+	hi.CPU, hi.OS = f[0], f[1]
+	return nil
+}
+
+func (hi *RDataHINFO) encode(c *context) error {
+	buf, err := appendCharString(nil, hi.CPU)
+	if err != nil {
+		return err
+	}
+	if buf, err = appendCharString(buf, hi.OS); err != nil {
+		return err
+	}
+	_, err = c.Write(buf)
+	return err
+}
+
+// RDataWKS lists the well known services, as ports, offered by a host over
+// an IPv4 protocol
+type RDataWKS struct {
+	Address  net.IP
+	Protocol uint8 // IP protocol number, such as 6 for TCP
+	Ports    []uint16
+}
+
+func (wks *RDataWKS) GetType() Type {
+	return WKS
+}
+
+func (wks *RDataWKS) String() string {
+	s := []string{wks.Address.String(), strconv.FormatUint(uint64(wks.Protocol), 10)}
+	for _, p := range wks.Ports {
+		s = append(s, strconv.FormatUint(uint64(p), 10))
+	}
+	return strings.Join(s, " ")
+}
+
+func (wks *RDataWKS) decode(c *context, d []byte) error {
+	if len(d) < 5 {
+		return ErrInvalidLen
+	}
+	wks.Address = net.IP(d[:4])
+	wks.Protocol = d[4]
+	wks.Ports = nil
+	for i, b := range d[5:] {
+		for j := 0; j < 8; j++ {
+			if b&(0x80>>j) != 0 {
+				wks.Ports = append(wks.Ports, uint16(i*8+j))
+			}
+		}
+	}
+	return nil
+}
+
+// fromString accepts protocols and services by number, or by name for TCP
+// and UDP
+func (wks *RDataWKS) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return ErrInvalidLen
+	}
+	if wks.Address = net.ParseIP(f[0]).To4(); wks.Address == nil {
+		return fmt.Errorf("invalid address %q", f[0])
+	}
+	proto := strings.ToLower(f[1])
+	switch proto {
+	case "tcp":
+		wks.Protocol = 6
+	case "udp":
+		wks.Protocol = 17
+	default:
+		var err error
+		if wks.Protocol, err = parseUint8(f[1]); err != nil {
+			return err
+		}
+	}
+	network := ""
+	switch wks.Protocol {
+	case 6:
+		network = "tcp"
+	case 17:
+		network = "udp"
+	}
+	wks.Ports = nil
+	for _, v := range f[2:] {
+		p, err := parseUint16(v)
+		if err != nil && network != "" {
+			var port int
+			port, err = net.LookupPort(network, v)
+			p = uint16(port)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid service %q", v)
+		}
+		wks.Ports = append(wks.Ports, p)
+	}
+	return nil
+}
+
+func (wks *RDataWKS) encode(c *context) error {
+	ip := wks.Address.To4()
+	if ip == nil {
+		return ErrInvalidLen
+	}
+	buf := append(append([]byte{}, ip...), wks.Protocol)
+	var bitmap []byte
+	for _, p := range wks.Ports {
+		for int(p/8) >= len(bitmap) {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[p/8] |= 0x80 >> (p % 8)
+	}
+	_, err := c.Write(append(buf, bitmap...))
+	return err
+}
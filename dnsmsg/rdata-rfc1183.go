@@ -0,0 +1,94 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Responsible Person and AFS Data Base (RFC 1183)
+
+// RDataRP gives the mailbox of the person responsible for the owner name,
+// and a name with TXT records about them, "." standing for none
+type RDataRP struct {
+	Mbox string
+	Txt  string
+}
+
+func (rp *RDataRP) GetType() Type {
+	return RP
+}
+
+func (rp *RDataRP) String() string {
+	return rp.Mbox + " " + rp.Txt
+}
+
+func (rp *RDataRP) decode(c *context, d []byte) error {
+	var n int
+	var err error
+	if rp.Mbox, n, err = c.readLabel(d); err != nil {
+		return err
+	}
+	rp.Txt, _, err = c.readLabel(d[n:])
+	return err
+}
+
+func (rp *RDataRP) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return ErrInvalidLen
+	}
+	rp.Mbox, rp.Txt = f[0], f[1]
+	return nil
+}
+
+func (rp *RDataRP) encode(c *context) error {
+	// names in types defined after RFC 1035 are not compressed (RFC 3597
+	// section 4)
+	if err := c.appendUncompressedLabel(rp.Mbox); err != nil {
+		return err
+	}
+	return c.appendUncompressedLabel(rp.Txt)
+}
+
+// RDataAFSDB designates an AFS or DCE server for the owner name
+type RDataAFSDB struct {
+	Subtype  uint16 // 1 for an AFS volume location server, 2 for DCE
+	Hostname string
+}
+
+func (afsdb *RDataAFSDB) GetType() Type {
+	return AFSDB
+}
+
+func (afsdb *RDataAFSDB) String() string {
+	return fmt.Sprintf("%d %s", afsdb.Subtype, afsdb.Hostname)
+}
+
+func (afsdb *RDataAFSDB) decode(c *context, d []byte) error {
+	if len(d) < 3 {
+		return ErrInvalidLen
+	}
+	afsdb.Subtype = binary.BigEndian.Uint16(d[:2])
+	var err error
+	afsdb.Hostname, _, err = c.readLabel(d[2:])
+	return err
+}
+
+func (afsdb *RDataAFSDB) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return ErrInvalidLen
+	}
+	var err error
+	afsdb.Subtype, err = parseUint16(f[0])
+	afsdb.Hostname = f[1]
+	return err
+}
+
+func (afsdb *RDataAFSDB) encode(c *context) error {
+	if _, err := c.Write(binary.BigEndian.AppendUint16(nil, afsdb.Subtype)); err != nil {
+		return err
+	}
+	return c.appendUncompressedLabel(afsdb.Hostname)
+}
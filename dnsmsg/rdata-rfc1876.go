@@ -0,0 +1,227 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Location information (RFC 1876)
+
+// RDataLOC holds a location in its wire representation. Latitude and
+// Longitude are in thousandths of a second of arc with 2^31 at the equator
+// and prime meridian, Altitude is in centimeters above a base of 100000m
+// below the WGS 84 reference spheroid. Size and precisions are encoded as a
+// mantissa (high nibble) and a power of ten (low nibble) in centimeters. Use
+// the accessors to get values in degrees and meters.
+type RDataLOC struct {
+	Version   uint8 // always 0
+	Size      uint8
+	HorizPre  uint8
+	VertPre   uint8
+	Latitude  uint32
+	Longitude uint32
+	Altitude  uint32
+}
+
+const (
+	locEquator  = 1 << 31  // latitude and longitude origin
+	locAltBase  = 10000000 // altitude origin, in centimeters
+	locDegree   = 3600000  // thousandths of a second of arc in a degree
+	locMaxAlt   = 42849672.95
+	locSize     = 0x12 // 1m
+	locHorizPre = 0x16 // 10000m
+	locVertPre  = 0x13 // 10m
+)
+
+func (loc *RDataLOC) GetType() Type {
+	return LOC
+}
+
+// LatDegrees returns the latitude in degrees, positive north of the equator
+func (loc *RDataLOC) LatDegrees() float64 {
+	return float64(int64(loc.Latitude)-locEquator) / locDegree
+}
+
+// LongDegrees returns the longitude in degrees, positive east of the prime
+// meridian
+func (loc *RDataLOC) LongDegrees() float64 {
+	return float64(int64(loc.Longitude)-locEquator) / locDegree
+}
+
+// AltMeters returns the altitude in meters above the WGS 84 spheroid
+func (loc *RDataLOC) AltMeters() float64 {
+	return float64(int64(loc.Altitude)-locAltBase) / 100
+}
+
+// SizeMeters returns the diameter of the sphere enclosing the entity
+func (loc *RDataLOC) SizeMeters() float64 {
+	return float64(locSizeCm(loc.Size)) / 100
+}
+
+// HorizPreMeters returns the horizontal precision of the location
+func (loc *RDataLOC) HorizPreMeters() float64 {
+	return float64(locSizeCm(loc.HorizPre)) / 100
+}
+
+// VertPreMeters returns the vertical precision of the location
+func (loc *RDataLOC) VertPreMeters() float64 {
+	return float64(locSizeCm(loc.VertPre)) / 100
+}
+
+// locSizeCm decodes a size or precision value to centimeters
+func locSizeCm(v uint8) uint64 {
+	cm := uint64(v >> 4)
+	for i := uint8(0); i < v&0xf; i++ {
+		cm *= 10
+	}
+	return cm
+}
+
+// locSizeString returns a size or precision value in meters, as in
+// presentation format
+func locSizeString(v uint8) string {
+	m, e := v>>4, v&0xf
+	switch e {
+	case 0:
+		return fmt.Sprintf("0.0%dm", m)
+	case 1:
+		return fmt.Sprintf("0.%d0m", m)
+	}
+	return strconv.Itoa(int(m)) + strings.Repeat("0", int(e)-2) + "m"
+}
+
+// parseLocSize parses a size or precision value in meters, with an optional
+// "m" suffix
+func parseLocSize(s string) (uint8, error) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "m"), 64)
+	if err != nil || f < 0 || f > 90000000 {
+		return 0, fmt.Errorf("invalid LOC size %q", s)
+	}
+	cm := uint64(math.Round(f * 100))
+	var e uint8
+	for cm >= 10 {
+		cm /= 10
+		e += 1
+	}
+	return uint8(cm)<<4 | e, nil
+}
+
+// locAngleString returns a latitude or longitude as degrees, minutes,
+// seconds and hemisphere
+func locAngleString(v uint32, pos, neg string) string {
+	a := int64(v) - locEquator
+	h := pos
+	if a < 0 {
+		a, h = -a, neg
+	}
+	deg := a / locDegree
+	a %= locDegree
+	return fmt.Sprintf("%d %d %.3f %s", deg, a/60000, float64(a%60000)/1000, h)
+}
+
+// parseLocAngle parses degrees, optional minutes and seconds, and the
+// hemisphere from f, and returns the value and the number of fields read
+func parseLocAngle(f []string, pos, neg string, maxDeg int64) (uint32, int, error) {
+	var parts [3]float64
+	for i := 0; i < len(f) && i < 4; i++ {
+		if f[i] != pos && f[i] != neg {
+			if i == 3 {
+				break
+			}
+			v, err := strconv.ParseFloat(f[i], 64)
+			if err != nil || v < 0 || (i < 2 && v != math.Trunc(v)) || (i > 0 && v >= 60) {
+				return 0, 0, fmt.Errorf("invalid LOC coordinate %q", f[i])
+			}
+			parts[i] = v
+			continue
+		}
+		a := int64(parts[0])*locDegree + int64(parts[1])*60000 + int64(math.Round(parts[2]*1000))
+		if a > maxDeg*locDegree {
+			return 0, 0, errors.New("LOC coordinate out of range")
+		}
+		if f[i] == neg {
+			a = -a
+		}
+		return uint32(a + locEquator), i + 1, nil
+	}
+	return 0, 0, fmt.Errorf("missing LOC hemisphere %s or %s", pos, neg)
+}
+
+func (loc *RDataLOC) String() string {
+	return fmt.Sprintf("%s %s %.2fm %s %s %s",
+		locAngleString(loc.Latitude, "N", "S"),
+		locAngleString(loc.Longitude, "E", "W"),
+		loc.AltMeters(),
+		locSizeString(loc.Size),
+		locSizeString(loc.HorizPre),
+		locSizeString(loc.VertPre),
+	)
+}
+
+func (loc *RDataLOC) decode(c *context, d []byte) error {
+	if len(d) != 16 {
+		return ErrInvalidLen
+	}
+	if d[0] != 0 {
+		return fmt.Errorf("unsupported LOC version %d", d[0])
+	}
+	for _, v := range d[1:4] {
+		if v>>4 > 9 || v&0xf > 9 {
+			return errors.New("invalid LOC size or precision")
+		}
+	}
+	loc.Version, loc.Size, loc.HorizPre, loc.VertPre = d[0], d[1], d[2], d[3]
+	loc.Latitude = binary.BigEndian.Uint32(d[4:8])
+	loc.Longitude = binary.BigEndian.Uint32(d[8:12])
+	loc.Altitude = binary.BigEndian.Uint32(d[12:16])
+	return nil
+}
+
+// fromString parses the presentation format:
+//
+//	d1 [m1 [s1]] {"N"|"S"} d2 [m2 [s2]] {"E"|"W"} alt["m"] [siz["m"] [hp["m"] [vp["m"]]]]
+func (loc *RDataLOC) fromString(s string) error {
+	f := strings.Fields(s)
+	var err error
+	var n int
+	if loc.Latitude, n, err = parseLocAngle(f, "N", "S", 90); err != nil {
+		return err
+	}
+	f = f[n:]
+	if loc.Longitude, n, err = parseLocAngle(f, "E", "W", 180); err != nil {
+		return err
+	}
+	f = f[n:]
+	if len(f) < 1 || len(f) > 4 {
+		return ErrInvalidLen
+	}
+	alt, err := strconv.ParseFloat(strings.TrimSuffix(f[0], "m"), 64)
+	if err != nil || alt < -100000 || alt > locMaxAlt {
+		return fmt.Errorf("invalid LOC altitude %q", f[0])
+	}
+	loc.Altitude = uint32(int64(math.Round(alt*100)) + locAltBase)
+
+	loc.Version, loc.Size, loc.HorizPre, loc.VertPre = 0, locSize, locHorizPre, locVertPre
+	for i, p := range []*uint8{&loc.Size, &loc.HorizPre, &loc.VertPre} {
+		if i+1 >= len(f) {
+			break
+		}
+		if *p, err = parseLocSize(f[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (loc *RDataLOC) encode(c *context) error {
+	buf := []byte{loc.Version, loc.Size, loc.HorizPre, loc.VertPre}
+	buf = binary.BigEndian.AppendUint32(buf, loc.Latitude)
+	buf = binary.BigEndian.AppendUint32(buf, loc.Longitude)
+	buf = binary.BigEndian.AppendUint32(buf, loc.Altitude)
+	_, err := c.Write(buf)
+	return err
+}
@@ -0,0 +1,53 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Key Exchange Delegation (RFC 2230)
+
+// RDataKX designates a host able to negotiate keys for the owner name, with
+// a preference like MX
+type RDataKX struct {
+	Pref      uint16
+	Exchanger string
+}
+
+func (kx *RDataKX) GetType() Type {
+	return KX
+}
+
+func (kx *RDataKX) String() string {
+	return fmt.Sprintf("%d %s", kx.Pref, kx.Exchanger)
+}
+
+func (kx *RDataKX) decode(c *context, d []byte) error {
+	if len(d) < 3 {
+		return ErrInvalidLen
+	}
+	kx.Pref = binary.BigEndian.Uint16(d[:2])
+	var err error
+	kx.Exchanger, _, err = c.readLabel(d[2:])
+	return err
+}
+
+func (kx *RDataKX) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return ErrInvalidLen
+	}
+	var err error
+	kx.Pref, err = parseUint16(f[0])
+	kx.Exchanger = f[1]
+	return err
+}
+
+func (kx *RDataKX) encode(c *context) error {
+	if _, err := c.Write(binary.BigEndian.AppendUint16(nil, kx.Pref)); err != nil {
+		return err
+	}
+	// the exchanger name must not be compressed (RFC 2230 section 3)
+	return c.appendUncompressedLabel(kx.Exchanger)
+}
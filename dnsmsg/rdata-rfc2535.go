@@ -0,0 +1,56 @@
+package dnsmsg
+
+import "strings"
+
+// SIG and KEY records (RFC 2535), replaced by RRSIG and DNSKEY for DNSSEC
+// but still used by SIG(0) transaction signatures (RFC 2931) and found in
+// old zones. They share the format of RRSIG and DNSKEY.
+
+type RDataSIG struct {
+	RDataRRSIG
+}
+
+func (sig *RDataSIG) GetType() Type {
+	return SIG
+}
+
+// IsSIG0 returns true if sig is a SIG(0) signature of a whole message rather
+// than of a RRset (RFC 2931 section 3)
+func (sig *RDataSIG) IsSIG0() bool {
+	return sig.TypeCovered == 0
+}
+
+// KEY flags
+const (
+	KEYNoKey = 0xc000 // the entity has no key, and the key field is empty
+)
+
+type RDataKEY struct {
+	RDataDNSKEY
+}
+
+func (key *RDataKEY) GetType() Type {
+	return KEY
+}
+
+func (key *RDataKEY) String() string {
+	return strings.TrimSuffix(key.RDataDNSKEY.String(), " ")
+}
+
+func (key *RDataKEY) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 3 {
+		return key.RDataDNSKEY.fromString(s)
+	}
+	// no public key, as when the flags say there is no key
+	var err error
+	if key.Flags, err = parseUint16(f[0]); err != nil {
+		return err
+	}
+	if key.Protocol, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	key.Algorithm, err = parseUint8(f[2])
+	key.PublicKey = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Service location (RFC 2782)
+
+// RDataSRV designates a server for the service named by the owner name, such
+// as _sip._udp.example.com.
+type RDataSRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (srv *RDataSRV) GetType() Type {
+	return SRV
+}
+
+func (srv *RDataSRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target)
+}
+
+func (srv *RDataSRV) decode(c *context, d []byte) error {
+	if len(d) < 7 {
+		return ErrInvalidLen
+	}
+	srv.Priority = binary.BigEndian.Uint16(d[:2])
+	srv.Weight = binary.BigEndian.Uint16(d[2:4])
+	srv.Port = binary.BigEndian.Uint16(d[4:6])
+	var err error
+	srv.Target, _, err = c.readLabel(d[6:])
+	return err
+}
+
+func (srv *RDataSRV) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	for i, v := range []*uint16{&srv.Priority, &srv.Weight, &srv.Port} {
+		if *v, err = parseUint16(f[i]); err != nil {
+			return err
+		}
+	}
+	srv.Target = f[3]
+	return nil
+}
+
+func (srv *RDataSRV) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, srv.Priority)
+	buf = binary.BigEndian.AppendUint16(buf, srv.Weight)
+	buf = binary.BigEndian.AppendUint16(buf, srv.Port)
+	if _, err := c.Write(buf); err != nil {
+		return err
+	}
+	// the target must not be compressed (RFC 2782)
+	return c.appendUncompressedLabel(srv.Target)
+}
@@ -0,0 +1,78 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Naming Authority Pointer (RFC 3403)
+
+type RDataNAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+func (naptr *RDataNAPTR) GetType() Type {
+	return NAPTR
+}
+
+func (naptr *RDataNAPTR) String() string {
+	return fmt.Sprintf("%d %d %s %s %s %s", naptr.Order, naptr.Preference, quoteString(naptr.Flags),
+		quoteString(naptr.Service), quoteString(naptr.Regexp), naptr.Replacement)
+}
+
+func (naptr *RDataNAPTR) decode(c *context, d []byte) error {
+	if len(d) < 4 {
+		return ErrInvalidLen
+	}
+	naptr.Order = binary.BigEndian.Uint16(d[:2])
+	naptr.Preference = binary.BigEndian.Uint16(d[2:4])
+	d = d[4:]
+
+	var err error
+	for _, s := range []*string{&naptr.Flags, &naptr.Service, &naptr.Regexp} {
+		if *s, d, err = readCharString(d); err != nil {
+			return err
+		}
+	}
+	naptr.Replacement, _, err = c.readLabel(d)
+	return err
+}
+
+func (naptr *RDataNAPTR) fromString(s string) error {
+	f, err := splitFields(s)
+	if err != nil {
+		return err
+	}
+	if len(f) != 6 {
+		return ErrInvalidLen
+	}
+	if naptr.Order, err = parseUint16(f[0]); err != nil {
+		return err
+	}
+	if naptr.Preference, err = parseUint16(f[1]); err != nil {
+		return err
+	}
+	naptr.Flags, naptr.Service, naptr.Regexp, naptr.Replacement = f[2], f[3], f[4], f[5]
+	return nil
+}
+
+func (naptr *RDataNAPTR) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, naptr.Order)
+	buf = binary.BigEndian.AppendUint16(buf, naptr.Preference)
+
+	var err error
+	for _, s := range []string{naptr.Flags, naptr.Service, naptr.Regexp} {
+		if buf, err = appendCharString(buf, s); err != nil {
+			return err
+		}
+	}
+	if _, err = c.Write(buf); err != nil {
+		return err
+	}
+	return c.appendUncompressedLabel(naptr.Replacement)
+}
@@ -0,0 +1,316 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DNSSEC resource records (RFC 4034)
+
+type RDataDNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+func (key *RDataDNSKEY) GetType() Type {
+	return DNSKEY
+}
+
+func (key *RDataDNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", key.Flags, key.Protocol, key.Algorithm, base64.StdEncoding.EncodeToString(key.PublicKey))
+}
+
+func (key *RDataDNSKEY) decode(c *context, d []byte) error {
+	if len(d) < 4 {
+		return ErrInvalidLen
+	}
+	key.Flags = binary.BigEndian.Uint16(d[:2])
+	key.Protocol = d[2]
+	key.Algorithm = d[3]
+	key.PublicKey = d[4:]
+	return nil
+}
+
+func (key *RDataDNSKEY) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	if key.Flags, err = parseUint16(f[0]); err != nil {
+		return err
+	}
+	if key.Protocol, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if key.Algorithm, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	key.PublicKey, err = base64.StdEncoding.DecodeString(strings.Join(f[3:], ""))
+	return err
+}
+
+func (key *RDataDNSKEY) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, key.Flags)
+	buf = append(buf, key.Protocol, key.Algorithm)
+	_, err := c.Write(append(buf, key.PublicKey...))
+	return err
+}
+
+type RDataDS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+func (ds *RDataDS) GetType() Type {
+	return DS
+}
+
+func (ds *RDataDS) String() string {
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(hex.EncodeToString(ds.Digest)))
+}
+
+func (ds *RDataDS) decode(c *context, d []byte) error {
+	if len(d) < 4 {
+		return ErrInvalidLen
+	}
+	ds.KeyTag = binary.BigEndian.Uint16(d[:2])
+	ds.Algorithm = d[2]
+	ds.DigestType = d[3]
+	ds.Digest = d[4:]
+	return nil
+}
+
+func (ds *RDataDS) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	if ds.KeyTag, err = parseUint16(f[0]); err != nil {
+		return err
+	}
+	if ds.Algorithm, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if ds.DigestType, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	ds.Digest, err = hex.DecodeString(strings.Join(f[3:], ""))
+	return err
+}
+
+func (ds *RDataDS) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, ds.KeyTag)
+	buf = append(buf, ds.Algorithm, ds.DigestType)
+	_, err := c.Write(append(buf, ds.Digest...))
+	return err
+}
+
+type RDataRRSIG struct {
+	TypeCovered Type
+	Algorithm   uint8
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+func (sig *RDataRRSIG) GetType() Type {
+	return RRSIG
+}
+
+func (sig *RDataRRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", sig.TypeCovered.text(), sig.Algorithm, sig.Labels, sig.OrigTTL,
+		formatSigTime(sig.Expiration), formatSigTime(sig.Inception), sig.KeyTag, sig.SignerName,
+		base64.StdEncoding.EncodeToString(sig.Signature))
+}
+
+func (sig *RDataRRSIG) decode(c *context, d []byte) error {
+	if len(d) < 19 {
+		return ErrInvalidLen
+	}
+	sig.TypeCovered = Type(binary.BigEndian.Uint16(d[:2]))
+	sig.Algorithm = d[2]
+	sig.Labels = d[3]
+	sig.OrigTTL = binary.BigEndian.Uint32(d[4:8])
+	sig.Expiration = binary.BigEndian.Uint32(d[8:12])
+	sig.Inception = binary.BigEndian.Uint32(d[12:16])
+	sig.KeyTag = binary.BigEndian.Uint16(d[16:18])
+
+	var n int
+	var err error
+	sig.SignerName, n, err = c.readLabel(d[18:])
+	if err != nil {
+		return err
+	}
+	sig.Signature = d[18+n:]
+	return nil
+}
+
+func (sig *RDataRRSIG) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 9 {
+		return ErrInvalidLen
+	}
+	var err error
+	if sig.TypeCovered, err = ParseType(f[0]); err != nil {
+		return err
+	}
+	if sig.Algorithm, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if sig.Labels, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	if sig.OrigTTL, err = parseUint32(f[3]); err != nil {
+		return err
+	}
+	if sig.Expiration, err = parseSigTime(f[4]); err != nil {
+		return err
+	}
+	if sig.Inception, err = parseSigTime(f[5]); err != nil {
+		return err
+	}
+	if sig.KeyTag, err = parseUint16(f[6]); err != nil {
+		return err
+	}
+	sig.SignerName = f[7]
+	sig.Signature, err = base64.StdEncoding.DecodeString(strings.Join(f[8:], ""))
+	return err
+}
+
+func (sig *RDataRRSIG) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, uint16(sig.TypeCovered))
+	buf = append(buf, sig.Algorithm, sig.Labels)
+	buf = binary.BigEndian.AppendUint32(buf, sig.OrigTTL)
+	buf = binary.BigEndian.AppendUint32(buf, sig.Expiration)
+	buf = binary.BigEndian.AppendUint32(buf, sig.Inception)
+	buf = binary.BigEndian.AppendUint16(buf, sig.KeyTag)
+	if _, err := c.Write(buf); err != nil {
+		return err
+	}
+	if err := c.appendUncompressedLabel(sig.SignerName); err != nil {
+		return err
+	}
+	_, err := c.Write(sig.Signature)
+	return err
+}
+
+type RDataNSEC struct {
+	NextDomain string
+	Types      []Type
+}
+
+func (nsec *RDataNSEC) GetType() Type {
+	return NSEC
+}
+
+func (nsec *RDataNSEC) String() string {
+	return strings.Join(append([]string{nsec.NextDomain}, typeListText(nsec.Types)...), " ")
+}
+
+func (nsec *RDataNSEC) decode(c *context, d []byte) error {
+	var n int
+	var err error
+	nsec.NextDomain, n, err = c.readLabel(d)
+	if err != nil {
+		return err
+	}
+	nsec.Types, err = parseTypeBitmap(d[n:])
+	return err
+}
+
+func (nsec *RDataNSEC) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 1 {
+		return ErrInvalidLen
+	}
+	var err error
+	nsec.NextDomain = f[0]
+	nsec.Types, err = parseTypeList(f[1:])
+	return err
+}
+
+func (nsec *RDataNSEC) encode(c *context) error {
+	if err := c.appendUncompressedLabel(nsec.NextDomain); err != nil {
+		return err
+	}
+	_, err := c.Write(appendTypeBitmap(nil, nsec.Types))
+	return err
+}
+
+// appendTypeBitmap appends the type bitmap representation of types (RFC 4034
+// section 4.1.2) to buf
+func appendTypeBitmap(buf []byte, types []Type) []byte {
+	sorted := append([]Type(nil), types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var bitmap [32]byte
+	for i := 0; i < len(sorted); {
+		window := byte(sorted[i] >> 8)
+		bitmap = [32]byte{}
+		l := 0
+		for ; i < len(sorted) && byte(sorted[i]>>8) == window; i++ {
+			b := byte(sorted[i])
+			bitmap[b/8] |= 0x80 >> (b % 8)
+			l = int(b/8) + 1
+		}
+		buf = append(buf, window, byte(l))
+		buf = append(buf, bitmap[:l]...)
+	}
+	return buf
+}
+
+// parseTypeBitmap decodes a type bitmap
+func parseTypeBitmap(d []byte) ([]Type, error) {
+	var res []Type
+	last := -1
+	for len(d) > 0 {
+		if len(d) < 2 || d[1] == 0 || d[1] > 32 || len(d) < int(d[1])+2 || int(d[0]) <= last {
+			return nil, ErrInvalidLen
+		}
+		window, l := d[0], int(d[1])
+		for i, b := range d[2 : l+2] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					res = append(res, Type(uint16(window)<<8|uint16(i*8+bit)))
+				}
+			}
+		}
+		last = int(window)
+		d = d[l+2:]
+	}
+	return res, nil
+}
+
+func typeListText(types []Type) []string {
+	res := make([]string, len(types))
+	for i, t := range types {
+		res[i] = t.text()
+	}
+	return res
+}
+
+func parseTypeList(f []string) ([]Type, error) {
+	res := make([]Type, 0, len(f))
+	for _, s := range f {
+		t, err := ParseType(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// SSH key fingerprints (RFC 4255)
+
+type RDataSSHFP struct {
+	Algorithm   uint8
+	FPType      uint8
+	Fingerprint []byte
+}
+
+func (fp *RDataSSHFP) GetType() Type {
+	return SSHFP
+}
+
+func (fp *RDataSSHFP) String() string {
+	return fmt.Sprintf("%d %d %s", fp.Algorithm, fp.FPType, strings.ToUpper(hex.EncodeToString(fp.Fingerprint)))
+}
+
+func (fp *RDataSSHFP) decode(c *context, d []byte) error {
+	if len(d) < 2 {
+		return ErrInvalidLen
+	}
+	fp.Algorithm, fp.FPType = d[0], d[1]
+	fp.Fingerprint = d[2:]
+	return nil
+}
+
+func (fp *RDataSSHFP) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 3 {
+		return ErrInvalidLen
+	}
+	var err error
+	if fp.Algorithm, err = parseUint8(f[0]); err != nil {
+		return err
+	}
+	if fp.FPType, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	fp.Fingerprint, err = hex.DecodeString(strings.Join(f[2:], ""))
+	return err
+}
+
+func (fp *RDataSSHFP) encode(c *context) error {
+	_, err := c.Write(append([]byte{fp.Algorithm, fp.FPType}, fp.Fingerprint...))
+	return err
+}
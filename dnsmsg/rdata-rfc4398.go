@@ -0,0 +1,79 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// certificates in the DNS (RFC 4398)
+
+// certTypes holds the mnemonics of certificate types
+var certTypes = map[string]uint16{
+	"PKIX":    1,
+	"SPKI":    2,
+	"PGP":     3,
+	"IPKIX":   4,
+	"ISPKI":   5,
+	"IPGP":    6,
+	"ACPKIX":  7,
+	"IACPKIX": 8,
+	"URI":     253,
+	"OID":     254,
+}
+
+type RDataCERT struct {
+	CertType    uint16
+	KeyTag      uint16
+	Algorithm   uint8
+	Certificate []byte
+}
+
+func (cert *RDataCERT) GetType() Type {
+	return CERT
+}
+
+func (cert *RDataCERT) String() string {
+	return fmt.Sprintf("%d %d %d %s", cert.CertType, cert.KeyTag, cert.Algorithm, base64.StdEncoding.EncodeToString(cert.Certificate))
+}
+
+func (cert *RDataCERT) decode(c *context, d []byte) error {
+	if len(d) < 5 {
+		return ErrInvalidLen
+	}
+	cert.CertType = binary.BigEndian.Uint16(d[:2])
+	cert.KeyTag = binary.BigEndian.Uint16(d[2:4])
+	cert.Algorithm = d[4]
+	cert.Certificate = d[5:]
+	return nil
+}
+
+func (cert *RDataCERT) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	if v, ok := certTypes[strings.ToUpper(f[0])]; ok {
+		cert.CertType = v
+	} else if cert.CertType, err = parseUint16(f[0]); err != nil {
+		return err
+	}
+	if cert.KeyTag, err = parseUint16(f[1]); err != nil {
+		return err
+	}
+	if cert.Algorithm, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	cert.Certificate, err = base64.StdEncoding.DecodeString(strings.Join(f[3:], ""))
+	return err
+}
+
+func (cert *RDataCERT) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint16(nil, cert.CertType)
+	buf = binary.BigEndian.AppendUint16(buf, cert.KeyTag)
+	buf = append(buf, cert.Algorithm)
+	_, err := c.Write(append(buf, cert.Certificate...))
+	return err
+}
@@ -0,0 +1,45 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// DHCP information (RFC 4701)
+
+// RDataDHCID is the identifier of the DHCP client a name was assigned to. It
+// is made of an identifier type, a digest type and a digest, but is opaque
+// to DNS.
+type RDataDHCID struct {
+	Data []byte
+}
+
+func (id *RDataDHCID) GetType() Type {
+	return DHCID
+}
+
+func (id *RDataDHCID) String() string {
+	return base64.StdEncoding.EncodeToString(id.Data)
+}
+
+func (id *RDataDHCID) decode(c *context, d []byte) error {
+	if len(d) == 0 {
+		return ErrInvalidLen
+	}
+	id.Data = d
+	return nil
+}
+
+func (id *RDataDHCID) fromString(s string) error {
+	var err error
+	id.Data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err == nil && len(id.Data) == 0 {
+		return ErrInvalidLen
+	}
+	return err
+}
+
+func (id *RDataDHCID) encode(c *context) error {
+	_, err := c.Write(id.Data)
+	return err
+}
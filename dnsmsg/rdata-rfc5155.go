@@ -0,0 +1,151 @@
+package dnsmsg
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// NSEC3 hashed denial of existence (RFC 5155)
+
+// base32hex without padding, as used for NSEC3 hashed owner names
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+type RDataNSEC3 struct {
+	Hash       uint8
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+	NextHashed []byte
+	Types      []Type
+}
+
+func (nsec3 *RDataNSEC3) GetType() Type {
+	return NSEC3
+}
+
+func (nsec3 *RDataNSEC3) String() string {
+	s := fmt.Sprintf("%d %d %d %s %s", nsec3.Hash, nsec3.Flags, nsec3.Iterations, saltText(nsec3.Salt), nsec3Encoding.EncodeToString(nsec3.NextHashed))
+	return strings.Join(append([]string{s}, typeListText(nsec3.Types)...), " ")
+}
+
+func (nsec3 *RDataNSEC3) decode(c *context, d []byte) error {
+	d, err := decodeNSEC3Param(d, &nsec3.Hash, &nsec3.Flags, &nsec3.Iterations, &nsec3.Salt)
+	if err != nil {
+		return err
+	}
+	if len(d) < 1 || len(d) < int(d[0])+1 {
+		return ErrInvalidLen
+	}
+	nsec3.NextHashed = d[1 : d[0]+1]
+	nsec3.Types, err = parseTypeBitmap(d[d[0]+1:])
+	return err
+}
+
+func (nsec3 *RDataNSEC3) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 5 {
+		return ErrInvalidLen
+	}
+	err := nsec3ParamFromString(f, &nsec3.Hash, &nsec3.Flags, &nsec3.Iterations, &nsec3.Salt)
+	if err != nil {
+		return err
+	}
+	if nsec3.NextHashed, err = nsec3Encoding.DecodeString(strings.ToUpper(f[4])); err != nil {
+		return err
+	}
+	nsec3.Types, err = parseTypeList(f[5:])
+	return err
+}
+
+func (nsec3 *RDataNSEC3) encode(c *context) error {
+	if len(nsec3.Salt) > 255 || len(nsec3.NextHashed) > 255 {
+		return ErrInvalidLen
+	}
+	buf := []byte{nsec3.Hash, nsec3.Flags, byte(nsec3.Iterations >> 8), byte(nsec3.Iterations), byte(len(nsec3.Salt))}
+	buf = append(buf, nsec3.Salt...)
+	buf = append(buf, byte(len(nsec3.NextHashed)))
+	buf = append(buf, nsec3.NextHashed...)
+	_, err := c.Write(appendTypeBitmap(buf, nsec3.Types))
+	return err
+}
+
+type RDataNSEC3PARAM struct {
+	Hash       uint8
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+}
+
+func (param *RDataNSEC3PARAM) GetType() Type {
+	return NSEC3PARAM
+}
+
+func (param *RDataNSEC3PARAM) String() string {
+	return fmt.Sprintf("%d %d %d %s", param.Hash, param.Flags, param.Iterations, saltText(param.Salt))
+}
+
+func (param *RDataNSEC3PARAM) decode(c *context, d []byte) error {
+	d, err := decodeNSEC3Param(d, &param.Hash, &param.Flags, &param.Iterations, &param.Salt)
+	if err == nil && len(d) > 0 {
+		err = ErrInvalidLen
+	}
+	return err
+}
+
+func (param *RDataNSEC3PARAM) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) != 4 {
+		return ErrInvalidLen
+	}
+	return nsec3ParamFromString(f, &param.Hash, &param.Flags, &param.Iterations, &param.Salt)
+}
+
+func (param *RDataNSEC3PARAM) encode(c *context) error {
+	if len(param.Salt) > 255 {
+		return ErrInvalidLen
+	}
+	buf := []byte{param.Hash, param.Flags, byte(param.Iterations >> 8), byte(param.Iterations), byte(len(param.Salt))}
+	_, err := c.Write(append(buf, param.Salt...))
+	return err
+}
+
+// decodeNSEC3Param decodes the fields shared by NSEC3 and NSEC3PARAM, and
+// returns the remaining data
+func decodeNSEC3Param(d []byte, hash, flags *uint8, iterations *uint16, salt *[]byte) ([]byte, error) {
+	if len(d) < 5 || len(d) < int(d[4])+5 {
+		return nil, ErrInvalidLen
+	}
+	*hash = d[0]
+	*flags = d[1]
+	*iterations = uint16(d[2])<<8 | uint16(d[3])
+	*salt = d[5 : d[4]+5]
+	return d[d[4]+5:], nil
+}
+
+func nsec3ParamFromString(f []string, hash, flags *uint8, iterations *uint16, salt *[]byte) error {
+	var err error
+	if *hash, err = parseUint8(f[0]); err != nil {
+		return err
+	}
+	if *flags, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if *iterations, err = parseUint16(f[2]); err != nil {
+		return err
+	}
+	*salt = nil
+	if f[3] != "-" {
+		*salt, err = hex.DecodeString(f[3])
+	}
+	return err
+}
+
+// saltText returns the presentation form of a salt, "-" when empty
+func saltText(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+	return strings.ToUpper(hex.EncodeToString(salt))
+}
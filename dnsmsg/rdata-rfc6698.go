@@ -0,0 +1,57 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TLSA certificate association (RFC 6698)
+
+type RDataTLSA struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+func (tlsa *RDataTLSA) GetType() Type {
+	return TLSA
+}
+
+func (tlsa *RDataTLSA) String() string {
+	return fmt.Sprintf("%d %d %d %s", tlsa.Usage, tlsa.Selector, tlsa.MatchingType, strings.ToUpper(hex.EncodeToString(tlsa.Data)))
+}
+
+func (tlsa *RDataTLSA) decode(c *context, d []byte) error {
+	if len(d) < 3 {
+		return ErrInvalidLen
+	}
+	tlsa.Usage, tlsa.Selector, tlsa.MatchingType = d[0], d[1], d[2]
+	tlsa.Data = d[3:]
+	return nil
+}
+
+func (tlsa *RDataTLSA) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	if tlsa.Usage, err = parseUint8(f[0]); err != nil {
+		return err
+	}
+	if tlsa.Selector, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if tlsa.MatchingType, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	tlsa.Data, err = hex.DecodeString(strings.Join(f[3:], ""))
+	return err
+}
+
+func (tlsa *RDataTLSA) encode(c *context) error {
+	_, err := c.Write(append([]byte{tlsa.Usage, tlsa.Selector, tlsa.MatchingType}, tlsa.Data...))
+	return err
+}
@@ -0,0 +1,69 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// EUI-48 and EUI-64 addresses (RFC 7043)
+
+// RDataEUI is a 48 bits (EUI48) or 64 bits (EUI64) address, typically the
+// MAC address of a device, written as hexadecimal bytes separated with
+// hyphens
+type RDataEUI struct {
+	Address []byte
+	Type    Type
+}
+
+func (eui *RDataEUI) GetType() Type {
+	return eui.Type
+}
+
+// euiLen returns the length in bytes of the addresses of type t
+func euiLen(t Type) int {
+	if t == EUI64 {
+		return 8
+	}
+	return 6
+}
+
+func (eui *RDataEUI) String() string {
+	s := make([]string, len(eui.Address))
+	for i, b := range eui.Address {
+		s[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(s, "-")
+}
+
+func (eui *RDataEUI) decode(c *context, d []byte) error {
+	if len(d) != euiLen(eui.Type) {
+		return ErrInvalidLen
+	}
+	eui.Address = d
+	return nil
+}
+
+func (eui *RDataEUI) fromString(s string) error {
+	f := strings.Split(strings.TrimSpace(s), "-")
+	if len(f) != euiLen(eui.Type) {
+		return ErrInvalidLen
+	}
+	eui.Address = make([]byte, len(f))
+	for i, v := range f {
+		if len(v) != 2 {
+			return ErrInvalidLen
+		}
+		if _, err := hex.Decode(eui.Address[i:i+1], []byte(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (eui *RDataEUI) encode(c *context) error {
+	if len(eui.Address) != euiLen(eui.Type) {
+		return ErrInvalidLen
+	}
+	_, err := c.Write(eui.Address)
+	return err
+}
@@ -0,0 +1,33 @@
+package dnsmsg
+
+// Child DS and DNSKEY records (RFC 7344), published by the child to request
+// changes of the DS records in the parent zone. They share the format of DS
+// and DNSKEY.
+
+type RDataCDS struct {
+	RDataDS
+}
+
+func (cds *RDataCDS) GetType() Type {
+	return CDS
+}
+
+// IsDelete returns true if cds requests the removal of all DS records of the
+// zone (RFC 8078 section 4)
+func (cds *RDataCDS) IsDelete() bool {
+	return cds.KeyTag == 0 && cds.Algorithm == 0 && cds.DigestType == 0 && len(cds.Digest) == 1 && cds.Digest[0] == 0
+}
+
+type RDataCDNSKEY struct {
+	RDataDNSKEY
+}
+
+func (key *RDataCDNSKEY) GetType() Type {
+	return CDNSKEY
+}
+
+// IsDelete returns true if key requests the removal of all DS records of the
+// zone (RFC 8078 section 4)
+func (key *RDataCDNSKEY) IsDelete() bool {
+	return key.Flags == 0 && key.Protocol == 3 && key.Algorithm == 0 && len(key.PublicKey) == 1 && key.PublicKey[0] == 0
+}
@@ -0,0 +1,63 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Child-to-parent synchronization (RFC 7477)
+
+// CSYNC flags
+const (
+	CSYNCImmediate  = 0x0001 // the parent may update immediately
+	CSYNCSOAMinimum = 0x0002 // SOA serial must be at least SOASerial
+)
+
+type RDataCSYNC struct {
+	SOASerial uint32
+	Flags     uint16
+	Types     []Type // types to synchronize
+}
+
+func (cs *RDataCSYNC) GetType() Type {
+	return CSYNC
+}
+
+func (cs *RDataCSYNC) String() string {
+	return strings.Join(append([]string{fmt.Sprintf("%d %d", cs.SOASerial, cs.Flags)}, typeListText(cs.Types)...), " ")
+}
+
+func (cs *RDataCSYNC) decode(c *context, d []byte) error {
+	if len(d) < 6 {
+		return ErrInvalidLen
+	}
+	cs.SOASerial = binary.BigEndian.Uint32(d[:4])
+	cs.Flags = binary.BigEndian.Uint16(d[4:6])
+	var err error
+	cs.Types, err = parseTypeBitmap(d[6:])
+	return err
+}
+
+func (cs *RDataCSYNC) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return ErrInvalidLen
+	}
+	var err error
+	if cs.SOASerial, err = parseUint32(f[0]); err != nil {
+		return err
+	}
+	if cs.Flags, err = parseUint16(f[1]); err != nil {
+		return err
+	}
+	cs.Types, err = parseTypeList(f[2:])
+	return err
+}
+
+func (cs *RDataCSYNC) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint32(nil, cs.SOASerial)
+	buf = binary.BigEndian.AppendUint16(buf, cs.Flags)
+	_, err := c.Write(appendTypeBitmap(buf, cs.Types))
+	return err
+}
@@ -0,0 +1,109 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Host Identity Protocol (RFC 8005)
+
+// RDataHIP holds the Host Identity Tag and public key of a HIP host, and the
+// rendezvous servers it can be reached through
+type RDataHIP struct {
+	Algorithm  uint8 // public key algorithm, as in IPSECKEY
+	HIT        []byte
+	PublicKey  []byte
+	Rendezvous []string
+}
+
+func (hip *RDataHIP) GetType() Type {
+	return HIP
+}
+
+func (hip *RDataHIP) String() string {
+	s := fmt.Sprintf("%d %s %s", hip.Algorithm, strings.ToUpper(hex.EncodeToString(hip.HIT)), base64.StdEncoding.EncodeToString(hip.PublicKey))
+	if len(hip.Rendezvous) > 0 {
+		s += " " + strings.Join(hip.Rendezvous, " ")
+	}
+	return s
+}
+
+func (hip *RDataHIP) decode(c *context, d []byte) error {
+	if len(d) < 4 {
+		return ErrInvalidLen
+	}
+	hitLen := int(d[0])
+	hip.Algorithm = d[1]
+	pkLen := int(binary.BigEndian.Uint16(d[2:4]))
+	d = d[4:]
+	if hitLen == 0 || len(d) < hitLen+pkLen {
+		return ErrInvalidLen
+	}
+	hip.HIT = d[:hitLen]
+	hip.PublicKey = d[hitLen : hitLen+pkLen]
+	d = d[hitLen+pkLen:]
+
+	// the rendezvous servers take the rest of the RDATA
+	hip.Rendezvous = nil
+	for len(d) > 0 {
+		name, n, err := c.readLabel(d)
+		if err != nil {
+			return err
+		}
+		hip.Rendezvous = append(hip.Rendezvous, name)
+		d = d[n:]
+	}
+	return nil
+}
+
+func (hip *RDataHIP) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 3 {
+		return ErrInvalidLen
+	}
+	var err error
+	if hip.Algorithm, err = parseUint8(f[0]); err != nil {
+		return err
+	}
+	if hip.HIT, err = hex.DecodeString(f[1]); err != nil {
+		return err
+	}
+	if len(hip.HIT) == 0 || len(hip.HIT) > 255 {
+		return ErrInvalidLen
+	}
+	if hip.PublicKey, err = base64.StdEncoding.DecodeString(f[2]); err != nil {
+		return err
+	}
+	if len(hip.PublicKey) > 0xffff {
+		return ErrInvalidLen
+	}
+	hip.Rendezvous = nil
+	if len(f) > 3 {
+		hip.Rendezvous = f[3:]
+	}
+	return nil
+}
+
+func (hip *RDataHIP) encode(c *context) error {
+	if len(hip.HIT) == 0 || len(hip.HIT) > 255 || len(hip.PublicKey) > 0xffff {
+		return ErrInvalidLen
+	}
+	buf := []byte{byte(len(hip.HIT)), hip.Algorithm}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(hip.PublicKey)))
+	buf = append(buf, hip.HIT...)
+	buf = append(buf, hip.PublicKey...)
+	if _, err := c.Write(buf); err != nil {
+		return err
+	}
+
+	// rendezvous server names must not be compressed (RFC 8005 section 6)
+	for _, name := range hip.Rendezvous {
+		if err := c.appendUncompressedLabel(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package dnsmsg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Certification Authority Authorization (RFC 8659)
+
+type RDataCAA struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+func (caa *RDataCAA) GetType() Type {
+	return CAA
+}
+
+func (caa *RDataCAA) String() string {
+	return fmt.Sprintf("%d %s %s", caa.Flags, caa.Tag, quoteString(caa.Value))
+}
+
+func (caa *RDataCAA) decode(c *context, d []byte) error {
+	if len(d) < 2 || len(d) < int(d[1])+2 {
+		return ErrInvalidLen
+	}
+	caa.Flags = d[0]
+	caa.Tag = string(d[2 : d[1]+2])
+	caa.Value = string(d[d[1]+2:])
+	return nil
+}
+
+func (caa *RDataCAA) fromString(s string) error {
+	f, err := splitFields(s)
+	if err != nil {
+		return err
+	}
+	if len(f) != 3 {
+		return ErrInvalidLen
+	}
+	if caa.Flags, err = parseUint8(f[0]); err != nil {
+		return err
+	}
+	caa.Tag, caa.Value = f[1], f[2]
+	return caa.checkTag()
+}
+
+// checkTag verifies the tag is made of 1 to 15 ASCII letters and digits
+func (caa *RDataCAA) checkTag() error {
+	if len(caa.Tag) == 0 || len(caa.Tag) > 15 {
+		return errors.New("invalid CAA tag")
+	}
+	for _, c := range []byte(caa.Tag) {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return errors.New("invalid CAA tag")
+		}
+	}
+	return nil
+}
+
+func (caa *RDataCAA) encode(c *context) error {
+	if err := caa.checkTag(); err != nil {
+		return err
+	}
+	buf := append([]byte{caa.Flags, byte(len(caa.Tag))}, caa.Tag...)
+	_, err := c.Write(append(buf, caa.Value...))
+	return err
+}
@@ -0,0 +1,66 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Message digest for DNS zones (RFC 8976)
+
+type RDataZONEMD struct {
+	Serial uint32 // serial of the zone SOA the digest was computed for
+	Scheme uint8  // 1 for SIMPLE
+	Hash   uint8  // 1 for SHA-384, 2 for SHA-512
+	Digest []byte
+}
+
+func (zmd *RDataZONEMD) GetType() Type {
+	return ZONEMD
+}
+
+func (zmd *RDataZONEMD) String() string {
+	return fmt.Sprintf("%d %d %d %s", zmd.Serial, zmd.Scheme, zmd.Hash, strings.ToUpper(hex.EncodeToString(zmd.Digest)))
+}
+
+func (zmd *RDataZONEMD) decode(c *context, d []byte) error {
+	// the digest is at least 12 bytes long
+	if len(d) < 18 {
+		return ErrInvalidLen
+	}
+	zmd.Serial = binary.BigEndian.Uint32(d[:4])
+	zmd.Scheme, zmd.Hash = d[4], d[5]
+	zmd.Digest = d[6:]
+	return nil
+}
+
+func (zmd *RDataZONEMD) fromString(s string) error {
+	f := strings.Fields(s)
+	if len(f) < 4 {
+		return ErrInvalidLen
+	}
+	var err error
+	if zmd.Serial, err = parseUint32(f[0]); err != nil {
+		return err
+	}
+	if zmd.Scheme, err = parseUint8(f[1]); err != nil {
+		return err
+	}
+	if zmd.Hash, err = parseUint8(f[2]); err != nil {
+		return err
+	}
+	if zmd.Digest, err = hex.DecodeString(strings.Join(f[3:], "")); err != nil {
+		return err
+	}
+	if len(zmd.Digest) < 12 {
+		return ErrInvalidLen
+	}
+	return nil
+}
+
+func (zmd *RDataZONEMD) encode(c *context) error {
+	buf := binary.BigEndian.AppendUint32(nil, zmd.Serial)
+	_, err := c.Write(append(append(buf, zmd.Scheme, zmd.Hash), zmd.Digest...))
+	return err
+}
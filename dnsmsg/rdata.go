@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"strconv"
 )
 
 type RData interface {
@@ -44,8 +43,15 @@ func RDataFromString(t Type, str string) (RData, error) {
 		_, err := fmt.Sscanf(str, "%d %s", &mx.Pref, &mx.Server)
 		return mx, err
 	case TXT:
-		s, err := strconv.Unquote(str)
-		return RDataTXT(s), err
+		// character strings, quoted or not
+		f, err := splitFields(str)
+		if err != nil {
+			return nil, err
+		}
+		if len(f) == 0 {
+			return nil, errBadString
+		}
+		return NewTXT(f...), nil
 	// RFC 3596
 	case AAAA:
 		ip := net.ParseIP(str).To16()
@@ -53,10 +59,117 @@ func RDataFromString(t Type, str string) (RData, error) {
 			return nil, errors.New("could not parse ipv6")
 		}
 		return &RDataIP{ip, t}, nil
+	// RFC 6672
+	case DNAME:
+		return &RDataLabel{str, t}, nil
+	}
+
+	if rd := newRData(t); rd != nil {
+		if err := rd.fromString(str); err != nil {
+			return nil, fmt.Errorf("while parsing %s string: %w", t.String(), err)
+		}
+		return rd, nil
+	}
+	if r := registered(t); r != nil {
+		rd, err := r.parse(str)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing %s string: %w", t.String(), err)
+		}
+		return &RDataPrivate{rd}, nil
 	}
 	return nil, fmt.Errorf("while parsing %s string: %w", t.String(), ErrNotSupport)
 }
 
+// rdataCodec is implemented by RData types able to decode themselves from
+// wire and presentation format
+type rdataCodec interface {
+	RData
+	decode(c *context, d []byte) error
+	fromString(s string) error
+}
+
+// newRData returns an empty RData for types implementing rdataCodec
+func newRData(t Type) rdataCodec {
+	switch t {
+	// RFC 1035
+	case HINFO:
+		return &RDataHINFO{}
+	case MINFO:
+		return &RDataMINFO{}
+	// RFC 1183
+	case RP:
+		return &RDataRP{}
+	case AFSDB:
+		return &RDataAFSDB{}
+	// RFC 2782
+	case SRV:
+		return &RDataSRV{}
+	case WKS:
+		return &RDataWKS{}
+	// RFC 4034
+	case DNSKEY:
+		return &RDataDNSKEY{}
+	case DS:
+		return &RDataDS{}
+	case RRSIG:
+		return &RDataRRSIG{}
+	case NSEC:
+		return &RDataNSEC{}
+	// RFC 7344
+	case CDS:
+		return &RDataCDS{}
+	case CDNSKEY:
+		return &RDataCDNSKEY{}
+	// RFC 5155
+	case NSEC3:
+		return &RDataNSEC3{}
+	case NSEC3PARAM:
+		return &RDataNSEC3PARAM{}
+	// RFC 6698
+	case TLSA:
+		return &RDataTLSA{}
+	// RFC 4255
+	case SSHFP:
+		return &RDataSSHFP{}
+	// RFC 8659
+	case CAA:
+		return &RDataCAA{}
+	// RFC 4398
+	case CERT:
+		return &RDataCERT{}
+	// RFC 4701
+	case DHCID:
+		return &RDataDHCID{}
+	// RFC 3403
+	case NAPTR:
+		return &RDataNAPTR{}
+	// RFC 1876
+	case LOC:
+		return &RDataLOC{}
+	// RFC 7477
+	case CSYNC:
+		return &RDataCSYNC{}
+	// RFC 8976
+	case ZONEMD:
+		return &RDataZONEMD{}
+	// RFC 8005
+	case HIP:
+		return &RDataHIP{}
+	// RFC 7043
+	case EUI48, EUI64:
+		return &RDataEUI{Type: t}
+	// RFC 2230
+	case KX:
+		return &RDataKX{}
+	// RFC 2535
+	case SIG:
+		return &RDataSIG{}
+	case KEY:
+		return &RDataKEY{}
+	}
+	return nil
+}
+
 func (c *context) parseRData(t Type, d []byte) (RData, error) {
 	// Parse rdata.
 	// Anything short enough (max 5 lines) can be put in here to avoid too many method?
@@ -138,7 +251,10 @@ func (c *context) parseRData(t Type, d []byte) (RData, error) {
 		}
 		return &RDataMX{binary.BigEndian.Uint16(d[:2]), lbl}, nil
 	case TXT:
-		return RDataTXT(d), nil
+		if txt := RDataTXT(d); txt.valid() {
+			return txt, nil
+		}
+		return nil, ErrInvalidLen
 	// RFC 3596
 	case AAAA:
 		if len(d) != 16 {
@@ -147,11 +263,38 @@ func (c *context) parseRData(t Type, d []byte) (RData, error) {
 		return &RDataIP{d, t}, nil
 	// RFC 6891
 	case OPT:
-		res := &RDataOPT{}
+		var res *RDataOPT
+		if c.parser != nil {
+			res = &c.parser.opt
+			*res = RDataOPT{}
+		} else {
+			res = &RDataOPT{}
+		}
 		if err := res.decode(c, d); err != nil {
 			return nil, err
 		}
 		return res, nil
+	// RFC 6672
+	case DNAME:
+		lbl, _, err := c.readLabel(d)
+		if err != nil {
+			return nil, err
+		}
+		return &RDataLabel{lbl, t}, nil
+	}
+
+	if rd := newRData(t); rd != nil {
+		if err := rd.decode(c, d); err != nil {
+			return nil, err
+		}
+		return rd, nil
+	}
+	if r := registered(t); r != nil {
+		rd := r.new()
+		if err := rd.UnmarshalBinary(d); err != nil {
+			return nil, err
+		}
+		return &RDataPrivate{rd}, nil
 	}
 	return nil, fmt.Errorf("while parsing %s: %w", t.String(), ErrNotSupport)
 }
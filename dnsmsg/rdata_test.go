@@ -0,0 +1,288 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRDataRoundTrip(t *testing.T) {
+	tests := []struct {
+		typ  Type
+		text string
+	}{
+		{DNSKEY, "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="},
+		{DS, "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"},
+		{RRSIG, "A 13 2 3600 20240801000000 20240718000000 12345 example.com. oJB1W6WNGv+ldvQ3WDG0MQkg5IEhjRip8WTrPYGv07h108dUKGMeDPKijVCHX3DDKdfb+v6oB9wfuh3DTJXUAw=="},
+		{NSEC, "host.example.com. A MX RRSIG NSEC TYPE1234"},
+		{CDS, "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"},
+		{CDS, "0 0 0 00"},
+		{CDNSKEY, "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="},
+		{CDNSKEY, "0 3 0 AA=="},
+		{NSEC3, "1 1 0 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR NS SOA RRSIG DNSKEY NSEC3PARAM"},
+		{NSEC3PARAM, "1 0 0 -"},
+		{TLSA, "3 1 1 0B9FA5A59EED715C26C1020C711B4F6EC42D58B0015E14337A39DAD301C5AFC3"},
+		{SSHFP, "4 2 4E6E1D9E5F4C2C4F93A8D1A2C1F0A7E0B9E3C2F1D4A5B6C7D8E9F0A1B2C3D4E5"},
+		{CAA, `0 issue "letsencrypt.org; validationmethods=dns-01"`},
+		{CERT, "1 12345 8 MIIBIjANBgkqhkiG9w0BAQ=="},
+		{NAPTR, `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{DNAME, "example.net."},
+		{LOC, "42 21 54.000 N 71 6 18.000 W -24.00m 30m 10000m 10m"},
+		{LOC, "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 0.50m 0.01m"},
+		{CSYNC, "66 3 A NS AAAA"},
+		{DHCID, "AAIBY2/AuCccgoJbsaxcQc9TUapptP69lOjxfNuVAA2kjEA="},
+		{CSYNC, "2021020801 0 NS"},
+		{HIP, "2 200100107B1A74DF365639CC39F1D578 AwEAAbdxyhNuSutc5EMzxTs9LBPCIkOFH8cIvM4p9+LrV4e19WzK00+CI6zBCQTdtWsuxKbWIy87UOoJTwkUs7lBu+Upr1gsNrut79ryra+bSRGQb1slImA8YVJyuIDsj7kwzG7jnERNqnWxZ48AWkskmdHaVDP4BcelrTI3rMXdXF5D"},
+		{HIP, "2 200100107B1A74DF365639CC39F1D578 AwEAAQ== rvs1.example.com. rvs2.example.com."},
+		{EUI48, "00-00-5e-00-53-2a"},
+		{KX, "10 kx.example.com."},
+		{SIG, "TYPE0 8 0 0 20240801000000 20240718000000 12345 client.example.com. AA=="},
+		{SIG, "A 13 2 3600 20240801000000 20240718000000 12345 example.com. AA=="},
+		{KEY, "512 3 8 AwEAAQ=="},
+		{KEY, "49152 3 0"},
+		{MINFO, "list-admin.example.com. list-errors.example.com."},
+		{HINFO, `"PC-Intel-700mhz" "Linux 2.4"`},
+		{TXT, `"v=spf1 -all"`},
+		{TXT, `"hello" "" "\"quoted\"\009"`},
+		{RP, "admin.example.com. info.example.com."},
+		{AFSDB, "1 afsdb.example.com."},
+		{SRV, "10 60 5060 sip.example.com."},
+		{WKS, "192.0.2.1 6 21 25 53 80"},
+		{WKS, "192.0.2.1 17"},
+		{EUI64, "00-00-5e-ef-10-00-00-2a"},
+		{ZONEMD, "2018031900 1 1 C68090D90A7AED716BC459F9340E3D7C1370D4D24B7E2FC3A1DDC0B9A87153B9A9713B3C9AE5CC27777F98B8E730044C"},
+	}
+
+	for _, tst := range tests {
+		rd, err := RDataFromString(tst.typ, tst.text)
+		if err != nil {
+			t.Errorf("%s: failed to parse %q: %s", tst.typ, tst.text, err)
+			continue
+		}
+		if rd.String() != tst.text {
+			t.Errorf("%s: expected %q, got %q", tst.typ, tst.text, rd.String())
+		}
+
+		// wire format round trip
+		msg := &Message{
+			Bits:     0x8000,
+			Question: []*Question{{Name: "example.com.", Type: tst.typ, Class: IN}},
+			Answer:   []*Resource{{Name: "example.com.", Type: tst.typ, Class: IN, TTL: 3600, Data: rd}},
+		}
+		buf, err := msg.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: failed to marshal: %s", tst.typ, err)
+			continue
+		}
+		msg, err = Parse(buf)
+		if err != nil {
+			t.Errorf("%s: failed to parse message: %s", tst.typ, err)
+			continue
+		}
+		// parsed names have no trailing dot
+		if got := msg.Answer[0].Data.String(); !sameButDots(got, tst.text) {
+			t.Errorf("%s: wire round trip gave %q", tst.typ, got)
+		}
+	}
+
+	for _, bad := range []struct {
+		typ  Type
+		text string
+	}{
+		{DS, "1 2 3 XYZ"},
+		{RRSIG, "A 13 2 3600 20241301000000 20240718000000 12345 example.com. AA=="},
+		{NSEC, "host.example.com. BOGUS"},
+		{CAA, `0 is-sue "x"`},
+		{NAPTR, `100 10 "S" "SIP+D2U" "`},
+		{LOC, "42 21 54 71 06 18 W -24m"},
+		{LOC, "91 0 0 N 0 0 0 E 0m"},
+		{LOC, "42 21 54 N 71 06 18 W"},
+		{CSYNC, "66 65536 A"},
+		{DHCID, "not base64!"},
+		{HIP, "2 200100107B1A74DF365639CC39F1D578"},
+		{HIP, "2 nothex AwEAAQ=="},
+		{EUI48, "00-00-5e-00-53"},
+		{KX, "10"},
+		{SIG, "A 13 2 3600"},
+		{KEY, "512 3"},
+		{MINFO, "list-admin.example.com."},
+		{WKS, "2001:db8::1 6 25"},
+		{WKS, "192.0.2.1 6 not-a-service"},
+		{EUI48, "00:00:5e:00:53:2a"},
+		{EUI64, "00-00-5e-00-53-2a"},
+		{ZONEMD, "2018031900 1 1 C68090D9"},
+	} {
+		if _, err := RDataFromString(bad.typ, bad.text); err == nil {
+			t.Errorf("%s: expected error for %q", bad.typ, bad.text)
+		}
+	}
+}
+
+// sameButDots compares two strings ignoring dots at the end of fields
+func sameButDots(a, b string) bool {
+	strip := func(s string) string {
+		var res []byte
+		for i := 0; i < len(s); i++ {
+			if s[i] == '.' && (i+1 == len(s) || s[i+1] == ' ') {
+				continue
+			}
+			res = append(res, s[i])
+		}
+		return string(res)
+	}
+	return strip(a) == strip(b)
+}
+
+func TestRDataLOC(t *testing.T) {
+	rd, err := RDataFromString(LOC, "42 21 54 N 71 06 18 W -24m 30m")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	loc := rd.(*RDataLOC)
+	if s := loc.String(); s != "42 21 54.000 N 71 6 18.000 W -24.00m 30m 10000m 10m" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if loc.Size != 0x33 || loc.HorizPre != 0x16 || loc.VertPre != 0x13 {
+		t.Errorf("unexpected sizes %#x %#x %#x", loc.Size, loc.HorizPre, loc.VertPre)
+	}
+	if v := loc.LatDegrees(); math.Abs(v-42.365) > 1e-9 {
+		t.Errorf("unexpected latitude %f", v)
+	}
+	if v := loc.LongDegrees(); math.Abs(v+71.105) > 1e-9 {
+		t.Errorf("unexpected longitude %f", v)
+	}
+	if loc.AltMeters() != -24 || loc.SizeMeters() != 30 || loc.HorizPreMeters() != 10000 || loc.VertPreMeters() != 10 {
+		t.Errorf("unexpected values %f %f %f %f", loc.AltMeters(), loc.SizeMeters(), loc.HorizPreMeters(), loc.VertPreMeters())
+	}
+}
+
+func TestRDataCDS(t *testing.T) {
+	for _, test := range []struct {
+		typ    Type
+		text   string
+		delete bool
+	}{
+		{CDS, "0 0 0 00", true},
+		{CDS, "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D", false},
+		{CDNSKEY, "0 3 0 AA==", true},
+		{CDNSKEY, "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==", false},
+	} {
+		rd, err := RDataFromString(test.typ, test.text)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", test.typ, err)
+		}
+		if rd.GetType() != test.typ {
+			t.Errorf("%s: got type %s", test.typ, rd.GetType())
+		}
+		if d := rd.(interface{ IsDelete() bool }).IsDelete(); d != test.delete {
+			t.Errorf("%s %s: IsDelete = %v", test.typ, test.text, d)
+		}
+	}
+}
+
+func TestRDataHIP(t *testing.T) {
+	rd, err := RDataFromString(HIP, "2 200100107B1A74DF365639CC39F1D578 AwEAAQ== rvs.example.com.")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	msg := &Message{
+		Bits:        0x8000,
+		Compression: CompressAll,
+		Answer:      []*Resource{{Name: "rvs.example.com.", Type: HIP, Class: IN, TTL: 3600, Data: rd}},
+	}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	// rendezvous servers are never compressed, even if the name was written
+	// before
+	if !bytes.HasSuffix(buf, []byte("\x03rvs\x07example\x03com\x00")) {
+		t.Errorf("rendezvous server was compressed: %x", buf)
+	}
+	msg, err = Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err)
+	}
+	if hip := msg.Answer[0].Data.(*RDataHIP); len(hip.Rendezvous) != 1 || hip.Rendezvous[0] != "rvs.example.com." {
+		t.Errorf("unexpected rendezvous servers %q", hip.Rendezvous)
+	}
+}
+
+func TestRDataSIG(t *testing.T) {
+	rd, err := RDataFromString(SIG, "TYPE0 8 0 0 20240801000000 20240718000000 12345 client.example.com. AA==")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if sig := rd.(*RDataSIG); !sig.IsSIG0() || sig.GetType() != SIG {
+		t.Errorf("expected a SIG(0) record, got %s %s", sig.GetType(), sig)
+	}
+
+	rd, err = RDataFromString(KEY, "49152 3 0")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if key := rd.(*RDataKEY); key.Flags&KEYNoKey != KEYNoKey || len(key.PublicKey) != 0 {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+// testPrivate is a private use type holding a string as is
+type testPrivate struct {
+	Value string
+}
+
+func (p *testPrivate) GetType() Type                  { return TypePrivateFirst }
+func (p *testPrivate) String() string                 { return p.Value }
+func (p *testPrivate) MarshalBinary() ([]byte, error) { return []byte(p.Value), nil }
+func (p *testPrivate) UnmarshalBinary(d []byte) error {
+	p.Value = string(d)
+	return nil
+}
+
+func TestRegisterType(t *testing.T) {
+	newRData := func() PrivateRData { return &testPrivate{} }
+	parse := func(s string) (PrivateRData, error) {
+		if s == "" {
+			return nil, ErrInvalidLen
+		}
+		return &testPrivate{Value: s}, nil
+	}
+	if err := RegisterType(TypePrivateFirst, newRData, parse); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+	t.Cleanup(func() {
+		typeRegistryLk.Lock()
+		delete(typeRegistry, TypePrivateFirst)
+		typeRegistryLk.Unlock()
+	})
+	if err := RegisterType(TypePrivateFirst, newRData, parse); err != ErrRegistered {
+		t.Errorf("registering twice: got %v", err)
+	}
+	if err := RegisterType(MX, newRData, parse); err != ErrNotSupport {
+		t.Errorf("registering MX: got %v", err)
+	}
+
+	rd, err := RDataFromString(TypePrivateFirst, "hello")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if _, err := RDataFromString(TypePrivateFirst, ""); err == nil {
+		t.Errorf("expected error for empty value")
+	}
+	msg := &Message{
+		Bits:   0x8000,
+		Answer: []*Resource{{Name: "example.com.", Type: TypePrivateFirst, Class: IN, TTL: 60, Data: rd}},
+	}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	msg, err = Parse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err)
+	}
+	p, ok := msg.Answer[0].Data.(*RDataPrivate)
+	if !ok || p.PrivateRData.(*testPrivate).Value != "hello" {
+		t.Errorf("unexpected record %s", msg.Answer[0])
+	}
+}
@@ -0,0 +1,75 @@
+package dnsmsg
+
+import "sync"
+
+// Private use types (RFC 6895 section 3.1)
+const (
+	TypePrivateFirst Type = 65280
+	TypePrivateLast  Type = 65534
+)
+
+// PrivateRData is implemented by the RData of types added with RegisterType.
+// MarshalBinary and UnmarshalBinary encode and decode the RDATA in wire
+// format, where names must not be compressed (RFC 3597 section 4).
+type PrivateRData interface {
+	GetType() Type
+	String() string
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(d []byte) error
+}
+
+// RDataPrivate holds the RData of a type added with RegisterType, so it can
+// be used in a Resource
+type RDataPrivate struct {
+	PrivateRData
+}
+
+func (rd *RDataPrivate) encode(c *context) error {
+	buf, err := rd.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(buf)
+	return err
+}
+
+type registeredType struct {
+	new   func() PrivateRData
+	parse func(s string) (PrivateRData, error)
+}
+
+var (
+	typeRegistry   map[Type]*registeredType
+	typeRegistryLk sync.RWMutex
+)
+
+// RegisterType adds t, a type in the private use range, to the types the
+// package can parse. newRData returns an empty value the RDATA of records is
+// decoded into, and parse reads the RDATA from its presentation format. It
+// is meant to be called at initialization, and fails if t is outside of the
+// private use range or was already registered.
+func RegisterType(t Type, newRData func() PrivateRData, parse func(s string) (PrivateRData, error)) error {
+	if t < TypePrivateFirst || t > TypePrivateLast {
+		return ErrNotSupport
+	}
+	typeRegistryLk.Lock()
+	defer typeRegistryLk.Unlock()
+	if _, ok := typeRegistry[t]; ok {
+		return ErrRegistered
+	}
+	if typeRegistry == nil {
+		typeRegistry = make(map[Type]*registeredType)
+	}
+	typeRegistry[t] = &registeredType{new: newRData, parse: parse}
+	return nil
+}
+
+// registered returns the registered type t, or nil
+func registered(t Type) *registeredType {
+	if t < TypePrivateFirst || t > TypePrivateLast {
+		return nil
+	}
+	typeRegistryLk.RLock()
+	defer typeRegistryLk.RUnlock()
+	return typeRegistry[t]
+}
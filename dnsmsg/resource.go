@@ -7,44 +7,64 @@ import (
 )
 
 type Resource struct {
-	Name  string
+	Name  Name
 	Type  Type
 	Class Class
 	TTL   uint32
 
 	Data RData
+
+	Pos Position // position in the parsed message, zero if not parsed
+
+	raw []byte // RDATA in the parsed message, if kept
+}
+
+// Position locates a resource in the message it was parsed from
+type Position struct {
+	Index  int // index in its section, in wire order (OPT included)
+	Offset int // offset of the record in the message
+	Len    int // length of the record, including name and RDATA
 }
 
 func (c *context) parseResource() (*Resource, error) {
+	start := c.rpos
 	lbl, err := c.parseLabel()
 	if err != nil {
 		return nil, err
 	}
-	r := &Resource{Name: lbl}
-
-	err = binary.Read(c, binary.BigEndian, &r.Type)
+	typ, err := c.readUint16()
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Read(c, binary.BigEndian, &r.Class)
+	class, err := c.readUint16()
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Read(c, binary.BigEndian, &r.TTL)
+	ttl, err := c.readUint32()
 	if err != nil {
 		return nil, err
 	}
-
-	var l uint16 // RDLENGTH
-	err = binary.Read(c, binary.BigEndian, &l)
+	l, err := c.readUint16() // RDLENGTH
 	if err != nil {
 		return nil, err
 	}
 
+	r := c.newResource()
+	r.Name, r.Type, r.Class, r.TTL = Name(lbl), Type(typ), Class(class), ttl
+
 	rdbuf, err := c.readLen(int(l))
 	if err != nil {
 		return nil, err
 	}
+	r.Pos = Position{Offset: start, Len: c.rpos - start}
+	if c.keepRaw() {
+		r.raw = rdbuf
+	}
+
+	if l == 0 && (r.Class == ClassANY || r.Class == ClassNONE) {
+		// RFC 2136 meta record without RDATA
+		return r, nil
+	}
 
 	r.Data, err = c.parseRData(r.Type, rdbuf)
 	if err != nil {
@@ -55,7 +75,7 @@ func (c *context) parseResource() (*Resource, error) {
 }
 
 func (r *Resource) encode(c *context) error {
-	err := c.appendLabel(r.Name)
+	err := c.appendLabel(string(r.Name))
 	if err != nil {
 		return err
 	}
@@ -80,7 +100,16 @@ func (r *Resource) encode(c *context) error {
 	}
 
 	start := c.Len()
-	err = r.Data.encode(c)
+	if r.Data != nil {
+		if c.compression == CompressStandard && !compressibleRData(r.Type) {
+			c.noCompress = true
+		}
+		err = r.Data.encode(c)
+		c.noCompress = c.compression == CompressNone
+		if err != nil {
+			return err
+		}
+	}
 
 	// this tells us how many bytes were written by r.Data.encode()
 	rdlen := c.Len() - start
@@ -94,6 +123,27 @@ func (r *Resource) encode(c *context) error {
 	return nil
 }
 
+// RawData returns the RDATA of r exactly as found in the message it was
+// parsed from, if parsed with ParseOptions.KeepRaw, and nil otherwise.
+// Compressed names are left as is.
+func (r *Resource) RawData() []byte {
+	return r.raw
+}
+
+// compressibleRData returns true if names in the RDATA of type t can be
+// compressed, which is only the case for the types of RFC 1035
+func compressibleRData(t Type) bool {
+	switch t {
+	case NS, MD, MF, CNAME, SOA, MB, MG, MR, PTR, MINFO, MX:
+		return true
+	}
+	return false
+}
+
 func (r *Resource) String() string {
-	return strings.Join([]string{r.Name, r.Class.String(), r.Type.String(), strconv.FormatUint(uint64(r.TTL), 10), r.Data.String()}, " ")
+	var data string
+	if r.Data != nil {
+		data = r.Data.String()
+	}
+	return strings.Join([]string{string(r.Name), r.Class.String(), r.Type.String(), strconv.FormatUint(uint64(r.TTL), 10), data}, " ")
 }
@@ -0,0 +1,178 @@
+package dnsmsg
+
+// RFC 1995 - Incremental Zone Transfer in DNS (IXFR)
+
+// IXFRDiff is a difference sequence of an incremental transfer: the zone
+// goes from version From to version To (both SOA records) by deleting the
+// records in Deleted, then adding the records in Added
+type IXFRDiff struct {
+	From    *Resource
+	Deleted []*Resource
+	To      *Resource
+	Added   []*Resource
+}
+
+// IXFRResponse is the content of an IXFR response
+type IXFRResponse struct {
+	SOA   *Resource   // SOA of the current version of the zone
+	Diffs []*IXFRDiff // differences, oldest first
+
+	// Full holds the records of the zone (SOA excluded) when the server
+	// sent a full transfer instead of differences, nil otherwise
+	Full []*Resource
+}
+
+// NewIXFRQuery returns an IXFR query for zone, for a client holding the
+// version serial of the zone
+func NewIXFRQuery(zone string, serial uint32) *Message {
+	msg := NewQuery(zone, IN, IXFR)
+	msg.Bits.SetRecDesired(false)
+	msg.Authority = []*Resource{{Name: Name(zone), Type: SOA, Class: IN, Data: &RDataSOA{MName: ".", RName: ".", Serial: serial}}}
+	return msg
+}
+
+// soaSerial returns the serial of SOA record rr, and false if rr is not a
+// SOA record
+func soaSerial(rr *Resource) (uint32, bool) {
+	soa, ok := rr.Data.(*RDataSOA)
+	if !ok || rr.Type != SOA {
+		return 0, false
+	}
+	return soa.Serial, true
+}
+
+// ParseIXFR reads the records of an IXFR response, as concatenated from the
+// answer sections of the response messages. A response with only the SOA
+// record means the client is up to date, and a response in the AXFR format
+// is returned in Full.
+func ParseIXFR(rrs []*Resource) (*IXFRResponse, error) {
+	if len(rrs) == 0 {
+		return nil, ErrXfr
+	}
+	serial, ok := soaSerial(rrs[0])
+	if !ok {
+		return nil, ErrXfr
+	}
+	res := &IXFRResponse{SOA: rrs[0]}
+	if len(rrs) == 1 {
+		return res, nil
+	}
+	if last, ok := soaSerial(rrs[len(rrs)-1]); !ok || last != serial {
+		return nil, ErrXfr
+	}
+
+	if len(rrs) == 2 || rrs[1].Type != SOA {
+		// full transfer
+		res.Full = rrs[1 : len(rrs)-1]
+		for _, rr := range res.Full {
+			if rr.Type == SOA {
+				return nil, ErrXfr
+			}
+		}
+		return res, nil
+	}
+
+	rrs = rrs[1 : len(rrs)-1]
+	var prev *Resource
+	for len(rrs) > 0 {
+		d := &IXFRDiff{From: rrs[0]}
+		from, _ := soaSerial(d.From)
+		if prev != nil && from != mustSerial(prev) {
+			// sequences must follow each other
+			return nil, ErrXfr
+		}
+		rrs = rrs[1:]
+		for len(rrs) > 0 && rrs[0].Type != SOA {
+			d.Deleted = append(d.Deleted, rrs[0])
+			rrs = rrs[1:]
+		}
+		if len(rrs) == 0 {
+			return nil, ErrXfr
+		}
+		d.To = rrs[0]
+		if _, ok := soaSerial(d.To); !ok {
+			return nil, ErrXfr
+		}
+		rrs = rrs[1:]
+		for len(rrs) > 0 && rrs[0].Type != SOA {
+			d.Added = append(d.Added, rrs[0])
+			rrs = rrs[1:]
+		}
+		res.Diffs = append(res.Diffs, d)
+		prev = d.To
+	}
+	if mustSerial(prev) != serial {
+		return nil, ErrXfr
+	}
+	return res, nil
+}
+
+func mustSerial(rr *Resource) uint32 {
+	s, _ := soaSerial(rr)
+	return s
+}
+
+// Records returns the records of the transfer in the order they are sent
+// on the wire
+func (x *IXFRResponse) Records() []*Resource {
+	res := []*Resource{x.SOA}
+	if x.Full == nil && len(x.Diffs) == 0 {
+		return res
+	}
+	res = append(res, x.Full...)
+	for _, d := range x.Diffs {
+		res = append(res, d.From)
+		res = append(res, d.Deleted...)
+		res = append(res, d.To)
+		res = append(res, d.Added...)
+	}
+	return append(res, x.SOA)
+}
+
+// Apply applies the transfer to the records of zone, which must include its
+// SOA record, and returns the records of the new version of the zone
+func (x *IXFRResponse) Apply(zone []*Resource) ([]*Resource, error) {
+	if x.Full != nil {
+		return append([]*Resource{x.SOA}, x.Full...), nil
+	}
+
+	var cur *Resource
+	var res []*Resource
+	for _, rr := range zone {
+		if rr.Type == SOA {
+			cur = rr
+			continue
+		}
+		res = append(res, rr)
+	}
+	if cur == nil {
+		return nil, ErrXfr
+	}
+
+	for _, d := range x.Diffs {
+		if mustSerial(d.From) != mustSerial(cur) {
+			return nil, ErrXfr
+		}
+		for _, del := range d.Deleted {
+			res = deleteRecord(res, del)
+		}
+		res = append(res, d.Added...)
+		cur = d.To
+	}
+	if mustSerial(cur) != mustSerial(x.SOA) {
+		return nil, ErrXfr
+	}
+	return append([]*Resource{x.SOA}, res...), nil
+}
+
+// deleteRecord removes the records matching rr (ignoring the TTL)
+func deleteRecord(rrs []*Resource, rr *Resource) []*Resource {
+	res := rrs[:0]
+	for _, r := range rrs {
+		if r.Type == rr.Type && r.Class == rr.Class && r.Name.Equal(rr.Name) && r.Data.String() == rr.Data.String() {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
@@ -0,0 +1,37 @@
+package dnsmsg
+
+// RFC 1996 - A Mechanism for Prompt Notification of Zone Changes (DNS NOTIFY)
+
+// NewNotify returns a NOTIFY message telling secondaries that zone changed,
+// including the SOA serial of the new version of the zone as a hint (other
+// SOA fields are left empty)
+func NewNotify(zone string, serial uint32) *Message {
+	msg := New()
+	msg.Bits.SetOpCode(Notify)
+	msg.Bits.SetAuth(true)
+	msg.Question = []*Question{{Name: Name(zone), Type: SOA, Class: IN}}
+	msg.Answer = []*Resource{{Name: Name(zone), Type: SOA, Class: IN, Data: &RDataSOA{MName: ".", RName: ".", Serial: serial}}}
+	return msg
+}
+
+// ValidateNotify checks that m is a well formed NOTIFY request, and returns
+// the zone it is about and the SOA serial it contains, if any. The sender
+// still needs to be checked against the list of primaries of the zone.
+func ValidateNotify(m *Message) (zone Name, serial uint32, hasSerial bool, err error) {
+	if m.Bits.OpCode() != Notify || m.Bits.IsResponse() || len(m.Question) != 1 {
+		return "", 0, false, ErrNotify
+	}
+	q := m.Question[0]
+	if q.Type != SOA {
+		// other types are not defined (RFC 1996 section 3.2)
+		return "", 0, false, ErrNotify
+	}
+	for _, rr := range m.Answer {
+		soa, ok := rr.Data.(*RDataSOA)
+		if !ok || rr.Type != SOA || !rr.Name.Equal(q.Name) {
+			return "", 0, false, ErrNotify
+		}
+		serial, hasSerial = soa.Serial, true
+	}
+	return q.Name, serial, hasSerial, nil
+}
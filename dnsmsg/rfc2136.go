@@ -0,0 +1,177 @@
+package dnsmsg
+
+// RFC 2136 - Dynamic Updates in the Domain Name System (DNS UPDATE)
+//
+// UPDATE messages reuse the sections of a query: the zone section is the
+// question section, prerequisites are in the answer section and updates in
+// the authority section.
+
+// PrereqKind is the kind of a prerequisite record (RFC 2136 section 2.4)
+type PrereqKind int
+
+const (
+	PrereqInvalid        PrereqKind = iota
+	PrereqRRSetExists               // RRset exists (value independent)
+	PrereqRRSetValue                // RRset exists (value dependent)
+	PrereqRRSetNotExists            // RRset does not exist
+	PrereqNameInUse                 // name is in use
+	PrereqNameNotInUse              // name is not in use
+)
+
+// UpdateKind is the kind of an update record (RFC 2136 section 2.5)
+type UpdateKind int
+
+const (
+	UpdateInvalid      UpdateKind = iota
+	UpdateAdd                     // add to an RRset
+	UpdateDeleteRRSet             // delete an RRset
+	UpdateDeleteName              // delete all RRsets from a name
+	UpdateDeleteRecord            // delete an RR from an RRset
+)
+
+// NewUpdate returns an UPDATE message for zone in class IN
+func NewUpdate(zone string) *Message {
+	msg := New()
+	msg.Bits.SetOpCode(Update)
+	msg.Question = []*Question{{Name: Name(zone), Type: SOA, Class: IN}}
+	return msg
+}
+
+// Zone returns the zone section of an UPDATE message, or nil if it does not
+// contain exactly one zone
+func (m *Message) Zone() *Question {
+	if len(m.Question) != 1 {
+		return nil
+	}
+	return m.Question[0]
+}
+
+// Prerequisites returns the prerequisite section of an UPDATE message
+func (m *Message) Prerequisites() []*Resource {
+	return m.Answer
+}
+
+// Updates returns the update section of an UPDATE message
+func (m *Message) Updates() []*Resource {
+	return m.Authority
+}
+
+// zoneClass returns the class of the zone of an UPDATE message
+func (m *Message) zoneClass() Class {
+	if z := m.Zone(); z != nil {
+		return z.Class
+	}
+	return IN
+}
+
+// RequireRRSetExists adds a prerequisite that an RRset of type typ exists
+// at name
+func (m *Message) RequireRRSetExists(name string, typ Type) {
+	m.Answer = append(m.Answer, &Resource{Name: Name(name), Type: typ, Class: ClassANY})
+}
+
+// RequireRRSet adds a prerequisite that the RRsets of rrs exist with exactly
+// the values in rrs
+func (m *Message) RequireRRSet(rrs ...*Resource) {
+	for _, rr := range rrs {
+		m.Answer = append(m.Answer, &Resource{Name: rr.Name, Type: rr.Type, Class: m.zoneClass(), Data: rr.Data})
+	}
+}
+
+// RequireRRSetNotExists adds a prerequisite that no RRset of type typ exists
+// at name
+func (m *Message) RequireRRSetNotExists(name string, typ Type) {
+	m.Answer = append(m.Answer, &Resource{Name: Name(name), Type: typ, Class: ClassNONE})
+}
+
+// RequireNameInUse adds a prerequisite that name owns at least one record
+func (m *Message) RequireNameInUse(name string) {
+	m.Answer = append(m.Answer, &Resource{Name: Name(name), Type: ANY, Class: ClassANY})
+}
+
+// RequireNameNotInUse adds a prerequisite that name owns no record
+func (m *Message) RequireNameNotInUse(name string) {
+	m.Answer = append(m.Answer, &Resource{Name: Name(name), Type: ANY, Class: ClassNONE})
+}
+
+// AddRecords adds rrs to their RRsets
+func (m *Message) AddRecords(rrs ...*Resource) {
+	for _, rr := range rrs {
+		m.Authority = append(m.Authority, &Resource{Name: rr.Name, Type: rr.Type, Class: m.zoneClass(), TTL: rr.TTL, Data: rr.Data})
+	}
+}
+
+// DeleteRRSet deletes the RRset of type typ at name
+func (m *Message) DeleteRRSet(name string, typ Type) {
+	m.Authority = append(m.Authority, &Resource{Name: Name(name), Type: typ, Class: ClassANY})
+}
+
+// DeleteName deletes all the RRsets at name
+func (m *Message) DeleteName(name string) {
+	m.Authority = append(m.Authority, &Resource{Name: Name(name), Type: ANY, Class: ClassANY})
+}
+
+// DeleteRecords deletes rrs from their RRsets
+func (m *Message) DeleteRecords(rrs ...*Resource) {
+	for _, rr := range rrs {
+		m.Authority = append(m.Authority, &Resource{Name: rr.Name, Type: rr.Type, Class: ClassNONE, Data: rr.Data})
+	}
+}
+
+// PrereqKind returns the kind of prerequisite r is in an UPDATE message for
+// a zone of class zclass, or PrereqInvalid if r is not a valid prerequisite
+func (r *Resource) PrereqKind(zclass Class) PrereqKind {
+	if r.TTL != 0 {
+		return PrereqInvalid
+	}
+	switch r.Class {
+	case ClassANY:
+		if r.Data != nil {
+			return PrereqInvalid
+		}
+		if r.Type == ANY {
+			return PrereqNameInUse
+		}
+		return PrereqRRSetExists
+	case ClassNONE:
+		if r.Data != nil {
+			return PrereqInvalid
+		}
+		if r.Type == ANY {
+			return PrereqNameNotInUse
+		}
+		return PrereqRRSetNotExists
+	case zclass:
+		if r.Data == nil || r.Type == ANY {
+			return PrereqInvalid
+		}
+		return PrereqRRSetValue
+	}
+	return PrereqInvalid
+}
+
+// UpdateKind returns the kind of update r is in an UPDATE message for a
+// zone of class zclass, or UpdateInvalid if r is not a valid update
+func (r *Resource) UpdateKind(zclass Class) UpdateKind {
+	switch r.Class {
+	case zclass:
+		if r.Data == nil || r.Type == ANY {
+			return UpdateInvalid
+		}
+		return UpdateAdd
+	case ClassANY:
+		if r.TTL != 0 || r.Data != nil {
+			return UpdateInvalid
+		}
+		if r.Type == ANY {
+			return UpdateDeleteName
+		}
+		return UpdateDeleteRRSet
+	case ClassNONE:
+		if r.TTL != 0 || r.Data == nil || r.Type == ANY {
+			return UpdateInvalid
+		}
+		return UpdateDeleteRecord
+	}
+	return UpdateInvalid
+}
@@ -0,0 +1,22 @@
+package dnsmsg
+
+// RequestNSID asks the server to return its name server identifier (RFC
+// 5001), by adding an empty NSID option to the query
+func (m *Message) RequestNSID() {
+	m.SetOpt(DnsOpt{Code: OptNSID})
+}
+
+// GetNSID returns the name server identifier, and whether the message had an
+// NSID option. Queries carry an empty NSID option.
+func (m *Message) GetNSID() ([]byte, bool) {
+	opt := m.GetOpt(OptNSID)
+	if opt == nil {
+		return nil, false
+	}
+	return opt.Data, true
+}
+
+// SetNSID sets the name server identifier on a response
+func (m *Message) SetNSID(id []byte) {
+	m.SetOpt(DnsOpt{Code: OptNSID, Data: id})
+}
@@ -0,0 +1,201 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// RFC 5936 - DNS Zone Transfer Protocol (AXFR)
+//
+// A zone transfer is a sequence of response messages sent over a stream,
+// whose answer sections contain the records of the zone, starting and
+// ending with its SOA record.
+
+// DefaultAXFRSize is the default maximum size of messages written by
+// AXFRWriter
+const DefaultAXFRSize = 16 * 1024
+
+// ReadStreamMessage reads a message prefixed with its 2 bytes length, as
+// used on TCP (RFC 1035 section 4.2.2)
+func ReadStreamMessage(r io.Reader) (*Message, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return Parse(buf)
+}
+
+// WriteStreamMessage writes m prefixed with its 2 bytes length
+func WriteStreamMessage(w io.Writer, m *Message) error {
+	buf, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(buf) > 0xffff {
+		return ErrInvalidLen
+	}
+	_, err = w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(buf))), buf...))
+	return err
+}
+
+// AXFRReader reads the records of a zone transfer from a stream, checking
+// that messages answer the query and that records are enclosed in the SOA
+// of the zone
+type AXFRReader struct {
+	r    io.Reader
+	id   uint16
+	soa  *Resource // opening SOA
+	rrs  []*Resource
+	done bool
+}
+
+// NewAXFRReader returns a reader for the response to the AXFR query with
+// the given ID, read from r
+func NewAXFRReader(r io.Reader, id uint16) *AXFRReader {
+	return &AXFRReader{r: r, id: id}
+}
+
+// SOA returns the SOA record of the transferred zone, once the first record
+// has been read
+func (x *AXFRReader) SOA() *Resource {
+	return x.soa
+}
+
+// Next returns the next record of the zone. The SOA is returned first, and
+// io.EOF once the closing SOA has been read (it is not returned again).
+func (x *AXFRReader) Next() (*Resource, error) {
+	for len(x.rrs) == 0 {
+		if x.done {
+			return nil, io.EOF
+		}
+		msg, err := ReadStreamMessage(x.r)
+		if err != nil {
+			if err == io.EOF {
+				// stream closed before the closing SOA
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if msg.ID != x.id || !msg.Bits.IsResponse() {
+			return nil, ErrXfr
+		}
+		if rc := msg.ExtendedRCode(); rc != NoError {
+			return nil, rc
+		}
+		x.rrs = msg.Answer
+	}
+
+	rr := x.rrs[0]
+	x.rrs = x.rrs[1:]
+	if x.soa == nil {
+		if _, ok := rr.Data.(*RDataSOA); !ok || rr.Type != SOA {
+			return nil, ErrXfr
+		}
+		x.soa = rr
+		return rr, nil
+	}
+	if rr.Type == SOA {
+		soa, ok := rr.Data.(*RDataSOA)
+		if !ok || soa.Serial != x.soa.Data.(*RDataSOA).Serial || !rr.Name.Equal(x.soa.Name) || len(x.rrs) > 0 {
+			// serial changed during the transfer, or records follow the
+			// closing SOA
+			return nil, ErrXfr
+		}
+		x.done = true
+		return nil, io.EOF
+	}
+	return rr, nil
+}
+
+// AXFRWriter writes the records of a zone transfer as response messages of
+// at most MaxSize bytes. Records must start with the SOA of the zone and
+// end with it.
+type AXFRWriter struct {
+	MaxSize int    // maximum message size
+	Base    string // base name for relative record names
+
+	w     io.Writer
+	q     *Message
+	cur   *Message
+	size  int
+	soa   *Resource
+	last  *Resource
+	count int
+	first bool
+}
+
+// NewAXFRWriter returns a writer answering AXFR query q on w
+func NewAXFRWriter(w io.Writer, q *Message) *AXFRWriter {
+	return &AXFRWriter{MaxSize: DefaultAXFRSize, w: w, q: q, first: true}
+}
+
+// Write adds a record to the transfer
+func (x *AXFRWriter) Write(rr *Resource) error {
+	if x.soa == nil {
+		if rr.Type != SOA {
+			return ErrXfr
+		}
+		x.soa = rr
+	}
+
+	// size of the record on its own, compression with previous records
+	// can only make it smaller
+	buf, err := (&Message{Answer: []*Resource{rr}, Base: x.Base}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	n := len(buf) - 12
+
+	if x.cur != nil && x.size+n > x.MaxSize {
+		if err := x.flush(); err != nil {
+			return err
+		}
+	}
+	if x.cur == nil {
+		x.cur = &Message{ID: x.q.ID, Bits: hQResp | hAuth, Base: x.Base}
+		x.size = 12
+		if x.first {
+			// the question is only repeated in the first message
+			for _, q := range x.q.Question {
+				c := *q
+				x.cur.Question = append(x.cur.Question, &c)
+			}
+			qbuf, err := x.cur.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			x.size = len(qbuf)
+			x.first = false
+		}
+	}
+	x.cur.Answer = append(x.cur.Answer, rr)
+	x.size += n
+	x.last = rr
+	x.count += 1
+	return nil
+}
+
+// Close writes the remaining records. The last record written must be the
+// SOA of the zone.
+func (x *AXFRWriter) Close() error {
+	if x.count < 2 || x.last.Type != SOA {
+		return ErrXfr
+	}
+	return x.flush()
+}
+
+func (x *AXFRWriter) flush() error {
+	if x.cur == nil {
+		return nil
+	}
+	err := WriteStreamMessage(x.w, x.cur)
+	x.cur = nil
+	return err
+}
@@ -0,0 +1,61 @@
+package dnsmsg
+
+// RFC 6762 - Multicast DNS
+//
+// mDNS uses the top bit of the class field as a flag: in questions it asks
+// for a unicast response (QU), in records it tells caches to flush other
+// records of the same RRset (cache-flush). The remaining 15 bits are the
+// class. The flag is kept in the Class field so messages round-trip
+// unchanged; the accessors below split it out.
+
+// mdnsFlag is the bit of the class field used by mDNS
+const mdnsFlag Class = 0x8000
+
+// MDNSSplit returns c without the mDNS flag, and whether the flag was set
+func (c Class) MDNSSplit() (Class, bool) {
+	return c &^ mdnsFlag, c&mdnsFlag != 0
+}
+
+// setMDNSFlag returns c with the mDNS flag set to v
+func (c Class) setMDNSFlag(v bool) Class {
+	if v {
+		return c | mdnsFlag
+	}
+	return c &^ mdnsFlag
+}
+
+// MDNSClass returns the class of the question, without the QU flag
+func (q *Question) MDNSClass() Class {
+	c, _ := q.Class.MDNSSplit()
+	return c
+}
+
+// UnicastResponse returns true if the QU flag is set, meaning the querier
+// accepts a unicast response (RFC 6762 section 5.4)
+func (q *Question) UnicastResponse() bool {
+	_, v := q.Class.MDNSSplit()
+	return v
+}
+
+// SetUnicastResponse sets or clears the QU flag of the question
+func (q *Question) SetUnicastResponse(v bool) {
+	q.Class = q.Class.setMDNSFlag(v)
+}
+
+// MDNSClass returns the class of the record, without the cache-flush flag
+func (r *Resource) MDNSClass() Class {
+	c, _ := r.Class.MDNSSplit()
+	return c
+}
+
+// CacheFlush returns true if the cache-flush flag of the record is set
+// (RFC 6762 section 10.2)
+func (r *Resource) CacheFlush() bool {
+	_, v := r.Class.MDNSSplit()
+	return v
+}
+
+// SetCacheFlush sets or clears the cache-flush flag of the record
+func (r *Resource) SetCacheFlush(v bool) {
+	r.Class = r.Class.setMDNSFlag(v)
+}
@@ -1,12 +1,20 @@
 package dnsmsg
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
 )
 
+// EDNS option codes
+const (
+	OptNSID          uint16 = 3  // RFC 5001
+	OptClientSubnet  uint16 = 8  // RFC 7871
+	OptCookie        uint16 = 10 // RFC 7873
+	OptPadding       uint16 = 12 // RFC 7830
+	OptExtendedError uint16 = 15 // RFC 8914
+)
+
 type DnsOpt struct {
 	Code uint16
 	Data []byte
@@ -18,31 +26,148 @@ func (opt *DnsOpt) String() string {
 
 type OptRCode uint32
 
+const optDO OptRCode = 0x8000 // DNSSEC OK flag (RFC 3225)
+
+// DO returns the DNSSEC OK flag (RFC 3225) of the message
+func (m *Message) DO() bool {
+	return m.HasEDNS && m.OptRCode&optDO == optDO
+}
+
+// SetDO sets the DNSSEC OK flag, enabling EDNS if needed
+func (m *Message) SetDO(do bool) {
+	if do {
+		m.HasEDNS = true
+		m.OptRCode |= optDO
+	} else {
+		m.OptRCode &= ^optDO
+	}
+}
+
+// ExtendedRCode returns the 12 bits response code of the message, made of
+// the 4 bits from the header and the upper 8 bits from the OPT record
+func (m *Message) ExtendedRCode() RCode {
+	rc := m.Bits.GetRCode()
+	if m.HasEDNS {
+		rc |= RCode(m.OptRCode>>24) << 4
+	}
+	return rc
+}
+
+// SetExtendedRCode sets the response code of the message, storing the upper
+// bits in the OPT record. EDNS is enabled if the code requires it.
+func (m *Message) SetExtendedRCode(rc RCode) {
+	m.Bits.SetRCode(rc & 0xf)
+	if rc > 0xf {
+		m.HasEDNS = true
+	}
+	m.OptRCode = m.OptRCode&0x00ffffff | OptRCode(rc>>4&0xff)<<24
+}
+
+// EDNSVersion returns the EDNS version of the message
+func (m *Message) EDNSVersion() uint8 {
+	return uint8(m.OptRCode >> 16)
+}
+
+// SetEDNSVersion sets the EDNS version of the message, enabling EDNS
+func (m *Message) SetEDNSVersion(v uint8) {
+	m.HasEDNS = true
+	m.OptRCode = m.OptRCode&0xff00ffff | OptRCode(v)<<16
+}
+
+// NegotiateEDNS sets the EDNS fields of response m to query q following RFC
+// 6891: EDNS is only used if the query used it, with version 0 (the only
+// one supported), the DO flag of the query, no other flag and udpSize as
+// payload size. If the query used a later version, the response code is
+// set to BADVERS and false is returned. q can be m itself.
+func (m *Message) NegotiateEDNS(q *Message, udpSize uint16) bool {
+	if !q.HasEDNS {
+		m.HasEDNS = false
+		m.OptRCode = 0
+		return true
+	}
+	ver, do := q.EDNSVersion(), q.DO()
+
+	m.HasEDNS = true
+	m.ReqUDPSize = udpSize
+	m.OptRCode = 0
+	m.SetDO(do)
+	if ver > 0 {
+		m.SetExtendedRCode(ErrBadVers)
+		return false
+	}
+	return true
+}
+
+// GetOpt returns the first EDNS option matching code, or nil if the message
+// has no such option
+func (m *Message) GetOpt(code uint16) *DnsOpt {
+	for n := range m.Opts {
+		if m.Opts[n].Code == code {
+			return &m.Opts[n]
+		}
+	}
+	return nil
+}
+
+// SetOpt replaces any EDNS option with the same code as opt, and enables EDNS
+// on the message if needed
+func (m *Message) SetOpt(opt DnsOpt) {
+	m.DelOpt(opt.Code)
+	m.Opts = append(m.Opts, opt)
+	m.HasEDNS = true
+}
+
+// DelOpt removes all EDNS options matching code
+func (m *Message) DelOpt(code uint16) {
+	opts := m.Opts[:0]
+	for _, o := range m.Opts {
+		if o.Code != code {
+			opts = append(opts, o)
+		}
+	}
+	m.Opts = opts
+}
+
+// optResource returns the OPT pseudo-RR matching the EDNS fields of the
+// message, for inclusion in the additional section
+func (m *Message) optResource() *Resource {
+	return &Resource{
+		Name:  ".",
+		Type:  OPT,
+		Class: Class(m.ReqUDPSize),
+		TTL:   uint32(m.OptRCode), // extended RCODE, version and flags (DO)
+		Data:  &RDataOPT{Opts: m.Opts},
+	}
+}
+
 type RDataOPT struct {
 	Opts []DnsOpt
 }
 
 func (opt *RDataOPT) decode(c *context, d []byte) error {
-	r := bytes.NewReader(d)
-	var err error
-
-	for r.Len() > 0 {
-		o := &DnsOpt{}
-		var l uint16
-		err = binary.Read(r, binary.BigEndian, &o.Code)
-		if err != nil {
-			return err
+	if c.parser != nil {
+		opt.Opts = c.parser.opts[:0]
+	}
+	for len(d) > 0 {
+		if len(d) < 4 {
+			return io.ErrUnexpectedEOF
 		}
-		err = binary.Read(r, binary.BigEndian, &l)
-		if err != nil {
-			return err
+		o := DnsOpt{Code: binary.BigEndian.Uint16(d)}
+		l := int(binary.BigEndian.Uint16(d[2:]))
+		d = d[4:]
+		if len(d) < l {
+			return io.ErrUnexpectedEOF
 		}
-
-		o.Data = make([]byte, l)
-		_, err = io.ReadFull(r, o.Data)
-		if err != nil {
-			return err
+		if c.parser != nil && c.parser.Borrow {
+			o.Data = d[:l:l]
+		} else {
+			o.Data = append(make([]byte, 0, l), d[:l]...)
 		}
+		d = d[l:]
+		opt.Opts = append(opt.Opts, o)
+	}
+	if c.parser != nil {
+		c.parser.opts = opt.Opts
 	}
 	return nil
 }
@@ -0,0 +1,32 @@
+package dnsmsg
+
+// Block sizes recommended by RFC 8467 for the block-length padding policy
+const (
+	PadQueryBlock    = 128
+	PadResponseBlock = 468
+)
+
+// PadTo adds a padding option (RFC 7830) to the message so its marshaled
+// size is a multiple of blockSize, replacing any existing padding. EDNS is
+// enabled on the message if needed. The message must not be modified after
+// this call, or the padding will be wrong.
+func (m *Message) PadTo(blockSize int) error {
+	if blockSize <= 0 {
+		return ErrInvalidLen
+	}
+	m.DelOpt(OptPadding)
+	hadEDNS := m.HasEDNS
+	m.HasEDNS = true
+
+	buf, err := m.MarshalBinary()
+	if err != nil {
+		m.HasEDNS = hadEDNS
+		return err
+	}
+
+	// padding option header takes 4 bytes
+	l := len(buf) + 4
+	pad := (blockSize - l%blockSize) % blockSize
+	m.Opts = append(m.Opts, DnsOpt{Code: OptPadding, Data: make([]byte, pad)})
+	return nil
+}
@@ -0,0 +1,120 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+// EDNSClientSubnet is the EDNS Client Subnet option (RFC 7871)
+type EDNSClientSubnet struct {
+	Family       uint16 // 1 for IPv4, 2 for IPv6
+	SourcePrefix uint8
+	ScopePrefix  uint8
+	Address      net.IP
+}
+
+// NewClientSubnet returns a client subnet option for the given network
+func NewClientSubnet(n *net.IPNet) *EDNSClientSubnet {
+	ones, _ := n.Mask.Size()
+	if ip4 := n.IP.To4(); ip4 != nil {
+		return &EDNSClientSubnet{Family: 1, SourcePrefix: uint8(ones), Address: ip4}
+	}
+	return &EDNSClientSubnet{Family: 2, SourcePrefix: uint8(ones), Address: n.IP.To16()}
+}
+
+// ParseClientSubnet decodes a client subnet option
+func ParseClientSubnet(opt *DnsOpt) (*EDNSClientSubnet, error) {
+	if opt.Code != OptClientSubnet || len(opt.Data) < 4 {
+		return nil, ErrOptInvalid
+	}
+	ecs := &EDNSClientSubnet{
+		Family:       binary.BigEndian.Uint16(opt.Data[:2]),
+		SourcePrefix: opt.Data[2],
+		ScopePrefix:  opt.Data[3],
+	}
+	addrLen := ecs.addrLen()
+	if addrLen == 0 || int(ecs.SourcePrefix) > addrLen*8 || int(ecs.ScopePrefix) > addrLen*8 {
+		return nil, ErrOptInvalid
+	}
+	addr := opt.Data[4:]
+	if len(addr) != (int(ecs.SourcePrefix)+7)/8 {
+		return nil, ErrOptInvalid
+	}
+
+	ecs.Address = make(net.IP, addrLen)
+	copy(ecs.Address, addr)
+	return ecs, nil
+}
+
+func (ecs *EDNSClientSubnet) addrLen() int {
+	switch ecs.Family {
+	case 1:
+		return net.IPv4len
+	case 2:
+		return net.IPv6len
+	default:
+		return 0
+	}
+}
+
+// Opt encodes the client subnet as an EDNS option. Only the first
+// SourcePrefix bits of the address are kept, as required by the RFC.
+func (ecs *EDNSClientSubnet) Opt() (DnsOpt, error) {
+	addrLen := ecs.addrLen()
+	if addrLen == 0 || int(ecs.SourcePrefix) > addrLen*8 || int(ecs.ScopePrefix) > addrLen*8 {
+		return DnsOpt{}, ErrOptInvalid
+	}
+	var addr net.IP
+	if addrLen == net.IPv4len {
+		addr = ecs.Address.To4()
+	} else {
+		addr = ecs.Address.To16()
+	}
+	if addr == nil {
+		return DnsOpt{}, ErrOptInvalid
+	}
+	addr = addr.Mask(net.CIDRMask(int(ecs.SourcePrefix), addrLen*8))
+
+	data := make([]byte, 4, 4+addrLen)
+	binary.BigEndian.PutUint16(data[:2], ecs.Family)
+	data[2] = ecs.SourcePrefix
+	data[3] = ecs.ScopePrefix
+	data = append(data, addr[:(int(ecs.SourcePrefix)+7)/8]...)
+
+	return DnsOpt{Code: OptClientSubnet, Data: data}, nil
+}
+
+// IPNet returns the source network described by the option
+func (ecs *EDNSClientSubnet) IPNet() *net.IPNet {
+	mask := net.CIDRMask(int(ecs.SourcePrefix), ecs.addrLen()*8)
+	return &net.IPNet{IP: ecs.Address.Mask(mask), Mask: mask}
+}
+
+func (ecs *EDNSClientSubnet) String() string {
+	return ecs.IPNet().String() + "/" + strconv.Itoa(int(ecs.ScopePrefix))
+}
+
+// GetClientSubnet returns the client subnet option of the message, or nil
+// if it has none or it is invalid
+func (m *Message) GetClientSubnet() *EDNSClientSubnet {
+	opt := m.GetOpt(OptClientSubnet)
+	if opt == nil {
+		return nil
+	}
+	ecs, err := ParseClientSubnet(opt)
+	if err != nil {
+		return nil
+	}
+	return ecs
+}
+
+// SetClientSubnet adds or replaces the client subnet option of the message
+func (m *Message) SetClientSubnet(ecs *EDNSClientSubnet) error {
+	opt, err := ecs.Opt()
+	if err != nil {
+		return err
+	}
+	m.SetOpt(opt)
+	return nil
+}
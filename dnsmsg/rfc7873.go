@@ -0,0 +1,68 @@
+package dnsmsg
+
+import "encoding/hex"
+
+// EDNSCookie is the DNS Cookie option (RFC 7873)
+type EDNSCookie struct {
+	Client []byte // client cookie, always 8 bytes
+	Server []byte // server cookie, 8 to 32 bytes if present
+}
+
+// ParseCookie decodes a cookie option
+func ParseCookie(opt *DnsOpt) (*EDNSCookie, error) {
+	if opt.Code != OptCookie {
+		return nil, ErrOptInvalid
+	}
+	l := len(opt.Data)
+	if l != 8 && (l < 16 || l > 40) {
+		return nil, ErrOptInvalid
+	}
+	res := &EDNSCookie{Client: make([]byte, 8)}
+	copy(res.Client, opt.Data)
+	if l > 8 {
+		res.Server = make([]byte, l-8)
+		copy(res.Server, opt.Data[8:])
+	}
+	return res, nil
+}
+
+// Opt encodes the cookie as an EDNS option
+func (c *EDNSCookie) Opt() (DnsOpt, error) {
+	if len(c.Client) != 8 {
+		return DnsOpt{}, ErrOptInvalid
+	}
+	if l := len(c.Server); l != 0 && (l < 8 || l > 32) {
+		return DnsOpt{}, ErrOptInvalid
+	}
+	data := make([]byte, 0, len(c.Client)+len(c.Server))
+	data = append(append(data, c.Client...), c.Server...)
+	return DnsOpt{Code: OptCookie, Data: data}, nil
+}
+
+func (c *EDNSCookie) String() string {
+	return hex.EncodeToString(c.Client) + hex.EncodeToString(c.Server)
+}
+
+// GetCookie returns the cookie option of the message, or nil if it has none
+// or it is invalid
+func (m *Message) GetCookie() *EDNSCookie {
+	opt := m.GetOpt(OptCookie)
+	if opt == nil {
+		return nil
+	}
+	c, err := ParseCookie(opt)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// SetCookie adds or replaces the cookie option of the message
+func (m *Message) SetCookie(c *EDNSCookie) error {
+	opt, err := c.Opt()
+	if err != nil {
+		return err
+	}
+	m.SetOpt(opt)
+	return nil
+}
@@ -0,0 +1,301 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// DNS messages in JSON (RFC 8427)
+//
+// Records are encoded with their RDATA in presentation format in a member
+// named after the type (rdataA, rdataMX, ...), or as RDATAHEX for types
+// without presentation format support. The lossless mode adds members that
+// are not part of RFC 8427 so that the message can be rebuilt exactly: EDNS
+// data, which RFC 8427 does not cover, and unknown RDATA as base64
+// (RDATAB64) instead of hex.
+
+// header bits used by RFC 8427 that have no accessors
+const (
+	hAuthData HeaderBits = 0x0020 // AD, RFC 4035
+	hChkDis   HeaderBits = 0x0010 // CD, RFC 4035
+)
+
+type jsonQuestion struct {
+	NAME      Name
+	TYPE      Type
+	TYPEname  string `json:",omitempty"`
+	CLASS     Class
+	CLASSname string `json:",omitempty"`
+}
+
+type jsonEDNS struct {
+	UDPSIZE uint16
+	FLAGS   OptRCode  // extended RCODE, version and flags
+	OPTIONS []jsonOpt `json:",omitempty"`
+}
+
+type jsonOpt struct {
+	CODE uint16
+	DATA []byte // base64
+}
+
+type jsonMessage struct {
+	ID      uint16
+	QR      int
+	Opcode  OpCode
+	AA      int
+	TC      int
+	RD      int
+	RA      int
+	AD      int
+	CD      int
+	RCODE   RCode
+	QDCOUNT int
+	ANCOUNT int
+	NSCOUNT int
+	ARCOUNT int
+
+	QuestionRRs   []*Question `json:"questionRRs,omitempty"`
+	AnswerRRs     []*Resource `json:"answerRRs,omitempty"`
+	AuthorityRRs  []*Resource `json:"authorityRRs,omitempty"`
+	AdditionalRRs []*Resource `json:"additionalRRs,omitempty"`
+
+	// single question form
+	QNAME  Name  `json:",omitempty"`
+	QTYPE  Type  `json:",omitempty"`
+	QCLASS Class `json:",omitempty"`
+
+	EDNS *jsonEDNS `json:",omitempty"` // lossless mode only
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// MarshalJSON encodes the message following RFC 8427
+func (m *Message) MarshalJSON() ([]byte, error) {
+	return m.marshalJSON(false)
+}
+
+// MarshalJSONLossless encodes the message following RFC 8427 with
+// extensions keeping EDNS data and unknown RDATA as base64, so that
+// UnmarshalJSON returns an identical message
+func (m *Message) MarshalJSONLossless() ([]byte, error) {
+	return m.marshalJSON(true)
+}
+
+func (m *Message) marshalJSON(lossless bool) ([]byte, error) {
+	j := &jsonMessage{
+		ID:            m.ID,
+		QR:            boolInt(m.Bits.IsResponse()),
+		Opcode:        m.Bits.OpCode(),
+		AA:            boolInt(m.Bits.IsAuth()),
+		TC:            boolInt(m.Bits.IsTrunc()),
+		RD:            boolInt(m.Bits.IsRecDesired()),
+		RA:            boolInt(m.Bits.IsRecAvailable()),
+		AD:            boolInt(m.Bits&hAuthData != 0),
+		CD:            boolInt(m.Bits&hChkDis != 0),
+		RCODE:         m.Bits.GetRCode(),
+		QDCOUNT:       len(m.Question),
+		ANCOUNT:       len(m.Answer),
+		NSCOUNT:       len(m.Authority),
+		ARCOUNT:       len(m.Additional),
+		QuestionRRs:   m.Question,
+		AnswerRRs:     m.Answer,
+		AuthorityRRs:  m.Authority,
+		AdditionalRRs: m.Additional,
+	}
+	if m.HasEDNS {
+		j.ARCOUNT += 1
+		if lossless {
+			j.EDNS = &jsonEDNS{UDPSIZE: m.ReqUDPSize, FLAGS: m.OptRCode}
+			for _, o := range m.Opts {
+				j.EDNS.OPTIONS = append(j.EDNS.OPTIONS, jsonOpt{CODE: o.Code, DATA: o.Data})
+			}
+		}
+	}
+
+	if !lossless {
+		return json.Marshal(j)
+	}
+
+	// resources need to know about the mode
+	type losslessMessage struct {
+		*jsonMessage
+		AnswerRRs     []losslessResource `json:"answerRRs,omitempty"`
+		AuthorityRRs  []losslessResource `json:"authorityRRs,omitempty"`
+		AdditionalRRs []losslessResource `json:"additionalRRs,omitempty"`
+	}
+	return json.Marshal(&losslessMessage{
+		jsonMessage:   j,
+		AnswerRRs:     losslessResources(m.Answer),
+		AuthorityRRs:  losslessResources(m.Authority),
+		AdditionalRRs: losslessResources(m.Additional),
+	})
+}
+
+// UnmarshalJSON decodes a message encoded following RFC 8427, including the
+// lossless extensions
+func (m *Message) UnmarshalJSON(b []byte) error {
+	j := &jsonMessage{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return err
+	}
+
+	*m = Message{
+		ID:         j.ID,
+		Question:   j.QuestionRRs,
+		Answer:     j.AnswerRRs,
+		Authority:  j.AuthorityRRs,
+		Additional: j.AdditionalRRs,
+	}
+	m.Bits.SetResponse(j.QR != 0)
+	m.Bits.SetOpCode(j.Opcode)
+	m.Bits.SetAuth(j.AA != 0)
+	m.Bits.SetTrunc(j.TC != 0)
+	m.Bits.SetRecDesired(j.RD != 0)
+	m.Bits.SetRecAvailable(j.RA != 0)
+	if j.AD != 0 {
+		m.Bits |= hAuthData
+	}
+	if j.CD != 0 {
+		m.Bits |= hChkDis
+	}
+	m.Bits.SetRCode(j.RCODE & 0xf)
+
+	if m.Question == nil && j.QNAME != "" {
+		m.Question = []*Question{{Name: j.QNAME, Type: j.QTYPE, Class: j.QCLASS}}
+	}
+
+	if j.EDNS != nil {
+		m.HasEDNS = true
+		m.ReqUDPSize = j.EDNS.UDPSIZE
+		m.OptRCode = j.EDNS.FLAGS
+		for _, o := range j.EDNS.OPTIONS {
+			m.Opts = append(m.Opts, DnsOpt{Code: o.CODE, Data: o.DATA})
+		}
+	}
+	return nil
+}
+
+func (q *Question) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonQuestion{
+		NAME:      q.Name,
+		TYPE:      q.Type,
+		TYPEname:  q.Type.text(),
+		CLASS:     q.Class,
+		CLASSname: q.Class.text(),
+	})
+}
+
+func (q *Question) UnmarshalJSON(b []byte) error {
+	j := &jsonQuestion{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return err
+	}
+	*q = Question{Name: j.NAME, Type: j.TYPE, Class: j.CLASS}
+	return nil
+}
+
+// losslessResource is a Resource encoded in lossless mode
+type losslessResource struct {
+	*Resource
+}
+
+func (r losslessResource) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(true)
+}
+
+func losslessResources(rrs []*Resource) []losslessResource {
+	res := make([]losslessResource, len(rrs))
+	for i, rr := range rrs {
+		res[i] = losslessResource{rr}
+	}
+	return res
+}
+
+func (r *Resource) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(false)
+}
+
+func (r *Resource) marshalJSON(lossless bool) ([]byte, error) {
+	obj := map[string]any{
+		"NAME":      r.Name,
+		"TYPE":      r.Type,
+		"TYPEname":  r.Type.text(),
+		"CLASS":     r.Class,
+		"CLASSname": r.Class.text(),
+		"TTL":       r.TTL,
+	}
+	switch rd := r.Data.(type) {
+	case nil:
+	case *RDataRaw:
+		if lossless {
+			obj["RDATAB64"] = base64.StdEncoding.EncodeToString(rd.Data)
+		} else {
+			obj["RDATAHEX"] = strings.ToUpper(hex.EncodeToString(rd.Data))
+		}
+	default:
+		obj["rdata"+r.Type.text()] = rd.String()
+	}
+	return json.Marshal(obj)
+}
+
+func (r *Resource) UnmarshalJSON(b []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+
+	*r = Resource{}
+	for k, dst := range map[string]any{"NAME": &r.Name, "TYPE": &r.Type, "CLASS": &r.Class, "TTL": &r.TTL} {
+		v, ok := obj[k]
+		if !ok {
+			if k == "TTL" {
+				continue
+			}
+			return ErrInvalidJSON
+		}
+		if err := json.Unmarshal(v, dst); err != nil {
+			return err
+		}
+	}
+
+	var s string
+	if v, ok := obj["rdata"+r.Type.text()]; ok {
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		rd, err := RDataFromString(r.Type, s)
+		if err != nil {
+			return err
+		}
+		r.Data = rd
+		return nil
+	}
+
+	var data []byte
+	var err error
+	if v, ok := obj["RDATAB64"]; ok {
+		if err = json.Unmarshal(v, &s); err == nil {
+			data, err = base64.StdEncoding.DecodeString(s)
+		}
+	} else if v, ok := obj["RDATAHEX"]; ok {
+		if err = json.Unmarshal(v, &s); err == nil {
+			data, err = hex.DecodeString(s)
+		}
+	} else {
+		// no RDATA, as in the records of an update deleting RRsets
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.Data = &RDataRaw{Data: data, Type: r.Type}
+	return nil
+}
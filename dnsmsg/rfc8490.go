@@ -0,0 +1,117 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// RFC 8490 - DNS Stateful Operations
+//
+// DSO messages have all section counts set to zero, and carry a list of
+// TLVs after the header instead: the primary TLV first (for requests and
+// unidirectional messages), followed by additional TLVs.
+
+// DSO TLV types
+const (
+	DSOKeepAlive         uint16 = 1
+	DSORetryDelay        uint16 = 2
+	DSOEncryptionPadding uint16 = 3
+)
+
+// DSOTLV is a TLV of a DSO message
+type DSOTLV struct {
+	Type uint16
+	Data []byte
+}
+
+// NewDSOKeepAlive returns a Keepalive TLV (RFC 8490 section 7.1) with the
+// given inactivity timeout and keepalive interval, in milliseconds on the
+// wire
+func NewDSOKeepAlive(inactivity, interval time.Duration) DSOTLV {
+	data := binary.BigEndian.AppendUint32(nil, uint32(inactivity.Milliseconds()))
+	data = binary.BigEndian.AppendUint32(data, uint32(interval.Milliseconds()))
+	return DSOTLV{Type: DSOKeepAlive, Data: data}
+}
+
+// ParseDSOKeepAlive returns the inactivity timeout and keepalive interval of
+// a Keepalive TLV
+func ParseDSOKeepAlive(tlv *DSOTLV) (inactivity, interval time.Duration, err error) {
+	if tlv.Type != DSOKeepAlive || len(tlv.Data) != 8 {
+		return 0, 0, ErrDSO
+	}
+	inactivity = time.Duration(binary.BigEndian.Uint32(tlv.Data)) * time.Millisecond
+	interval = time.Duration(binary.BigEndian.Uint32(tlv.Data[4:])) * time.Millisecond
+	return
+}
+
+// NewDSORetryDelay returns a Retry Delay TLV (RFC 8490 section 7.2) asking
+// the client to wait d before reconnecting
+func NewDSORetryDelay(d time.Duration) DSOTLV {
+	return DSOTLV{Type: DSORetryDelay, Data: binary.BigEndian.AppendUint32(nil, uint32(d.Milliseconds()))}
+}
+
+// ParseDSORetryDelay returns the delay of a Retry Delay TLV
+func ParseDSORetryDelay(tlv *DSOTLV) (time.Duration, error) {
+	if tlv.Type != DSORetryDelay || len(tlv.Data) != 4 {
+		return 0, ErrDSO
+	}
+	return time.Duration(binary.BigEndian.Uint32(tlv.Data)) * time.Millisecond, nil
+}
+
+// NewDSOPadding returns an Encryption Padding TLV (RFC 8490 section 7.3)
+// of n bytes
+func NewDSOPadding(n int) DSOTLV {
+	return DSOTLV{Type: DSOEncryptionPadding, Data: make([]byte, n)}
+}
+
+// NewDSO returns a DSO request with the given TLVs, the first one being the
+// primary TLV. Unidirectional messages must have their ID set to zero.
+func NewDSO(tlvs ...DSOTLV) *Message {
+	msg := New()
+	msg.Bits.SetOpCode(DSO)
+	msg.DSO = tlvs
+	return msg
+}
+
+// PrimaryTLV returns the primary TLV of a DSO request, or nil if there is
+// none. In responses, the first TLV is only a response primary TLV if it has
+// the same type as the request primary TLV.
+func (m *Message) PrimaryTLV() *DSOTLV {
+	if m.Bits.OpCode() != DSO || len(m.DSO) == 0 {
+		return nil
+	}
+	return &m.DSO[0]
+}
+
+// parseDSO reads the TLVs following the header of a DSO message
+func (c *context) parseDSO() ([]DSOTLV, error) {
+	var res []DSOTLV
+	for c.rpos < len(c.rawMsg) {
+		if c.rpos+4 > len(c.rawMsg) {
+			return nil, ErrInvalidLen
+		}
+		tlv := DSOTLV{Type: binary.BigEndian.Uint16(c.rawMsg[c.rpos:])}
+		l := int(binary.BigEndian.Uint16(c.rawMsg[c.rpos+2:]))
+		c.rpos += 4
+		if c.rpos+l > len(c.rawMsg) {
+			return nil, ErrInvalidLen
+		}
+		tlv.Data = c.rawMsg[c.rpos : c.rpos+l]
+		c.rpos += l
+		res = append(res, tlv)
+	}
+	return res, nil
+}
+
+// encodeDSO appends the TLVs of a DSO message
+func (m *Message) encodeDSO(c *context) error {
+	for _, tlv := range m.DSO {
+		if len(tlv.Data) > 0xffff {
+			return ErrInvalidLen
+		}
+		c.rawMsg = binary.BigEndian.AppendUint16(c.rawMsg, tlv.Type)
+		c.rawMsg = binary.BigEndian.AppendUint16(c.rawMsg, uint16(len(tlv.Data)))
+		c.rawMsg = append(c.rawMsg, tlv.Data...)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ExtendedErrorCode is an Extended DNS Error INFO-CODE (RFC 8914)
+type ExtendedErrorCode uint16
+
+const (
+	EDEOther                       ExtendedErrorCode = 0
+	EDEUnsupportedDNSKEYAlgorithm  ExtendedErrorCode = 1
+	EDEUnsupportedDSDigestType     ExtendedErrorCode = 2
+	EDEStaleAnswer                 ExtendedErrorCode = 3
+	EDEForgedAnswer                ExtendedErrorCode = 4
+	EDEDNSSECIndeterminate         ExtendedErrorCode = 5
+	EDEDNSSECBogus                 ExtendedErrorCode = 6
+	EDESignatureExpired            ExtendedErrorCode = 7
+	EDESignatureNotYetValid        ExtendedErrorCode = 8
+	EDEDNSKEYMissing               ExtendedErrorCode = 9
+	EDERRSIGsMissing               ExtendedErrorCode = 10
+	EDENoZoneKeyBitSet             ExtendedErrorCode = 11
+	EDENSECMissing                 ExtendedErrorCode = 12
+	EDECachedError                 ExtendedErrorCode = 13
+	EDENotReady                    ExtendedErrorCode = 14
+	EDEBlocked                     ExtendedErrorCode = 15
+	EDECensored                    ExtendedErrorCode = 16
+	EDEFiltered                    ExtendedErrorCode = 17
+	EDEProhibited                  ExtendedErrorCode = 18
+	EDEStaleNXDomainAnswer         ExtendedErrorCode = 19
+	EDENotAuthoritative            ExtendedErrorCode = 20
+	EDENotSupported                ExtendedErrorCode = 21
+	EDENoReachableAuthority        ExtendedErrorCode = 22
+	EDENetworkError                ExtendedErrorCode = 23
+	EDEInvalidData                 ExtendedErrorCode = 24
+	EDESignatureExpiredBeforeValid ExtendedErrorCode = 25 // RFC 9077
+	EDETooEarly                    ExtendedErrorCode = 26 // RFC 9250
+	EDEUnsupportedNSEC3Iterations  ExtendedErrorCode = 27 // RFC 9276
+	EDEUnableToConformToPolicy     ExtendedErrorCode = 28
+	EDESynthesized                 ExtendedErrorCode = 29
+	EDEInvalidQueryType            ExtendedErrorCode = 30
+)
+
+var edeNames = [...]string{
+	"Other Error",
+	"Unsupported DNSKEY Algorithm",
+	"Unsupported DS Digest Type",
+	"Stale Answer",
+	"Forged Answer",
+	"DNSSEC Indeterminate",
+	"DNSSEC Bogus",
+	"Signature Expired",
+	"Signature Not Yet Valid",
+	"DNSKEY Missing",
+	"RRSIGs Missing",
+	"No Zone Key Bit Set",
+	"NSEC Missing",
+	"Cached Error",
+	"Not Ready",
+	"Blocked",
+	"Censored",
+	"Filtered",
+	"Prohibited",
+	"Stale NXDomain Answer",
+	"Not Authoritative",
+	"Not Supported",
+	"No Reachable Authority",
+	"Network Error",
+	"Invalid Data",
+	"Signature Expired before Valid",
+	"Too Early",
+	"Unsupported NSEC3 Iterations Value",
+	"Unable to conform to policy",
+	"Synthesized",
+	"Invalid Query Type",
+}
+
+func (c ExtendedErrorCode) String() string {
+	if int(c) < len(edeNames) {
+		return edeNames[c]
+	}
+	return "EDE(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// ExtendedError is the Extended DNS Error option (RFC 8914)
+type ExtendedError struct {
+	InfoCode  ExtendedErrorCode
+	ExtraText string // optional UTF-8 text for humans
+}
+
+// ParseExtendedError decodes an extended error option
+func ParseExtendedError(opt *DnsOpt) (*ExtendedError, error) {
+	if opt.Code != OptExtendedError || len(opt.Data) < 2 {
+		return nil, ErrOptInvalid
+	}
+	txt := opt.Data[2:]
+	if len(txt) > 0 && txt[len(txt)-1] == 0 {
+		// some implementations NUL terminate the text
+		txt = txt[:len(txt)-1]
+	}
+	if !utf8.Valid(txt) {
+		return nil, ErrOptInvalid
+	}
+	return &ExtendedError{
+		InfoCode:  ExtendedErrorCode(binary.BigEndian.Uint16(opt.Data[:2])),
+		ExtraText: string(txt),
+	}, nil
+}
+
+// Opt encodes the extended error as an EDNS option
+func (e *ExtendedError) Opt() DnsOpt {
+	data := make([]byte, 2, 2+len(e.ExtraText))
+	binary.BigEndian.PutUint16(data, uint16(e.InfoCode))
+	data = append(data, e.ExtraText...)
+	return DnsOpt{Code: OptExtendedError, Data: data}
+}
+
+func (e *ExtendedError) String() string {
+	res := strconv.FormatUint(uint64(e.InfoCode), 10) + " (" + e.InfoCode.String() + ")"
+	if e.ExtraText != "" {
+		res += ": " + e.ExtraText
+	}
+	return res
+}
+
+// AddExtendedError appends an extended error to the message. A message can
+// carry more than one extended error.
+func (m *Message) AddExtendedError(code ExtendedErrorCode, text string) {
+	e := &ExtendedError{InfoCode: code, ExtraText: text}
+	m.Opts = append(m.Opts, e.Opt())
+	m.HasEDNS = true
+}
+
+// ExtendedErrors returns all valid extended errors found in the message
+func (m *Message) ExtendedErrors() []*ExtendedError {
+	var res []*ExtendedError
+	for n := range m.Opts {
+		if m.Opts[n].Code != OptExtendedError {
+			continue
+		}
+		if e, err := ParseExtendedError(&m.Opts[n]); err == nil {
+			res = append(res, e)
+		}
+	}
+	return res
+}
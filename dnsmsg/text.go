@@ -0,0 +1,143 @@
+package dnsmsg
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helpers for the presentation format of RDATA (RFC 1035 section 5.1)
+
+var errBadString = errors.New("invalid character string")
+
+// splitFields splits s on white space. Quoted strings form a single field,
+// returned without quotes and with \X and \DDD escapes resolved.
+func splitFields(s string) ([]string, error) {
+	var res []string
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return res, nil
+		}
+		if s[0] != '"' {
+			p := strings.IndexAny(s, " \t\r\n")
+			if p == -1 {
+				p = len(s)
+			}
+			res = append(res, s[:p])
+			s = s[p:]
+			continue
+		}
+
+		var buf []byte
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] != '\\' {
+				buf = append(buf, s[i])
+				continue
+			}
+			i++
+			switch {
+			case i == len(s):
+				return nil, errBadString
+			case s[i] >= '0' && s[i] <= '9':
+				if i+3 > len(s) {
+					return nil, errBadString
+				}
+				v, err := strconv.ParseUint(s[i:i+3], 10, 8)
+				if err != nil {
+					return nil, errBadString
+				}
+				buf = append(buf, byte(v))
+				i += 2
+			default:
+				buf = append(buf, s[i])
+			}
+		}
+		if i == len(s) {
+			return nil, errBadString
+		}
+		res = append(res, string(buf))
+		s = s[i+1:]
+	}
+}
+
+// quoteString returns s as a quoted character string, escaping quotes,
+// backslashes and non printable bytes
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			b.WriteByte('\\')
+			if c < 100 {
+				b.WriteByte('0')
+			}
+			if c < 10 {
+				b.WriteByte('0')
+			}
+			b.WriteString(strconv.Itoa(int(c)))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// appendCharString appends s to buf as a length prefixed character string
+func appendCharString(buf []byte, s string) ([]byte, error) {
+	if len(s) > 255 {
+		return buf, ErrInvalidLen
+	}
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...), nil
+}
+
+// readCharString reads a length prefixed character string from d
+func readCharString(d []byte) (string, []byte, error) {
+	if len(d) < 1 || len(d) < int(d[0])+1 {
+		return "", nil, ErrInvalidLen
+	}
+	return string(d[1 : d[0]+1]), d[d[0]+1:], nil
+}
+
+// parseUint8 and friends parse numeric RDATA fields
+func parseUint8(s string) (uint8, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	return uint8(v), err
+}
+
+func parseUint16(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 10, 16)
+	return uint16(v), err
+}
+
+func parseUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
+
+const sigTimeFormat = "20060102150405"
+
+// parseSigTime parses a RRSIG time, either as YYYYMMDDHHmmSS or as a number
+// of seconds since the epoch (RFC 4034 section 3.2)
+func parseSigTime(s string) (uint32, error) {
+	if len(s) == len(sigTimeFormat) {
+		t, err := time.Parse(sigTimeFormat, s)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(t.Unix()), nil
+	}
+	return parseUint32(s)
+}
+
+func formatSigTime(v uint32) string {
+	return time.Unix(int64(v), 0).UTC().Format(sigTimeFormat)
+}
@@ -0,0 +1,82 @@
+package dnsmsg
+
+// TruncatePolicy selects which records Truncate drops first
+type TruncatePolicy int
+
+const (
+	// TruncateAdditionalFirst drops additional records first, then
+	// authority and answer records
+	TruncateAdditionalFirst TruncatePolicy = iota
+	// TruncateAnswerFirst drops answer records first, then authority and
+	// additional records
+	TruncateAnswerFirst
+)
+
+// Truncate drops records from the message until it fits in maxSize bytes in
+// wire format, one RRset at a time starting from the end of each section, so
+// that an RRset is never split. The TC bit is set if answer or authority
+// records had to be dropped (RFC 2181 section 9), but not for additional
+// records. The OPT record is kept.
+//
+// Truncate returns the wire size of the message after truncation, which can
+// still exceed maxSize if the message does not fit without any record.
+func (m *Message) Truncate(maxSize int, policy TruncatePolicy) (int, error) {
+	sections := []*[]*Resource{&m.Additional, &m.Authority, &m.Answer}
+	if policy == TruncateAnswerFirst {
+		sections = []*[]*Resource{&m.Answer, &m.Authority, &m.Additional}
+	}
+
+	sizes := make(map[*Resource]int)
+	for {
+		buf, err := m.marshal(sizes)
+		if err != nil {
+			return 0, err
+		}
+		if len(buf) <= maxSize {
+			return len(buf), nil
+		}
+
+		// drop RRsets until the sizes measured above fit, then check the
+		// message again as names of the remaining records may have been
+		// compressed against the dropped ones
+		size := len(buf)
+		for size > maxSize {
+			var s *[]*Resource
+			for _, s = range sections {
+				if len(*s) > 0 {
+					break
+				}
+			}
+			if len(*s) == 0 {
+				break
+			}
+			var dropped []*Resource
+			*s, dropped = dropLastRRSet(*s)
+			for _, rr := range dropped {
+				size -= sizes[rr]
+			}
+			if s != &m.Additional {
+				m.Bits.SetTrunc(true)
+			}
+		}
+		if size == len(buf) {
+			// nothing left to drop
+			return len(buf), nil
+		}
+	}
+}
+
+// dropLastRRSet removes the records of the same RRset as the last record,
+// and returns them
+func dropLastRRSet(rrs []*Resource) (res, dropped []*Resource) {
+	last := rrs[len(rrs)-1]
+	res = rrs[:0]
+	for _, rr := range rrs {
+		if rr.Type != last.Type || rr.Class != last.Class || !rr.Name.Equal(last.Name) {
+			res = append(res, rr)
+		} else {
+			dropped = append(dropped, rr)
+		}
+	}
+	return res, dropped
+}
@@ -1,5 +1,11 @@
 package dnsmsg
 
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
 //go:generate stringer -type=Type
 
 type Type uint16
@@ -48,17 +54,19 @@ const (
 	NSEC   Type = 47
 	DNSKEY Type = 48
 
-	DHCID      Type = 49 // RFC 4701
-	NSEC3      Type = 50 // RFC 5155
-	NSEC3PARAM Type = 51 // RFC 5155
-	TLSA       Type = 52 // RFC 6698
-	SMIMEA     Type = 53 // RFC 8162
-	HIP        Type = 55 // RFC 8005
-	CDS        Type = 59 // RFC 7344
-	CDNSKEY    Type = 60 // RFC 7344
-	OPENPGPKEY Type = 61 // RFC 7929
-	CSYNC      Type = 62 // RFC 7477
-	ZONEMD     Type = 63 // TBA (draft)
+	DHCID      Type = 49  // RFC 4701
+	NSEC3      Type = 50  // RFC 5155
+	NSEC3PARAM Type = 51  // RFC 5155
+	TLSA       Type = 52  // RFC 6698
+	SMIMEA     Type = 53  // RFC 8162
+	HIP        Type = 55  // RFC 8005
+	CDS        Type = 59  // RFC 7344
+	CDNSKEY    Type = 60  // RFC 7344
+	OPENPGPKEY Type = 61  // RFC 7929
+	CSYNC      Type = 62  // RFC 7477
+	ZONEMD     Type = 63  // RFC 8976
+	EUI48      Type = 108 // RFC 7043
+	EUI64      Type = 109 // RFC 7043
 
 	TKEY Type = 249 // RFC 2930
 	TSIG Type = 250 // RFC 7553
@@ -75,3 +83,39 @@ const (
 	TA  Type = 32768 // DNSSEC Trust Authorities
 	DLV Type = 32769 // RFC 4431
 )
+
+var (
+	typeByName     map[string]Type
+	typeByNameOnce sync.Once
+)
+
+// ParseType returns the Type matching the given name (case insensitive),
+// including the generic TYPEnnn form from RFC 3597
+func ParseType(s string) (Type, error) {
+	typeByNameOnce.Do(func() {
+		typeByName = make(map[string]Type, len(_Type_map))
+		for t, n := range _Type_map {
+			typeByName[n] = t
+		}
+	})
+
+	s = strings.ToUpper(s)
+	if t, ok := typeByName[s]; ok {
+		return t, nil
+	}
+	if v, ok := strings.CutPrefix(s, "TYPE"); ok {
+		if n, err := strconv.ParseUint(v, 10, 16); err == nil {
+			return Type(n), nil
+		}
+	}
+	return 0, ErrNotSupport
+}
+
+// text returns the presentation form of t, using the generic TYPEnnn form
+// of RFC 3597 for unknown types
+func (t Type) text() string {
+	if s, ok := _Type_map[t]; ok {
+		return s
+	}
+	return "TYPE" + strconv.FormatUint(uint64(t), 10)
+}
@@ -54,6 +54,8 @@ func _() {
 	_ = x[OPENPGPKEY-61]
 	_ = x[CSYNC-62]
 	_ = x[ZONEMD-63]
+	_ = x[EUI48-108]
+	_ = x[EUI64-109]
 	_ = x[TKEY-249]
 	_ = x[TSIG-250]
 	_ = x[IXFR-251]
@@ -67,7 +69,7 @@ func _() {
 	_ = x[DLV-32769]
 }
 
-const _Type_name = "ANSMDMFCNAMESOAMBMGMRNULLWKSPTRHINFOMINFOMXTXTRPAFSDBSIGKEYAAAALOCSRVNAPTRKXCERTDNAMEOPTAPLDSSSHFPPSECKEYRRSIGNSECDNSKEYDHCIDNSEC3NSEC3PARAMTLSASMIMEAHIPCDSCDNSKEYOPENPGPKEYCSYNCZONEMDTKEYTSIGIXFRAXFRMAILBMAILAANYURICAATADLV"
+const _Type_name = "ANSMDMFCNAMESOAMBMGMRNULLWKSPTRHINFOMINFOMXTXTRPAFSDBSIGKEYAAAALOCSRVNAPTRKXCERTDNAMEOPTAPLDSSSHFPPSECKEYRRSIGNSECDNSKEYDHCIDNSEC3NSEC3PARAMTLSASMIMEAHIPCDSCDNSKEYOPENPGPKEYCSYNCZONEMDEUI48EUI64TKEYTSIGIXFRAXFRMAILBMAILAANYURICAATADLV"
 
 var _Type_map = map[Type]string{
 	1:     _Type_name[0:1],
@@ -116,17 +118,19 @@ var _Type_map = map[Type]string{
 	61:    _Type_name[163:173],
 	62:    _Type_name[173:178],
 	63:    _Type_name[178:184],
-	249:   _Type_name[184:188],
-	250:   _Type_name[188:192],
-	251:   _Type_name[192:196],
-	252:   _Type_name[196:200],
-	253:   _Type_name[200:205],
-	254:   _Type_name[205:210],
-	255:   _Type_name[210:213],
-	256:   _Type_name[213:216],
-	257:   _Type_name[216:219],
-	32768: _Type_name[219:221],
-	32769: _Type_name[221:224],
+	108:   _Type_name[184:189],
+	109:   _Type_name[189:194],
+	249:   _Type_name[194:198],
+	250:   _Type_name[198:202],
+	251:   _Type_name[202:206],
+	252:   _Type_name[206:210],
+	253:   _Type_name[210:215],
+	254:   _Type_name[215:220],
+	255:   _Type_name[220:223],
+	256:   _Type_name[223:226],
+	257:   _Type_name[226:229],
+	32768: _Type_name[229:231],
+	32769: _Type_name[231:234],
 }
 
 func (i Type) String() string {
@@ -0,0 +1,246 @@
+package dnsmsg
+
+import (
+	"bufio"
+	"io"
+)
+
+// XFROp tells what the records of a XFRSet are
+type XFROp int
+
+const (
+	XFRZone   XFROp = iota // records of the zone, from a full transfer
+	XFRDelete              // records deleted by an incremental transfer
+	XFRAdd                 // records added by an incremental transfer
+)
+
+func (op XFROp) String() string {
+	switch op {
+	case XFRZone:
+		return "zone"
+	case XFRDelete:
+		return "delete"
+	case XFRAdd:
+		return "add"
+	default:
+		return "unknown"
+	}
+}
+
+// XFRSet is a RRset of a zone transfer
+type XFRSet struct {
+	Op      XFROp
+	Serial  uint32 // serial of the zone version the records are deleted from or added to
+	Records []*Resource
+}
+
+// xfr reader states
+const (
+	xfrStart  = iota // expecting the opening SOA
+	xfrFirst         // expecting the first record after the opening SOA
+	xfrFull          // reading the records of a full transfer
+	xfrDelete        // reading the records deleted from a version
+	xfrAdd           // reading the records added to a version
+)
+
+// XFRReader reads the response to an AXFR or IXFR query from a stream one
+// RRset at a time, so large zones can be transferred without holding them
+// in memory. It checks that records are enclosed in the SOA of the zone, that
+// the SOA serial does not change during the transfer and that incremental
+// differences follow each other from the version of the client.
+type XFRReader struct {
+	r      io.Reader
+	id     uint16
+	ixfr   bool
+	serial uint32 // version of the client, for IXFR
+	state  int
+	soa    *Resource
+	cur    uint32 // serial of the version being read
+	incr   bool
+	msgs   int
+	rrs    []*Resource
+	next   *XFRSet // RRset read ahead
+}
+
+// NewXFRReader returns a reader for the response to q, an AXFR query or an
+// IXFR query returned by NewIXFRQuery, read from r
+func NewXFRReader(r io.Reader, q *Message) *XFRReader {
+	x := &XFRReader{r: r, id: q.ID}
+	if len(q.Question) == 1 && q.Question[0].Type == IXFR {
+		x.ixfr = true
+		if len(q.Authority) == 1 {
+			x.serial, _ = soaSerial(q.Authority[0])
+		}
+	}
+	return x
+}
+
+// SOA returns the SOA record of the transferred version of the zone, once
+// the first RRset has been read
+func (x *XFRReader) SOA() *Resource {
+	return x.soa
+}
+
+// Incremental returns true if the server sent differences rather than the
+// whole zone. It is only meaningful once the first RRset has been read.
+func (x *XFRReader) Incremental() bool {
+	return x.incr
+}
+
+// Next returns the next RRset of the transfer, or io.EOF once the closing
+// SOA has been read. A response telling an IXFR client it is up to date has
+// no RRset.
+func (x *XFRReader) Next() (*XFRSet, error) {
+	set := x.next
+	x.next = nil
+	for {
+		rr, op, serial, err := x.nextRecord()
+		if err == io.EOF && set != nil {
+			return set, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if set != nil {
+			first := set.Records[0]
+			if op != set.Op || serial != set.Serial || rr.Type != first.Type || rr.Class != first.Class || !rr.Name.Equal(first.Name) {
+				x.next = &XFRSet{Op: op, Serial: serial, Records: []*Resource{rr}}
+				return set, nil
+			}
+			set.Records = append(set.Records, rr)
+			continue
+		}
+		set = &XFRSet{Op: op, Serial: serial, Records: []*Resource{rr}}
+	}
+}
+
+// read returns the next record of the stream
+func (x *XFRReader) read() (*Resource, error) {
+	for len(x.rrs) == 0 {
+		msg, err := ReadStreamMessage(x.r)
+		if err != nil {
+			if err == io.EOF {
+				// stream closed before the closing SOA
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if msg.ID != x.id || !msg.Bits.IsResponse() {
+			return nil, ErrXfr
+		}
+		if rc := msg.ExtendedRCode(); rc != NoError {
+			return nil, rc
+		}
+		x.rrs = msg.Answer
+		x.msgs += 1
+	}
+	rr := x.rrs[0]
+	x.rrs = x.rrs[1:]
+	return rr, nil
+}
+
+// end checks the closing SOA is the last record of the stream
+func (x *XFRReader) end() error {
+	if len(x.rrs) > 0 {
+		return ErrXfr
+	}
+	x.state = -1
+	return io.EOF
+}
+
+// nextRecord returns the next record that is not a SOA marking the start or
+// end of the transfer or of a difference sequence, with what it is for
+func (x *XFRReader) nextRecord() (*Resource, XFROp, uint32, error) {
+	if x.state < 0 {
+		return nil, 0, 0, io.EOF
+	}
+	for {
+		rr, err := x.read()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		serial, isSOA := soaSerial(rr)
+		if isSOA && x.soa != nil && !rr.Name.Equal(x.soa.Name) {
+			return nil, 0, 0, ErrXfr
+		}
+
+		switch x.state {
+		case xfrStart:
+			if !isSOA {
+				return nil, 0, 0, ErrXfr
+			}
+			x.soa, x.cur = rr, serial
+			x.state = xfrFirst
+			if x.ixfr && x.msgs == 1 && len(x.rrs) == 0 && int32(serial-x.serial) <= 0 {
+				// the client is up to date (RFC 1995 section 4)
+				return nil, 0, 0, x.end()
+			}
+		case xfrFirst:
+			if !isSOA {
+				x.state = xfrFull
+				return rr, XFRZone, x.cur, nil
+			}
+			if serial == x.cur {
+				// empty zone
+				return nil, 0, 0, x.end()
+			}
+			if !x.ixfr || serial != x.serial {
+				// differences must start at the version of the client
+				return nil, 0, 0, ErrXfr
+			}
+			x.cur, x.incr = serial, true
+			x.state = xfrDelete
+		case xfrFull:
+			if !isSOA {
+				return rr, XFRZone, x.cur, nil
+			}
+			if serial != x.cur {
+				// serial changed during the transfer
+				return nil, 0, 0, ErrXfr
+			}
+			return nil, 0, 0, x.end()
+		case xfrDelete:
+			if !isSOA {
+				return rr, XFRDelete, x.cur, nil
+			}
+			x.cur = serial
+			x.state = xfrAdd
+		case xfrAdd:
+			if !isSOA {
+				return rr, XFRAdd, x.cur, nil
+			}
+			if serial != x.cur {
+				// sequences must follow each other
+				return nil, 0, 0, ErrXfr
+			}
+			if last, _ := soaSerial(x.soa); serial == last {
+				return nil, 0, 0, x.end()
+			}
+			x.state = xfrDelete
+		}
+	}
+}
+
+// Transfer sends zone transfer query q (AXFR, or IXFR from NewIXFRQuery) on
+// conn, a stream connection to the primary server, and calls fn for each
+// RRset of the response as it is received. It returns the SOA of the
+// transferred version of the zone once the transfer is complete. Timeouts
+// are left to the caller, through the deadline of conn.
+func Transfer(conn io.ReadWriter, q *Message, fn func(*XFRSet) error) (*Resource, error) {
+	if err := WriteStreamMessage(conn, q); err != nil {
+		return nil, err
+	}
+	x := NewXFRReader(bufio.NewReader(conn), q)
+	for {
+		set, err := x.Next()
+		if err == io.EOF {
+			return x.SOA(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(set); err != nil {
+			return nil, err
+		}
+	}
+}
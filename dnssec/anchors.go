@@ -0,0 +1,221 @@
+package dnssec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// rootAnchors is the format of IANA's root-anchors.xml
+type rootAnchors struct {
+	Zone    string `xml:"Zone"`
+	Digests []struct {
+		ValidFrom  string `xml:"validFrom,attr"`
+		ValidUntil string `xml:"validUntil,attr"`
+		KeyTag     uint16 `xml:"KeyTag"`
+		Algorithm  uint8  `xml:"Algorithm"`
+		DigestType uint8  `xml:"DigestType"`
+		Digest     string `xml:"Digest"`
+	} `xml:"KeyDigest"`
+}
+
+// ParseRootAnchors reads trust anchors in the XML format published by IANA
+// at https://data.iana.org/root-anchors/root-anchors.xml, and returns the DS
+// records of those valid at time now
+func ParseRootAnchors(r io.Reader, now time.Time) ([]*dnsmsg.Resource, error) {
+	var ta rootAnchors
+	if err := xml.NewDecoder(r).Decode(&ta); err != nil {
+		return nil, err
+	}
+	zone := anchorName(ta.Zone)
+	if zone == "" {
+		return nil, errors.New("trust anchor without zone")
+	}
+
+	var res []*dnsmsg.Resource
+	for _, kd := range ta.Digests {
+		from, err := time.Parse(time.RFC3339, kd.ValidFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validFrom for key %d: %w", kd.KeyTag, err)
+		}
+		if now.Before(from) {
+			continue
+		}
+		if kd.ValidUntil != "" {
+			until, err := time.Parse(time.RFC3339, kd.ValidUntil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validUntil for key %d: %w", kd.KeyTag, err)
+			}
+			if !now.Before(until) {
+				continue
+			}
+		}
+		digest, err := hex.DecodeString(strings.TrimSpace(kd.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest for key %d: %w", kd.KeyTag, err)
+		}
+		ds := &dnsmsg.RDataDS{KeyTag: kd.KeyTag, Algorithm: kd.Algorithm, DigestType: kd.DigestType, Digest: digest}
+		res = append(res, &dnsmsg.Resource{Name: zone, Type: dnsmsg.DS, Class: dnsmsg.IN, Data: ds})
+	}
+	return res, nil
+}
+
+// ParseTrustAnchors reads the trust-anchors (or managed-keys) statements of
+// a BIND configuration file such as bind.keys, and returns the DS records of
+// the anchors. Anchors given as keys (initial-key or static-key) are returned
+// as their SHA-256 DS.
+//
+//	trust-anchors {
+//		. initial-ds 20326 8 2 "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D";
+//	};
+func ParseTrustAnchors(r io.Reader) ([]*dnsmsg.Resource, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	toks, err := anchorTokens(string(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*dnsmsg.Resource
+	for len(toks) > 0 {
+		if len(toks) < 2 || (toks[0] != "trust-anchors" && toks[0] != "managed-keys") || toks[1] != "{" {
+			return nil, fmt.Errorf("unexpected %q", toks[0])
+		}
+		toks = toks[2:]
+		for len(toks) > 0 && toks[0] != "}" {
+			end := 0
+			for end < len(toks) && toks[end] != ";" {
+				end++
+			}
+			if end == len(toks) {
+				return nil, errors.New("missing ; after trust anchor")
+			}
+			rr, err := parseTrustAnchor(toks[:end])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, rr)
+			toks = toks[end+1:]
+		}
+		if len(toks) < 2 || toks[1] != ";" {
+			return nil, errors.New("unterminated trust-anchors statement")
+		}
+		toks = toks[2:]
+	}
+	return res, nil
+}
+
+// parseTrustAnchor parses a single anchor of a trust-anchors statement
+func parseTrustAnchor(f []string) (*dnsmsg.Resource, error) {
+	if len(f) < 6 {
+		return nil, fmt.Errorf("invalid trust anchor %q", strings.Join(f, " "))
+	}
+	name := anchorName(f[0])
+	if name == "" {
+		return nil, fmt.Errorf("invalid trust anchor name %q", f[0])
+	}
+	var n [3]uint64
+	for i := range n {
+		v, err := strconv.ParseUint(f[i+2], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor for %s: %w", name, err)
+		}
+		n[i] = v
+	}
+	data := strings.Join(f[5:], "")
+
+	switch f[1] {
+	case "initial-ds", "static-ds":
+		if n[1] > 0xff || n[2] > 0xff {
+			return nil, fmt.Errorf("invalid trust anchor for %s", name)
+		}
+		digest, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest for %s: %w", name, err)
+		}
+		ds := &dnsmsg.RDataDS{KeyTag: uint16(n[0]), Algorithm: uint8(n[1]), DigestType: uint8(n[2]), Digest: digest}
+		return &dnsmsg.Resource{Name: name, Type: dnsmsg.DS, Class: dnsmsg.IN, Data: ds}, nil
+	case "initial-key", "static-key":
+		if n[1] != 3 || n[2] > 0xff {
+			return nil, fmt.Errorf("invalid trust anchor for %s", name)
+		}
+		pub, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for %s: %w", name, err)
+		}
+		key := &dnsmsg.Resource{Name: name, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN,
+			Data: &dnsmsg.RDataDNSKEY{Flags: uint16(n[0]), Protocol: uint8(n[1]), Algorithm: uint8(n[2]), PublicKey: pub}}
+		ds, err := NewDS(key, DigestSHA256)
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmsg.Resource{Name: name, Type: dnsmsg.DS, Class: dnsmsg.IN, Data: ds}, nil
+	}
+	return nil, fmt.Errorf("unsupported trust anchor type %s", f[1])
+}
+
+// anchorName returns s as a fully qualified name, or an empty name
+func anchorName(s string) dnsmsg.Name {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	n := dnsmsg.Name(s)
+	if !n.IsFQDN() {
+		n += "."
+	}
+	return n
+}
+
+// anchorTokens splits a BIND configuration into tokens, skipping comments.
+// Braces and semicolons are tokens of their own, and quotes are removed.
+func anchorTokens(s string) ([]string, error) {
+	var res []string
+	for len(s) > 0 {
+		switch {
+		case s[0] == ' ' || s[0] == '\t' || s[0] == '\r' || s[0] == '\n':
+			s = s[1:]
+		case s[0] == '#' || strings.HasPrefix(s, "//"):
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				i = len(s) - 1
+			}
+			s = s[i+1:]
+		case strings.HasPrefix(s, "/*"):
+			i := strings.Index(s, "*/")
+			if i < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			s = s[i+2:]
+		case s[0] == '{' || s[0] == '}' || s[0] == ';':
+			res = append(res, s[:1])
+			s = s[1:]
+		case s[0] == '"':
+			i := strings.IndexByte(s[1:], '"')
+			if i < 0 {
+				return nil, errors.New("unterminated quoted string")
+			}
+			// keys and digests may be split over several lines
+			res = append(res, strings.Join(strings.Fields(s[1:i+1]), ""))
+			s = s[i+2:]
+		default:
+			i := strings.IndexAny(s, " \t\r\n{};\"")
+			if i < 0 {
+				i = len(s)
+			}
+			res = append(res, s[:i])
+			s = s[i:]
+		}
+	}
+	return res, nil
+}
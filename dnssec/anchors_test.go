@@ -0,0 +1,97 @@
+package dnssec
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRootAnchors = `<?xml version="1.0" encoding="UTF-8"?>
+<TrustAnchor id="380DC50D-484E-40D0-A3AE-68F2B18F61C7" source="http://data.iana.org/root-anchors/root-anchors.xml">
+<Zone>.</Zone>
+<KeyDigest id="Kjqmt7v" validFrom="2010-07-15T00:00:00+00:00" validUntil="2019-01-11T00:00:00+00:00">
+<KeyTag>19036</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5</Digest>
+</KeyDigest>
+<KeyDigest id="Klajeyz" validFrom="2017-02-02T00:00:00+00:00">
+<KeyTag>20326</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D</Digest>
+</KeyDigest>
+</TrustAnchor>
+`
+
+func TestParseRootAnchors(t *testing.T) {
+	var tests = []struct {
+		now    string
+		expect []string
+	}{
+		{"2009-01-01T00:00:00Z", nil},
+		{"2015-01-01T00:00:00Z", []string{". IN DS 0 19036 8 2 49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5"}},
+		{"2018-01-01T00:00:00Z", []string{
+			". IN DS 0 19036 8 2 49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5",
+			". IN DS 0 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		}},
+		{"2019-01-11T00:00:00Z", []string{". IN DS 0 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"}},
+	}
+	for _, test := range tests {
+		now, _ := time.Parse(time.RFC3339, test.now)
+		rrs, err := ParseRootAnchors(strings.NewReader(testRootAnchors), now)
+		if err != nil {
+			t.Fatalf("failed to parse: %s", err)
+		}
+		var res []string
+		for _, rr := range rrs {
+			res = append(res, rr.String())
+		}
+		if strings.Join(res, "\n") != strings.Join(test.expect, "\n") {
+			t.Errorf("%s: unexpected anchors %q", test.now, res)
+		}
+	}
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	const conf = `# bind.keys
+trust-anchors {
+	# This key (20326) was published in the root zone in 2017.
+	. initial-key 257 3 8 "AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTO
+		iW1vkIbzxeF3+/4RgWOq7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kv
+		ArMtNROxVQuCaSnIDdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3
+		rCj/EWgvIWgb9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7L
+		jVc1uTIdsIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB
+		5qihylGa8subX2Nn6UwNR1AkUTV74bU=";
+	/* a DS anchor */
+	example.com static-ds 12345 13 2 "0123456789ABCDEF 0123456789ABCDEF";
+};
+`
+	rrs, err := ParseTrustAnchors(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	var res []string
+	for _, rr := range rrs {
+		res = append(res, rr.String())
+	}
+	expect := []string{
+		". IN DS 0 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		"example.com. IN DS 0 12345 13 2 0123456789ABCDEF0123456789ABCDEF",
+	}
+	if strings.Join(res, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected anchors %q", res)
+	}
+
+	for _, s := range []string{
+		`trust-anchors { . initial-ds 20326 8 2 "E06D"; }`,
+		`trust-anchors { . initial-ds 20326 8 "E06D"; };`,
+		`trust-anchors { . unknown-ds 20326 8 2 "E06D"; };`,
+		`trust-anchors { . initial-ds 20326 8 2 "E06D" };`,
+		`options { };`,
+	} {
+		if _, err := ParseTrustAnchors(strings.NewReader(s)); err == nil {
+			t.Errorf("no error parsing %s", s)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package dnssec
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// algorithmNames are the mnemonics of the algorithms in key files
+var algorithmNames = map[uint8]string{
+	RSASHA1:          "RSASHA1",
+	RSASHA1NSEC3SHA1: "NSEC3RSASHA1",
+	RSASHA256:        "RSASHA256",
+	RSASHA512:        "RSASHA512",
+	ECDSAP256SHA256:  "ECDSAP256SHA256",
+	ECDSAP384SHA384:  "ECDSAP384SHA384",
+	ED25519:          "ED25519",
+}
+
+// rsaFields are the fields of RSA private key files, in order
+var rsaFields = []string{"Modulus", "PublicExponent", "PrivateExponent", "Prime1", "Prime2", "Exponent1", "Exponent2", "Coefficient"}
+
+// BINDKeyName returns the base name of the files of key as created by BIND's
+// dnssec-keygen, such as Kexample.com.+013+12345, to which the .key and
+// .private extensions are added
+func BINDKeyName(key *dnsmsg.Resource) (string, error) {
+	k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+	if !ok {
+		return "", ErrInvalidKey
+	}
+	name := strings.ToLower(string(key.Name))
+	if name != "." {
+		name = strings.TrimSuffix(name, ".") + "."
+	}
+	return fmt.Sprintf("K%s+%03d+%05d", name, k.Algorithm, KeyTag(k)), nil
+}
+
+// ParseBINDKey reads the DNSKEY record of a .key file, which may be
+// preceded by comments
+func ParseBINDKey(r io.Reader) (*dnsmsg.Resource, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), ";")
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		rr := &dnsmsg.Resource{Name: dnsmsg.Name(f[0]), Type: dnsmsg.DNSKEY, Class: dnsmsg.IN}
+		if !rr.Name.IsFQDN() {
+			return nil, fmt.Errorf("key owner %s is not fully qualified", f[0])
+		}
+		f = f[1:]
+		// TTL and class can appear in any order before the type
+		for i := 0; i < 2 && len(f) > 0; i++ {
+			if v, err := strconv.ParseUint(f[0], 10, 32); err == nil {
+				rr.TTL = uint32(v)
+			} else if c, err := dnsmsg.ParseClass(f[0]); err == nil {
+				rr.Class = c
+			} else {
+				break
+			}
+			f = f[1:]
+		}
+		if len(f) == 0 || !strings.EqualFold(f[0], "DNSKEY") {
+			return nil, errors.New("key file does not hold a DNSKEY record")
+		}
+		data, err := dnsmsg.RDataFromString(dnsmsg.DNSKEY, strings.Join(f[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		rr.Data = data
+		return rr, nil
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("key file does not hold a DNSKEY record")
+}
+
+// WriteBINDKey writes key in the format of a .key file
+func WriteBINDKey(w io.Writer, key *dnsmsg.Resource) error {
+	k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+	if !ok {
+		return ErrInvalidKey
+	}
+	kind := "zone"
+	if k.Flags&FlagSEP != 0 {
+		kind = "key"
+	}
+	_, err := fmt.Fprintf(w, "; This is a %s-signing key, keyid %d, for %s\n%s IN DNSKEY %s\n", kind, KeyTag(k), key.Name, key.Name, k)
+	return err
+}
+
+// ParseBINDPrivateKey reads a private key file (v1.2 or later) as written by
+// dnssec-keygen or ldns, and returns its algorithm and key. Fields not
+// related to the key itself, such as timing metadata, are ignored.
+func ParseBINDPrivateKey(r io.Reader) (uint8, crypto.Signer, error) {
+	fields := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if err := s.Err(); err != nil {
+		return 0, nil, err
+	}
+	if !strings.HasPrefix(fields["Private-key-format"], "v1.") {
+		return 0, nil, errors.New("unsupported private key format")
+	}
+	// Algorithm: 13 (ECDSAP256SHA256)
+	a, _, _ := strings.Cut(fields["Algorithm"], " ")
+	v, err := strconv.ParseUint(a, 10, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid algorithm %q", fields["Algorithm"])
+	}
+	alg := uint8(v)
+
+	value := func(name string) ([]byte, error) {
+		v, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("missing %s in private key", name)
+		}
+		return base64.StdEncoding.DecodeString(v)
+	}
+
+	switch alg {
+	case RSASHA256, RSASHA512:
+		n := make([]*big.Int, len(rsaFields))
+		for i, name := range rsaFields {
+			v, err := value(name)
+			if err != nil {
+				return 0, nil, err
+			}
+			n[i] = new(big.Int).SetBytes(v)
+		}
+		if !n[1].IsInt64() || n[1].Int64() > 1<<31-1 {
+			return 0, nil, ErrInvalidKey
+		}
+		priv := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n[0], E: int(n[1].Int64())},
+			D:         n[2],
+			Primes:    []*big.Int{n[3], n[4]},
+		}
+		if err := priv.Validate(); err != nil {
+			return 0, nil, err
+		}
+		priv.Precompute()
+		return alg, priv, nil
+	case ECDSAP256SHA256, ECDSAP384SHA384:
+		d, err := value("PrivateKey")
+		if err != nil {
+			return 0, nil, err
+		}
+		curve := elliptic.P256()
+		if alg == ECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		priv, err := ecdsaPrivateKey(curve, d)
+		if err != nil {
+			return 0, nil, err
+		}
+		return alg, priv, nil
+	case ED25519:
+		seed, err := value("PrivateKey")
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return 0, nil, ErrInvalidKey
+		}
+		return alg, ed25519.NewKeyFromSeed(seed), nil
+	}
+	return 0, nil, ErrUnsupported
+}
+
+// ecdsaPrivateKey returns the key of curve with the private scalar d
+func ecdsaPrivateKey(curve elliptic.Curve, d []byte) (*ecdsa.PrivateKey, error) {
+	size := curve.Params().BitSize / 8
+	k := new(big.Int).SetBytes(d)
+	if len(d) != size || k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidKey
+	}
+	priv := &ecdsa.PrivateKey{D: k}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// WriteBINDPrivateKey writes priv, a key for algorithm alg, in the v1.3
+// private key format of BIND
+func WriteBINDPrivateKey(w io.Writer, alg uint8, priv crypto.Signer) error {
+	b64 := base64.StdEncoding.EncodeToString
+	var lines []string
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if alg != RSASHA256 && alg != RSASHA512 {
+			return ErrInvalidKey
+		}
+		if len(priv.Primes) != 2 {
+			// not expressible in this format
+			return ErrUnsupported
+		}
+		priv.Precompute()
+		n := []*big.Int{priv.N, big.NewInt(int64(priv.E)), priv.D, priv.Primes[0], priv.Primes[1],
+			priv.Precomputed.Dp, priv.Precomputed.Dq, priv.Precomputed.Qinv}
+		for i, name := range rsaFields {
+			lines = append(lines, name+": "+b64(n[i].Bytes()))
+		}
+	case *ecdsa.PrivateKey:
+		if _, err := publicKeyData(alg, &priv.PublicKey); err != nil {
+			return err
+		}
+		lines = append(lines, "PrivateKey: "+b64(priv.D.FillBytes(make([]byte, priv.Curve.Params().BitSize/8))))
+	case ed25519.PrivateKey:
+		if alg != ED25519 {
+			return ErrInvalidKey
+		}
+		lines = append(lines, "PrivateKey: "+b64(priv.Seed()))
+	default:
+		return ErrUnsupported
+	}
+
+	_, err := fmt.Fprintf(w, "Private-key-format: v1.3\nAlgorithm: %d (%s)\n%s\n", alg, algorithmNames[alg], strings.Join(lines, "\n"))
+	return err
+}
+
+// LoadBINDKey returns a Signer for the key stored in the base.key and
+// base.private files, base being for example Kexample.com.+013+12345
+func LoadBINDKey(base string) (*Signer, error) {
+	f, err := os.Open(base + ".key")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	key, err := ParseBINDKey(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s.key: %w", base, err)
+	}
+
+	pf, err := os.Open(base + ".private")
+	if err != nil {
+		return nil, err
+	}
+	defer pf.Close()
+	alg, priv, err := ParseBINDPrivateKey(pf)
+	if err != nil {
+		return nil, fmt.Errorf("%s.private: %w", base, err)
+	}
+	k := key.Data.(*dnsmsg.RDataDNSKEY)
+	if alg != k.Algorithm {
+		return nil, ErrKeyMismatch
+	}
+	return NewSigner(key.Name, k, priv)
+}
+
+// SaveBINDKey writes the key of s to the .key and .private files in dir,
+// with the names used by dnssec-keygen, and returns their base path. The
+// private key file is only readable by its owner.
+func SaveBINDKey(dir string, s *Signer) (string, error) {
+	key := s.DNSKEY(0)
+	name, err := BINDKeyName(key)
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, name)
+
+	f, err := os.OpenFile(base+".private", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = WriteBINDPrivateKey(f, s.Key.Algorithm, s.priv)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	f, err = os.Create(base + ".key")
+	if err != nil {
+		return "", err
+	}
+	err = WriteBINDKey(f, key)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return base, nil
+}
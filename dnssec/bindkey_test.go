@@ -0,0 +1,101 @@
+package dnssec
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestParseBINDKey(t *testing.T) {
+	// RFC 6605 section 6.1 and RFC 8080 section 6.1
+	var tests = []struct {
+		key, private, name string
+	}{
+		{`; This is a key-signing key, keyid 55648, for example.net.
+example.net. 3600 IN DNSKEY 257 3 13 GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==
+`, `Private-key-format: v1.2
+Algorithm: 13 (ECDSAP256SHA256)
+PrivateKey: GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=
+`, "Kexample.net.+013+55648"},
+		{`example.com. IN DNSKEY 257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=
+`, `Private-key-format: v1.2
+Algorithm: 15 (ED25519)
+PrivateKey: ODIyNjAzODQ2MjgwODAxMjI2NDUxOTAyMDQxNDIyNjI=
+`, "Kexample.com.+015+03613"},
+	}
+	for _, test := range tests {
+		key, err := ParseBINDKey(strings.NewReader(test.key))
+		if err != nil {
+			t.Errorf("failed to parse key: %s", err)
+			continue
+		}
+		if name, err := BINDKeyName(key); err != nil || name != test.name {
+			t.Errorf("got key name %s (%v), expected %s", name, err, test.name)
+		}
+		alg, priv, err := ParseBINDPrivateKey(strings.NewReader(test.private))
+		if err != nil {
+			t.Errorf("%s: failed to parse private key: %s", test.name, err)
+			continue
+		}
+		k := key.Data.(*dnsmsg.RDataDNSKEY)
+		if alg != k.Algorithm {
+			t.Errorf("%s: got algorithm %d", test.name, alg)
+		}
+		if _, err := NewSigner(key.Name, k, priv); err != nil {
+			t.Errorf("%s: private key does not match: %s", test.name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteBINDPrivateKey(&buf, alg, priv); err != nil {
+			t.Errorf("%s: failed to write private key: %s", test.name, err)
+		}
+		if res := strings.Replace(buf.String(), "v1.3", "v1.2", 1); res != test.private {
+			t.Errorf("%s: got private key\n%s", test.name, res)
+		}
+	}
+
+	bad := []string{
+		"Private-key-format: v2.0\nAlgorithm: 13\nPrivateKey: GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=\n",
+		"Private-key-format: v1.3\nAlgorithm: 13\n",
+		"Private-key-format: v1.3\nAlgorithm: 13\nPrivateKey: GU6SnQ==\n",
+		"Private-key-format: v1.3\nAlgorithm: 3 (DSA)\nPrime(p): AA==\n",
+	}
+	for _, s := range bad {
+		if _, _, err := ParseBINDPrivateKey(strings.NewReader(s)); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestSaveBINDKey(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []uint8{RSASHA256, ECDSAP384SHA384, ED25519} {
+		key, priv, err := GenerateKey(alg, FlagZone|FlagSEP)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		s, err := NewSigner("Example.", key, priv)
+		if err != nil {
+			t.Fatalf("failed to create signer: %s", err)
+		}
+		base, err := SaveBINDKey(dir, s)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to save key: %s", alg, err)
+			continue
+		}
+		l, err := LoadBINDKey(base)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to load key: %s", alg, err)
+			continue
+		}
+		if l.Zone != "Example." || l.Key.String() != key.String() {
+			t.Errorf("algorithm %d: loaded key %s %s", alg, l.Zone, l.Key)
+		}
+		if !strings.HasPrefix(filepath.Base(base), "Kexample.+0") {
+			t.Errorf("algorithm %d: unexpected file name %s", alg, base)
+		}
+	}
+}
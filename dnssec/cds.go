@@ -0,0 +1,157 @@
+package dnssec
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var ErrInvalidCDS = errors.New("inconsistent CDS or CDNSKEY records")
+
+// NewCDS returns the CDS and CDNSKEY records asking the parent of zone to
+// publish DS records for keys, typically the KSKs, with the given digest
+// types, or SHA-256 if none (RFC 7344 section 4)
+func NewCDS(zone dnsmsg.Name, keys []*dnsmsg.RDataDNSKEY, ttl uint32, digestTypes ...uint8) (cds, cdnskey []*dnsmsg.Resource, err error) {
+	if len(keys) == 0 {
+		return nil, nil, ErrNoKey
+	}
+	if len(digestTypes) == 0 {
+		digestTypes = []uint8{DigestSHA256}
+	}
+	for _, k := range keys {
+		key := &dnsmsg.Resource{Name: zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: ttl, Data: k}
+		for _, dt := range digestTypes {
+			ds, err := NewDS(key, dt)
+			if err != nil {
+				return nil, nil, err
+			}
+			cds = append(cds, &dnsmsg.Resource{Name: zone, Type: dnsmsg.CDS, Class: dnsmsg.IN, TTL: ttl, Data: &dnsmsg.RDataCDS{RDataDS: *ds}})
+		}
+		cdnskey = append(cdnskey, &dnsmsg.Resource{Name: zone, Type: dnsmsg.CDNSKEY, Class: dnsmsg.IN, TTL: ttl, Data: &dnsmsg.RDataCDNSKEY{RDataDNSKEY: *k}})
+	}
+	return cds, cdnskey, nil
+}
+
+// DeleteCDS returns the CDS and CDNSKEY records asking the parent of zone to
+// remove all its DS records, making the zone insecure (RFC 8078 section 4)
+func DeleteCDS(zone dnsmsg.Name, ttl uint32) (cds, cdnskey *dnsmsg.Resource) {
+	cds = &dnsmsg.Resource{Name: zone, Type: dnsmsg.CDS, Class: dnsmsg.IN, TTL: ttl,
+		Data: &dnsmsg.RDataCDS{RDataDS: dnsmsg.RDataDS{Digest: []byte{0}}}}
+	cdnskey = &dnsmsg.Resource{Name: zone, Type: dnsmsg.CDNSKEY, Class: dnsmsg.IN, TTL: ttl,
+		Data: &dnsmsg.RDataCDNSKEY{RDataDNSKEY: dnsmsg.RDataDNSKEY{Protocol: 3, PublicKey: []byte{0}}}}
+	return cds, cdnskey
+}
+
+// DSUpdate is the change of the DS RRset of a zone requested by its CDS and
+// CDNSKEY records
+type DSUpdate struct {
+	Add    []*dnsmsg.RDataDS
+	Remove []*dnsmsg.RDataDS
+	Delete bool // all DS records are removed, making the zone insecure
+}
+
+// Needed returns true if the DS RRset of the parent must be changed
+func (u *DSUpdate) Needed() bool {
+	return len(u.Add) > 0 || len(u.Remove) > 0
+}
+
+// CheckDSUpdate compares ds, the DS records of a zone in its parent, with
+// the CDS and CDNSKEY records found in the zone, and returns the changes to
+// make to the DS RRset. Keys only given as CDNSKEY keep their current DS, or
+// get a SHA-256 DS. Without CDS or CDNSKEY records, no change is requested.
+// The records must have been validated with the keys of the current DS
+// records (RFC 7344 section 4.1).
+func CheckDSUpdate(ds, cds []*dnsmsg.Resource) (*DSUpdate, error) {
+	var parent, wanted []*dnsmsg.RDataDS
+	for _, rr := range ds {
+		if d, ok := rr.Data.(*dnsmsg.RDataDS); ok {
+			parent = append(parent, d)
+		}
+	}
+
+	var keys []*dnsmsg.Resource
+	del := false
+	for _, rr := range cds {
+		switch d := rr.Data.(type) {
+		case *dnsmsg.RDataCDS:
+			if d.IsDelete() {
+				del = true
+			} else {
+				wanted = append(wanted, &d.RDataDS)
+			}
+		case *dnsmsg.RDataCDNSKEY:
+			if d.IsDelete() {
+				del = true
+			} else {
+				keys = append(keys, &dnsmsg.Resource{Name: rr.Name, Type: dnsmsg.DNSKEY, Class: rr.Class, Data: &d.RDataDNSKEY})
+			}
+		}
+	}
+
+	if del {
+		// the delete request must be alone (RFC 8078 section 4)
+		if len(wanted) > 0 || len(keys) > 0 {
+			return nil, ErrInvalidCDS
+		}
+		return &DSUpdate{Remove: parent, Delete: len(parent) > 0}, nil
+	}
+
+	if len(wanted) > 0 && len(keys) > 0 {
+		// CDS and CDNSKEY must designate the same keys
+		for _, key := range keys {
+			if !slices.ContainsFunc(wanted, func(d *dnsmsg.RDataDS) bool { return dsMatches(d, key) }) {
+				return nil, ErrInvalidCDS
+			}
+		}
+		for _, d := range wanted {
+			if !slices.ContainsFunc(keys, func(key *dnsmsg.Resource) bool { return dsMatches(d, key) }) {
+				return nil, ErrInvalidCDS
+			}
+		}
+	} else {
+		for _, key := range keys {
+			i := len(wanted)
+			for _, d := range parent {
+				if dsMatches(d, key) {
+					wanted = append(wanted, d)
+				}
+			}
+			if len(wanted) == i {
+				d, err := NewDS(key, DigestSHA256)
+				if err != nil {
+					return nil, err
+				}
+				wanted = append(wanted, d)
+			}
+		}
+	}
+
+	u := &DSUpdate{}
+	if len(wanted) == 0 {
+		return u, nil
+	}
+	for _, d := range wanted {
+		if !slices.ContainsFunc(parent, func(p *dnsmsg.RDataDS) bool { return sameDS(p, d) }) {
+			u.Add = append(u.Add, d)
+		}
+	}
+	for _, p := range parent {
+		if !slices.ContainsFunc(wanted, func(d *dnsmsg.RDataDS) bool { return sameDS(p, d) }) {
+			u.Remove = append(u.Remove, p)
+		}
+	}
+	return u, nil
+}
+
+// sameDS returns true if a and b are the same DS record
+func sameDS(a, b *dnsmsg.RDataDS) bool {
+	return a.KeyTag == b.KeyTag && a.Algorithm == b.Algorithm && a.DigestType == b.DigestType && bytes.Equal(a.Digest, b.Digest)
+}
+
+// dsMatches returns true if ds is a DS record of key
+func dsMatches(ds *dnsmsg.RDataDS, key *dnsmsg.Resource) bool {
+	d, err := NewDS(key, ds.DigestType)
+	return err == nil && sameDS(d, ds)
+}
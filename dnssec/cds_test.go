@@ -0,0 +1,101 @@
+package dnssec
+
+import (
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestCDS(t *testing.T) {
+	var keys []*dnsmsg.RDataDNSKEY
+	for i := 0; i < 2; i++ {
+		k, _, err := GenerateKey(ECDSAP256SHA256, FlagZone|FlagSEP)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		keys = append(keys, k)
+	}
+	oldKey, newKey := keys[0], keys[1]
+
+	cds, cdnskey, err := NewCDS("example.", keys, 3600, DigestSHA256, DigestSHA384)
+	if err != nil {
+		t.Fatalf("failed to create CDS: %s", err)
+	}
+	if len(cds) != 4 || len(cdnskey) != 2 {
+		t.Fatalf("got %d CDS and %d CDNSKEY records", len(cds), len(cdnskey))
+	}
+	if c := cds[1].Data.(*dnsmsg.RDataCDS); c.KeyTag != KeyTag(oldKey) || c.DigestType != DigestSHA384 {
+		t.Errorf("unexpected CDS %s", c)
+	}
+	if _, _, err := NewCDS("example.", nil, 3600); err != ErrNoKey {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+
+	// the parent has the DS of the old key
+	ds := func(k *dnsmsg.RDataDNSKEY) *dnsmsg.Resource {
+		d, err := NewDS(&dnsmsg.Resource{Name: "example.", Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, Data: k}, DigestSHA256)
+		if err != nil {
+			t.Fatalf("failed to compute DS: %s", err)
+		}
+		return testRR("example.", dnsmsg.DS, d)
+	}
+	parent := []*dnsmsg.Resource{ds(oldKey)}
+	newOnly, newKeyOnly, _ := NewCDS("example.", []*dnsmsg.RDataDNSKEY{newKey}, 3600)
+	del, delKey := DeleteCDS("example.", 3600)
+
+	var tests = []struct {
+		name   string
+		cds    []*dnsmsg.Resource
+		add    []uint16
+		remove []uint16
+		delete bool
+		err    error
+	}{
+		{"no CDS", nil, nil, nil, false, nil},
+		{"unchanged", cds[:1], nil, nil, false, nil},
+		{"double DS", append(cds, cdnskey...), []uint16{KeyTag(oldKey), KeyTag(newKey), KeyTag(newKey)}, nil, false, nil},
+		{"replace", newOnly, []uint16{KeyTag(newKey)}, []uint16{KeyTag(oldKey)}, false, nil},
+		{"CDNSKEY only", newKeyOnly, []uint16{KeyTag(newKey)}, []uint16{KeyTag(oldKey)}, false, nil},
+		{"CDNSKEY keeps DS", cdnskey, []uint16{KeyTag(newKey)}, nil, false, nil},
+		{"delete", []*dnsmsg.Resource{del, delKey}, nil, []uint16{KeyTag(oldKey)}, true, nil},
+		{"delete with keys", []*dnsmsg.Resource{del, cds[0]}, nil, nil, false, ErrInvalidCDS},
+		{"inconsistent", append(newOnly, cdnskey[0]), nil, nil, false, ErrInvalidCDS},
+	}
+	for _, test := range tests {
+		u, err := CheckDSUpdate(parent, test.cds)
+		if err != test.err {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		tags := func(l []*dnsmsg.RDataDS) []uint16 {
+			var res []uint16
+			for _, d := range l {
+				res = append(res, d.KeyTag)
+			}
+			return res
+		}
+		add, remove := tags(u.Add), tags(u.Remove)
+		if len(add) != len(test.add) || len(remove) != len(test.remove) || u.Delete != test.delete || u.Needed() != (len(add)+len(remove) > 0) {
+			t.Errorf("%s: got add %v, remove %v, delete %v", test.name, add, remove, u.Delete)
+			continue
+		}
+		for i := range add {
+			if add[i] != test.add[i] {
+				t.Errorf("%s: got add %v, expected %v", test.name, add, test.add)
+			}
+		}
+		for i := range remove {
+			if remove[i] != test.remove[i] {
+				t.Errorf("%s: got remove %v, expected %v", test.name, remove, test.remove)
+			}
+		}
+	}
+
+	// the delete sentinels (RFC 8078 section 4)
+	if del.Data.String() != "0 0 0 00" || delKey.Data.String() != "0 3 0 AA==" {
+		t.Errorf("unexpected delete records %s and %s", del.Data, delKey.Data)
+	}
+}
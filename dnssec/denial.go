@@ -0,0 +1,445 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// NSEC3 hash algorithm and flags (RFC 5155 section 11)
+const (
+	NSEC3SHA1   = 1
+	NSEC3OptOut = 0x01
+)
+
+// MaxNSEC3Iterations is the highest number of NSEC3 iterations accepted when
+// validating, above which responses are treated as insecure (RFC 9276
+// section 3.2)
+const MaxNSEC3Iterations = 150
+
+var (
+	ErrNoDenial        = errors.New("records do not prove the denial of existence")
+	ErrNSEC3Iterations = errors.New("too many NSEC3 iterations")
+)
+
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// NSEC3Hash returns the hash of name with the given salt and additional
+// iterations (RFC 5155 section 5)
+func NSEC3Hash(name dnsmsg.Name, alg uint8, iterations uint16, salt []byte) ([]byte, error) {
+	if alg != NSEC3SHA1 {
+		return nil, ErrUnsupported
+	}
+	buf, err := name.CanonicalWire()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.New()
+	for i := 0; i <= int(iterations); i++ {
+		h.Reset()
+		h.Write(buf)
+		h.Write(salt)
+		buf = h.Sum(buf[:0])
+	}
+	return buf, nil
+}
+
+// parentName returns name without its first label
+func parentName(name dnsmsg.Name) dnsmsg.Name {
+	l := name.SplitLabels()
+	if len(l) <= 1 {
+		return "."
+	}
+	return dnsmsg.Name(strings.Join(l[1:], ".") + ".")
+}
+
+// commonAncestor returns the longest name both a and b are subdomains of
+func commonAncestor(a, b dnsmsg.Name) dnsmsg.Name {
+	la, lb := a.SplitLabels(), b.SplitLabels()
+	n := 0
+	for n < len(la) && n < len(lb) && dnsmsg.Name(la[len(la)-1-n]).Equal(dnsmsg.Name(lb[len(lb)-1-n])) {
+		n++
+	}
+	if n == 0 {
+		return "."
+	}
+	return dnsmsg.Name(strings.Join(la[len(la)-n:], ".") + ".")
+}
+
+// wildcardOf returns the wildcard name immediately below name
+func wildcardOf(name dnsmsg.Name) dnsmsg.Name {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+// typeBitmap is the list of types of an NSEC or NSEC3 record
+type typeBitmap []dnsmsg.Type
+
+func (b typeBitmap) has(t dnsmsg.Type) bool {
+	return slices.Contains(b, t)
+}
+
+// delegation returns true if the bitmap is the one of a delegation point or
+// a DNAME, whose records cannot prove anything about names below them
+// (RFC 6840 section 4.1)
+func (b typeBitmap) delegation() bool {
+	return b.has(dnsmsg.NS) && !b.has(dnsmsg.SOA) || b.has(dnsmsg.DNAME)
+}
+
+// noData returns true if the bitmap proves that there is no record of type
+// t at its owner name (RFC 4035 section 5.4, RFC 5155 section 8.5)
+func (b typeBitmap) noData(t dnsmsg.Type) bool {
+	if b.has(t) || b.has(dnsmsg.CNAME) {
+		return false
+	}
+	if t == dnsmsg.DS {
+		// DS records are in the parent zone, not at the apex of the child
+		return !b.has(dnsmsg.SOA)
+	}
+	// the parent side of a delegation only proves the absence of DS
+	return !b.has(dnsmsg.NS) || b.has(dnsmsg.SOA)
+}
+
+// denial holds the authenticated NSEC or NSEC3 records of a response
+type denial struct {
+	zone  dnsmsg.Name
+	nsec  []*dnsmsg.Resource
+	nsec3 []*nsec3Record
+
+	// NSEC3 parameters, the same for all records
+	alg        uint8
+	iterations uint16
+	salt       []byte
+}
+
+type nsec3Record struct {
+	hash []byte
+	data *dnsmsg.RDataNSEC3
+}
+
+// newDenial checks the signatures of the NSEC and NSEC3 records in records,
+// which must all belong to the same zone. Other records are ignored.
+func newDenial(records, rrsigs, keys []*dnsmsg.Resource, now time.Time, allowSHA1 bool) (*denial, error) {
+	d := &denial{}
+	seen := make(map[string]bool)
+	for _, rr := range records {
+		if rr.Type != dnsmsg.NSEC && rr.Type != dnsmsg.NSEC3 {
+			continue
+		}
+		k := string(rr.Name.Canonical()) + "/" + rr.Type.String()
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		var rrset []*dnsmsg.Resource
+		for _, o := range records {
+			if o.Type == rr.Type && o.Name.Equal(rr.Name) {
+				rrset = append(rrset, o)
+			}
+		}
+		if len(rrset) != 1 {
+			// there is only one NSEC or NSEC3 record per name
+			return nil, ErrNoDenial
+		}
+		sig, err := verifyRRset(rrset, rrsigs, keys, now, allowSHA1)
+		if err != nil {
+			return nil, err
+		}
+		zone := dnsmsg.Name(sig.SignerName)
+		if d.zone == "" {
+			d.zone = zone
+		} else if !d.zone.Equal(zone) {
+			return nil, ErrNoDenial
+		}
+
+		switch data := rr.Data.(type) {
+		case *dnsmsg.RDataNSEC:
+			d.nsec = append(d.nsec, rr)
+		case *dnsmsg.RDataNSEC3:
+			// owner is the base32hex hash directly below the zone
+			l := rr.Name.SplitLabels()
+			if len(l) < 1 || !parentName(rr.Name).Equal(zone) {
+				return nil, ErrNoDenial
+			}
+			h, err := nsec3Encoding.DecodeString(strings.ToUpper(l[0]))
+			if err != nil {
+				return nil, ErrNoDenial
+			}
+			if len(d.nsec3) == 0 {
+				d.alg, d.iterations, d.salt = data.Hash, data.Iterations, data.Salt
+			} else if data.Hash != d.alg || data.Iterations != d.iterations || !bytes.Equal(data.Salt, d.salt) {
+				return nil, ErrNoDenial
+			}
+			d.nsec3 = append(d.nsec3, &nsec3Record{h, data})
+		default:
+			return nil, ErrNoDenial
+		}
+	}
+	if d.zone == "" || len(d.nsec) > 0 && len(d.nsec3) > 0 {
+		return nil, ErrNoDenial
+	}
+	if len(d.nsec3) > 0 {
+		if d.alg != NSEC3SHA1 {
+			return nil, ErrUnsupported
+		}
+		if d.iterations > MaxNSEC3Iterations {
+			return nil, ErrNSEC3Iterations
+		}
+	}
+	return d, nil
+}
+
+// nsecMatch returns the NSEC record owned by name
+func (d *denial) nsecMatch(name dnsmsg.Name) *dnsmsg.RDataNSEC {
+	for _, rr := range d.nsec {
+		if rr.Name.Equal(name) {
+			return rr.Data.(*dnsmsg.RDataNSEC)
+		}
+	}
+	return nil
+}
+
+// nsecCover returns the NSEC record proving that name does not exist
+func (d *denial) nsecCover(name dnsmsg.Name) *dnsmsg.Resource {
+	if !name.IsSubDomainOf(d.zone) {
+		return nil
+	}
+	for _, rr := range d.nsec {
+		nsec := rr.Data.(*dnsmsg.RDataNSEC)
+		next := dnsmsg.Name(nsec.NextDomain)
+		if rr.Name.Compare(name) >= 0 {
+			continue
+		}
+		// the last record of the zone points back to the apex
+		if next.Compare(name) <= 0 && next.Compare(rr.Name) > 0 {
+			continue
+		}
+		if name.IsSubDomainOf(rr.Name) && typeBitmap(nsec.Types).delegation() {
+			continue
+		}
+		return rr
+	}
+	return nil
+}
+
+// nsecEncloser returns the closest encloser of name, which does not exist,
+// proven by the NSEC record rr covering it (RFC 4035 section 5.4)
+func (d *denial) nsecEncloser(name dnsmsg.Name, rr *dnsmsg.Resource) dnsmsg.Name {
+	a := commonAncestor(name, rr.Name)
+	b := commonAncestor(name, dnsmsg.Name(rr.Data.(*dnsmsg.RDataNSEC).NextDomain))
+	if b.CountLabels() > a.CountLabels() {
+		a = b
+	}
+	if !a.IsSubDomainOf(d.zone) {
+		return d.zone
+	}
+	return a
+}
+
+// nsec3Match returns the NSEC3 record whose hash is the one of name
+func (d *denial) nsec3Match(name dnsmsg.Name) *dnsmsg.RDataNSEC3 {
+	h, err := NSEC3Hash(name, d.alg, d.iterations, d.salt)
+	if err != nil {
+		return nil
+	}
+	for _, r := range d.nsec3 {
+		if bytes.Equal(r.hash, h) {
+			return r.data
+		}
+	}
+	return nil
+}
+
+// nsec3Cover returns the NSEC3 record whose interval contains the hash of
+// name, proving that it does not exist
+func (d *denial) nsec3Cover(name dnsmsg.Name) *dnsmsg.RDataNSEC3 {
+	h, err := NSEC3Hash(name, d.alg, d.iterations, d.salt)
+	if err != nil {
+		return nil
+	}
+	for _, r := range d.nsec3 {
+		after, before := bytes.Compare(h, r.hash) > 0, bytes.Compare(h, r.data.NextHashed) < 0
+		if bytes.Compare(r.data.NextHashed, r.hash) > 0 {
+			if after && before {
+				return r.data
+			}
+		} else if after || before {
+			// the last record of the chain
+			return r.data
+		}
+	}
+	return nil
+}
+
+// nsec3Encloser returns the closest encloser of name, and the NSEC3 record
+// covering the next closer name (RFC 5155 section 8.3)
+func (d *denial) nsec3Encloser(name dnsmsg.Name) (dnsmsg.Name, *dnsmsg.RDataNSEC3) {
+	if !name.IsSubDomainOf(d.zone) {
+		return "", nil
+	}
+	next := name
+	for ce := parentName(name); ce.IsSubDomainOf(d.zone); ce = parentName(ce) {
+		if m := d.nsec3Match(ce); m != nil {
+			if typeBitmap(m.Types).delegation() {
+				return "", nil
+			}
+			if c := d.nsec3Cover(next); c != nil {
+				return ce, c
+			}
+			return "", nil
+		}
+		if ce == "." {
+			break
+		}
+		next = ce
+	}
+	return "", nil
+}
+
+// VerifyDenial checks that the NSEC or NSEC3 records in records, signed by
+// rrsigs, prove the negative response with code rcode to question q. For
+// NXDOMAIN (dnsmsg.ErrName) the name and the wildcard at its closest encloser
+// must not exist. For NODATA (dnsmsg.NoError) the name or the matching
+// wildcard must exist without the type, or, for DS queries with NSEC3, the
+// name must be covered by an Opt-Out record. keys are the DNSKEY records of
+// the zone, assumed to be trusted.
+func VerifyDenial(q *dnsmsg.Question, rcode dnsmsg.RCode, records, rrsigs, keys []*dnsmsg.Resource) error {
+	return VerifyDenialAt(q, rcode, records, rrsigs, keys, time.Now())
+}
+
+// VerifyDenialAt is VerifyDenial with the signatures checked at time now
+func VerifyDenialAt(q *dnsmsg.Question, rcode dnsmsg.RCode, records, rrsigs, keys []*dnsmsg.Resource, now time.Time) error {
+	d, err := newDenial(records, rrsigs, keys, now, false)
+	if err != nil {
+		return err
+	}
+	return d.prove(q, rcode)
+}
+
+// prove checks that the records prove the negative response with code rcode
+// to question q
+func (d *denial) prove(q *dnsmsg.Question, rcode dnsmsg.RCode) error {
+	if !q.Name.IsSubDomainOf(d.zone) {
+		return ErrNoDenial
+	}
+
+	switch {
+	case rcode == dnsmsg.ErrName && len(d.nsec) > 0:
+		rr := d.nsecCover(q.Name)
+		if rr == nil {
+			return ErrNoDenial
+		}
+		if d.nsecCover(wildcardOf(d.nsecEncloser(q.Name, rr))) == nil {
+			return ErrNoDenial
+		}
+		return nil
+	case rcode == dnsmsg.NoError && len(d.nsec) > 0:
+		if m := d.nsecMatch(q.Name); m != nil {
+			if typeBitmap(m.Types).noData(q.Type) {
+				return nil
+			}
+			return ErrNoDenial
+		}
+		rr := d.nsecCover(q.Name)
+		if rr == nil {
+			return ErrNoDenial
+		}
+		if dnsmsg.Name(rr.Data.(*dnsmsg.RDataNSEC).NextDomain).IsSubDomainOf(q.Name) {
+			// empty non-terminal
+			return nil
+		}
+		if m := d.nsecMatch(wildcardOf(d.nsecEncloser(q.Name, rr))); m != nil && typeBitmap(m.Types).noData(q.Type) {
+			return nil
+		}
+		return ErrNoDenial
+	case rcode == dnsmsg.ErrName:
+		if d.nsec3Match(q.Name) != nil {
+			return ErrNoDenial
+		}
+		ce, _ := d.nsec3Encloser(q.Name)
+		if ce == "" || d.nsec3Cover(wildcardOf(ce)) == nil {
+			return ErrNoDenial
+		}
+		return nil
+	case rcode == dnsmsg.NoError:
+		if m := d.nsec3Match(q.Name); m != nil {
+			if typeBitmap(m.Types).noData(q.Type) {
+				return nil
+			}
+			return ErrNoDenial
+		}
+		ce, next := d.nsec3Encloser(q.Name)
+		if ce == "" {
+			return ErrNoDenial
+		}
+		if q.Type == dnsmsg.DS && next.Flags&NSEC3OptOut != 0 {
+			// insecure delegation (RFC 5155 section 8.6)
+			return nil
+		}
+		if m := d.nsec3Match(wildcardOf(ce)); m != nil && typeBitmap(m.Types).noData(q.Type) {
+			return nil
+		}
+		return ErrNoDenial
+	}
+	return ErrNoDenial
+}
+
+// delegation returns true if the records, which prove that there is no DS
+// record at name, show that name is a delegation point, making the child zone
+// insecure
+func (d *denial) delegation(name dnsmsg.Name) bool {
+	if len(d.nsec) > 0 {
+		m := d.nsecMatch(name)
+		return m != nil && typeBitmap(m.Types).has(dnsmsg.NS)
+	}
+	if m := d.nsec3Match(name); m != nil {
+		return typeBitmap(m.Types).has(dnsmsg.NS)
+	}
+	// only an Opt-Out record proves the absence of DS without a match
+	_, next := d.nsec3Encloser(name)
+	return next != nil && next.Flags&NSEC3OptOut != 0
+}
+
+// VerifyWildcard checks that the records prove that name does not exist,
+// when an answer for it was synthesized from a wildcard whose signature has
+// the given labels field (RFC 4035 section 5.3.4, RFC 5155 section 8.8)
+func VerifyWildcard(name dnsmsg.Name, labels uint8, records, rrsigs, keys []*dnsmsg.Resource) error {
+	return VerifyWildcardAt(name, labels, records, rrsigs, keys, time.Now())
+}
+
+// VerifyWildcardAt is VerifyWildcard with the signatures checked at time now
+func VerifyWildcardAt(name dnsmsg.Name, labels uint8, records, rrsigs, keys []*dnsmsg.Resource, now time.Time) error {
+	return verifyWildcard(name, labels, records, rrsigs, keys, now, false)
+}
+
+func verifyWildcard(name dnsmsg.Name, labels uint8, records, rrsigs, keys []*dnsmsg.Resource, now time.Time, allowSHA1 bool) error {
+	d, err := newDenial(records, rrsigs, keys, now, allowSHA1)
+	if err != nil {
+		return err
+	}
+	l := name.SplitLabels()
+	if int(labels) >= len(l) {
+		return ErrNoDenial
+	}
+	if len(d.nsec) > 0 {
+		if d.nsecCover(name) == nil {
+			return ErrNoDenial
+		}
+		return nil
+	}
+	// the next closer name, one label below the wildcard's parent
+	next := dnsmsg.Name(strings.Join(l[len(l)-int(labels)-1:], ".") + ".")
+	if d.nsec3Cover(next) == nil {
+		return ErrNoDenial
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestNSEC3Hash(t *testing.T) {
+	// RFC 5155 appendix A
+	salt, _ := hex.DecodeString("aabbccdd")
+	var tests = []struct {
+		name dnsmsg.Name
+		hash string
+	}{
+		{"example.", "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom"},
+		{"a.example.", "35mthgpgcu1qg68fab165klnsnk3dpvl"},
+		{"ai.example.", "gjeqe526plbf1g8mklp59enfd789njgi"},
+		{"NS1.example.", "2t7b4g4vsa5smi47k61mv5bv1a22bojr"},
+		{"*.w.example.", "r53bq7cc2uvmubfu5ocmm6pers9tk9en"},
+		{"x.y.w.example.", "2vptu5timamqttgl4luu9kg21e0aor3s"},
+	}
+	for _, test := range tests {
+		h, err := NSEC3Hash(test.name, NSEC3SHA1, 12, salt)
+		if err != nil {
+			t.Errorf("failed to hash %s: %s", test.name, err)
+			continue
+		}
+		if s := strings.ToLower(nsec3Encoding.EncodeToString(h)); s != test.hash {
+			t.Errorf("%s: got hash %s, expected %s", test.name, s, test.hash)
+		}
+	}
+}
+
+// testDenialZone lists the names of the test zone and their types.
+// sub.example. is a delegation without DS, and w.example. and y.example. are
+// empty non-terminals.
+var testDenialZone = []struct {
+	name  dnsmsg.Name
+	types []dnsmsg.Type
+}{
+	{"example.", []dnsmsg.Type{dnsmsg.NS, dnsmsg.SOA, dnsmsg.RRSIG, dnsmsg.DNSKEY}},
+	{"a.example.", []dnsmsg.Type{dnsmsg.A, dnsmsg.RRSIG}},
+	{"sub.example.", []dnsmsg.Type{dnsmsg.NS}},
+	{"*.w.example.", []dnsmsg.Type{dnsmsg.MX, dnsmsg.RRSIG}},
+	{"x.y.example.", []dnsmsg.Type{dnsmsg.A, dnsmsg.RRSIG}},
+}
+
+// testDenialNSEC returns the signed NSEC records of testDenialZone
+// testDenialTime is when the denial test records are signed and verified
+var testDenialTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testDenialNSEC(t *testing.T, priv *ecdsa.PrivateKey, key *dnsmsg.Resource) (rrs, sigs []*dnsmsg.Resource) {
+	for i, n := range testDenialZone {
+		next := testDenialZone[(i+1)%len(testDenialZone)].name
+		rr := &dnsmsg.Resource{Name: n.name, Type: dnsmsg.NSEC, Class: dnsmsg.IN, TTL: 3600,
+			Data: &dnsmsg.RDataNSEC{NextDomain: string(next), Types: append(n.types, dnsmsg.NSEC)}}
+		rrs = append(rrs, rr)
+		sigs = append(sigs, signTestAt(t, testDenialTime, priv, key, rr))
+	}
+	return
+}
+
+// testDenialNSEC3 returns the signed NSEC3 records of testDenialZone, with
+// the given flags. Delegations without DS have no record when flags has
+// Opt-Out set.
+func testDenialNSEC3(t *testing.T, priv *ecdsa.PrivateKey, key *dnsmsg.Resource, flags uint8, iterations uint16) (rrs, sigs []*dnsmsg.Resource) {
+	type entry struct {
+		hash  []byte
+		types []dnsmsg.Type
+	}
+	var entries []*entry
+	add := func(name dnsmsg.Name, types []dnsmsg.Type) {
+		h, err := NSEC3Hash(name, NSEC3SHA1, iterations, []byte{0xab})
+		if err != nil {
+			t.Fatalf("failed to hash %s: %s", name, err)
+		}
+		entries = append(entries, &entry{h, types})
+	}
+	for _, n := range testDenialZone {
+		if flags&NSEC3OptOut != 0 && n.name == "sub.example." {
+			continue
+		}
+		add(n.name, n.types)
+	}
+	add("w.example.", nil)
+	add("y.example.", nil)
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].hash, entries[j].hash) < 0 })
+
+	for i, e := range entries {
+		next := entries[(i+1)%len(entries)].hash
+		rr := &dnsmsg.Resource{Name: dnsmsg.Name(nsec3Encoding.EncodeToString(e.hash) + ".example."), Type: dnsmsg.NSEC3, Class: dnsmsg.IN, TTL: 3600,
+			Data: &dnsmsg.RDataNSEC3{Hash: NSEC3SHA1, Flags: flags, Iterations: iterations, Salt: []byte{0xab}, NextHashed: next, Types: e.types}}
+		rrs = append(rrs, rr)
+		sigs = append(sigs, signTestAt(t, testDenialTime, priv, key, rr))
+	}
+	return
+}
+
+var testDenialQueries = []struct {
+	name  dnsmsg.Name
+	typ   dnsmsg.Type
+	rcode dnsmsg.RCode
+	ok    bool
+}{
+	{"b.example.", dnsmsg.A, dnsmsg.ErrName, true},
+	{"B.Example.", dnsmsg.A, dnsmsg.ErrName, true},
+	{"a.example.", dnsmsg.A, dnsmsg.ErrName, false},
+	{"a.example.", dnsmsg.MX, dnsmsg.NoError, true},
+	{"a.example.", dnsmsg.A, dnsmsg.NoError, false},
+	{"b.example.", dnsmsg.A, dnsmsg.NoError, false},
+	{"y.example.", dnsmsg.A, dnsmsg.NoError, true},       // empty non-terminal
+	{"z.w.example.", dnsmsg.AAAA, dnsmsg.NoError, true},  // wildcard without the type
+	{"z.w.example.", dnsmsg.MX, dnsmsg.NoError, false},   // wildcard with the type
+	{"z.w.example.", dnsmsg.AAAA, dnsmsg.ErrName, false}, // wildcard exists
+	{"sub.example.", dnsmsg.DS, dnsmsg.NoError, true},
+	{"sub.example.", dnsmsg.A, dnsmsg.NoError, false}, // referral expected
+	{"example.", dnsmsg.DS, dnsmsg.NoError, false},    // child side of the zone cut
+	{"foo.sub.example.", dnsmsg.A, dnsmsg.ErrName, false},
+	{"example.org.", dnsmsg.A, dnsmsg.ErrName, false},
+}
+
+func TestVerifyDenialNSEC(t *testing.T) {
+	priv, key := newTestKey(t, "example.")
+	keys := []*dnsmsg.Resource{key}
+	rrs, sigs := testDenialNSEC(t, priv, key)
+
+	for _, test := range testDenialQueries {
+		q := &dnsmsg.Question{Name: test.name, Type: test.typ, Class: dnsmsg.IN}
+		err := VerifyDenialAt(q, test.rcode, rrs, sigs, keys, testDenialTime)
+		if (err == nil) != test.ok {
+			t.Errorf("%s %s rcode %d: unexpected result %v", test.name, test.typ, test.rcode, err)
+		}
+	}
+
+	// NXDOMAIN requires the wildcard proof too
+	q := &dnsmsg.Question{Name: "b.example.", Type: dnsmsg.A, Class: dnsmsg.IN}
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, rrs[1:2], sigs, keys, testDenialTime); err != ErrNoDenial {
+		t.Errorf("expected ErrNoDenial without wildcard proof, got %v", err)
+	}
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, rrs[:2], sigs, keys, testDenialTime); err != nil {
+		t.Errorf("failed to verify minimal proof: %s", err)
+	}
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, rrs, sigs, keys, testDenialTime.Add(2*time.Hour)); err != ErrSignatureTime {
+		t.Errorf("expected ErrSignatureTime, got %v", err)
+	}
+	rrs[0].Data.(*dnsmsg.RDataNSEC).NextDomain = "c.example."
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, rrs, sigs, keys, testDenialTime); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature, got %v", err)
+	}
+
+	if err := VerifyWildcardAt("z.w.example.", 2, rrs[1:], sigs, keys, testDenialTime); err != nil {
+		t.Errorf("failed to verify wildcard answer: %s", err)
+	}
+	if err := VerifyWildcardAt("x.y.example.", 2, rrs[1:], sigs, keys, testDenialTime); err != ErrNoDenial {
+		t.Errorf("expected ErrNoDenial for existing name, got %v", err)
+	}
+}
+
+func TestVerifyDenialNSEC3(t *testing.T) {
+	priv, key := newTestKey(t, "example.")
+	keys := []*dnsmsg.Resource{key}
+	rrs, sigs := testDenialNSEC3(t, priv, key, 0, 10)
+
+	for _, test := range testDenialQueries {
+		q := &dnsmsg.Question{Name: test.name, Type: test.typ, Class: dnsmsg.IN}
+		err := VerifyDenialAt(q, test.rcode, rrs, sigs, keys, testDenialTime)
+		if (err == nil) != test.ok {
+			t.Errorf("%s %s rcode %d: unexpected result %v", test.name, test.typ, test.rcode, err)
+		}
+	}
+
+	if err := VerifyWildcardAt("z.w.example.", 2, rrs, sigs, keys, testDenialTime); err != nil {
+		t.Errorf("failed to verify wildcard answer: %s", err)
+	}
+
+	// Opt-Out: the unsigned delegation has no record
+	rrs, sigs = testDenialNSEC3(t, priv, key, NSEC3OptOut, 10)
+	q := &dnsmsg.Question{Name: "sub.example.", Type: dnsmsg.DS, Class: dnsmsg.IN}
+	if err := VerifyDenialAt(q, dnsmsg.NoError, rrs, sigs, keys, testDenialTime); err != nil {
+		t.Errorf("failed to verify Opt-Out proof: %s", err)
+	}
+	q.Type = dnsmsg.A
+	if err := VerifyDenialAt(q, dnsmsg.NoError, rrs, sigs, keys, testDenialTime); err != ErrNoDenial {
+		t.Errorf("expected ErrNoDenial, got %v", err)
+	}
+
+	rrs, sigs = testDenialNSEC3(t, priv, key, 0, MaxNSEC3Iterations+1)
+	q.Name = "b.example."
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, rrs, sigs, keys, testDenialTime); err != ErrNSEC3Iterations {
+		t.Errorf("expected ErrNSEC3Iterations, got %v", err)
+	}
+}
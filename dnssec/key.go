@@ -0,0 +1,162 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// DNSSEC algorithm numbers (RFC 8624 section 3.1)
+const (
+	RSASHA1          = 5
+	RSASHA1NSEC3SHA1 = 7
+	RSASHA256        = 8
+	RSASHA512        = 10
+	ECDSAP256SHA256  = 13
+	ECDSAP384SHA384  = 14
+	ED25519          = 15
+)
+
+// DNSKEY flags (RFC 4034 section 2.1.1 and RFC 5011 section 3)
+const (
+	FlagZone   = 0x0100
+	FlagRevoke = 0x0080
+	FlagSEP    = 0x0001
+)
+
+// DS digest types (RFC 4034, RFC 4509 and RFC 6605)
+const (
+	DigestSHA1   = 1
+	DigestSHA256 = 2
+	DigestSHA384 = 4
+)
+
+var ErrInvalidKey = errors.New("invalid public key")
+
+// algorithmSupported returns true if signatures with algorithm alg can be
+// verified
+func algorithmSupported(alg uint8) bool {
+	switch alg {
+	case RSASHA256, RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384, ED25519:
+		return true
+	}
+	return false
+}
+
+// algorithmLegacy returns true for the SHA-1 based algorithms, which can
+// only be verified when explicitly allowed (RFC 8624 section 3.1)
+func algorithmLegacy(alg uint8) bool {
+	return alg == RSASHA1 || alg == RSASHA1NSEC3SHA1
+}
+
+// KeyTag returns the key tag of key (RFC 4034 appendix B)
+func KeyTag(key *dnsmsg.RDataDNSKEY) uint16 {
+	var ac uint32
+	for i, b := range keyRData(key) {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16
+	return uint16(ac)
+}
+
+// NewDS returns the DS record data for key, a DNSKEY record, with the given
+// digest type (RFC 4034 section 5.1.4)
+func NewDS(key *dnsmsg.Resource, digestType uint8) (*dnsmsg.RDataDS, error) {
+	k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+	if !ok || key.Type != dnsmsg.DNSKEY {
+		return nil, ErrInvalidKey
+	}
+	buf, err := key.Name.CanonicalWire()
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, keyRData(k)...)
+
+	var digest []byte
+	switch digestType {
+	case DigestSHA1:
+		d := sha1.Sum(buf)
+		digest = d[:]
+	case DigestSHA256:
+		d := sha256.Sum256(buf)
+		digest = d[:]
+	case DigestSHA384:
+		d := sha512.Sum384(buf)
+		digest = d[:]
+	default:
+		return nil, ErrUnsupported
+	}
+	return &dnsmsg.RDataDS{KeyTag: KeyTag(k), Algorithm: k.Algorithm, DigestType: digestType, Digest: digest}, nil
+}
+
+// keyRData returns the RDATA of key in wire format
+func keyRData(key *dnsmsg.RDataDNSKEY) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, key.Flags)
+	buf = append(buf, key.Protocol, key.Algorithm)
+	return append(buf, key.PublicKey...)
+}
+
+// publicKey returns the public key of key for use with crypto packages
+func publicKey(key *dnsmsg.RDataDNSKEY) (crypto.PublicKey, error) {
+	switch key.Algorithm {
+	case RSASHA1, RSASHA1NSEC3SHA1, RSASHA256, RSASHA512:
+		// RFC 3110 section 2: exponent length, exponent and modulus
+		d := key.PublicKey
+		if len(d) < 1 {
+			return nil, ErrInvalidKey
+		}
+		explen := int(d[0])
+		d = d[1:]
+		if explen == 0 {
+			if len(d) < 2 {
+				return nil, ErrInvalidKey
+			}
+			explen = int(binary.BigEndian.Uint16(d))
+			d = d[2:]
+		}
+		if explen == 0 || explen > 4 || len(d) <= explen {
+			return nil, ErrInvalidKey
+		}
+		e := 0
+		for _, b := range d[:explen] {
+			e = e<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(d[explen:]), E: e}, nil
+	case ECDSAP256SHA256, ECDSAP384SHA384:
+		// RFC 6605 section 4: X and Y coordinates
+		curve := elliptic.P256()
+		if key.Algorithm == ECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		size := curve.Params().BitSize / 8
+		if len(key.PublicKey) != 2*size {
+			return nil, ErrInvalidKey
+		}
+		x := new(big.Int).SetBytes(key.PublicKey[:size])
+		y := new(big.Int).SetBytes(key.PublicKey[size:])
+		if !curve.IsOnCurve(x, y) {
+			return nil, ErrInvalidKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case ED25519:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.PublicKey(key.PublicKey), nil
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,72 @@
+package dnssec
+
+import (
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// RRsetResult is the result of the verification of an RRset of a message
+type RRsetResult struct {
+	Section dnsmsg.Section // dnsmsg.SectionAnswer or dnsmsg.SectionAuthority
+	RRset   []*dnsmsg.Resource
+	Sig     *dnsmsg.RDataRRSIG // valid signature, nil on error
+	Err     error
+}
+
+// Wildcard returns true if the RRset was synthesized from a wildcard, in
+// which case the non-existence of its name must also be proven (see
+// VerifyWildcard)
+func (r *RRsetResult) Wildcard() bool {
+	if r.Sig == nil {
+		return false
+	}
+	l := r.RRset[0].Name.SplitLabels()
+	return int(r.Sig.Labels) < len(l) && l[0] != "*"
+}
+
+// VerifyMessage groups the records of the answer and authority sections of
+// msg in RRsets, and checks each against the RRSIG records of its section
+// with keys, the trusted DNSKEY records of the zone, at time now. RRSIG
+// records themselves are not verified. Results are in the order the RRsets
+// first appear in msg.
+func VerifyMessage(msg *dnsmsg.Message, keys []*dnsmsg.Resource, now time.Time) []*RRsetResult {
+	var res []*RRsetResult
+	for _, s := range []dnsmsg.Section{dnsmsg.SectionAnswer, dnsmsg.SectionAuthority} {
+		rrs := msg.Answer
+		if s == dnsmsg.SectionAuthority {
+			rrs = msg.Authority
+		}
+		for _, set := range rrsets(rrs) {
+			r := &RRsetResult{Section: s, RRset: set}
+			r.Sig, r.Err = VerifyRRset(set, rrs, keys, now)
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// rrsets groups rrs, except RRSIG records, by name, type and class
+func rrsets(rrs []*dnsmsg.Resource) [][]*dnsmsg.Resource {
+	type rrsetKey struct {
+		name  dnsmsg.Name
+		typ   dnsmsg.Type
+		class dnsmsg.Class
+	}
+	idx := make(map[rrsetKey]int)
+	var res [][]*dnsmsg.Resource
+	for _, rr := range rrs {
+		if rr.Type == dnsmsg.RRSIG {
+			continue
+		}
+		k := rrsetKey{rr.Name.Canonical(), rr.Type, rr.Class}
+		i, ok := idx[k]
+		if !ok {
+			i = len(res)
+			idx[k] = i
+			res = append(res, nil)
+		}
+		res[i] = append(res[i], rr)
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package dnssec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestVerifyMessage(t *testing.T) {
+	priv, key := newTestKey(t, "example.")
+	ip := func(b byte) *dnsmsg.RDataIP { return &dnsmsg.RDataIP{IP: []byte{192, 0, 2, b}, Type: dnsmsg.A} }
+
+	www := []*dnsmsg.Resource{testRR("www.example.", dnsmsg.A, ip(1)), testRR("WWW.example.", dnsmsg.A, ip(2))}
+	wild := testRR("*.w.example.", dnsmsg.A, ip(3))
+	wildSig := signTest(t, priv, key, wild)
+	expanded, expandedSig := *wild, *wildSig
+	expanded.Name, expandedSig.Name = "host.w.example.", "host.w.example."
+	tampered := testRR("mail.example.", dnsmsg.A, ip(4))
+	tamperedSig := signTest(t, priv, key, tampered)
+	tampered.Data = ip(5)
+	nsec := testRR("example.", dnsmsg.NSEC, &dnsmsg.RDataNSEC{NextDomain: "www.example.", Types: []dnsmsg.Type{dnsmsg.NS, dnsmsg.SOA, dnsmsg.RRSIG, dnsmsg.NSEC}})
+
+	msg := &dnsmsg.Message{
+		Answer: []*dnsmsg.Resource{www[0], signTest(t, priv, key, www...), &expanded, &expandedSig, tampered, tamperedSig, www[1]},
+		Authority: []*dnsmsg.Resource{
+			testRR("example.", dnsmsg.NS, &dnsmsg.RDataLabel{Label: "ns.example.", Type: dnsmsg.NS}),
+			nsec, signTest(t, priv, key, nsec),
+		},
+	}
+	res := VerifyMessage(msg, []*dnsmsg.Resource{key}, time.Now())
+
+	var expect = []struct {
+		section  dnsmsg.Section
+		name     dnsmsg.Name
+		typ      dnsmsg.Type
+		count    int
+		err      error
+		wildcard bool
+	}{
+		{dnsmsg.SectionAnswer, "www.example.", dnsmsg.A, 2, nil, false},
+		{dnsmsg.SectionAnswer, "host.w.example.", dnsmsg.A, 1, nil, true},
+		{dnsmsg.SectionAnswer, "mail.example.", dnsmsg.A, 1, ErrBadSignature, false},
+		{dnsmsg.SectionAuthority, "example.", dnsmsg.NS, 1, ErrNoSignature, false},
+		{dnsmsg.SectionAuthority, "example.", dnsmsg.NSEC, 1, nil, false},
+	}
+	if len(res) != len(expect) {
+		t.Fatalf("got %d results, expected %d", len(res), len(expect))
+	}
+	for i, e := range expect {
+		r := res[i]
+		if r.Section != e.section || r.RRset[0].Name != e.name || r.RRset[0].Type != e.typ || len(r.RRset) != e.count {
+			t.Errorf("result %d: got %d %s %s (%d records)", i, r.Section, r.RRset[0].Name, r.RRset[0].Type, len(r.RRset))
+		}
+		if r.Err != e.err || (r.Sig != nil) != (e.err == nil) {
+			t.Errorf("result %d: got error %v, expected %v", i, r.Err, e.err)
+		}
+		if r.Wildcard() != e.wildcard {
+			t.Errorf("result %d: got wildcard %v", i, r.Wildcard())
+		}
+	}
+}
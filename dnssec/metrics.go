@@ -0,0 +1,162 @@
+package dnssec
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives measurements of the signing and validation work done by
+// the package, for capacity planning. It can feed any metrics system, such
+// as Prometheus or expvar, or be a Stats. Methods are called concurrently
+// and must not block.
+type Metrics interface {
+	// Signed is called after each signature made by a Signer, with the
+	// algorithm, the time it took and its error, if any
+	Signed(alg uint8, d time.Duration, err error)
+	// Verified is called after each signature checked with a matching
+	// key, with the algorithm, the time it took and the result: nil if
+	// the signature is valid, or the reason it is not
+	Verified(alg uint8, d time.Duration, err error)
+	// KeyCache is called when a Validator looks up the validated keys of
+	// a zone, hit being true if they were cached
+	KeyCache(hit bool)
+}
+
+var metrics atomic.Pointer[Metrics]
+
+// SetMetrics makes m receive the measurements of the package, or disables
+// them if m is nil
+func SetMetrics(m Metrics) {
+	if m == nil {
+		metrics.Store(nil)
+		return
+	}
+	metrics.Store(&m)
+}
+
+// getMetrics returns the current Metrics, or nil
+func getMetrics() Metrics {
+	if m := metrics.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// LatencyBuckets are the upper bounds of the latency histograms of Stats
+var LatencyBuckets = [...]time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// OpStats counts operations, such as signatures of an algorithm
+type OpStats struct {
+	Count  uint64        `json:"count"`
+	Errors uint64        `json:"errors"`
+	Time   time.Duration `json:"time"` // total
+	// Latency is a histogram of the time taken: Latency[i] counts the
+	// operations that took at most LatencyBuckets[i], and the last one
+	// the slower operations
+	Latency [len(LatencyBuckets) + 1]uint64 `json:"latency"`
+}
+
+func (o *OpStats) add(d time.Duration, err error) {
+	o.Count++
+	if err != nil {
+		o.Errors++
+	}
+	o.Time += d
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	o.Latency[i]++
+}
+
+// Stats is a Metrics keeping counters and latency histograms in memory
+type Stats struct {
+	lk       sync.Mutex
+	signed   map[string]*OpStats
+	verified map[string]*OpStats
+	hits     uint64
+	misses   uint64
+}
+
+// StatsSnapshot is the content of a Stats at a given time
+type StatsSnapshot struct {
+	Signatures     map[string]OpStats `json:"signatures"`    // by algorithm mnemonic
+	Verifications  map[string]OpStats `json:"verifications"` // by algorithm mnemonic and result, such as "ED25519 ok"
+	KeyCacheHits   uint64             `json:"key_cache_hits"`
+	KeyCacheMisses uint64             `json:"key_cache_misses"`
+}
+
+// algorithmName returns the mnemonic of alg, or its number
+func algorithmName(alg uint8) string {
+	if n, ok := algorithmNames[alg]; ok {
+		return n
+	}
+	return strconv.Itoa(int(alg))
+}
+
+func (s *Stats) Signed(alg uint8, d time.Duration, err error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.signed == nil {
+		s.signed = make(map[string]*OpStats)
+	}
+	k := algorithmName(alg)
+	if s.signed[k] == nil {
+		s.signed[k] = &OpStats{}
+	}
+	s.signed[k].add(d, err)
+}
+
+func (s *Stats) Verified(alg uint8, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.verified == nil {
+		s.verified = make(map[string]*OpStats)
+	}
+	k := algorithmName(alg) + " " + result
+	if s.verified[k] == nil {
+		s.verified[k] = &OpStats{}
+	}
+	s.verified[k].add(d, err)
+}
+
+func (s *Stats) KeyCache(hit bool) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if hit {
+		s.hits++
+	} else {
+		s.misses++
+	}
+}
+
+// Snapshot returns a copy of the counters of s
+func (s *Stats) Snapshot() *StatsSnapshot {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	res := &StatsSnapshot{
+		Signatures:     make(map[string]OpStats, len(s.signed)),
+		Verifications:  make(map[string]OpStats, len(s.verified)),
+		KeyCacheHits:   s.hits,
+		KeyCacheMisses: s.misses,
+	}
+	for k, o := range s.signed {
+		res.Signatures[k] = *o
+	}
+	for k, o := range s.verified {
+		res.Verifications[k] = *o
+	}
+	return res
+}
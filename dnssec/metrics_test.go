@@ -0,0 +1,74 @@
+package dnssec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestMetrics(t *testing.T) {
+	stats := &Stats{}
+	SetMetrics(stats)
+	defer SetMetrics(nil)
+
+	key, priv, err := GenerateKey(ED25519, FlagZone)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	s, err := NewSigner("example.", key, priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+	rr := &dnsmsg.Resource{Name: "www.example.", Type: dnsmsg.A, Class: dnsmsg.IN, TTL: 300, Data: &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A}}
+	now := time.Now()
+	sig, err := s.Sign([]*dnsmsg.Resource{rr}, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	keys := []*dnsmsg.Resource{s.DNSKEY(3600)}
+	if _, err := VerifyRRset([]*dnsmsg.Resource{rr}, []*dnsmsg.Resource{sig}, keys, now); err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	other := *rr
+	other.Data = &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 2}, Type: dnsmsg.A}
+	if _, err := VerifyRRset([]*dnsmsg.Resource{&other}, []*dnsmsg.Resource{sig}, keys, now); err != ErrBadSignature {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	// the second validation uses the cached keys
+	c := newTestChain(t)
+	v := NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: []*dnsmsg.Resource{c.anchor}})
+	for i := 0; i < 2; i++ {
+		if state, err := v.Validate(context.Background(), c.www[:1], c.www[1:]); state != Secure {
+			t.Fatalf("expected secure, got %s (%v)", state, err)
+		}
+	}
+
+	snap := stats.Snapshot()
+	if o := snap.Signatures["ED25519"]; o.Count != 1 || o.Errors != 0 {
+		t.Errorf("unexpected signature stats %+v", o)
+	}
+	if o := snap.Verifications["ED25519 ok"]; o.Count != 1 {
+		t.Errorf("unexpected successful verification stats %+v", o)
+	}
+	if o := snap.Verifications["ED25519 "+ErrBadSignature.Error()]; o.Count != 1 || o.Errors != 1 {
+		t.Errorf("unexpected failed verification stats %+v", o)
+	}
+	if o := snap.Verifications["ECDSAP256SHA256 ok"]; o.Count == 0 {
+		t.Errorf("no verification recorded for the validator")
+	}
+	if snap.KeyCacheHits != 1 || snap.KeyCacheMisses != 1 {
+		t.Errorf("expected 1 key cache hit and miss, got %d and %d", snap.KeyCacheHits, snap.KeyCacheMisses)
+	}
+
+	// latency buckets
+	var o OpStats
+	for _, d := range []time.Duration{time.Microsecond, 50 * time.Microsecond, time.Second} {
+		o.add(d, nil)
+	}
+	if o.Latency != [len(LatencyBuckets) + 1]uint64{1, 1, 0, 0, 0, 1} {
+		t.Errorf("unexpected histogram %v", o.Latency)
+	}
+}
@@ -0,0 +1,51 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var ErrNoPEM = errors.New("no PRIVATE KEY PEM block found")
+
+// MarshalPrivateKeyPEM returns priv, as returned by GenerateKey, encoded in
+// a PKCS #8 PRIVATE KEY PEM block
+func MarshalPrivateKeyPEM(priv crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKeyPEM reads the first PKCS #8 PRIVATE KEY PEM block of data
+// and returns the DNSKEY for algorithm alg and flags with its private key.
+// The algorithm is not stored in the PEM data, and must match the key type.
+func ParsePrivateKeyPEM(data []byte, alg uint8, flags uint16) (*dnsmsg.RDataDNSKEY, crypto.Signer, error) {
+	var block *pem.Block
+	for {
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, nil, ErrNoPEM
+		}
+		if block.Type == "PRIVATE KEY" {
+			break
+		}
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, nil, ErrUnsupported
+	}
+	pub, err := publicKeyData(alg, priv.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dnsmsg.RDataDNSKEY{Flags: flags, Protocol: 3, Algorithm: alg, PublicKey: pub}, priv, nil
+}
@@ -0,0 +1,44 @@
+package dnssec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrivateKeyPEM(t *testing.T) {
+	for _, alg := range []uint8{RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384, ED25519} {
+		key, priv, err := GenerateKey(alg, FlagZone)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		buf, err := MarshalPrivateKeyPEM(priv)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to marshal key: %s", alg, err)
+			continue
+		}
+		k, p, err := ParsePrivateKeyPEM(append([]byte("comment\n"), buf...), alg, FlagZone)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to parse key: %s", alg, err)
+			continue
+		}
+		if k.Flags != FlagZone || k.Algorithm != alg || !bytes.Equal(k.PublicKey, key.PublicKey) {
+			t.Errorf("algorithm %d: got DNSKEY %s, expected %s", alg, k, key)
+		}
+		if _, err := NewSigner("example.", key, p); err != nil {
+			t.Errorf("algorithm %d: private key does not match: %s", alg, err)
+		}
+
+		// the algorithm must match the key
+		other := uint8(ED25519)
+		if alg == ED25519 {
+			other = ECDSAP256SHA256
+		}
+		if _, _, err := ParsePrivateKeyPEM(buf, other, FlagZone); err != ErrInvalidKey {
+			t.Errorf("algorithm %d: expected ErrInvalidKey, got %v", alg, err)
+		}
+	}
+
+	if _, _, err := ParsePrivateKeyPEM([]byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"), ED25519, FlagZone); err != ErrNoPEM {
+		t.Errorf("expected ErrNoPEM, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// RolloverMethod is the way keys are replaced (RFC 6781 section 4.1)
+type RolloverMethod int
+
+const (
+	PrePublish RolloverMethod = iota // ZSK: new key published before it signs
+	DoubleDS                         // KSK: new DS published before the key
+)
+
+// RolloverAction is what happens at a step of a rollover
+type RolloverAction int
+
+const (
+	PublishKey   RolloverAction = iota // new DNSKEY added to the zone
+	StartSigning                       // new key used instead of the old one
+	RemoveKey                          // old DNSKEY removed from the zone
+	SubmitDS                           // DS of the new key added to the parent
+	SwapKey                            // old DNSKEY replaced by the new one, which signs
+	RemoveDS                           // DS of the old key removed from the parent
+)
+
+var rolloverActions = [...]string{"publish key", "start signing", "remove key", "submit DS", "swap key", "remove DS"}
+
+func (a RolloverAction) String() string {
+	if int(a) < len(rolloverActions) {
+		return rolloverActions[a]
+	}
+	return fmt.Sprintf("RolloverAction(%d)", int(a))
+}
+
+var ErrInvalidPolicy = errors.New("invalid rollover policy")
+
+// RolloverPolicy gives the method and timings of a rollover. The intervals
+// between steps are computed as in RFC 7583 section 3, from the TTLs and
+// the time changes take to reach all the name servers.
+type RolloverPolicy struct {
+	Method            RolloverMethod
+	DNSKEYTTL         time.Duration // TTL of the DNSKEY RRset
+	MaxZoneTTL        time.Duration // highest TTL of the signed records of the zone, for PrePublish
+	DSTTL             time.Duration // TTL of the DS RRset in the parent zone, for DoubleDS
+	Propagation       time.Duration // time for a change to reach all name servers of the zone
+	ParentPropagation time.Duration // time for the parent to publish DS changes, for DoubleDS
+	DigestType        uint8         // digest of the DS records, DigestSHA256 if zero
+}
+
+// RolloverStep is a step of a rollover: the changes to make at time At, and
+// the keys signing from then on (the zone RRsets for a ZSK, the DNSKEY
+// RRset for a KSK)
+type RolloverStep struct {
+	At           time.Time
+	Action       RolloverAction
+	Add          []*dnsmsg.Resource // DNSKEY records to add to the zone
+	Remove       []*dnsmsg.Resource // DNSKEY records to remove from the zone
+	ParentAdd    []*dnsmsg.Resource // DS records to add to the parent zone
+	ParentRemove []*dnsmsg.Resource // DS records to remove from the parent zone
+	Signing      []*dnsmsg.RDataDNSKEY
+}
+
+// Rollover plans the replacement of the key Old of Zone by New
+type Rollover struct {
+	Zone   dnsmsg.Name
+	Old    *dnsmsg.RDataDNSKEY
+	New    *dnsmsg.RDataDNSKEY
+	Policy RolloverPolicy
+}
+
+// Plan returns the steps of the rollover starting at start. With
+// PrePublish, the new key is published, then signs once it is in all
+// caches, and the old key is removed once its signatures have expired from
+// caches. With DoubleDS, the DS of the new key is submitted to the parent,
+// then the new key replaces the old one once the DS is in all caches, and
+// the old DS is removed once the old key has expired from caches.
+func (r *Rollover) Plan(start time.Time) ([]*RolloverStep, error) {
+	p := &r.Policy
+	if r.Old == nil || r.New == nil || p.DNSKEYTTL <= 0 {
+		return nil, ErrInvalidPolicy
+	}
+	if r.Old.Algorithm != r.New.Algorithm {
+		// the zone would not be signed with every algorithm of its keys
+		// for a while (RFC 6781 section 4.1.4)
+		return nil, ErrUnsupported
+	}
+	key := func(k *dnsmsg.RDataDNSKEY) []*dnsmsg.Resource {
+		return []*dnsmsg.Resource{{Name: r.Zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: uint32(p.DNSKEYTTL / time.Second), Data: k}}
+	}
+	oldKey, newKey := key(r.Old), key(r.New)
+
+	switch p.Method {
+	case PrePublish:
+		if p.MaxZoneTTL <= 0 {
+			return nil, ErrInvalidPolicy
+		}
+		// RFC 7583 section 3.2
+		signing := start.Add(p.Propagation + p.DNSKEYTTL)
+		remove := signing.Add(p.Propagation + p.MaxZoneTTL)
+		return []*RolloverStep{
+			{At: start, Action: PublishKey, Add: newKey, Signing: []*dnsmsg.RDataDNSKEY{r.Old}},
+			{At: signing, Action: StartSigning, Signing: []*dnsmsg.RDataDNSKEY{r.New}},
+			{At: remove, Action: RemoveKey, Remove: oldKey, Signing: []*dnsmsg.RDataDNSKEY{r.New}},
+		}, nil
+	case DoubleDS:
+		if p.DSTTL <= 0 {
+			return nil, ErrInvalidPolicy
+		}
+		digestType := p.DigestType
+		if digestType == 0 {
+			digestType = DigestSHA256
+		}
+		ds := func(k []*dnsmsg.Resource) ([]*dnsmsg.Resource, error) {
+			d, err := NewDS(k[0], digestType)
+			if err != nil {
+				return nil, err
+			}
+			return []*dnsmsg.Resource{{Name: r.Zone, Type: dnsmsg.DS, Class: dnsmsg.IN, TTL: uint32(p.DSTTL / time.Second), Data: d}}, nil
+		}
+		oldDS, err := ds(oldKey)
+		if err != nil {
+			return nil, err
+		}
+		newDS, err := ds(newKey)
+		if err != nil {
+			return nil, err
+		}
+		// RFC 7583 section 3.3
+		swap := start.Add(p.ParentPropagation + p.DSTTL)
+		remove := swap.Add(p.Propagation + p.DNSKEYTTL)
+		return []*RolloverStep{
+			{At: start, Action: SubmitDS, ParentAdd: newDS, Signing: []*dnsmsg.RDataDNSKEY{r.Old}},
+			{At: swap, Action: SwapKey, Add: newKey, Remove: oldKey, Signing: []*dnsmsg.RDataDNSKEY{r.New}},
+			{At: remove, Action: RemoveDS, ParentRemove: oldDS, Signing: []*dnsmsg.RDataDNSKEY{r.New}},
+		}, nil
+	}
+	return nil, ErrInvalidPolicy
+}
@@ -0,0 +1,108 @@
+package dnssec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestRollover(t *testing.T) {
+	newKey := func(alg uint8, flags uint16) *dnsmsg.RDataDNSKEY {
+		k, _, err := GenerateKey(alg, flags)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		return k
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// ZSK, pre-publish
+	oldZSK, newZSK := newKey(ECDSAP256SHA256, FlagZone), newKey(ECDSAP256SHA256, FlagZone)
+	r := &Rollover{Zone: "example.", Old: oldZSK, New: newZSK, Policy: RolloverPolicy{
+		Method:      PrePublish,
+		DNSKEYTTL:   time.Hour,
+		MaxZoneTTL:  24 * time.Hour,
+		Propagation: 5 * time.Minute,
+	}}
+	steps, err := r.Plan(start)
+	if err != nil {
+		t.Fatalf("failed to plan ZSK rollover: %s", err)
+	}
+	expect := []struct {
+		at     time.Duration
+		action RolloverAction
+		signer *dnsmsg.RDataDNSKEY
+	}{
+		{0, PublishKey, oldZSK},
+		{65 * time.Minute, StartSigning, newZSK},
+		{25*time.Hour + 10*time.Minute, RemoveKey, newZSK},
+	}
+	if len(steps) != len(expect) {
+		t.Fatalf("got %d steps", len(steps))
+	}
+	for i, e := range expect {
+		s := steps[i]
+		if !s.At.Equal(start.Add(e.at)) || s.Action != e.action || len(s.Signing) != 1 || s.Signing[0] != e.signer {
+			t.Errorf("step %d: got %s at %s", i, s.Action, s.At)
+		}
+	}
+	if len(steps[0].Add) != 1 || steps[0].Add[0].Data != newZSK || steps[0].Add[0].TTL != 3600 {
+		t.Errorf("new key not published")
+	}
+	if len(steps[2].Remove) != 1 || steps[2].Remove[0].Data != oldZSK {
+		t.Errorf("old key not removed")
+	}
+
+	// KSK, double-DS
+	oldKSK, newKSK := newKey(ED25519, FlagZone|FlagSEP), newKey(ED25519, FlagZone|FlagSEP)
+	r = &Rollover{Zone: "example.", Old: oldKSK, New: newKSK, Policy: RolloverPolicy{
+		Method:            DoubleDS,
+		DNSKEYTTL:         time.Hour,
+		DSTTL:             24 * time.Hour,
+		Propagation:       5 * time.Minute,
+		ParentPropagation: time.Hour,
+	}}
+	steps, err = r.Plan(start)
+	if err != nil {
+		t.Fatalf("failed to plan KSK rollover: %s", err)
+	}
+	expect = []struct {
+		at     time.Duration
+		action RolloverAction
+		signer *dnsmsg.RDataDNSKEY
+	}{
+		{0, SubmitDS, oldKSK},
+		{25 * time.Hour, SwapKey, newKSK},
+		{26*time.Hour + 5*time.Minute, RemoveDS, newKSK},
+	}
+	if len(steps) != len(expect) {
+		t.Fatalf("got %d steps", len(steps))
+	}
+	for i, e := range expect {
+		s := steps[i]
+		if !s.At.Equal(start.Add(e.at)) || s.Action != e.action || len(s.Signing) != 1 || s.Signing[0] != e.signer {
+			t.Errorf("step %d: got %s at %s", i, s.Action, s.At)
+		}
+	}
+	ds := steps[0].ParentAdd
+	if len(ds) != 1 || ds[0].TTL != 86400 || ds[0].Data.(*dnsmsg.RDataDS).KeyTag != KeyTag(newKSK) || ds[0].Data.(*dnsmsg.RDataDS).DigestType != DigestSHA256 {
+		t.Errorf("unexpected new DS %v", ds)
+	}
+	if s := steps[1]; len(s.Add) != 1 || s.Add[0].Data != newKSK || len(s.Remove) != 1 || s.Remove[0].Data != oldKSK {
+		t.Errorf("keys not swapped")
+	}
+	if ds := steps[2].ParentRemove; len(ds) != 1 || ds[0].Data.(*dnsmsg.RDataDS).KeyTag != KeyTag(oldKSK) {
+		t.Errorf("unexpected old DS %v", ds)
+	}
+
+	// invalid plans
+	r.Policy.DSTTL = 0
+	if _, err := r.Plan(start); err != ErrInvalidPolicy {
+		t.Errorf("expected ErrInvalidPolicy, got %v", err)
+	}
+	r.New = newKey(ECDSAP256SHA256, FlagZone|FlagSEP)
+	if _, err := r.Plan(start); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported for an algorithm rollover, got %v", err)
+	}
+}
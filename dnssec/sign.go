@@ -0,0 +1,215 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var ErrKeyMismatch = errors.New("private key does not match the DNSKEY")
+
+// DefaultRSAKeySize is the size of the RSA keys made by GenerateKey
+const DefaultRSAKeySize = 2048
+
+// GenerateKey returns a new key pair for algorithm alg. flags are the DNSKEY
+// flags, typically FlagZone for a ZSK or FlagZone|FlagSEP for a KSK.
+func GenerateKey(alg uint8, flags uint16) (*dnsmsg.RDataDNSKEY, crypto.Signer, error) {
+	return GenerateKeyBits(alg, flags, DefaultRSAKeySize)
+}
+
+// GenerateKeyBits is like GenerateKey, with RSA keys of the given size in
+// bits. The size of other keys is set by the algorithm, and bits is ignored.
+func GenerateKeyBits(alg uint8, flags uint16, bits int) (*dnsmsg.RDataDNSKEY, crypto.Signer, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case RSASHA256, RSASHA512:
+		priv, err = rsa.GenerateKey(rand.Reader, bits)
+	case ECDSAP256SHA256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384SHA384:
+		priv, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case ED25519:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := publicKeyData(alg, priv.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dnsmsg.RDataDNSKEY{Flags: flags, Protocol: 3, Algorithm: alg, PublicKey: pub}, priv, nil
+}
+
+// publicKeyData returns the DNSKEY public key field for pub
+func publicKeyData(alg uint8, pub crypto.PublicKey) ([]byte, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != RSASHA256 && alg != RSASHA512 {
+			return nil, ErrInvalidKey
+		}
+		// RFC 3110 section 2
+		e := big.NewInt(int64(pub.E)).Bytes()
+		var buf []byte
+		if len(e) < 256 {
+			buf = []byte{byte(len(e))}
+		} else {
+			buf = []byte{0, byte(len(e) >> 8), byte(len(e))}
+		}
+		buf = append(buf, e...)
+		return append(buf, pub.N.Bytes()...), nil
+	case *ecdsa.PublicKey:
+		curve := elliptic.P256()
+		if alg == ECDSAP384SHA384 {
+			curve = elliptic.P384()
+		} else if alg != ECDSAP256SHA256 {
+			return nil, ErrInvalidKey
+		}
+		if pub.Curve != curve {
+			return nil, ErrInvalidKey
+		}
+		size := curve.Params().BitSize / 8
+		return append(pub.X.FillBytes(make([]byte, size)), pub.Y.FillBytes(make([]byte, size))...), nil
+	case ed25519.PublicKey:
+		if alg != ED25519 {
+			return nil, ErrInvalidKey
+		}
+		return []byte(pub), nil
+	}
+	return nil, ErrUnsupported
+}
+
+// Signer signs RRsets of a zone with a private key
+type Signer struct {
+	Zone dnsmsg.Name
+	Key  *dnsmsg.RDataDNSKEY
+
+	priv crypto.Signer
+	tag  uint16
+}
+
+// NewSigner returns a Signer for zone using the private key priv of key.
+// priv can be any crypto.Signer, such as a key held in a KMS or HSM, as long
+// as its Public method returns the public key of the DNSKEY.
+func NewSigner(zone dnsmsg.Name, key *dnsmsg.RDataDNSKEY, priv crypto.Signer) (*Signer, error) {
+	if err := verifyKeyPair(key, priv); err != nil {
+		return nil, err
+	}
+	return NewSignerUnchecked(zone, key, priv), nil
+}
+
+// NewSignerUnchecked returns a Signer for zone without checking that priv is
+// the private key of key, for signers that cannot return their public key.
+// Signatures made with a wrong key will not validate.
+func NewSignerUnchecked(zone dnsmsg.Name, key *dnsmsg.RDataDNSKEY, priv crypto.Signer) *Signer {
+	return &Signer{Zone: zone, Key: key, priv: priv, tag: KeyTag(key)}
+}
+
+// verifyKeyPair checks that priv is the private key of key
+func verifyKeyPair(key *dnsmsg.RDataDNSKEY, priv crypto.Signer) error {
+	if !algorithmSupported(key.Algorithm) {
+		return ErrUnsupported
+	}
+	pub, err := publicKeyData(key.Algorithm, priv.Public())
+	if err != nil {
+		if err == ErrInvalidKey {
+			return ErrKeyMismatch
+		}
+		return err
+	}
+	if !bytes.Equal(pub, key.PublicKey) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// DNSKEY returns the DNSKEY record of the signer, with the given TTL
+func (s *Signer) DNSKEY(ttl uint32) *dnsmsg.Resource {
+	return &dnsmsg.Resource{Name: s.Zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: ttl, Data: s.Key}
+}
+
+// Sign returns the RRSIG record of rrset, valid from inception to
+// expiration. The records must be in the zone of the signer.
+func (s *Signer) Sign(rrset []*dnsmsg.Resource, inception, expiration time.Time) (*dnsmsg.Resource, error) {
+	if len(rrset) == 0 || !rrset[0].Name.IsSubDomainOf(s.Zone) {
+		return nil, ErrInvalidRRset
+	}
+	owner := rrset[0]
+	l := owner.Name.SplitLabels()
+	if len(l) > 0 && l[0] == "*" {
+		l = l[1:]
+	}
+	sig := &dnsmsg.RDataRRSIG{
+		TypeCovered: owner.Type,
+		Algorithm:   s.Key.Algorithm,
+		Labels:      uint8(len(l)),
+		OrigTTL:     owner.TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      s.tag,
+		SignerName:  string(s.Zone),
+	}
+	data, err := BuildSignedData(rrset, sig)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	sig.Signature, err = s.sign(data)
+	if m := getMetrics(); m != nil {
+		m.Signed(s.Key.Algorithm, time.Since(start), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dnsmsg.Resource{Name: owner.Name, Type: dnsmsg.RRSIG, Class: owner.Class, TTL: owner.TTL, Data: sig}, nil
+}
+
+// sign returns the signature of data in the format of the RRSIG records
+func (s *Signer) sign(data []byte) ([]byte, error) {
+	switch s.Key.Algorithm {
+	case RSASHA256:
+		d := sha256.Sum256(data)
+		return s.priv.Sign(rand.Reader, d[:], crypto.SHA256)
+	case RSASHA512:
+		d := sha512.Sum512(data)
+		return s.priv.Sign(rand.Reader, d[:], crypto.SHA512)
+	case ECDSAP256SHA256, ECDSAP384SHA384:
+		var digest []byte
+		hash, size := crypto.SHA256, 32
+		if s.Key.Algorithm == ECDSAP384SHA384 {
+			d := sha512.Sum384(data)
+			digest, hash, size = d[:], crypto.SHA384, 48
+		} else {
+			d := sha256.Sum256(data)
+			digest = d[:]
+		}
+		der, err := s.priv.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		// crypto.Signer returns an ASN.1 signature, RRSIG uses r and s
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, err
+		}
+		return append(rs.R.FillBytes(make([]byte, size)), rs.S.FillBytes(make([]byte, size))...), nil
+	case ED25519:
+		return s.priv.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	return nil, ErrUnsupported
+}
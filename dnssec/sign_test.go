@@ -0,0 +1,281 @@
+package dnssec
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+func TestSigner(t *testing.T) {
+	rr := &dnsmsg.Resource{Name: "www.example.", Type: dnsmsg.A, Class: dnsmsg.IN, TTL: 300, Data: &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A}}
+	now := time.Now()
+	for _, alg := range []uint8{RSASHA256, RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384, ED25519} {
+		key, priv, err := GenerateKey(alg, FlagZone)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to generate key: %s", alg, err)
+			continue
+		}
+		s, err := NewSigner("example.", key, priv)
+		if err != nil {
+			t.Errorf("algorithm %d: failed to create signer: %s", alg, err)
+			continue
+		}
+		sig, err := s.Sign([]*dnsmsg.Resource{rr}, now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Errorf("algorithm %d: failed to sign: %s", alg, err)
+			continue
+		}
+		if err := VerifyRRSIG([]*dnsmsg.Resource{rr}, sig.Data.(*dnsmsg.RDataRRSIG), s.DNSKEY(3600), now); err != nil {
+			t.Errorf("algorithm %d: failed to verify: %s", alg, err)
+		}
+
+		_, other, _ := GenerateKey(alg, FlagZone)
+		if _, err := NewSigner("example.", key, other); err != ErrKeyMismatch {
+			t.Errorf("algorithm %d: expected ErrKeyMismatch, got %v", alg, err)
+		}
+	}
+	if _, _, err := GenerateKey(RSASHA1, FlagZone); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+// opaqueSigner hides the type of the private key, as with a KMS
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestSignerOpaque(t *testing.T) {
+	rrset := []*dnsmsg.Resource{{Name: "www.example.", Type: dnsmsg.A, Class: dnsmsg.IN, TTL: 300, Data: &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A}}}
+	now := time.Now()
+	for _, alg := range []uint8{RSASHA256, ECDSAP256SHA256, ED25519} {
+		key, priv, err := GenerateKey(alg, FlagZone)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		s, err := NewSigner("example.", key, opaqueSigner{priv})
+		if err != nil {
+			t.Errorf("algorithm %d: failed to create signer: %s", alg, err)
+			continue
+		}
+		sig, err := s.Sign(rrset, now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Errorf("algorithm %d: failed to sign: %s", alg, err)
+			continue
+		}
+		if err := VerifyRRSIG(rrset, sig.Data.(*dnsmsg.RDataRRSIG), s.DNSKEY(3600), now); err != nil {
+			t.Errorf("algorithm %d: failed to verify: %s", alg, err)
+		}
+	}
+
+	// without checks, a wrong key makes bad signatures
+	key, _, _ := GenerateKey(ECDSAP256SHA256, FlagZone)
+	_, other, _ := GenerateKey(ECDSAP256SHA256, FlagZone)
+	s := NewSignerUnchecked("example.", key, other)
+	sig, err := s.Sign(rrset, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	if err := VerifyRRSIG(rrset, sig.Data.(*dnsmsg.RDataRRSIG), s.DNSKEY(3600), now); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature, got %v", err)
+	}
+}
+
+const testSignZone = `$ORIGIN example.
+@	3600	IN	SOA	ns1 admin 1 7200 3600 1209600 300
+	3600	IN	NS	ns1
+ns1	3600	IN	A	192.0.2.1
+www	3600	IN	A	192.0.2.2
+www	3600	IN	A	192.0.2.3
+*.w	3600	IN	MX	10 www
+sub	3600	IN	NS	ns.sub
+sub	3600	IN	A	192.0.2.5
+ns.sub	3600	IN	A	192.0.2.4
+sec	3600	IN	NS	ns1
+sec	3600	IN	AAAA	2001:db8::1
+sec	3600	IN	DS	12345 13 2 0123456789ABCDEF
+`
+
+func TestSignZone(t *testing.T) {
+	rrs, err := dnszone.Parse(strings.NewReader(testSignZone), "example.")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	newSigner := func(flags uint16) *Signer {
+		key, priv, err := GenerateKey(ECDSAP256SHA256, flags)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		s, err := NewSigner("example.", key, priv)
+		if err != nil {
+			t.Fatalf("failed to create signer: %s", err)
+		}
+		return s
+	}
+	ksk, zsk := newSigner(FlagZone|FlagSEP), newSigner(FlagZone)
+
+	now := time.Now()
+	signed, err := SignZone("example.", rrs, []*Signer{ksk}, []*Signer{zsk}, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to sign zone: %s", err)
+	}
+
+	// NSEC chain, in canonical order and without glue, even at the zone cuts
+	var chain []string
+	var nsecs, sigs, keys []*dnsmsg.Resource
+	for _, rr := range signed {
+		switch rr.Type {
+		case dnsmsg.NSEC:
+			chain = append(chain, rr.String())
+			nsecs = append(nsecs, rr)
+		case dnsmsg.RRSIG:
+			sigs = append(sigs, rr)
+		case dnsmsg.DNSKEY:
+			keys = append(keys, rr)
+		}
+	}
+	expect := []string{
+		"example. IN NSEC 300 ns1.example. NS SOA RRSIG NSEC DNSKEY",
+		"ns1.example. IN NSEC 300 sec.example. A RRSIG NSEC",
+		"sec.example. IN NSEC 300 sub.example. NS DS RRSIG NSEC",
+		"sub.example. IN NSEC 300 *.w.example. NS RRSIG NSEC",
+		"*.w.example. IN NSEC 300 www.example. MX RRSIG NSEC",
+		"www.example. IN NSEC 300 example. A RRSIG NSEC",
+	}
+	if strings.Join(chain, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected NSEC chain:\n%s", strings.Join(chain, "\n"))
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected 2 DNSKEY records, got %d", len(keys))
+	}
+
+	// every authoritative RRset is signed, by the KSK for DNSKEY
+	var tests = []struct {
+		name   dnsmsg.Name
+		typ    dnsmsg.Type
+		signed bool
+	}{
+		{"example.", dnsmsg.SOA, true},
+		{"example.", dnsmsg.NS, true},
+		{"example.", dnsmsg.DNSKEY, true},
+		{"www.example.", dnsmsg.A, true},
+		{"*.w.example.", dnsmsg.MX, true},
+		{"sec.example.", dnsmsg.DS, true},
+		{"sec.example.", dnsmsg.NS, false},
+		{"sub.example.", dnsmsg.NS, false},
+		{"sub.example.", dnsmsg.A, false},
+		{"sec.example.", dnsmsg.AAAA, false},
+		{"ns.sub.example.", dnsmsg.A, false},
+	}
+	for _, test := range tests {
+		rrset := records(signed, test.name, test.typ)
+		sig, err := VerifyRRset(rrset, sigs, keys, now)
+		if !test.signed {
+			if len(records(signed, test.name, dnsmsg.RRSIG)) > 0 && err != ErrNoSignature {
+				t.Errorf("%s %s: unexpected signature", test.name, test.typ)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: failed to verify: %s", test.name, test.typ, err)
+			continue
+		}
+		signer := zsk
+		if test.typ == dnsmsg.DNSKEY {
+			signer = ksk
+		}
+		if sig.KeyTag != KeyTag(signer.Key) {
+			t.Errorf("%s %s: signed with key %d", test.name, test.typ, sig.KeyTag)
+		}
+	}
+
+	// the chain proves the absence of names and types
+	q := &dnsmsg.Question{Name: "nope.example.", Type: dnsmsg.A, Class: dnsmsg.IN}
+	if err := VerifyDenialAt(q, dnsmsg.ErrName, nsecs, sigs, keys, now); err != nil {
+		t.Errorf("failed to verify NXDOMAIN: %s", err)
+	}
+	q = &dnsmsg.Question{Name: "sub.example.", Type: dnsmsg.DS, Class: dnsmsg.IN}
+	if err := VerifyDenialAt(q, dnsmsg.NoError, nsecs, sigs, keys, now); err != nil {
+		t.Errorf("failed to verify absence of DS: %s", err)
+	}
+
+	if _, err := SignZone("example.", rrs[1:], []*Signer{ksk}, nil, now, now); err != ErrNoSOA {
+		t.Errorf("expected ErrNoSOA, got %v", err)
+	}
+	if _, err := SignZone("example.org.", rrs, []*Signer{ksk}, nil, now, now); err != ErrOutOfZone {
+		t.Errorf("expected ErrOutOfZone, got %v", err)
+	}
+}
+
+func TestSignZoneNSEC3(t *testing.T) {
+	rrs, err := dnszone.Parse(strings.NewReader(testSignZone), "example.")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	key, priv, err := GenerateKey(ECDSAP256SHA256, FlagZone|FlagSEP)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	ksk, err := NewSigner("example.", key, priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+
+	now := time.Now()
+	for _, optOut := range []bool{false, true} {
+		param := &dnsmsg.RDataNSEC3PARAM{Hash: NSEC3SHA1, Iterations: 1, Salt: []byte{0xab, 0xcd}}
+		if optOut {
+			param.Flags = NSEC3OptOut
+		}
+		signed, err := SignZoneNSEC3("example.", rrs, []*Signer{ksk}, nil, now.Add(-time.Hour), now.Add(time.Hour), param)
+		if err != nil {
+			t.Fatalf("failed to sign zone: %s", err)
+		}
+		var nsec3s, sigs, keys []*dnsmsg.Resource
+		for _, rr := range signed {
+			switch rr.Type {
+			case dnsmsg.NSEC:
+				t.Errorf("unexpected NSEC record %s", rr)
+			case dnsmsg.NSEC3:
+				nsec3s = append(nsec3s, rr)
+			case dnsmsg.RRSIG:
+				sigs = append(sigs, rr)
+			case dnsmsg.DNSKEY:
+				keys = append(keys, rr)
+			}
+		}
+
+		// the authoritative names and the empty non-terminal w.example.,
+		// without the insecure delegation sub.example. with opt-out
+		expect := 7
+		if optOut {
+			expect = 6
+		}
+		if len(nsec3s) != expect {
+			t.Errorf("opt-out %v: expected %d NSEC3 records, got %d", optOut, expect, len(nsec3s))
+		}
+		if _, err := VerifyRRset(records(signed, "example.", dnsmsg.NSEC3PARAM), sigs, keys, now); err != nil {
+			t.Errorf("opt-out %v: failed to verify NSEC3PARAM: %s", optOut, err)
+		}
+
+		var tests = []struct {
+			name  dnsmsg.Name
+			typ   dnsmsg.Type
+			rcode dnsmsg.RCode
+		}{
+			{"nope.example.", dnsmsg.A, dnsmsg.ErrName},
+			{"www.example.", dnsmsg.AAAA, dnsmsg.NoError},
+			{"w.example.", dnsmsg.A, dnsmsg.NoError},
+			{"sub.example.", dnsmsg.DS, dnsmsg.NoError},
+		}
+		for _, test := range tests {
+			q := &dnsmsg.Question{Name: test.name, Type: test.typ, Class: dnsmsg.IN}
+			if err := VerifyDenialAt(q, test.rcode, nsec3s, sigs, keys, now); err != nil {
+				t.Errorf("opt-out %v: %s %s: failed to verify denial: %s", optOut, test.name, test.typ, err)
+			}
+		}
+	}
+}
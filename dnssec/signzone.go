@@ -0,0 +1,273 @@
+package dnssec
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var (
+	ErrOutOfZone = errors.New("record is not in the zone")
+	ErrNoKey     = errors.New("no signing key")
+)
+
+// SignZone returns the records of the zone at origin signed with NSEC
+// (RFC 4035 section 2). The DNSKEY RRset, which gets the keys of all signers
+// added, is signed by the ksks, and the other RRsets by the zsks, or the
+// ksks if there are none. At delegation points only the DS and NSEC RRsets
+// are signed, and the NSEC bitmap only lists NS, DS, RRSIG and NSEC. Names
+// below them (glue) or below a DNAME are left out of the NSEC chain. RRSIG,
+// NSEC, NSEC3 and NSEC3PARAM records in rrs are dropped.
+func SignZone(origin dnsmsg.Name, rrs []*dnsmsg.Resource, ksks, zsks []*Signer, inception, expiration time.Time) ([]*dnsmsg.Resource, error) {
+	return signZone(origin, rrs, ksks, zsks, inception, expiration, nil)
+}
+
+// SignZoneNSEC3 is like SignZone, but proves the denial of existence with
+// NSEC3 records hashed with the parameters of param, which is added to the
+// apex (RFC 5155 section 7.1). Empty non-terminals get an NSEC3 record. If
+// the opt-out flag of param is set, delegations without DS records have
+// none, and the NSEC3 records covering them have the flag set.
+func SignZoneNSEC3(origin dnsmsg.Name, rrs []*dnsmsg.Resource, ksks, zsks []*Signer, inception, expiration time.Time, param *dnsmsg.RDataNSEC3PARAM) ([]*dnsmsg.Resource, error) {
+	if param == nil {
+		return nil, ErrUnsupported
+	}
+	return signZone(origin, rrs, ksks, zsks, inception, expiration, param)
+}
+
+// signZone signs the zone at origin, with NSEC3 if param is not nil
+func signZone(origin dnsmsg.Name, rrs []*dnsmsg.Resource, ksks, zsks []*Signer, inception, expiration time.Time, param *dnsmsg.RDataNSEC3PARAM) ([]*dnsmsg.Resource, error) {
+	if param != nil && param.Hash != NSEC3SHA1 {
+		return nil, ErrUnsupported
+	}
+	if len(ksks) == 0 {
+		return nil, ErrNoKey
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+	for _, s := range append(slices.Clip(ksks), zsks...) {
+		if !s.Zone.Equal(origin) {
+			return nil, ErrOutOfZone
+		}
+	}
+	soa, soaRR := apexSOA(origin, rrs)
+	if soa == nil {
+		return nil, ErrNoSOA
+	}
+
+	// RRsets by name
+	type rrsetKey struct {
+		name dnsmsg.Name
+		typ  dnsmsg.Type
+	}
+	sets := make(map[rrsetKey][]*dnsmsg.Resource)
+	types := make(map[dnsmsg.Name][]dnsmsg.Type)
+	owners := make(map[dnsmsg.Name]dnsmsg.Name)
+	add := func(rr *dnsmsg.Resource) {
+		name := rr.Name.Canonical()
+		k := rrsetKey{name, rr.Type}
+		if _, ok := sets[k]; !ok {
+			types[name] = append(types[name], rr.Type)
+		}
+		if _, ok := owners[name]; !ok {
+			owners[name] = rr.Name
+		}
+		sets[k] = append(sets[k], rr)
+	}
+	for _, rr := range rrs {
+		if !rr.Name.IsSubDomainOf(origin) {
+			return nil, ErrOutOfZone
+		}
+		switch rr.Type {
+		case dnsmsg.RRSIG, dnsmsg.NSEC, dnsmsg.NSEC3, dnsmsg.NSEC3PARAM:
+			continue
+		}
+		add(rr)
+	}
+
+	// keys of the signers missing from the DNSKEY RRset
+	apex := origin.Canonical()
+	keyTTL := soaRR.TTL
+	if keys := sets[rrsetKey{apex, dnsmsg.DNSKEY}]; len(keys) > 0 {
+		keyTTL = keys[0].TTL
+	}
+	for _, s := range append(slices.Clip(ksks), zsks...) {
+		found := false
+		for _, rr := range sets[rrsetKey{apex, dnsmsg.DNSKEY}] {
+			if k, ok := rr.Data.(*dnsmsg.RDataDNSKEY); ok && k.Flags == s.Key.Flags && k.Algorithm == s.Key.Algorithm && bytes.Equal(k.PublicKey, s.Key.PublicKey) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add(s.DNSKEY(keyTTL))
+		}
+	}
+
+	names := make([]dnsmsg.Name, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Compare(names[j]) < 0 })
+
+	// zone cuts and DNAMEs, whose descendants are not authoritative
+	var cuts []dnsmsg.Name
+	for _, name := range names {
+		if name != apex && slices.Contains(types[name], dnsmsg.NS) || slices.Contains(types[name], dnsmsg.DNAME) {
+			cuts = append(cuts, name)
+		}
+	}
+	occluded := func(name dnsmsg.Name) bool {
+		for _, c := range cuts {
+			if name != c && name.IsSubDomainOf(c) {
+				return true
+			}
+		}
+		return false
+	}
+	var auth []dnsmsg.Name
+	for _, name := range names {
+		if !occluded(name) {
+			auth = append(auth, name)
+		}
+	}
+
+	// RFC 9077 section 3.3
+	nsecTTL := min(soa.Minimum, soaRR.TTL)
+	nsecs := make(map[dnsmsg.Name]*dnsmsg.Resource)
+	var nsec3s []*dnsmsg.Resource
+	if param != nil {
+		// the parameters are given with the flags cleared (RFC 5155
+		// section 4.1.2)
+		add(&dnsmsg.Resource{Name: owners[apex], Type: dnsmsg.NSEC3PARAM, Class: soaRR.Class, TTL: nsecTTL,
+			Data: &dnsmsg.RDataNSEC3PARAM{Hash: param.Hash, Iterations: param.Iterations, Salt: param.Salt}})
+		var err error
+		if nsec3s, err = nsec3Chain(origin, auth, types, param, soaRR.Class, nsecTTL); err != nil {
+			return nil, err
+		}
+		auth = nil
+	}
+	for i, name := range auth {
+		next := owners[auth[(i+1)%len(auth)]]
+		bitmap := append(slices.Clone(types[name]), dnsmsg.NSEC, dnsmsg.RRSIG)
+		if name != apex && slices.Contains(bitmap, dnsmsg.NS) {
+			// glue at a delegation point is not authoritative (RFC 4035
+			// section 2.3)
+			bitmap = slices.DeleteFunc(bitmap, func(t dnsmsg.Type) bool {
+				return t != dnsmsg.NS && t != dnsmsg.DS && t != dnsmsg.NSEC && t != dnsmsg.RRSIG
+			})
+		}
+		slices.Sort(bitmap)
+		nsecs[name] = &dnsmsg.Resource{Name: owners[name], Type: dnsmsg.NSEC, Class: soaRR.Class, TTL: nsecTTL,
+			Data: &dnsmsg.RDataNSEC{NextDomain: string(next), Types: bitmap}}
+	}
+
+	var res []*dnsmsg.Resource
+	sign := func(rrset []*dnsmsg.Resource, signers []*Signer) error {
+		res = append(res, rrset...)
+		for _, s := range signers {
+			sig, err := s.Sign(rrset, inception, expiration)
+			if err != nil {
+				return err
+			}
+			res = append(res, sig)
+		}
+		return nil
+	}
+	for _, name := range names {
+		t := slices.Clone(types[name])
+		slices.Sort(t)
+		glue := occluded(name)
+		delegation := name != apex && slices.Contains(t, dnsmsg.NS)
+		for _, typ := range t {
+			rrset := sets[rrsetKey{name, typ}]
+			signers := zsks
+			switch {
+			case glue || delegation && typ != dnsmsg.DS:
+				// glue and delegation NS records are not signed
+				signers = nil
+			case name == apex && typ == dnsmsg.DNSKEY:
+				signers = ksks
+			}
+			if err := sign(rrset, signers); err != nil {
+				return nil, err
+			}
+		}
+		if nsec, ok := nsecs[name]; ok {
+			if err := sign([]*dnsmsg.Resource{nsec}, zsks); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, nsec3 := range nsec3s {
+		if err := sign([]*dnsmsg.Resource{nsec3}, zsks); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// nsec3Chain returns the NSEC3 records of auth, the authoritative names of
+// the zone at origin in canonical order, and of the empty non-terminals
+// above them, sorted by hash
+func nsec3Chain(origin dnsmsg.Name, auth []dnsmsg.Name, types map[dnsmsg.Name][]dnsmsg.Type, param *dnsmsg.RDataNSEC3PARAM, class dnsmsg.Class, ttl uint32) ([]*dnsmsg.Resource, error) {
+	apex := origin.Canonical()
+	optOut := param.Flags&NSEC3OptOut != 0
+
+	type entry struct {
+		hash  []byte
+		types []dnsmsg.Type
+	}
+	var chain []*entry
+	seen := make(map[dnsmsg.Name]bool)
+	for _, name := range auth {
+		t := types[name]
+		delegation := name != apex && slices.Contains(t, dnsmsg.NS)
+		if delegation && optOut && !slices.Contains(t, dnsmsg.DS) {
+			// insecure delegation, covered by an opt-out record
+			continue
+		}
+		// names between name and the apex with no records of their own
+		for n := name; !seen[n]; n = parentName(n) {
+			seen[n] = true
+			var bitmap []dnsmsg.Type
+			if n == name {
+				bitmap = slices.Clone(t)
+				if delegation {
+					bitmap = slices.DeleteFunc(bitmap, func(t dnsmsg.Type) bool { return t != dnsmsg.NS && t != dnsmsg.DS })
+				}
+				if !delegation || slices.Contains(bitmap, dnsmsg.DS) {
+					bitmap = append(bitmap, dnsmsg.RRSIG)
+				}
+				slices.Sort(bitmap)
+			}
+			h, err := NSEC3Hash(n, param.Hash, param.Iterations, param.Salt)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, &entry{h, bitmap})
+			if n == apex {
+				break
+			}
+		}
+	}
+	slices.SortFunc(chain, func(a, b *entry) int { return bytes.Compare(a.hash, b.hash) })
+
+	var flags uint8
+	if optOut {
+		flags = NSEC3OptOut
+	}
+	res := make([]*dnsmsg.Resource, 0, len(chain))
+	for i, e := range chain {
+		owner := dnsmsg.Name(strings.ToLower(nsec3Encoding.EncodeToString(e.hash)) + "." + string(apex))
+		res = append(res, &dnsmsg.Resource{Name: owner, Type: dnsmsg.NSEC3, Class: class, TTL: ttl,
+			Data: &dnsmsg.RDataNSEC3{Hash: param.Hash, Flags: flags, Iterations: param.Iterations, Salt: param.Salt,
+				NextHashed: chain[(i+1)%len(chain)].hash, Types: e.types}})
+	}
+	return res, nil
+}
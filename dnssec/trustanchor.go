@@ -0,0 +1,360 @@
+package dnssec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// AnchorState is the state of a trust anchor (RFC 5011 section 4)
+type AnchorState int
+
+const (
+	AnchorAddPend AnchorState = iota // new key, waiting for the hold-down time
+	AnchorValid                      // trusted key
+	AnchorMissing                    // trusted key absent from the DNSKEY RRset
+	AnchorRevoked                    // key revoked by its owner
+)
+
+var anchorStates = [...]string{"addpend", "valid", "missing", "revoked"}
+
+func (s AnchorState) String() string {
+	if int(s) < len(anchorStates) {
+		return anchorStates[s]
+	}
+	return fmt.Sprintf("AnchorState(%d)", int(s))
+}
+
+func (s AnchorState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *AnchorState) UnmarshalText(b []byte) error {
+	for i, v := range anchorStates {
+		if v == string(b) {
+			*s = AnchorState(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown anchor state %s", b)
+}
+
+// Default timers of RFC 5011 section 2.4.1 and 2.3
+const (
+	DefaultHoldDown = 30 * 24 * time.Hour
+
+	minRefresh = time.Hour
+	maxRefresh = 15 * 24 * time.Hour
+)
+
+var ErrNoTrustedKey = errors.New("DNSKEY RRset is not signed by a trusted key")
+
+// TrustAnchor is a key tracked by a TrustAnchorManager. Anchors configured
+// with a DS record only have DS set until the key is seen.
+type TrustAnchor struct {
+	Key     *dnsmsg.RDataDNSKEY `json:"key,omitempty"`
+	DS      *dnsmsg.RDataDS     `json:"ds,omitempty"`
+	State   AnchorState         `json:"state"`
+	Changed time.Time           `json:"changed"` // time of the last state change
+}
+
+// matches returns true if key is the key of the anchor, ignoring its
+// revoked flag
+func (a *TrustAnchor) matches(key *dnsmsg.Resource) bool {
+	k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+	if !ok {
+		return false
+	}
+	if a.Key != nil {
+		return a.Key.Algorithm == k.Algorithm && bytes.Equal(a.Key.PublicKey, k.PublicKey)
+	}
+	ds, err := NewDS(key, a.DS.DigestType)
+	return err == nil && ds.KeyTag == a.DS.KeyTag && ds.Algorithm == a.DS.Algorithm && bytes.Equal(ds.Digest, a.DS.Digest)
+}
+
+// trusted returns true if the anchor can be used to validate
+func (a *TrustAnchor) trusted() bool {
+	return a.State == AnchorValid || a.State == AnchorMissing
+}
+
+// TrustAnchorManager keeps the trust anchors of a zone, typically the root,
+// up to date by following the rollovers of its keys as described in RFC
+// 5011. Keys signed by a trusted key become trusted after a hold-down time,
+// and trusted keys that revoke themselves are removed.
+type TrustAnchorManager struct {
+	Zone      dnsmsg.Name
+	Fetch     FetchFunc
+	StateFile string           // file the anchors are saved to and loaded from, if set
+	HoldDown  time.Duration    // DefaultHoldDown if zero
+	Now       func() time.Time // current time, time.Now if nil
+
+	lk      sync.Mutex
+	anchors []*TrustAnchor
+	next    time.Duration // time before the next refresh
+}
+
+// NewTrustAnchorManager returns a manager for zone, starting with the state
+// saved in stateFile if it exists, or with the initial DS or DNSKEY records
+func NewTrustAnchorManager(zone dnsmsg.Name, fetch FetchFunc, initial []*dnsmsg.Resource, stateFile string) (*TrustAnchorManager, error) {
+	m := &TrustAnchorManager{Zone: zone, Fetch: fetch, StateFile: stateFile}
+	if stateFile != "" {
+		buf, err := os.ReadFile(stateFile)
+		if err == nil {
+			if err := json.Unmarshal(buf, &m.anchors); err != nil {
+				return nil, fmt.Errorf("invalid trust anchor state in %s: %w", stateFile, err)
+			}
+			return m, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	for _, rr := range initial {
+		if !rr.Name.Equal(zone) {
+			continue
+		}
+		switch data := rr.Data.(type) {
+		case *dnsmsg.RDataDS:
+			m.anchors = append(m.anchors, &TrustAnchor{DS: data, State: AnchorValid})
+		case *dnsmsg.RDataDNSKEY:
+			m.anchors = append(m.anchors, &TrustAnchor{Key: data, State: AnchorValid})
+		}
+	}
+	if len(m.anchors) == 0 {
+		return nil, ErrNoTrustedKey
+	}
+	return m, nil
+}
+
+func (m *TrustAnchorManager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// State returns a copy of the tracked anchors
+func (m *TrustAnchorManager) State() []TrustAnchor {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	res := make([]TrustAnchor, len(m.anchors))
+	for i, a := range m.anchors {
+		res[i] = *a
+	}
+	return res
+}
+
+// Anchors returns the trusted keys, as DNSKEY records or DS records for
+// keys not seen yet, for use in ValidatorConfig.Anchors
+func (m *TrustAnchorManager) Anchors() []*dnsmsg.Resource {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	var res []*dnsmsg.Resource
+	for _, a := range m.anchors {
+		if !a.trusted() {
+			continue
+		}
+		if a.Key != nil {
+			res = append(res, &dnsmsg.Resource{Name: m.Zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, Data: a.Key})
+		} else {
+			res = append(res, &dnsmsg.Resource{Name: m.Zone, Type: dnsmsg.DS, Class: dnsmsg.IN, Data: a.DS})
+		}
+	}
+	return res
+}
+
+// Refresh fetches the DNSKEY RRset of the zone and updates the state of the
+// anchors (RFC 5011 section 4). Nothing changes unless the RRset is signed
+// by a trusted key.
+func (m *TrustAnchorManager) Refresh(ctx context.Context) error {
+	msg, err := m.Fetch(ctx, m.Zone, dnsmsg.DNSKEY)
+	if err != nil {
+		return err
+	}
+	keys := records(msg.Answer, m.Zone, dnsmsg.DNSKEY)
+	now := m.now()
+	holdDown := m.HoldDown
+	if holdDown == 0 {
+		holdDown = DefaultHoldDown
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	var trusted []*dnsmsg.Resource
+	for _, key := range keys {
+		k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+		if !ok || k.Flags&FlagRevoke != 0 {
+			continue
+		}
+		for _, a := range m.anchors {
+			if a.trusted() && a.matches(key) {
+				trusted = append(trusted, key)
+			}
+		}
+	}
+	sig, err := VerifyRRset(keys, msg.Answer, trusted, now)
+	if err != nil {
+		if len(trusted) == 0 {
+			return ErrNoTrustedKey
+		}
+		return err
+	}
+	m.next = refreshInterval(sig, now)
+
+	changed := false
+	set := func(a *TrustAnchor, state AnchorState) {
+		a.State, a.Changed = state, now
+		changed = true
+	}
+
+	seen := make(map[*TrustAnchor]bool)
+	for _, key := range keys {
+		k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+		if !ok || k.Flags&FlagSEP == 0 {
+			continue
+		}
+		var a *TrustAnchor
+		for _, o := range m.anchors {
+			if o.matches(key) {
+				a = o
+				break
+			}
+		}
+
+		if k.Flags&FlagRevoke != 0 {
+			// only the key itself can revoke it (RFC 5011 section 2.1)
+			if a == nil || a.State == AnchorRevoked {
+				continue
+			}
+			if _, err := VerifyRRset(keys, msg.Answer, []*dnsmsg.Resource{key}, now); err != nil {
+				continue
+			}
+			a.Key = k
+			set(a, AnchorRevoked)
+			seen[a] = true
+			continue
+		}
+
+		if a == nil {
+			a = &TrustAnchor{Key: k}
+			m.anchors = append(m.anchors, a)
+			set(a, AnchorAddPend)
+			seen[a] = true
+			continue
+		}
+		seen[a] = true
+		if a.Key == nil {
+			a.Key, a.DS = k, nil
+			changed = true
+		}
+		switch a.State {
+		case AnchorAddPend:
+			if now.Sub(a.Changed) >= holdDown {
+				set(a, AnchorValid)
+			}
+		case AnchorMissing:
+			set(a, AnchorValid)
+		}
+	}
+
+	anchors := m.anchors[:0]
+	for _, a := range m.anchors {
+		switch {
+		case a.State == AnchorRevoked:
+			if now.Sub(a.Changed) >= holdDown {
+				// remove hold-down time (RFC 5011 section 2.5)
+				changed = true
+				continue
+			}
+		case seen[a]:
+		case a.State == AnchorAddPend:
+			// gone before the end of the hold-down time
+			changed = true
+			continue
+		case a.State == AnchorValid && a.Key != nil:
+			set(a, AnchorMissing)
+		}
+		anchors = append(anchors, a)
+	}
+	m.anchors = anchors
+
+	if changed {
+		return m.save()
+	}
+	return nil
+}
+
+// refreshInterval returns the active refresh interval after the DNSKEY
+// RRset signed by sig was fetched (RFC 5011 section 2.3)
+func refreshInterval(sig *dnsmsg.RDataRRSIG, now time.Time) time.Duration {
+	res := min(maxRefresh, time.Duration(sig.OrigTTL)*time.Second/2)
+	if exp := time.Unix(int64(sig.Expiration), 0).Sub(now) / 2; exp < res {
+		res = exp
+	}
+	return max(res, minRefresh)
+}
+
+// save writes the anchors to the state file
+func (m *TrustAnchorManager) save() error {
+	if m.StateFile == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(m.anchors, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := m.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.StateFile)
+}
+
+// Run refreshes the anchors until ctx is done, at the interval given by the
+// TTL and signatures of the DNSKEY RRset, retrying every hour after a
+// failure. onChange, if not nil, is called with the new anchors whenever the
+// trusted keys change, for example to update a Validator.
+func (m *TrustAnchorManager) Run(ctx context.Context, onChange func(anchors []*dnsmsg.Resource)) {
+	for {
+		before := m.Anchors()
+		next := minRefresh
+		if err := m.Refresh(ctx); err == nil {
+			m.lk.Lock()
+			next = m.next
+			m.lk.Unlock()
+		}
+		if after := m.Anchors(); onChange != nil && !sameAnchors(before, after) {
+			onChange(after)
+		}
+
+		t := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sameAnchors returns true if a and b hold the same records
+func sameAnchors(a, b []*dnsmsg.Resource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
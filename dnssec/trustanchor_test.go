@@ -0,0 +1,118 @@
+package dnssec
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestTrustAnchorManager(t *testing.T) {
+	priv1, key1 := newTestKey(t, ".")
+	priv2, key2 := newTestKey(t, ".")
+	key1.Data.(*dnsmsg.RDataDNSKEY).Flags |= FlagSEP
+	key2.Data.(*dnsmsg.RDataDNSKEY).Flags |= FlagSEP
+	ds, err := NewDS(key1, DigestSHA256)
+	if err != nil {
+		t.Fatalf("failed to compute DS: %s", err)
+	}
+
+	// the DNSKEY RRset served at each refresh, signed by the given keys
+	now := time.Now()
+	var keys []*dnsmsg.Resource
+	var signers []*ecdsa.PrivateKey
+	fetch := func(ctx context.Context, name dnsmsg.Name, typ dnsmsg.Type) (*dnsmsg.Message, error) {
+		msg := &dnsmsg.Message{Answer: append([]*dnsmsg.Resource{}, keys...)}
+		for i, priv := range signers {
+			msg.Answer = append(msg.Answer, signTestAt(t, now, priv, keys[i], keys...))
+		}
+		return msg, nil
+	}
+
+	file := filepath.Join(t.TempDir(), "root.json")
+	m, err := NewTrustAnchorManager(".", fetch, []*dnsmsg.Resource{{Name: ".", Type: dnsmsg.DS, Class: dnsmsg.IN, Data: ds}}, file)
+	if err != nil {
+		t.Fatalf("failed to create manager: %s", err)
+	}
+	m.Now = func() time.Time { return now }
+
+	check := func(step string, expect ...AnchorState) {
+		t.Helper()
+		var states []AnchorState
+		for _, a := range m.State() {
+			states = append(states, a.State)
+		}
+		if !reflect.DeepEqual(states, expect) {
+			t.Errorf("%s: got states %v, expected %v", step, states, expect)
+		}
+	}
+	refresh := func(step string, d time.Duration) {
+		t.Helper()
+		now = now.Add(d)
+		if err := m.Refresh(context.Background()); err != nil {
+			t.Fatalf("%s: failed to refresh: %s", step, err)
+		}
+	}
+
+	keys, signers = []*dnsmsg.Resource{key1}, []*ecdsa.PrivateKey{priv1}
+	refresh("initial", 0)
+	check("initial", AnchorValid)
+	if a := m.State()[0]; a.Key == nil || a.DS != nil {
+		t.Errorf("initial: DS anchor not replaced by its key")
+	}
+
+	// new key, trusted after the hold-down time
+	keys = []*dnsmsg.Resource{key1, key2}
+	refresh("publish", time.Hour)
+	check("publish", AnchorValid, AnchorAddPend)
+	if len(m.Anchors()) != 1 {
+		t.Errorf("publish: untrusted key in anchors")
+	}
+	refresh("hold-down", 15*24*time.Hour)
+	check("hold-down", AnchorValid, AnchorAddPend)
+	refresh("trusted", 15*24*time.Hour)
+	check("trusted", AnchorValid, AnchorValid)
+
+	// the new key signs, the old key revokes itself
+	revoked := *key1
+	rk := *key1.Data.(*dnsmsg.RDataDNSKEY)
+	rk.Flags |= FlagRevoke
+	revoked.Data = &rk
+	keys, signers = []*dnsmsg.Resource{key2, &revoked}, []*ecdsa.PrivateKey{priv2, priv1}
+	refresh("revoke", time.Hour)
+	check("revoke", AnchorRevoked, AnchorValid)
+	if a := m.Anchors(); len(a) != 1 || a[0].Data.(*dnsmsg.RDataDNSKEY) != key2.Data {
+		t.Errorf("revoke: unexpected anchors %v", a)
+	}
+
+	// state survives restarts
+	m2, err := NewTrustAnchorManager(".", fetch, nil, file)
+	if err != nil {
+		t.Fatalf("failed to load state: %s", err)
+	}
+	if s1, s2 := m.State(), m2.State(); len(s1) != len(s2) || s1[0].State != s2[0].State || !s1[0].Changed.Equal(s2[0].Changed) {
+		t.Errorf("unexpected loaded state %v", s2)
+	}
+
+	// DNSKEY records left undecoded are ignored
+	raw := &dnsmsg.Resource{Name: ".", Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: 3600,
+		Data: &dnsmsg.RDataRaw{Data: append([]byte{1, 1, 3, ECDSAP256SHA256}, make([]byte, 64)...), Type: dnsmsg.DNSKEY}}
+	keys, signers = []*dnsmsg.Resource{key2, raw}, []*ecdsa.PrivateKey{priv2}
+	refresh("raw", time.Hour)
+	check("raw", AnchorRevoked, AnchorValid)
+
+	keys, signers = []*dnsmsg.Resource{key2}, []*ecdsa.PrivateKey{priv2}
+	refresh("remove", 31*24*time.Hour)
+	check("remove", AnchorValid)
+
+	// unknown key only
+	keys, signers = []*dnsmsg.Resource{key1}, []*ecdsa.PrivateKey{priv1}
+	if err := m.Refresh(context.Background()); err != ErrNoTrustedKey {
+		t.Errorf("expected ErrNoTrustedKey, got %v", err)
+	}
+	check("untrusted", AnchorValid)
+}
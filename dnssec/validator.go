@@ -0,0 +1,384 @@
+package dnssec
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// State is the result of the validation of an RRset (RFC 4033 section 5)
+type State int
+
+const (
+	Indeterminate State = iota // no trust anchor covers the name
+	Secure                     // signed along a chain of trust from an anchor
+	Insecure                   // below a proven unsigned delegation
+	Bogus                      // should be signed, but validation failed
+)
+
+func (s State) String() string {
+	switch s {
+	case Secure:
+		return "secure"
+	case Insecure:
+		return "insecure"
+	case Bogus:
+		return "bogus"
+	}
+	return "indeterminate"
+}
+
+// DefaultMaxZones is the default number of names whose validated state is
+// cached by a Validator
+const DefaultMaxZones = 10000
+
+// bogusTTL is how long failures are cached (RFC 4035 section 4.7)
+const bogusTTL = time.Minute
+
+// FetchFunc queries the records of type t at name, typically through a
+// recursive resolver with the DO and CD bits set. The response must include
+// the RRSIG records of the answer and, for negative answers, the NSEC or
+// NSEC3 records and their signatures in the authority section.
+type FetchFunc func(ctx context.Context, name dnsmsg.Name, t dnsmsg.Type) (*dnsmsg.Message, error)
+
+// ValidatorConfig is the configuration of a Validator
+type ValidatorConfig struct {
+	Fetch   FetchFunc
+	Anchors []*dnsmsg.Resource // DS or DNSKEY records of the trusted keys
+	Now     func() time.Time   // current time, time.Now if nil
+
+	// MaxZones is the number of names whose validated state is cached,
+	// DefaultMaxZones if 0. The least recently used are dropped first.
+	MaxZones int
+
+	// AllowSHA1 enables the verification of signatures with the RSASHA1
+	// and RSASHA1-NSEC3-SHA1 algorithms (5 and 7), still found in many
+	// zones. Zones signed only with these are otherwise insecure.
+	AllowSHA1 bool
+}
+
+// Validator validates RRsets along the chain of trust from its trust
+// anchors, fetching the DS and DNSKEY RRsets of the zones on the way. The
+// validated keys of each zone are cached for their TTL.
+type Validator struct {
+	cfg ValidatorConfig
+
+	lk      sync.Mutex
+	anchors []*dnsmsg.Resource
+	zones   map[dnsmsg.Name]*list.Element // of *zoneEntry
+	lru     *list.List                    // most recently used first
+}
+
+// zoneEntry is the validated state of a name, and the keys of its zone
+type zoneEntry struct {
+	name    dnsmsg.Name // canonical, key in the cache
+	state   State
+	zone    dnsmsg.Name        // apex of the zone containing the name
+	keys    []*dnsmsg.Resource // DNSKEY RRset of the zone, if secure
+	err     error              // reason of a bogus state
+	expires time.Time
+}
+
+// NewValidator returns a Validator using cfg
+func NewValidator(cfg *ValidatorConfig) *Validator {
+	v := &Validator{cfg: *cfg, anchors: cfg.Anchors, zones: make(map[dnsmsg.Name]*list.Element), lru: list.New()}
+	if v.cfg.Now == nil {
+		v.cfg.Now = time.Now
+	}
+	if v.cfg.MaxZones <= 0 {
+		v.cfg.MaxZones = DefaultMaxZones
+	}
+	return v
+}
+
+// Validate returns the validation state of rrset. sigs holds its RRSIG
+// records and, for answers synthesized from a wildcard, the NSEC or NSEC3
+// records proving that the name does not exist with their own RRSIG
+// records. An error is returned with the Bogus state to explain it, or with
+// the Indeterminate state if the DS and DNSKEY records could not be fetched.
+func (v *Validator) Validate(ctx context.Context, rrset, sigs []*dnsmsg.Resource) (State, error) {
+	if len(rrset) == 0 {
+		return Indeterminate, ErrInvalidRRset
+	}
+	owner := rrset[0].Name
+
+	var signer dnsmsg.Name
+	for _, rr := range sigs {
+		if sig, ok := rr.Data.(*dnsmsg.RDataRRSIG); ok && sig.TypeCovered == rrset[0].Type && rr.Name.Equal(owner) {
+			signer = dnsmsg.Name(sig.SignerName)
+			break
+		}
+	}
+	if signer == "" || !owner.IsSubDomainOf(signer) {
+		// unsigned, which is only fine in an insecure zone
+		e, err := v.zoneOf(ctx, owner)
+		if err != nil {
+			return Indeterminate, err
+		}
+		if e.state == Secure {
+			return Bogus, ErrNoSignature
+		}
+		return e.state, e.err
+	}
+
+	e, err := v.zoneOf(ctx, signer)
+	if err != nil {
+		return Indeterminate, err
+	}
+	if e.state != Secure {
+		return e.state, e.err
+	}
+	if !e.zone.Equal(signer) {
+		// the signer is not the apex of a zone
+		return Bogus, ErrNoSignature
+	}
+	now := v.cfg.Now()
+	sig, err := verifyRRset(rrset, sigs, e.keys, now, v.cfg.AllowSHA1)
+	if err != nil {
+		return Bogus, err
+	}
+	if l := owner.SplitLabels(); int(sig.Labels) < len(l) && l[0] != "*" {
+		if err := verifyWildcard(owner, sig.Labels, sigs, sigs, e.keys, now, v.cfg.AllowSHA1); err != nil {
+			return Bogus, err
+		}
+	}
+	return Secure, nil
+}
+
+// SetAnchors replaces the trust anchors, for example after a rollover
+// tracked by a TrustAnchorManager, and clears the cache
+func (v *Validator) SetAnchors(anchors []*dnsmsg.Resource) {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	v.anchors = anchors
+	v.zones = make(map[dnsmsg.Name]*list.Element)
+	v.lru.Init()
+}
+
+// cached returns the cached state of name, if still valid at now. Expired
+// entries are removed.
+func (v *Validator) cached(name dnsmsg.Name, now time.Time) *zoneEntry {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	el, ok := v.zones[name]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*zoneEntry)
+	if !now.Before(e.expires) {
+		v.lru.Remove(el)
+		delete(v.zones, name)
+		return nil
+	}
+	v.lru.MoveToFront(el)
+	return e
+}
+
+// store caches e, dropping the least recently used entries past MaxZones
+func (v *Validator) store(e *zoneEntry) {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	if el, ok := v.zones[e.name]; ok {
+		el.Value = e
+		v.lru.MoveToFront(el)
+		return
+	}
+	v.zones[e.name] = v.lru.PushFront(e)
+	for v.lru.Len() > v.cfg.MaxZones {
+		el := v.lru.Back()
+		v.lru.Remove(el)
+		delete(v.zones, el.Value.(*zoneEntry).name)
+	}
+}
+
+// anchor returns the closest trust anchor of name, or an empty name, and the
+// anchors
+func (v *Validator) anchor(name dnsmsg.Name) (dnsmsg.Name, []*dnsmsg.Resource) {
+	v.lk.Lock()
+	anchors := v.anchors
+	v.lk.Unlock()
+
+	var res dnsmsg.Name
+	for _, rr := range anchors {
+		if name.IsSubDomainOf(rr.Name) && (res == "" || rr.Name.CountLabels() > res.CountLabels()) {
+			res = rr.Name
+		}
+	}
+	return res, anchors
+}
+
+// zoneOf returns the validated state of name, walking down from its trust
+// anchor
+func (v *Validator) zoneOf(ctx context.Context, name dnsmsg.Name) (*zoneEntry, error) {
+	name = name.Canonical()
+	now := v.cfg.Now()
+	e := v.cached(name, now)
+	if m := getMetrics(); m != nil {
+		m.KeyCache(e != nil)
+	}
+	if e != nil {
+		return e, nil
+	}
+
+	anchor, anchors := v.anchor(name)
+	if anchor == "" {
+		return &zoneEntry{state: Indeterminate}, nil
+	}
+	var err error
+	if anchor.Equal(name) {
+		e, err = v.anchorZone(ctx, name, anchors, now)
+	} else {
+		var parent *zoneEntry
+		parent, err = v.zoneOf(ctx, parentName(name))
+		if err != nil || parent.state != Secure {
+			return parent, err
+		}
+		e, err = v.descend(ctx, parent, name, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.name = name
+	v.store(e)
+	return e, nil
+}
+
+// bogus returns an entry for a failed validation
+func bogus(err error, now time.Time) *zoneEntry {
+	return &zoneEntry{state: Bogus, err: err, expires: now.Add(bogusTTL)}
+}
+
+// expiry returns the time the validation of rrs expires, after the lowest of
+// their TTLs
+func expiry(now time.Time, rrs ...[]*dnsmsg.Resource) time.Time {
+	ttl := uint32(0xffffffff)
+	for _, l := range rrs {
+		for _, rr := range l {
+			ttl = min(ttl, rr.TTL)
+		}
+	}
+	return now.Add(time.Duration(ttl) * time.Second)
+}
+
+// records returns the records of type t at name in rrs
+func records(rrs []*dnsmsg.Resource, name dnsmsg.Name, t dnsmsg.Type) []*dnsmsg.Resource {
+	var res []*dnsmsg.Resource
+	for _, rr := range rrs {
+		if rr.Type == t && rr.Name.Equal(name) {
+			res = append(res, rr)
+		}
+	}
+	return res
+}
+
+// anchorZone validates the DNSKEY RRset of the trust anchor at name
+func (v *Validator) anchorZone(ctx context.Context, name dnsmsg.Name, anchors []*dnsmsg.Resource, now time.Time) (*zoneEntry, error) {
+	msg, err := v.cfg.Fetch(ctx, name, dnsmsg.DNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	keys := records(msg.Answer, name, dnsmsg.DNSKEY)
+
+	var trusted []*dnsmsg.Resource
+	for _, key := range keys {
+		k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+		if !ok || k.Flags&FlagRevoke != 0 {
+			continue
+		}
+		for _, a := range anchors {
+			if !a.Name.Equal(name) {
+				continue
+			}
+			switch ad := a.Data.(type) {
+			case *dnsmsg.RDataDS:
+				if ds, err := NewDS(key, ad.DigestType); err == nil && ds.KeyTag == ad.KeyTag && ds.Algorithm == ad.Algorithm && bytes.Equal(ds.Digest, ad.Digest) {
+					trusted = append(trusted, key)
+				}
+			case *dnsmsg.RDataDNSKEY:
+				if ad.Algorithm == k.Algorithm && bytes.Equal(ad.PublicKey, k.PublicKey) {
+					trusted = append(trusted, key)
+				}
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return bogus(ErrNoSignature, now), nil
+	}
+	if _, err := verifyRRset(keys, msg.Answer, trusted, now, v.cfg.AllowSHA1); err != nil {
+		return bogus(err, now), nil
+	}
+	return &zoneEntry{state: Secure, zone: name, keys: keys, expires: expiry(now, keys)}, nil
+}
+
+// descend returns the state of name, whose parent is in the secure zone of
+// parent, by checking if name has a DS RRset in that zone
+func (v *Validator) descend(ctx context.Context, parent *zoneEntry, name dnsmsg.Name, now time.Time) (*zoneEntry, error) {
+	msg, err := v.cfg.Fetch(ctx, name, dnsmsg.DS)
+	if err != nil {
+		return nil, err
+	}
+
+	dss := records(msg.Answer, name, dnsmsg.DS)
+	if len(dss) == 0 {
+		// there must be a proof that there is no DS, then either name is
+		// an insecure delegation, or it is in the same zone as its parent
+		d, err := newDenial(msg.Authority, msg.Authority, parent.keys, now, v.cfg.AllowSHA1)
+		if err == ErrNSEC3Iterations {
+			return &zoneEntry{state: Insecure, zone: name, expires: expiry(now, msg.Authority)}, nil
+		}
+		if err == nil {
+			err = d.prove(&dnsmsg.Question{Name: name, Type: dnsmsg.DS, Class: dnsmsg.IN}, msg.ExtendedRCode())
+		}
+		if err != nil {
+			return bogus(err, now), nil
+		}
+		if d.delegation(name) {
+			return &zoneEntry{state: Insecure, zone: name, expires: expiry(now, msg.Authority)}, nil
+		}
+		return &zoneEntry{state: Secure, zone: parent.zone, keys: parent.keys, expires: expiry(now, msg.Authority)}, nil
+	}
+
+	if _, err := verifyRRset(dss, msg.Answer, parent.keys, now, v.cfg.AllowSHA1); err != nil {
+		return bogus(err, now), nil
+	}
+	var supported []*dnsmsg.RDataDS
+	for _, rr := range dss {
+		if ds, ok := rr.Data.(*dnsmsg.RDataDS); ok && (algorithmSupported(ds.Algorithm) || v.cfg.AllowSHA1 && algorithmLegacy(ds.Algorithm)) {
+			switch ds.DigestType {
+			case DigestSHA1, DigestSHA256, DigestSHA384:
+				supported = append(supported, ds)
+			}
+		}
+	}
+	if len(supported) == 0 {
+		// treated as unsigned (RFC 4035 section 5.2)
+		return &zoneEntry{state: Insecure, zone: name, expires: expiry(now, dss)}, nil
+	}
+
+	msg, err = v.cfg.Fetch(ctx, name, dnsmsg.DNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	keys := records(msg.Answer, name, dnsmsg.DNSKEY)
+	var trusted []*dnsmsg.Resource
+	for _, key := range keys {
+		for _, ds := range supported {
+			if d, err := NewDS(key, ds.DigestType); err == nil && d.KeyTag == ds.KeyTag && d.Algorithm == ds.Algorithm && bytes.Equal(d.Digest, ds.Digest) {
+				trusted = append(trusted, key)
+				break
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return bogus(ErrNoSignature, now), nil
+	}
+	if _, err := verifyRRset(keys, msg.Answer, trusted, now, v.cfg.AllowSHA1); err != nil {
+		return bogus(err, now), nil
+	}
+	return &zoneEntry{state: Secure, zone: name, keys: keys, expires: expiry(now, dss, keys)}, nil
+}
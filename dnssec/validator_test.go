@@ -0,0 +1,204 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// testChain is a signed example. zone, with the signed child zone
+// sec.example. and the unsigned delegation unsigned.example.
+type testChain struct {
+	answers map[string]*dnsmsg.Message
+	fetches int
+	err     error
+
+	anchor *dnsmsg.Resource // DS of the example. key
+	www    []*dnsmsg.Resource
+	host   []*dnsmsg.Resource // host.sec.example. A and RRSIG
+}
+
+func testRR(name dnsmsg.Name, t dnsmsg.Type, data dnsmsg.RData) *dnsmsg.Resource {
+	return &dnsmsg.Resource{Name: name, Type: t, Class: dnsmsg.IN, TTL: 3600, Data: data}
+}
+
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{answers: make(map[string]*dnsmsg.Message)}
+	set := func(name dnsmsg.Name, typ dnsmsg.Type, answer, authority []*dnsmsg.Resource) {
+		c.answers[string(name)+"/"+typ.String()] = &dnsmsg.Message{Answer: answer, Authority: authority}
+	}
+
+	priv, key := newTestKey(t, "example.")
+	key.Data.(*dnsmsg.RDataDNSKEY).Flags |= FlagSEP
+	set("example.", dnsmsg.DNSKEY, []*dnsmsg.Resource{key, signTest(t, priv, key, key)}, nil)
+	ds, err := NewDS(key, DigestSHA256)
+	if err != nil {
+		t.Fatalf("failed to compute DS: %s", err)
+	}
+	c.anchor = testRR("example.", dnsmsg.DS, ds)
+
+	childPriv, childKey := newTestKey(t, "sec.example.")
+	set("sec.example.", dnsmsg.DNSKEY, []*dnsmsg.Resource{childKey, signTest(t, childPriv, childKey, childKey)}, nil)
+	ds, err = NewDS(childKey, DigestSHA256)
+	if err != nil {
+		t.Fatalf("failed to compute DS: %s", err)
+	}
+	dsrr := testRR("sec.example.", dnsmsg.DS, ds)
+	set("sec.example.", dnsmsg.DS, []*dnsmsg.Resource{dsrr, signTest(t, priv, key, dsrr)}, nil)
+
+	nsec := func(name, next dnsmsg.Name, types ...dnsmsg.Type) []*dnsmsg.Resource {
+		rr := testRR(name, dnsmsg.NSEC, &dnsmsg.RDataNSEC{NextDomain: string(next), Types: types})
+		return []*dnsmsg.Resource{rr, signTest(t, priv, key, rr)}
+	}
+	set("unsigned.example.", dnsmsg.DS, nil, nsec("unsigned.example.", "www.example.", dnsmsg.NS, dnsmsg.RRSIG, dnsmsg.NSEC))
+	set("www.example.", dnsmsg.DS, nil, nsec("www.example.", "example.", dnsmsg.A, dnsmsg.RRSIG, dnsmsg.NSEC))
+
+	www := testRR("www.example.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A})
+	c.www = []*dnsmsg.Resource{www, signTest(t, priv, key, www)}
+	host := testRR("host.sec.example.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 2}, Type: dnsmsg.A})
+	c.host = []*dnsmsg.Resource{host, signTest(t, childPriv, childKey, host)}
+	return c
+}
+
+func (c *testChain) fetch(ctx context.Context, name dnsmsg.Name, t dnsmsg.Type) (*dnsmsg.Message, error) {
+	c.fetches += 1
+	if c.err != nil {
+		return nil, c.err
+	}
+	if msg, ok := c.answers[string(name)+"/"+t.String()]; ok {
+		return msg, nil
+	}
+	return &dnsmsg.Message{}, nil
+}
+
+func TestValidator(t *testing.T) {
+	c := newTestChain(t)
+	v := NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: []*dnsmsg.Resource{c.anchor}})
+	ctx := context.Background()
+
+	unsigned := []*dnsmsg.Resource{testRR("host.unsigned.example.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 3}, Type: dnsmsg.A})}
+	tampered := *c.www[0]
+	tampered.Data = &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 99}, Type: dnsmsg.A}
+	outside := []*dnsmsg.Resource{testRR("example.org.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 4}, Type: dnsmsg.A})}
+
+	var tests = []struct {
+		name  string
+		rrset []*dnsmsg.Resource
+		sigs  []*dnsmsg.Resource
+		state State
+		err   error
+	}{
+		{"signed", c.www[:1], c.www[1:], Secure, nil},
+		{"child zone", c.host[:1], c.host[1:], Secure, nil},
+		{"unsigned delegation", unsigned, nil, Insecure, nil},
+		{"missing signature", c.www[:1], nil, Bogus, ErrNoSignature},
+		{"wrong signer", c.www[:1], c.host[1:], Bogus, ErrNoSignature},
+		{"tampered", []*dnsmsg.Resource{&tampered}, c.www[1:], Bogus, ErrBadSignature},
+		{"no trust anchor", outside, nil, Indeterminate, nil},
+	}
+	for _, test := range tests {
+		state, err := v.Validate(ctx, test.rrset, test.sigs)
+		if state != test.state || err != test.err {
+			t.Errorf("%s: got %s (%v), expected %s (%v)", test.name, state, err, test.state, test.err)
+		}
+	}
+
+	// keys are cached
+	n := c.fetches
+	if state, err := v.Validate(ctx, c.host[:1], c.host[1:]); state != Secure || err != nil || c.fetches != n {
+		t.Errorf("unexpected state %s (%v) after %d fetches", state, err, c.fetches-n)
+	}
+
+	// failure to fetch
+	c.err = errors.New("timeout")
+	v = NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: []*dnsmsg.Resource{c.anchor}})
+	if state, err := v.Validate(ctx, c.www[:1], c.www[1:]); state != Indeterminate || err != c.err {
+		t.Errorf("expected indeterminate state on fetch error, got %s (%v)", state, err)
+	}
+
+	// anchor not matching the key
+	c.err = nil
+	c.anchor.Data.(*dnsmsg.RDataDS).Digest[0] ^= 1
+	v = NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: []*dnsmsg.Resource{c.anchor}})
+	if state, err := v.Validate(ctx, c.www[:1], c.www[1:]); state != Bogus || err != ErrNoSignature {
+		t.Errorf("expected bogus state with wrong anchor, got %s (%v)", state, err)
+	}
+	fixed := *c.anchor
+	ds := *c.anchor.Data.(*dnsmsg.RDataDS)
+	ds.Digest = append([]byte{ds.Digest[0] ^ 1}, ds.Digest[1:]...)
+	fixed.Data = &ds
+	v.SetAnchors([]*dnsmsg.Resource{&fixed})
+	if state, err := v.Validate(ctx, c.www[:1], c.www[1:]); state != Secure || err != nil {
+		t.Errorf("expected secure state after anchor update, got %s (%v)", state, err)
+	}
+}
+
+func TestValidatorCache(t *testing.T) {
+	c := newTestChain(t)
+	now := time.Now()
+	v := NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: []*dnsmsg.Resource{c.anchor}, Now: func() time.Time { return now }, MaxZones: 1})
+	ctx := context.Background()
+
+	// example. is dropped for sec.example., used last
+	if state, err := v.Validate(ctx, c.host[:1], c.host[1:]); state != Secure {
+		t.Fatalf("expected secure, got %s (%v)", state, err)
+	}
+	if len(v.zones) != 1 || v.lru.Len() != 1 || v.zones["sec.example."] == nil {
+		t.Errorf("expected only sec.example. cached, got %d entries", len(v.zones))
+	}
+
+	// expired entries are dropped when looked up
+	now = now.Add(2 * time.Hour)
+	if e := v.cached("sec.example.", now); e != nil || len(v.zones) != 0 || v.lru.Len() != 0 {
+		t.Errorf("expired entry still cached, %d entries", len(v.zones))
+	}
+	n := c.fetches
+	if state, _ := v.Validate(ctx, c.host[:1], c.host[1:]); state != Bogus || c.fetches == n {
+		t.Errorf("expected keys fetched again and signatures expired, got %s", state)
+	}
+}
+
+func TestValidatorSHA1(t *testing.T) {
+	c := &testChain{answers: make(map[string]*dnsmsg.Message)}
+	set := func(name dnsmsg.Name, typ dnsmsg.Type, answer ...*dnsmsg.Resource) {
+		c.answers[string(name)+"/"+typ.String()] = &dnsmsg.Message{Answer: answer}
+	}
+
+	// legacy.example. is signed with RSASHA1 only
+	priv, key := newTestKey(t, "example.")
+	set("example.", dnsmsg.DNSKEY, key, signTest(t, priv, key, key))
+	anchor, err := NewDS(key, DigestSHA256)
+	if err != nil {
+		t.Fatalf("failed to compute DS: %s", err)
+	}
+	childPriv, childKey := newTestKeySHA1(t, "legacy.example.")
+	set("legacy.example.", dnsmsg.DNSKEY, childKey, signTestSHA1(t, childPriv, childKey, childKey))
+	ds, err := NewDS(childKey, DigestSHA256)
+	if err != nil {
+		t.Fatalf("failed to compute DS: %s", err)
+	}
+	dsrr := testRR("legacy.example.", dnsmsg.DS, ds)
+	set("legacy.example.", dnsmsg.DS, dsrr, signTest(t, priv, key, dsrr))
+	host := testRR("host.legacy.example.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A})
+	sig := signTestSHA1(t, childPriv, childKey, host)
+	tampered := *host
+	tampered.Data = &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 99}, Type: dnsmsg.A}
+
+	ctx := context.Background()
+	anchors := []*dnsmsg.Resource{testRR("example.", dnsmsg.DS, anchor)}
+	v := NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: anchors})
+	if state, err := v.Validate(ctx, []*dnsmsg.Resource{host}, []*dnsmsg.Resource{sig}); state != Insecure || err != nil {
+		t.Errorf("expected insecure state without SHA-1, got %s (%v)", state, err)
+	}
+
+	v = NewValidator(&ValidatorConfig{Fetch: c.fetch, Anchors: anchors, AllowSHA1: true})
+	if state, err := v.Validate(ctx, []*dnsmsg.Resource{host}, []*dnsmsg.Resource{sig}); state != Secure || err != nil {
+		t.Errorf("expected secure state with SHA-1, got %s (%v)", state, err)
+	}
+	if state, err := v.Validate(ctx, []*dnsmsg.Resource{&tampered}, []*dnsmsg.Resource{sig}); state != Bogus || err != ErrBadSignature {
+		t.Errorf("expected bogus state, got %s (%v)", state, err)
+	}
+}
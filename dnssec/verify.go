@@ -0,0 +1,225 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var (
+	ErrNoSignature   = errors.New("no signature by a known key")
+	ErrBadSignature  = errors.New("signature verification failed")
+	ErrSignatureTime = errors.New("signature is expired or not yet valid")
+	ErrInvalidRRset  = errors.New("records do not form a single RRset")
+)
+
+// BuildSignedData returns the data signed by sig over rrset (RFC 4034
+// section 3.1.8.1): the RRSIG RDATA without the signature, followed by the
+// records in canonical form and order, with the original TTL and, for
+// wildcard expansions, the wildcard owner name.
+func BuildSignedData(rrset []*dnsmsg.Resource, sig *dnsmsg.RDataRRSIG) ([]byte, error) {
+	if len(rrset) == 0 {
+		return nil, ErrInvalidRRset
+	}
+	first := rrset[0]
+	for _, rr := range rrset {
+		if rr.Type != sig.TypeCovered || rr.Class != first.Class || !rr.Name.Equal(first.Name) {
+			return nil, ErrInvalidRRset
+		}
+	}
+
+	owner, err := signedOwner(first.Name, sig.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	s := *sig
+	s.Signature = nil
+	buf, err := (&dnsmsg.Resource{Type: dnsmsg.RRSIG, Data: &s}).CanonicalRData()
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		rdata []byte
+		wire  []byte
+	}
+	entries := make([]*entry, 0, len(rrset))
+	for _, rr := range rrset {
+		r := *rr
+		r.Name = owner
+		r.TTL = sig.OrigTTL
+		rdata, err := r.CanonicalRData()
+		if err != nil {
+			return nil, err
+		}
+		wire, err := r.CanonicalWire()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry{rdata, wire})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].rdata, entries[j].rdata) < 0
+	})
+	for i, e := range entries {
+		if i > 0 && bytes.Equal(entries[i-1].rdata, e.rdata) {
+			// duplicate records are signed once
+			continue
+		}
+		buf = append(buf, e.wire...)
+	}
+	return buf, nil
+}
+
+// signedOwner returns the owner name the signature of a record at name with
+// the given RRSIG labels field was computed with: name itself, or the
+// wildcard it was expanded from (RFC 4035 section 5.3.2)
+func signedOwner(name dnsmsg.Name, labels uint8) (dnsmsg.Name, error) {
+	l := name.SplitLabels()
+	if len(l) > 0 && l[0] == "*" {
+		// the wildcard label is not counted
+		l = l[1:]
+	}
+	switch {
+	case int(labels) > len(l):
+		return "", ErrInvalidRRset
+	case int(labels) == len(l):
+		return name, nil
+	}
+	return dnsmsg.Name("*." + strings.Join(l[len(l)-int(labels):], ".") + "."), nil
+}
+
+// sigValid returns true if now is within the validity period of sig, using
+// serial number arithmetic (RFC 4034 section 3.1.5)
+func sigValid(sig *dnsmsg.RDataRRSIG, now time.Time) bool {
+	t := uint32(now.Unix())
+	return int32(t-sig.Inception) >= 0 && int32(sig.Expiration-t) >= 0
+}
+
+// VerifyRRSIG checks that sig is a valid signature of rrset by key, a DNSKEY
+// record, at time now (RFC 4035 section 5.3)
+func VerifyRRSIG(rrset []*dnsmsg.Resource, sig *dnsmsg.RDataRRSIG, key *dnsmsg.Resource, now time.Time) error {
+	return verifyRRSIG(rrset, sig, key, now, false)
+}
+
+// verifyRRSIG is VerifyRRSIG, also accepting RSASHA1 signatures if
+// allowSHA1 is set
+func verifyRRSIG(rrset []*dnsmsg.Resource, sig *dnsmsg.RDataRRSIG, key *dnsmsg.Resource, now time.Time, allowSHA1 bool) (err error) {
+	k, ok := key.Data.(*dnsmsg.RDataDNSKEY)
+	if !ok || key.Type != dnsmsg.DNSKEY {
+		return ErrInvalidKey
+	}
+	if k.Protocol != 3 || k.Flags&FlagZone == 0 || k.Algorithm != sig.Algorithm || KeyTag(k) != sig.KeyTag || !key.Name.Equal(dnsmsg.Name(sig.SignerName)) {
+		return ErrNoSignature
+	}
+	if len(rrset) == 0 || !rrset[0].Name.IsSubDomainOf(dnsmsg.Name(sig.SignerName)) {
+		return ErrInvalidRRset
+	}
+	if m := getMetrics(); m != nil {
+		start := time.Now()
+		defer func() { m.Verified(k.Algorithm, time.Since(start), err) }()
+	}
+	if !sigValid(sig, now) {
+		return ErrSignatureTime
+	}
+	if algorithmLegacy(k.Algorithm) && !allowSHA1 {
+		return ErrUnsupported
+	}
+	data, err := BuildSignedData(rrset, sig)
+	if err != nil {
+		return err
+	}
+	return verifySignature(k, data, sig.Signature)
+}
+
+// VerifyRRset checks that rrset is signed by one of keys with one of rrsigs,
+// and returns the valid signature. Signatures of other RRsets are ignored.
+func VerifyRRset(rrset, rrsigs, keys []*dnsmsg.Resource, now time.Time) (*dnsmsg.RDataRRSIG, error) {
+	return verifyRRset(rrset, rrsigs, keys, now, false)
+}
+
+func verifyRRset(rrset, rrsigs, keys []*dnsmsg.Resource, now time.Time, allowSHA1 bool) (*dnsmsg.RDataRRSIG, error) {
+	if len(rrset) == 0 {
+		return nil, ErrInvalidRRset
+	}
+	res := ErrNoSignature
+	for _, rr := range rrsigs {
+		sig, ok := rr.Data.(*dnsmsg.RDataRRSIG)
+		if !ok || sig.TypeCovered != rrset[0].Type || !rr.Name.Equal(rrset[0].Name) {
+			continue
+		}
+		for _, key := range keys {
+			err := verifyRRSIG(rrset, sig, key, now, allowSHA1)
+			if err == nil {
+				return sig, nil
+			}
+			if err != ErrNoSignature {
+				// keep the reason the matching key failed
+				res = err
+			}
+		}
+	}
+	return nil, res
+}
+
+// verifySignature checks the signature sig of data by key
+func verifySignature(key *dnsmsg.RDataDNSKEY, data, sig []byte) error {
+	pub, err := publicKey(key)
+	if err != nil {
+		return err
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		h, hash := sha256.New(), crypto.SHA256
+		switch key.Algorithm {
+		case RSASHA1, RSASHA1NSEC3SHA1:
+			h, hash = sha1.New(), crypto.SHA1
+		case RSASHA512:
+			h, hash = sha512.New(), crypto.SHA512
+		}
+		h.Write(data)
+		if rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig) != nil {
+			return ErrBadSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		// RFC 6605 section 4: r and s, each the size of the curve
+		var digest []byte
+		if key.Algorithm == ECDSAP384SHA384 {
+			d := sha512.Sum384(data)
+			digest = d[:]
+		} else {
+			d := sha256.Sum256(data)
+			digest = d[:]
+		}
+		size := pub.Curve.Params().BitSize / 8
+		if len(sig) != 2*size {
+			return ErrBadSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrBadSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return ErrBadSignature
+		}
+		return nil
+	}
+	return ErrUnsupported
+}
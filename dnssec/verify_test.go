@@ -0,0 +1,397 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+// newTestKey returns a new ECDSA P-256 key and its DNSKEY record for zone
+func newTestKey(t *testing.T, zone dnsmsg.Name) (*ecdsa.PrivateKey, *dnsmsg.Resource) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	pub := append(priv.X.FillBytes(make([]byte, 32)), priv.Y.FillBytes(make([]byte, 32))...)
+	key := &dnsmsg.Resource{Name: zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: 3600,
+		Data: &dnsmsg.RDataDNSKEY{Flags: FlagZone, Protocol: 3, Algorithm: ECDSAP256SHA256, PublicKey: pub}}
+	return priv, key
+}
+
+// signTest returns an RRSIG record for rrset, valid for an hour around now
+func signTest(t *testing.T, priv *ecdsa.PrivateKey, key *dnsmsg.Resource, rrset ...*dnsmsg.Resource) *dnsmsg.Resource {
+	return signTestAt(t, time.Now(), priv, key, rrset...)
+}
+
+// signTestAt returns an RRSIG record for rrset, valid for an hour around t
+func signTestAt(t *testing.T, at time.Time, priv *ecdsa.PrivateKey, key *dnsmsg.Resource, rrset ...*dnsmsg.Resource) *dnsmsg.Resource {
+	labels := rrset[0].Name.CountLabels()
+	if strings.HasPrefix(string(rrset[0].Name), "*.") {
+		labels -= 1
+	}
+	now := uint32(at.Unix())
+	sig := &dnsmsg.RDataRRSIG{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   ECDSAP256SHA256,
+		Labels:      uint8(labels),
+		OrigTTL:     rrset[0].TTL,
+		Expiration:  now + 3600,
+		Inception:   now - 3600,
+		KeyTag:      KeyTag(key.Data.(*dnsmsg.RDataDNSKEY)),
+		SignerName:  string(key.Name),
+	}
+	data, err := BuildSignedData(rrset, sig)
+	if err != nil {
+		t.Fatalf("failed to build signed data: %s", err)
+	}
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	sig.Signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return &dnsmsg.Resource{Name: rrset[0].Name, Type: dnsmsg.RRSIG, Class: rrset[0].Class, TTL: rrset[0].TTL, Data: sig}
+}
+
+func TestVerifyRRSIG(t *testing.T) {
+	var tests = []struct {
+		zone   string
+		origin dnsmsg.Name
+		tag    uint16
+		ds     string
+	}{
+		// RFC 6605 section 6.1
+		{`example.net. 3600 IN DNSKEY 257 3 13 (
+        GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edb
+        krSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA== )
+www.example.net. 3600 IN A 192.0.2.1
+www.example.net. 3600 IN RRSIG A 13 3 3600 (
+        20100909100439 20100812100439 55648 example.net.
+        qx6wLYqmh+l9oCKTN6qIc+bw6ya+KJ8oMz0YP107epXA
+        yGmt+3SNruPFKG7tZoLBLlUzGGus7ZwmwWep666VCw== )
+`, "example.net.", 55648, "55648 13 2 B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17"},
+		// RFC 8080 section 6.1
+		{`example.com. 3600 IN DNSKEY 257 3 15 (
+             l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4= )
+example.com. 3600 IN MX 10 mail.example.com.
+example.com. 3600 IN RRSIG MX 15 2 3600 (
+             1440021600 1438207200 3613 example.com. (
+             oL9krJun7xfBOIWcGHi7mag5/hdZrKWw15jPGrHpjQeRAvTdszaPD+QL
+             s3fx8A4M3e23mRZ9VrbpMngwcrqNAg== ) )
+`, "example.com.", 3613, "3613 15 2 3AA5AB37EFCE57F737FC1627013FEE07BDF241BD10F3B1964AB55C78E79A304B"},
+	}
+
+	for _, test := range tests {
+		rrs, err := dnszone.Parse(strings.NewReader(test.zone), string(test.origin))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", test.origin, err)
+		}
+		key, rrset, sig := rrs[0], rrs[1:2], rrs[2].Data.(*dnsmsg.RDataRRSIG)
+		if tag := KeyTag(key.Data.(*dnsmsg.RDataDNSKEY)); tag != test.tag {
+			t.Errorf("%s: got key tag %d, expected %d", test.origin, tag, test.tag)
+		}
+		if ds, err := NewDS(key, DigestSHA256); err != nil || ds.String() != test.ds {
+			t.Errorf("%s: got DS %s (%v), expected %s", test.origin, ds, err, test.ds)
+		}
+		now := time.Unix(int64(sig.Inception), 0).Add(time.Hour)
+		if err := VerifyRRSIG(rrset, sig, key, now); err != nil {
+			t.Errorf("%s: failed to verify: %s", test.origin, err)
+		}
+		if err := VerifyRRSIG(rrset, sig, key, time.Unix(int64(sig.Expiration), 0).Add(time.Second)); err != ErrSignatureTime {
+			t.Errorf("%s: expected ErrSignatureTime, got %v", test.origin, err)
+		}
+		rrset[0].TTL = 60 // ignored, the original TTL is signed
+		if err := VerifyRRSIG(rrset, sig, key, now); err != nil {
+			t.Errorf("%s: failed to verify with different TTL: %s", test.origin, err)
+		}
+		rrset[0].Name = dnsmsg.Name(strings.ToUpper(string(rrset[0].Name)))
+		if err := VerifyRRSIG(rrset, sig, key, now); err != nil {
+			t.Errorf("%s: failed to verify in upper case: %s", test.origin, err)
+		}
+		rrset[0].Class = dnsmsg.CH
+		if err := VerifyRRSIG(rrset, sig, key, now); err != ErrBadSignature {
+			t.Errorf("%s: expected ErrBadSignature, got %v", test.origin, err)
+		}
+	}
+}
+
+func TestVerifyRRset(t *testing.T) {
+	priv, key := newTestKey(t, "example.")
+	_, other := newTestKey(t, "example.")
+	keys := []*dnsmsg.Resource{other, key}
+
+	// wildcard expansion, and duplicate records
+	a := &dnsmsg.Resource{Name: "*.example.", Type: dnsmsg.A, Class: dnsmsg.IN, TTL: 300, Data: &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A}}
+	b := &dnsmsg.Resource{Name: "*.example.", Type: dnsmsg.A, Class: dnsmsg.IN, TTL: 300, Data: &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 2}, Type: dnsmsg.A}}
+	sig := signTest(t, priv, key, a, b)
+	if sig.Data.(*dnsmsg.RDataRRSIG).Labels != 1 {
+		t.Errorf("unexpected labels in %s", sig)
+	}
+
+	x, y := *a, *b
+	x.Name, y.Name = "www.example.", "www.example."
+	sig.Name = "www.example."
+	if _, err := VerifyRRset([]*dnsmsg.Resource{&y, &x, &y}, []*dnsmsg.Resource{sig}, keys, time.Now()); err != nil {
+		t.Errorf("failed to verify wildcard expansion: %s", err)
+	}
+	if _, err := VerifyRRset([]*dnsmsg.Resource{&x}, []*dnsmsg.Resource{sig}, keys, time.Now()); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature for partial RRset, got %v", err)
+	}
+	if _, err := VerifyRRset([]*dnsmsg.Resource{&x, &y}, []*dnsmsg.Resource{sig}, keys[:1], time.Now()); err != ErrNoSignature {
+		t.Errorf("expected ErrNoSignature with other key, got %v", err)
+	}
+}
+
+// newTestKeySHA1 returns a new RSA key and its RSASHA1 DNSKEY record for zone
+func newTestKeySHA1(t *testing.T, zone dnsmsg.Name) (*rsa.PrivateKey, *dnsmsg.Resource) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	pub, err := publicKeyData(RSASHA256, &priv.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to encode key: %s", err)
+	}
+	key := &dnsmsg.Resource{Name: zone, Type: dnsmsg.DNSKEY, Class: dnsmsg.IN, TTL: 3600,
+		Data: &dnsmsg.RDataDNSKEY{Flags: FlagZone, Protocol: 3, Algorithm: RSASHA1, PublicKey: pub}}
+	return priv, key
+}
+
+// signTestSHA1 returns an RSASHA1 RRSIG record for rrset, valid for an hour
+// around now
+func signTestSHA1(t *testing.T, priv *rsa.PrivateKey, key *dnsmsg.Resource, rrset ...*dnsmsg.Resource) *dnsmsg.Resource {
+	now := uint32(time.Now().Unix())
+	sig := &dnsmsg.RDataRRSIG{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   RSASHA1,
+		Labels:      uint8(rrset[0].Name.CountLabels()),
+		OrigTTL:     rrset[0].TTL,
+		Expiration:  now + 3600,
+		Inception:   now - 3600,
+		KeyTag:      KeyTag(key.Data.(*dnsmsg.RDataDNSKEY)),
+		SignerName:  string(key.Name),
+	}
+	data, err := BuildSignedData(rrset, sig)
+	if err != nil {
+		t.Fatalf("failed to build signed data: %s", err)
+	}
+	digest := sha1.Sum(data)
+	if sig.Signature, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA1, digest[:]); err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	return &dnsmsg.Resource{Name: rrset[0].Name, Type: dnsmsg.RRSIG, Class: rrset[0].Class, TTL: rrset[0].TTL, Data: sig}
+}
+
+func TestVerifyRRSIGSHA1(t *testing.T) {
+	priv, key := newTestKeySHA1(t, "example.")
+	rrset := []*dnsmsg.Resource{testRR("www.example.", dnsmsg.A, &dnsmsg.RDataIP{IP: []byte{192, 0, 2, 1}, Type: dnsmsg.A})}
+	sig := signTestSHA1(t, priv, key, rrset...).Data.(*dnsmsg.RDataRRSIG)
+	now := time.Now()
+
+	// only verified when allowed
+	if err := VerifyRRSIG(rrset, sig, key, now); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if err := verifyRRSIG(rrset, sig, key, now, true); err != nil {
+		t.Errorf("failed to verify: %s", err)
+	}
+	sig.Signature[0] ^= 1
+	if err := verifyRRSIG(rrset, sig, key, now, true); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature, got %v", err)
+	}
+
+	// and never used to sign
+	if _, err := NewSigner("example.", key.Data.(*dnsmsg.RDataDNSKEY), priv); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestSignTXT(t *testing.T) {
+	// TXT RDATA is made of length prefixed character strings, whatever its
+	// source (RFC 1035 section 3.3.14)
+	_, priv, err := ParseBINDPrivateKey(strings.NewReader("Private-key-format: v1.2\nAlgorithm: 15 (ED25519)\nPrivateKey: ODIyNjAzODQ2MjgwODAxMjI2NDUxOTAyMDQxNDIyNjI=\n"))
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	key, _ := dnsmsg.RDataFromString(dnsmsg.DNSKEY, "257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=")
+	s, err := NewSigner("example.com.", key.(*dnsmsg.RDataDNSKEY), priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+
+	zone, err := dnszone.Parse(strings.NewReader(`example.com. 3600 IN TXT "v=spf1 -all"
+example.com. 3600 IN TXT hello "world"
+`), "")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	sig, err := s.Sign(zone, time.Unix(1438207200, 0), time.Unix(1440021600, 0))
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	// RRSIG RDATA without signature, then the records in canonical order
+	expect, _ := hex.DecodeString("0010" + "0f02" + "00000e10" + "55d4fc60" + "55b94ce0" + "0e1d" + "076578616d706c6503636f6d00" +
+		"076578616d706c6503636f6d00" + "0010" + "0001" + "00000e10" + "000c" + "0568656c6c6f05776f726c64" +
+		"076578616d706c6503636f6d00" + "0010" + "0001" + "00000e10" + "000c" + "0b763d73706631202d616c6c")
+	rrsig := sig.Data.(*dnsmsg.RDataRRSIG)
+	data, err := BuildSignedData(zone, rrsig)
+	if err != nil {
+		t.Fatalf("failed to build signed data: %s", err)
+	}
+	if !bytes.Equal(data, expect) {
+		t.Errorf("unexpected signed data %x", data)
+	}
+	if !ed25519.Verify(priv.Public().(ed25519.PublicKey), expect, rrsig.Signature) {
+		t.Errorf("signature does not cover the expected data")
+	}
+
+	// the same records given as text or read from the wire
+	txt1, _ := dnsmsg.RDataFromString(dnsmsg.TXT, `"hello" "world"`)
+	txt2, _ := dnsmsg.RDataFromString(dnsmsg.TXT, `"v=spf1 -all"`)
+	msg := &dnsmsg.Message{Answer: []*dnsmsg.Resource{testRR("example.com.", dnsmsg.TXT, txt1), testRR("example.com.", dnsmsg.TXT, txt2)}}
+	buf, err := msg.MarshalBinary()
+	if err == nil {
+		msg, err = dnsmsg.Parse(buf)
+	}
+	if err != nil {
+		t.Fatalf("failed to go through wire format: %s", err)
+	}
+	for _, rrset := range [][]*dnsmsg.Resource{msg.Answer[:2], {testRR("example.com.", dnsmsg.TXT, txt2), testRR("example.com.", dnsmsg.TXT, txt1)}} {
+		if err := VerifyRRSIG(rrset, rrsig, s.DNSKEY(3600), time.Unix(1439000000, 0)); err != nil {
+			t.Errorf("failed to verify %s: %s", rrset[0], err)
+		}
+	}
+}
+
+func TestSignedDataVectors(t *testing.T) {
+	// the RFC 8080 key signs records with names in their RDATA, which are
+	// signed in lower case, and HINFO whose character strings keep their
+	// case. Expected data and signatures were computed independently.
+	_, priv, err := ParseBINDPrivateKey(strings.NewReader("Private-key-format: v1.2\nAlgorithm: 15 (ED25519)\nPrivateKey: ODIyNjAzODQ2MjgwODAxMjI2NDUxOTAyMDQxNDIyNjI=\n"))
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	key, _ := dnsmsg.RDataFromString(dnsmsg.DNSKEY, "257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=")
+	s, err := NewSigner("example.com.", key.(*dnsmsg.RDataDNSKEY), priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+
+	var tests = []struct {
+		typ   dnsmsg.Type
+		rdata string
+		data  string // RRSIG RDATA without signature, then the record
+		sig   string
+	}{
+		{dnsmsg.HINFO, `"PC-Intel" "Linux"`,
+			"000d0f0300000e1055d4fc6055b94ce00e1d076578616d706c6503636f6d00" +
+				"04686f7374076578616d706c6503636f6d00000d000100000e10000f0850432d496e74656c054c696e7578",
+			"2BL/NGLfRanwXeMtl4yA9gV9N+XjU7tNMB5jChVZMNPb7zOZbNcWtQlyASaLEApcWFaDEqrZ3Y1Ij6xj2VziAQ=="},
+		{dnsmsg.RP, "Admin.Example.com. Info.Example.com.",
+			"00110f0300000e1055d4fc6055b94ce00e1d076578616d706c6503636f6d00" +
+				"04686f7374076578616d706c6503636f6d000011000100000e1000250561646d696e076578616d706c6503636f6d0004696e666f076578616d706c6503636f6d00",
+			"1L+lrj1/DoQHkNWNQWT2yHZWRhqQab4TAQu2s531lTmOgUEbeW2oGGJ+1BA3zpGWWCKviD9/VTRe7ezzUgkPDA=="},
+		{dnsmsg.AFSDB, "1 AFS.Example.com.",
+			"00120f0300000e1055d4fc6055b94ce00e1d076578616d706c6503636f6d00" +
+				"04686f7374076578616d706c6503636f6d000012000100000e100013000103616673076578616d706c6503636f6d00",
+			"oitOvXuc8jzGfYBzFSU527o/jv72Sq7fifBx497p7NtqNU/rQhYfqHPybzcrm+xhQB3sCg5aTkpMFVWLp/HCCw=="},
+		{dnsmsg.SRV, "10 60 5060 SIP.Example.com.",
+			"00210f0300000e1055d4fc6055b94ce00e1d076578616d706c6503636f6d00" +
+				"04686f7374076578616d706c6503636f6d000021000100000e100017000a003c13c403736970076578616d706c6503636f6d00",
+			"md5ShY47QDogCtdDiC4/oF8gHQMQtzs7Je41faZf6bGdupu0LO3mbkdsiXj8Mg5U8cO+NwiI+KuZJqCKGjSsCw=="},
+	}
+	for _, test := range tests {
+		data, err := dnsmsg.RDataFromString(test.typ, test.rdata)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", test.typ, err)
+		}
+		rrset := []*dnsmsg.Resource{testRR("Host.Example.com.", test.typ, data)}
+		sig, err := s.Sign(rrset, time.Unix(1438207200, 0), time.Unix(1440021600, 0))
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %s", test.typ, err)
+		}
+		rrsig := sig.Data.(*dnsmsg.RDataRRSIG)
+		signed, err := BuildSignedData(rrset, rrsig)
+		if err != nil {
+			t.Fatalf("%s: failed to build signed data: %s", test.typ, err)
+		}
+		if hex.EncodeToString(signed) != test.data {
+			t.Errorf("%s: unexpected signed data %x", test.typ, signed)
+		}
+		if got := base64.StdEncoding.EncodeToString(rrsig.Signature); got != test.sig {
+			t.Errorf("%s: unexpected signature %s", test.typ, got)
+		}
+
+		// the known signature verifies the records read from the wire
+		msg := &dnsmsg.Message{Answer: rrset}
+		buf, err := msg.MarshalBinary()
+		if err == nil {
+			msg, err = dnsmsg.Parse(buf)
+		}
+		if err != nil {
+			t.Fatalf("%s: failed to go through wire format: %s", test.typ, err)
+		}
+		rrsig.Signature, _ = base64.StdEncoding.DecodeString(test.sig)
+		if err := VerifyRRSIG(msg.Answer, rrsig, s.DNSKEY(3600), time.Unix(1439000000, 0)); err != nil {
+			t.Errorf("%s: failed to verify: %s", test.typ, err)
+		}
+	}
+}
+
+func TestBuildSignedDataCase(t *testing.T) {
+	// names in RDATA are signed in lower case, so the signatures are valid
+	// whatever the case of the records (RFC 4034 section 6.2)
+	priv, key := newTestKey(t, "example.")
+	rdata := map[dnsmsg.Type]string{
+		dnsmsg.NS:    "NS1.Example.",
+		dnsmsg.SOA:   "NS1.Example. Admin.Example. 1 7200 3600 1209600 300",
+		dnsmsg.MX:    "10 Mail.Example.",
+		dnsmsg.RP:    "Admin.Example. Info.Example.",
+		dnsmsg.AFSDB: "1 AFS.Example.",
+		dnsmsg.SRV:   "10 60 5060 SIP.Example.",
+		dnsmsg.NAPTR: `100 10 "S" "SIP+D2U" "" _SIP._UDP.Example.`,
+		dnsmsg.KX:    "10 KX.Example.",
+		dnsmsg.DNAME: "Target.Example.",
+		dnsmsg.HINFO: `"PC" "Linux"`,
+	}
+	now := time.Now()
+	for typ, s := range rdata {
+		data, err := dnsmsg.RDataFromString(typ, s)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", typ, err)
+		}
+		rr := testRR("Host.Example.", typ, data)
+		sig := signTest(t, priv, key, rr)
+
+		lower, err := dnsmsg.RDataFromString(typ, strings.ToLower(s))
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", typ, err)
+		}
+		rr = testRR("host.example.", typ, lower)
+		err = VerifyRRSIG([]*dnsmsg.Resource{rr}, sig.Data.(*dnsmsg.RDataRRSIG), key, now)
+		switch {
+		case typ == dnsmsg.HINFO || typ == dnsmsg.NAPTR:
+			// character strings keep their case
+			if err != ErrBadSignature {
+				t.Errorf("%s: expected ErrBadSignature, got %v", typ, err)
+			}
+		case err != nil:
+			t.Errorf("%s: failed to verify: %s", typ, err)
+		}
+	}
+}
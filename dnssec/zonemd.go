@@ -0,0 +1,182 @@
+// Package dnssec implements the cryptographic operations of DNSSEC and
+// related zone integrity mechanisms on top of dnsmsg.
+package dnssec
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"sort"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// ZONEMD schemes and hash algorithms (RFC 8976 section 5)
+const (
+	ZONEMDSimple = 1
+
+	ZONEMDSHA384 = 1
+	ZONEMDSHA512 = 2
+)
+
+var (
+	ErrNoSOA          = errors.New("zone has no SOA record at its apex")
+	ErrNoZONEMD       = errors.New("zone has no usable ZONEMD record")
+	ErrZONEMDSerial   = errors.New("ZONEMD serial does not match the SOA")
+	ErrZONEMDMismatch = errors.New("zone digest does not match")
+	ErrUnsupported    = errors.New("unsupported algorithm")
+)
+
+// zonemdHash returns a hash for ZONEMD hash algorithm alg
+func zonemdHash(alg uint8) (hash.Hash, error) {
+	switch alg {
+	case ZONEMDSHA384:
+		return sha512.New384(), nil
+	case ZONEMDSHA512:
+		return sha512.New(), nil
+	}
+	return nil, ErrUnsupported
+}
+
+// apexSOA returns the SOA record of the zone at origin
+func apexSOA(origin dnsmsg.Name, rrs []*dnsmsg.Resource) (*dnsmsg.RDataSOA, *dnsmsg.Resource) {
+	for _, rr := range rrs {
+		if soa, ok := rr.Data.(*dnsmsg.RDataSOA); ok && rr.Type == dnsmsg.SOA && rr.Name.Equal(origin) {
+			return soa, rr
+		}
+	}
+	return nil, nil
+}
+
+// ZoneDigest computes the SIMPLE scheme digest (RFC 8976 section 3.3) of the
+// zone at origin made of records rrs, using hash algorithm alg. The ZONEMD
+// records at the apex and their signatures are left out, duplicate records
+// are counted once, and names must be fully qualified.
+func ZoneDigest(origin dnsmsg.Name, rrs []*dnsmsg.Resource, alg uint8) ([]byte, error) {
+	h, err := zonemdHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		rr    *dnsmsg.Resource
+		rdata []byte
+		wire  []byte
+	}
+	entries := make([]*entry, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr.Name.Equal(origin) {
+			if rr.Type == dnsmsg.ZONEMD {
+				continue
+			}
+			if sig, ok := rr.Data.(*dnsmsg.RDataRRSIG); ok && sig.TypeCovered == dnsmsg.ZONEMD {
+				continue
+			}
+		}
+		rdata, err := rr.CanonicalRData()
+		if err != nil {
+			return nil, err
+		}
+		wire, err := rr.CanonicalWire()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry{rr, rdata, wire})
+	}
+
+	// canonical order: owner name, type, then RDATA (RFC 4034 section 6.3)
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if c := a.rr.Name.Compare(b.rr.Name); c != 0 {
+			return c < 0
+		}
+		if a.rr.Type != b.rr.Type {
+			return a.rr.Type < b.rr.Type
+		}
+		if a.rr.Class != b.rr.Class {
+			return a.rr.Class < b.rr.Class
+		}
+		return bytes.Compare(a.rdata, b.rdata) < 0
+	})
+
+	var prev *entry
+	for _, e := range entries {
+		if prev != nil && bytes.Equal(prev.wire, e.wire) {
+			continue
+		}
+		h.Write(e.wire)
+		prev = e
+	}
+	return h.Sum(nil), nil
+}
+
+// NewZONEMD returns a ZONEMD record for the zone at origin, with the serial
+// and TTL of its SOA record
+func NewZONEMD(origin dnsmsg.Name, rrs []*dnsmsg.Resource, alg uint8) (*dnsmsg.Resource, error) {
+	soa, soaRR := apexSOA(origin, rrs)
+	if soa == nil {
+		return nil, ErrNoSOA
+	}
+	digest, err := ZoneDigest(origin, rrs, alg)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsmsg.Resource{
+		Name:  soaRR.Name,
+		Type:  dnsmsg.ZONEMD,
+		Class: soaRR.Class,
+		TTL:   soaRR.TTL,
+		Data:  &dnsmsg.RDataZONEMD{Serial: soa.Serial, Scheme: ZONEMDSimple, Hash: alg, Digest: digest},
+	}, nil
+}
+
+// VerifyZONEMD checks the zone at origin against its ZONEMD records (RFC 8976
+// section 4). The zone is valid if one of the records using a supported
+// scheme and hash algorithm matches, and a record with the serial of the SOA
+// is required.
+func VerifyZONEMD(origin dnsmsg.Name, rrs []*dnsmsg.Resource) error {
+	soa, _ := apexSOA(origin, rrs)
+	if soa == nil {
+		return ErrNoSOA
+	}
+
+	var zmds []*dnsmsg.RDataZONEMD
+	seen := make(map[[2]uint8]bool)
+	for _, rr := range rrs {
+		zmd, ok := rr.Data.(*dnsmsg.RDataZONEMD)
+		if !ok || rr.Type != dnsmsg.ZONEMD || !rr.Name.Equal(origin) {
+			continue
+		}
+		if zmd.Serial != soa.Serial {
+			return ErrZONEMDSerial
+		}
+		k := [2]uint8{zmd.Scheme, zmd.Hash}
+		if seen[k] {
+			// several records with the same scheme and algorithm
+			return ErrNoZONEMD
+		}
+		seen[k] = true
+		if zmd.Scheme != ZONEMDSimple {
+			continue
+		}
+		if _, err := zonemdHash(zmd.Hash); err != nil {
+			continue
+		}
+		zmds = append(zmds, zmd)
+	}
+	if len(zmds) == 0 {
+		return ErrNoZONEMD
+	}
+
+	for _, zmd := range zmds {
+		digest, err := ZoneDigest(origin, rrs, zmd.Hash)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(digest, zmd.Digest) {
+			return nil
+		}
+	}
+	return ErrZONEMDMismatch
+}
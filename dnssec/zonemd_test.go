@@ -0,0 +1,58 @@
+package dnssec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+	"github.com/KarpelesLab/dns/dnszone"
+)
+
+// RFC 8976 appendix A.1
+const simpleZone = `example.      86400  IN  SOA     ns1 admin 2018031900 (
+                                 1800 900 604800 86400 )
+              86400  IN  NS      ns1
+              86400  IN  NS      ns2
+              86400  IN  ZONEMD  2018031900 1 1 (
+                                 c68090d90a7aed71
+                                 6bc459f9340e3d7c
+                                 1370d4d24b7e2fc3
+                                 a1ddc0b9a87153b9
+                                 a9713b3c9ae5cc27
+                                 777f98b8e730044c )
+ns1           3600   IN  A       203.0.113.63
+ns2           3600   IN  AAAA    2001:db8::63
+`
+
+func TestZONEMD(t *testing.T) {
+	rrs, err := dnszone.Parse(strings.NewReader(simpleZone), "example.")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	if err := VerifyZONEMD("example.", rrs); err != nil {
+		t.Errorf("failed to verify zone: %s", err)
+	}
+
+	// digest computed by NewZONEMD matches, for any order of records
+	rev := make([]*dnsmsg.Resource, 0, len(rrs))
+	for i := len(rrs) - 1; i >= 0; i-- {
+		rev = append(rev, rrs[i])
+	}
+	zmd, err := NewZONEMD("example.", rev, ZONEMDSHA384)
+	if err != nil {
+		t.Fatalf("failed to compute digest: %s", err)
+	}
+	if zmd.String() != "example. IN ZONEMD 86400 2018031900 1 1 C68090D90A7AED716BC459F9340E3D7C1370D4D24B7E2FC3A1DDC0B9A87153B9A9713B3C9AE5CC27777F98B8E730044C" {
+		t.Errorf("unexpected ZONEMD record %s", zmd)
+	}
+
+	// modified zone
+	rrs[len(rrs)-1].TTL = 60
+	if err := VerifyZONEMD("example.", rrs); err != ErrZONEMDMismatch {
+		t.Errorf("expected ErrZONEMDMismatch, got %v", err)
+	}
+	rrs[0].Data.(*dnsmsg.RDataSOA).Serial += 1
+	if err := VerifyZONEMD("example.", rrs); err != ErrZONEMDSerial {
+		t.Errorf("expected ErrZONEMDSerial, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package dnszone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// DiffOptions selects the differences reported by Diff
+type DiffOptions struct {
+	IgnoreTTL    bool // records differing only by their TTL are the same
+	IgnoreSerial bool // ignore changes of the SOA serial alone
+	IgnoreRRSIG  bool // ignore RRSIG records, which change at each re-signing
+}
+
+// Change is a difference between two versions of a RRset. Old is nil for
+// added RRsets, and New for removed ones.
+type Change struct {
+	Name string // fully qualified, lower case
+	Type dnsmsg.Type
+	Old  []*dnsmsg.Resource
+	New  []*dnsmsg.Resource
+}
+
+// String returns the change in a diff like format, with one line per record
+// prefixed with - or +
+func (c *Change) String() string {
+	var b strings.Builder
+	for _, rr := range c.Old {
+		fmt.Fprintf(&b, "- %s\n", rr)
+	}
+	for _, rr := range c.New {
+		fmt.Fprintf(&b, "+ %s\n", rr)
+	}
+	return b.String()
+}
+
+type rrsetKey struct {
+	name string
+	typ  dnsmsg.Type
+}
+
+// rrsets groups rrs by owner name and type, names relative to origin being
+// qualified
+func rrsets(origin string, rrs []*dnsmsg.Resource, opts *DiffOptions) map[rrsetKey][]*dnsmsg.Resource {
+	res := make(map[rrsetKey][]*dnsmsg.Resource)
+	for _, rr := range rrs {
+		if opts.IgnoreRRSIG && rr.Type == dnsmsg.RRSIG {
+			continue
+		}
+		k := rrsetKey{dnsmsg.ToLowerASCII(qualify(string(rr.Name), origin)), rr.Type}
+		res[k] = append(res[k], rr)
+	}
+	return res
+}
+
+// sameRRset returns true if a and b hold the same records
+func sameRRset(origin string, a, b []*dnsmsg.Resource, opts *DiffOptions) bool {
+	key := func(rr *dnsmsg.Resource) string {
+		s := rdataText(rr, origin)
+		if soa, ok := rr.Data.(*dnsmsg.RDataSOA); ok && opts.IgnoreSerial {
+			c := *soa
+			c.Serial = 0
+			s = rdataText(&dnsmsg.Resource{Type: rr.Type, Data: &c}, origin)
+		}
+		if !opts.IgnoreTTL {
+			s = fmt.Sprintf("%d %s", rr.TTL, s)
+		}
+		return dnsmsg.ToLowerASCII(s)
+	}
+	set := func(rrs []*dnsmsg.Resource) []string {
+		res := make([]string, 0, len(rrs))
+		for _, rr := range rrs {
+			res = append(res, key(rr))
+		}
+		sort.Strings(res)
+		// duplicate records are the same record
+		n := 0
+		for i, s := range res {
+			if i == 0 || s != res[n-1] {
+				res[n] = s
+				n += 1
+			}
+		}
+		return res[:n]
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff compares two versions of the zone at origin, and returns the RRsets
+// that were added, removed or changed in canonical order. Names not ending
+// with a dot are relative to origin.
+func Diff(origin string, old, new []*dnsmsg.Resource, opts *DiffOptions) []*Change {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+	if !strings.HasSuffix(origin, ".") {
+		origin += "."
+	}
+	a, b := rrsets(origin, old, opts), rrsets(origin, new, opts)
+
+	var res []*Change
+	for k, o := range a {
+		n := b[k]
+		if n != nil && sameRRset(origin, o, n, opts) {
+			continue
+		}
+		res = append(res, &Change{Name: k.name, Type: k.typ, Old: o, New: n})
+	}
+	for k, n := range b {
+		if _, ok := a[k]; !ok {
+			res = append(res, &Change{Name: k.name, Type: k.typ, New: n})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if c := dnsmsg.Name(res[i].Name).Compare(dnsmsg.Name(res[j].Name)); c != 0 {
+			return c < 0
+		}
+		return res[i].Type < res[j].Type
+	})
+	return res
+}
@@ -0,0 +1,58 @@
+package dnszone
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(strings.NewReader(`$TTL 1h
+@	SOA	ns1 hostmaster 1 1d 2h 4w 300
+	NS	ns1
+	RRSIG	NS 13 2 3600 20240801000000 20240718000000 12345 example.com. AAAA
+ns1	A	192.0.2.1
+www	A	192.0.2.10
+	A	192.0.2.11
+old	TXT	"bye"
+`), "example.com.")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	new, err := Parse(strings.NewReader(`$TTL 1h
+@	SOA	ns1 hostmaster 2 1d 2h 4w 300
+	NS	NS1.example.com.
+	RRSIG	NS 13 2 3600 20240901000000 20240818000000 12345 example.com. BBBB
+ns1	300	A	192.0.2.1
+www	A	192.0.2.11
+	A	192.0.2.12
+new	TXT	"hi"
+`), "example.com.")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	describe := func(opts *DiffOptions) string {
+		var res []string
+		for _, c := range Diff("example.com", old, new, opts) {
+			res = append(res, c.Name+" "+c.Type.String())
+		}
+		return strings.Join(res, ", ")
+	}
+
+	for _, test := range []struct {
+		opts   *DiffOptions
+		expect string
+	}{
+		{nil, "example.com. SOA, example.com. RRSIG, new.example.com. TXT, ns1.example.com. A, old.example.com. TXT, www.example.com. A"},
+		{&DiffOptions{IgnoreTTL: true, IgnoreSerial: true, IgnoreRRSIG: true}, "new.example.com. TXT, old.example.com. TXT, www.example.com. A"},
+	} {
+		if got := describe(test.opts); got != test.expect {
+			t.Errorf("%+v: got %q, expected %q", test.opts, got, test.expect)
+		}
+	}
+
+	c := Diff("example.com.", old, new, &DiffOptions{IgnoreRRSIG: true})[4]
+	if s := c.String(); !strings.HasPrefix(s, "- www.example.com. IN A 3600 192.0.2.10\n") || len(c.Old) != 2 || len(c.New) != 2 {
+		t.Errorf("unexpected change %q", s)
+	}
+}
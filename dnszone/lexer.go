@@ -0,0 +1,173 @@
+package dnszone
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// token is a single field of a zone file entry
+type token struct {
+	text   string
+	quoted bool // text was a quoted string, and has been unescaped
+}
+
+// lexer splits a zone file into entries, handling comments, quoted strings
+// and parentheses spanning multiple lines
+type lexer struct {
+	r    *bufio.Reader
+	line int
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{r: bufio.NewReader(r), line: 1}
+}
+
+// entry returns the fields of the next entry, and whether its first line
+// started with a blank, meaning the owner name was omitted. It returns
+// io.EOF once all entries have been read.
+func (l *lexer) entry() (toks []token, blank bool, line int, err error) {
+	var buf []byte
+	inToken := false
+	lineStart := true
+	depth := 0
+	line = l.line
+
+	flush := func() {
+		if inToken {
+			toks = append(toks, token{text: string(buf)})
+			buf = buf[:0]
+			inToken = false
+		}
+	}
+
+	for {
+		c, err := l.r.ReadByte()
+		if err == io.EOF {
+			if depth > 0 {
+				return nil, false, line, errors.New("unbalanced parentheses")
+			}
+			flush()
+			if len(toks) > 0 {
+				return toks, blank, line, nil
+			}
+			return nil, false, line, io.EOF
+		} else if err != nil {
+			return nil, false, line, err
+		}
+
+		if lineStart && depth == 0 && len(toks) == 0 && !inToken {
+			// first character of an entry
+			line = l.line
+			blank = c == ' ' || c == '\t'
+		}
+		lineStart = false
+
+		switch c {
+		case '\n':
+			l.line++
+			lineStart = true
+			flush()
+			if depth == 0 && len(toks) > 0 {
+				return toks, blank, line, nil
+			}
+		case ' ', '\t', '\r':
+			flush()
+		case ';':
+			// comment, skip until end of line
+			for {
+				c, err = l.r.ReadByte()
+				if err != nil || c == '\n' {
+					break
+				}
+			}
+			if err == nil {
+				l.r.UnreadByte()
+			}
+		case '(':
+			flush()
+			depth++
+		case ')':
+			flush()
+			if depth == 0 {
+				return nil, false, l.line, errors.New("unbalanced parentheses")
+			}
+			depth--
+		case '"':
+			flush()
+			s, err := l.quoted()
+			if err != nil {
+				return nil, false, l.line, err
+			}
+			toks = append(toks, token{text: s, quoted: true})
+		case '\\':
+			// keep escape sequences as is, they are part of the field
+			inToken = true
+			buf = append(buf, c)
+			if c, err = l.r.ReadByte(); err == nil {
+				if c == '\n' {
+					l.line++
+				}
+				buf = append(buf, c)
+			}
+		default:
+			inToken = true
+			buf = append(buf, c)
+		}
+	}
+}
+
+// quoted reads a quoted string up to the closing quote and returns its
+// unescaped value
+func (l *lexer) quoted() (string, error) {
+	var buf []byte
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil || c == '\n' {
+			return "", errors.New("unterminated quoted string")
+		}
+		switch c {
+		case '"':
+			return unescape(string(buf))
+		case '\\':
+			buf = append(buf, c)
+			if c, err = l.r.ReadByte(); err != nil {
+				return "", errors.New("unterminated quoted string")
+			}
+			if c == '\n' {
+				l.line++
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+// unescape resolves the \X and \DDD escape sequences of RFC 1035 section 5.1
+func unescape(s string) (string, error) {
+	var res []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			res = append(res, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", errors.New("trailing backslash")
+		}
+		if s[i] < '0' || s[i] > '9' {
+			res = append(res, s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", errors.New("invalid \\DDD escape")
+		}
+		v, err := strconv.ParseUint(s[i:i+3], 10, 8)
+		if err != nil {
+			return "", errors.New("invalid \\DDD escape")
+		}
+		res = append(res, byte(v))
+		i += 2
+	}
+	return string(res), nil
+}
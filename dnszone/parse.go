@@ -0,0 +1,443 @@
+// Package dnszone reads zone files in the master file format of RFC 1035
+// section 5, as used by BIND and most other DNS servers.
+package dnszone
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+var (
+	ErrNoOrigin  = errors.New("relative name without $ORIGIN")
+	ErrNoTTL     = errors.New("no TTL specified and no $TTL default")
+	ErrNoInclude = errors.New("$INCLUDE is not allowed")
+	ErrTooDeep   = errors.New("too many nested $INCLUDE")
+)
+
+// maxIncludeDepth limits nesting of $INCLUDE, which also stops include loops
+const maxIncludeDepth = 8
+
+// Error is returned when a zone file cannot be parsed, and gives the
+// position of the faulty entry
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Parser holds the settings used when parsing a zone file. The zero value
+// parses zones with no default origin or TTL and refuses $INCLUDE.
+type Parser struct {
+	Origin string       // initial origin, as a fully qualified name
+	TTL    uint32       // default TTL, used until $TTL is found (0 for none)
+	Class  dnsmsg.Class // default class, IN if zero
+
+	// Include opens files referenced by $INCLUDE. If nil, $INCLUDE entries
+	// cause an error, as zones from untrusted sources should not be able to
+	// read arbitrary files.
+	Include func(name string) (io.ReadCloser, error)
+}
+
+// Parse reads a zone file from r, using origin for relative names
+func Parse(r io.Reader, origin string) ([]*dnsmsg.Resource, error) {
+	p := &Parser{Origin: origin}
+	return p.Parse(r)
+}
+
+// ParseFile reads the zone file fn, using origin for relative names.
+// $INCLUDE is allowed, relative paths being resolved from the directory of
+// the file containing the $INCLUDE.
+func ParseFile(fn, origin string) ([]*dnsmsg.Resource, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &Parser{
+		Origin: origin,
+		Include: func(name string) (io.ReadCloser, error) {
+			return os.Open(name)
+		},
+	}
+	st := p.newState()
+	err = st.parse(f, fn, 0)
+	return st.res, err
+}
+
+// Parse reads a zone file from r
+func (p *Parser) Parse(r io.Reader) ([]*dnsmsg.Resource, error) {
+	st := p.newState()
+	err := st.parse(r, "", 0)
+	return st.res, err
+}
+
+// parseState is the state of the parser, carried across $INCLUDE
+type parseState struct {
+	p       *Parser
+	origin  string
+	ttl     uint32 // $TTL value
+	hasTTL  bool
+	last    uint32 // last explicit TTL
+	hasLast bool
+	class   dnsmsg.Class
+	owner   string // last owner name
+	res     []*dnsmsg.Resource
+}
+
+func (p *Parser) newState() *parseState {
+	st := &parseState{
+		p:      p,
+		origin: p.Origin,
+		ttl:    p.TTL,
+		hasTTL: p.TTL != 0,
+		class:  p.Class,
+	}
+	if st.origin != "" && !strings.HasSuffix(st.origin, ".") {
+		st.origin += "."
+	}
+	if st.class == 0 {
+		st.class = dnsmsg.IN
+	}
+	return st
+}
+
+func (st *parseState) parse(r io.Reader, file string, depth int) error {
+	lex := newLexer(r)
+	for {
+		toks, blank, line, err := lex.entry()
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = st.entry(toks, blank, file, depth)
+		}
+		if err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				// error in an included file
+				return err
+			}
+			return &Error{File: file, Line: line, Err: err}
+		}
+	}
+}
+
+func (st *parseState) entry(toks []token, blank bool, file string, depth int) error {
+	switch strings.ToUpper(toks[0].text) {
+	case "$ORIGIN":
+		if len(toks) != 2 {
+			return errors.New("$ORIGIN takes one argument")
+		}
+		origin, err := st.name(toks[1].text)
+		if err != nil {
+			return err
+		}
+		st.origin = origin
+		return nil
+	case "$TTL":
+		if len(toks) != 2 {
+			return errors.New("$TTL takes one argument")
+		}
+		ttl, ok := parseTTL(toks[1].text)
+		if !ok {
+			return fmt.Errorf("invalid TTL %q", toks[1].text)
+		}
+		st.ttl, st.hasTTL = ttl, true
+		return nil
+	case "$INCLUDE":
+		return st.include(toks[1:], file, depth)
+	}
+	if strings.HasPrefix(toks[0].text, "$") && !blank {
+		return fmt.Errorf("unsupported directive %s", toks[0].text)
+	}
+
+	if !blank {
+		owner, err := st.name(toks[0].text)
+		if err != nil {
+			return err
+		}
+		st.owner = owner
+		toks = toks[1:]
+	} else if st.owner == "" {
+		return errors.New("no owner name")
+	}
+
+	// TTL and class can appear in any order before the type
+	var ttl uint32
+	hasTTL := false
+	class := st.class
+	for i := 0; i < 2 && len(toks) > 0; i++ {
+		if v, ok := parseTTL(toks[0].text); ok && !hasTTL {
+			ttl, hasTTL = v, true
+		} else if c, err := dnsmsg.ParseClass(toks[0].text); err == nil {
+			class = c
+		} else {
+			break
+		}
+		toks = toks[1:]
+	}
+	if len(toks) == 0 {
+		return errors.New("missing record type")
+	}
+	typ, err := dnsmsg.ParseType(toks[0].text)
+	if err != nil {
+		return fmt.Errorf("unknown record type %s", toks[0].text)
+	}
+	toks = toks[1:]
+
+	rd, err := st.rdata(typ, toks)
+	if err != nil {
+		return fmt.Errorf("invalid %s record: %w", typ, err)
+	}
+
+	switch {
+	case hasTTL:
+		st.last, st.hasLast = ttl, true
+	case st.hasTTL:
+		// RFC 2308
+		ttl = st.ttl
+	case st.hasLast:
+		// RFC 1035: the last explicit TTL is the default
+		ttl = st.last
+	default:
+		soa, ok := rd.(*dnsmsg.RDataSOA)
+		if !ok {
+			return ErrNoTTL
+		}
+		// BIND uses the SOA minimum in this case
+		ttl = soa.Minimum
+	}
+	st.class = class
+
+	st.res = append(st.res, &dnsmsg.Resource{
+		Name:  dnsmsg.Name(st.owner),
+		Type:  typ,
+		Class: class,
+		TTL:   ttl,
+		Data:  rd,
+	})
+	return nil
+}
+
+// include processes a $INCLUDE entry. Origin and owner are restored once the
+// included file has been read, as required by RFC 1035.
+func (st *parseState) include(args []token, file string, depth int) error {
+	if st.p.Include == nil {
+		return ErrNoInclude
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("$INCLUDE takes a file name and an optional origin")
+	}
+	if depth >= maxIncludeDepth {
+		return ErrTooDeep
+	}
+
+	origin, owner := st.origin, st.owner
+	defer func() { st.origin, st.owner = origin, owner }()
+
+	if len(args) == 2 {
+		o, err := st.name(args[1].text)
+		if err != nil {
+			return err
+		}
+		st.origin = o
+	}
+
+	fn := args[0].text
+	if file != "" && !filepath.IsAbs(fn) {
+		fn = filepath.Join(filepath.Dir(file), fn)
+	}
+	f, err := st.p.Include(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return st.parse(f, fn, depth+1)
+}
+
+// name returns the fully qualified form of the name n
+func (st *parseState) name(n string) (string, error) {
+	if n == "@" {
+		n = ""
+	} else if strings.HasSuffix(n, ".") && !strings.HasSuffix(n, "\\.") {
+		return n, nil
+	}
+	if st.origin == "" {
+		return "", ErrNoOrigin
+	}
+	if n == "" {
+		return st.origin, nil
+	}
+	if st.origin == "." {
+		return n + ".", nil
+	}
+	return n + "." + st.origin, nil
+}
+
+// nameFields lists the position of domain name fields in the RDATA of each
+// type, as these can be relative to the origin
+var nameFields = map[dnsmsg.Type][]int{
+	dnsmsg.NS:    {0},
+	dnsmsg.MD:    {0},
+	dnsmsg.MF:    {0},
+	dnsmsg.CNAME: {0},
+	dnsmsg.SOA:   {0, 1},
+	dnsmsg.MB:    {0},
+	dnsmsg.MG:    {0},
+	dnsmsg.MR:    {0},
+	dnsmsg.PTR:   {0},
+	dnsmsg.MINFO: {0, 1},
+	dnsmsg.MX:    {1},
+	dnsmsg.RP:    {0, 1},
+	dnsmsg.AFSDB: {1},
+	dnsmsg.SRV:   {3},
+	dnsmsg.NAPTR: {5},
+	dnsmsg.KX:    {1},
+	dnsmsg.DNAME: {0},
+	dnsmsg.RRSIG: {7},
+	dnsmsg.NSEC:  {0},
+}
+
+// rdata builds the RDATA of a record of type typ from its fields
+func (st *parseState) rdata(typ dnsmsg.Type, toks []token) (dnsmsg.RData, error) {
+	if len(toks) > 0 && toks[0].text == `\#` && !toks[0].quoted {
+		return genericRData(typ, toks[1:])
+	}
+
+	if typ == dnsmsg.TXT {
+		// character strings, quoted or not
+		strs := make([]string, len(toks))
+		for i, t := range toks {
+			v := t.text
+			if !t.quoted {
+				var err error
+				if v, err = unescape(v); err != nil {
+					return nil, err
+				}
+			}
+			strs[i] = v
+		}
+		return dnsmsg.NewTXT(strs...), nil
+	}
+
+	fields := make([]string, len(toks))
+	for i, t := range toks {
+		fields[i] = t.text
+		if t.quoted {
+			// RDataFromString expects quoted strings to stay quoted
+			fields[i] = quoteStrings(t.text)
+		}
+	}
+	for _, i := range nameFields[typ] {
+		if i < len(fields) {
+			n, err := st.name(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = n
+		}
+	}
+	if typ == dnsmsg.SOA && len(fields) == 7 {
+		// timers may use units
+		for i := 2; i < 7; i++ {
+			v, ok := parseTTL(fields[i])
+			if !ok {
+				return nil, fmt.Errorf("invalid value %q", fields[i])
+			}
+			fields[i] = strconv.FormatUint(uint64(v), 10)
+		}
+	}
+	return dnsmsg.RDataFromString(typ, strings.Join(fields, " "))
+}
+
+// genericRData parses the unknown RR format of RFC 3597: \# length hex...
+func genericRData(typ dnsmsg.Type, toks []token) (dnsmsg.RData, error) {
+	if len(toks) < 1 {
+		return nil, errors.New("missing RDATA length")
+	}
+	l, err := strconv.ParseUint(toks[0].text, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid RDATA length")
+	}
+	var s strings.Builder
+	for _, t := range toks[1:] {
+		s.WriteString(t.text)
+	}
+	data, err := hex.DecodeString(s.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != int(l) {
+		return nil, errors.New("RDATA length mismatch")
+	}
+	return &dnsmsg.RDataRaw{Data: data, Type: typ}, nil
+}
+
+// parseTTL parses a TTL given either in seconds, or using the BIND units
+// (1w2d3h4m5s)
+func parseTTL(s string) (uint32, bool) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	if v, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(v), true
+	}
+
+	var res, cur uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			cur = cur*10 + uint64(c-'0')
+			digits = true
+			if cur > 0xffffffff {
+				return 0, false
+			}
+			continue
+		}
+		if !digits {
+			return 0, false
+		}
+		switch c {
+		case 's', 'S':
+		case 'm', 'M':
+			cur *= 60
+		case 'h', 'H':
+			cur *= 3600
+		case 'd', 'D':
+			cur *= 86400
+		case 'w', 'W':
+			cur *= 604800
+		default:
+			return 0, false
+		}
+		res += cur
+		cur, digits = 0, false
+	}
+	if digits || res > 0xffffffff {
+		// trailing number without unit, or overflow
+		return 0, false
+	}
+	return uint32(res), true
+}
@@ -0,0 +1,138 @@
+package dnszone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testZone = `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2024072901 ; serial
+		1d         ; refresh
+		2h         ; retry
+		4w         ; expire
+		300 )      ; minimum
+	IN	NS	ns1
+	IN	NS	ns2.example.net.
+	IN	MX	10 mail
+ns1	300	A	192.0.2.1
+www	IN 600	AAAA	2001:db8::1
+	TXT	"hello; world" "\"quoted\"\032x"
+$ORIGIN sub.example.com.
+host	CNAME	@
+raw	TYPE1234	\# 3 abcdef
+	CAA	0 issue "ca.example.net; account=1"
+sip	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp
+`
+
+func TestParse(t *testing.T) {
+	res, err := Parse(strings.NewReader(testZone), "")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+
+	expect := []string{
+		"example.com. IN SOA 3600 ns1.example.com. hostmaster.example.com. 2024072901 86400 7200 2419200 300",
+		"example.com. IN NS 3600 ns1.example.com.",
+		"example.com. IN NS 3600 ns2.example.net.",
+		"example.com. IN MX 3600 10 mail.example.com.",
+		"ns1.example.com. IN A 300 192.0.2.1",
+		"www.example.com. IN AAAA 600 2001:db8::1",
+		`www.example.com. IN TXT 3600 "hello; world" "\"quoted\" x"`,
+		"host.sub.example.com. IN CNAME 3600 sub.example.com.",
+		"raw.sub.example.com. IN Type(1234) 3600 abcdef",
+		`raw.sub.example.com. IN CAA 3600 0 issue "ca.example.net; account=1"`,
+		`sip.sub.example.com. IN NAPTR 3600 100 10 "S" "SIP+D2U" "" _sip._udp.sub.example.com.`,
+	}
+	if len(res) != len(expect) {
+		t.Fatalf("expected %d records, got %d: %v", len(expect), len(res), res)
+	}
+	for i, r := range res {
+		if r.String() != expect[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expect[i], r.String())
+		}
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	rrs, err := Parse(strings.NewReader(`a 60 IN TXT "hello" "world"
+b 60 IN TXT `+long+"\n"), "example.com.")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+
+	// string boundaries are kept, long strings are split
+	expect := []string{"\x05hello\x05world", "\xff" + long[:255] + "\x2d" + long[255:]}
+	for i, rr := range rrs {
+		d, err := rr.CanonicalRData()
+		if err != nil {
+			t.Fatalf("failed to encode %s: %s", rr, err)
+		}
+		if string(d) != expect[i] {
+			t.Errorf("record %d: unexpected RDATA %x", i, d)
+		}
+	}
+
+	// and survive writing the zone
+	buf := &strings.Builder{}
+	if err := Write(buf, "example.com.", rrs); err != nil {
+		t.Fatalf("failed to write zone: %s", err)
+	}
+	res, err := Parse(strings.NewReader(buf.String()), "")
+	if err != nil {
+		t.Fatalf("failed to parse written zone: %s", err)
+	}
+	for i, rr := range res {
+		if rr.Data.String() != rrs[i].Data.String() {
+			t.Errorf("record %d: %s became %s", i, rrs[i].Data, rr.Data)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		zone string
+		line int
+		err  error
+	}{
+		{"www A 192.0.2.1\n", 1, ErrNoOrigin},
+		{"$ORIGIN example.com.\nwww A 192.0.2.1\n", 2, ErrNoTTL},
+		{"$ORIGIN example.com.\n\n$INCLUDE other.zone\n", 3, ErrNoInclude},
+		{"$ORIGIN example.com.\n$TTL 60\nwww A (\n192.0.2.1\n", 3, nil},
+		{"$ORIGIN example.com.\n$TTL 60\nwww BOGUS x\n", 3, nil},
+	}
+
+	for _, tst := range tests {
+		_, err := Parse(strings.NewReader(tst.zone), "")
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected parse error, got %v", tst.zone, err)
+			continue
+		}
+		if e.Line != tst.line {
+			t.Errorf("%q: expected error on line %d, got %s", tst.zone, tst.line, err)
+		}
+		if tst.err != nil && !errors.Is(err, tst.err) {
+			t.Errorf("%q: expected %s, got %s", tst.zone, tst.err, err)
+		}
+	}
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.zone"), []byte("$TTL 60\n$INCLUDE hosts.zone hosts\nwww A 192.0.2.2\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "hosts.zone"), []byte("a A 192.0.2.3\n"), 0600)
+
+	res, err := ParseFile(filepath.Join(dir, "main.zone"), "example.com")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	if len(res) != 2 || res[0].Name != "a.hosts.example.com." || res[1].Name != "www.example.com." {
+		t.Errorf("unexpected records %v", res)
+	}
+}
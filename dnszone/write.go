@@ -0,0 +1,176 @@
+package dnszone
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+// Write serializes rrs to w in master file format, starting with $ORIGIN
+// and $TTL directives. Records are sorted in canonical order (RFC 4034
+// section 6.1), with the SOA record of the origin first. Names not ending
+// with a dot are relative to origin, as when encoding messages.
+func Write(w io.Writer, origin string, rrs []*dnsmsg.Resource) error {
+	if !strings.HasSuffix(origin, ".") {
+		origin += "."
+	}
+
+	type entry struct {
+		rr    *dnsmsg.Resource
+		name  string // fully qualified owner name
+		rdata string
+		soa   bool
+	}
+	entries := make([]*entry, 0, len(rrs))
+	ttls := make(map[uint32]int)
+	for _, rr := range rrs {
+		e := &entry{rr: rr, name: qualify(string(rr.Name), origin)}
+		e.rdata = rdataText(rr, origin)
+		e.soa = rr.Type == dnsmsg.SOA && dnsmsg.EqualFoldASCII(e.name, origin)
+		entries = append(entries, e)
+		ttls[rr.TTL]++
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.soa != b.soa {
+			return a.soa
+		}
+		if c := dnsmsg.Name(a.name).Compare(dnsmsg.Name(b.name)); c != 0 {
+			return c < 0
+		}
+		if a.rr.Type != b.rr.Type {
+			return a.rr.Type < b.rr.Type
+		}
+		return a.rdata < b.rdata
+	})
+
+	// the most common TTL becomes the default
+	var ttl uint32
+	best := 0
+	for v, n := range ttls {
+		if n > best || (n == best && v < ttl) {
+			ttl, best = v, n
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n$TTL %d\n", origin, ttl)
+	for _, e := range entries {
+		bw.WriteString(relative(e.name, origin))
+		if e.rr.TTL != ttl {
+			fmt.Fprintf(bw, "\t%d", e.rr.TTL)
+		}
+		fmt.Fprintf(bw, "\t%s\t%s\t%s\n", className(e.rr.Class), typeName(e.rr.Type), e.rdata)
+	}
+	return bw.Flush()
+}
+
+// qualify returns the fully qualified form of n, which is relative to origin
+// unless it ends with a dot
+func qualify(n, origin string) string {
+	switch {
+	case strings.HasSuffix(n, "."):
+		return n
+	case n == "" || n == "@":
+		return origin
+	case origin == ".":
+		return n + "."
+	}
+	return n + "." + origin
+}
+
+// relative returns the fully qualified name n relative to origin if it is
+// within origin
+func relative(n, origin string) string {
+	if dnsmsg.EqualFoldASCII(n, origin) {
+		return "@"
+	}
+	if origin == "." {
+		return n
+	}
+	if len(n) > len(origin) && n[len(n)-len(origin)-1] == '.' && dnsmsg.EqualFoldASCII(n[len(n)-len(origin):], origin) {
+		return n[:len(n)-len(origin)-1]
+	}
+	return n
+}
+
+// rdataText returns the presentation format of the RDATA of rr, with domain
+// names fully qualified
+func rdataText(rr *dnsmsg.Resource, origin string) string {
+	switch rd := rr.Data.(type) {
+	case *dnsmsg.RDataRaw:
+		return fmt.Sprintf("\\# %d %s", len(rd.Data), rd.String())
+	case *dnsmsg.RDataNAPTR:
+		// quoted fields may contain spaces
+		naptr := *rd
+		naptr.Replacement = qualify(naptr.Replacement, origin)
+		return naptr.String()
+	}
+
+	s := rr.Data.String()
+	idx := nameFields[rr.Type]
+	if len(idx) == 0 {
+		return s
+	}
+	fields := strings.Fields(s)
+	for _, i := range idx {
+		if i < len(fields) {
+			fields[i] = qualify(fields[i], origin)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// quoteStrings returns s as a sequence of quoted character strings of at
+// most 255 bytes each
+func quoteStrings(s string) string {
+	var b strings.Builder
+	for {
+		chunk := s
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		s = s[len(chunk):]
+
+		b.WriteByte('"')
+		for i := 0; i < len(chunk); i++ {
+			switch c := chunk[i]; {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c < ' ' || c > '~':
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+
+		if s == "" {
+			return b.String()
+		}
+		b.WriteByte(' ')
+	}
+}
+
+func typeName(t dnsmsg.Type) string {
+	s := t.String()
+	if strings.HasPrefix(s, "Type(") {
+		return "TYPE" + strconv.FormatUint(uint64(t), 10)
+	}
+	return s
+}
+
+func className(c dnsmsg.Class) string {
+	s := c.String()
+	if strings.HasPrefix(s, "Class(") {
+		return "CLASS" + strconv.FormatUint(uint64(c), 10)
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package dnszone
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/KarpelesLab/dns/dnsmsg"
+)
+
+func TestWrite(t *testing.T) {
+	rrs, err := Parse(strings.NewReader(testZone), "")
+	if err != nil {
+		t.Fatalf("failed to parse zone: %s", err)
+	}
+	// shuffle records, the output must not depend on the input order
+	rrs[0], rrs[len(rrs)-1] = rrs[len(rrs)-1], rrs[0]
+	rrs = append(rrs, mustParse(t, "sub.example.com. 3600 TXT sub"))
+	// an escaped dot is part of the label, sorting before ns1
+	rrs = append(rrs, mustParse(t, `a\.z.example.com. 3600 TXT dot`))
+
+	expect := `$ORIGIN example.com.
+$TTL 3600
+@	IN	SOA	ns1.example.com. hostmaster.example.com. 2024072901 86400 7200 2419200 300
+@	IN	NS	ns1.example.com.
+@	IN	NS	ns2.example.net.
+@	IN	MX	10 mail.example.com.
+a\.z	IN	TXT	"dot"
+ns1	300	IN	A	192.0.2.1
+sub	IN	TXT	"sub"
+host.sub	IN	CNAME	sub.example.com.
+raw.sub	IN	CAA	0 issue "ca.example.net; account=1"
+raw.sub	IN	TYPE1234	\# 3 abcdef
+sip.sub	IN	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp.sub.example.com.
+www	IN	TXT	"hello; world" "\"quoted\" x"
+www	600	IN	AAAA	2001:db8::1
+`
+	buf := &bytes.Buffer{}
+	if err := Write(buf, "example.com", rrs); err != nil {
+		t.Fatalf("failed to write zone: %s", err)
+	}
+	if buf.String() != expect {
+		t.Errorf("unexpected zone:\n%s", buf)
+	}
+
+	// the output must parse back to the same records
+	res, err := Parse(buf, "")
+	if err != nil {
+		t.Fatalf("failed to parse written zone: %s", err)
+	}
+	if len(res) != len(rrs) {
+		t.Errorf("expected %d records after round trip, got %d", len(rrs), len(res))
+	}
+}
+
+func mustParse(t *testing.T, s string) *dnsmsg.Resource {
+	t.Helper()
+	rrs, err := Parse(strings.NewReader(s), "")
+	if err != nil || len(rrs) != 1 {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return rrs[0]
+}